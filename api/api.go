@@ -25,6 +25,178 @@ import (
 // Replica represents an instance of MinBFT replica.
 type Replica interface {
 	ConnectionHandler
+	CommitFeed
+	Introspector
+}
+
+// CommittedOperation represents an operation committed by replicas.
+//
+// Position is the position of the operation in the order of commit,
+// starting from one. View is the view number and UICounter is the
+// UI counter the primary assigned to the Prepare message of the
+// operation. ClientID and Seq identify the Request message; Kind
+// tells how replicas interpret the operation.
+//
+// Certificate proves that f+1 replicas committed the operation. It
+// consists of the serialized Prepare message followed by serialized
+// Commit messages from distinct backup replicas. It can be checked
+// with minbft.VerifyCommittedOperation against the membership in the
+// view the operation was committed in.
+type CommittedOperation struct {
+	Position    uint64
+	View        uint64
+	UICounter   uint64
+	ClientID    uint32
+	Seq         uint64
+	Kind        RequestKind
+	Operation   []byte
+	Certificate [][]byte
+}
+
+// RequestKind tells how replicas interpret the operation of a
+// request.
+type RequestKind int32
+
+// Kinds of requests
+const (
+	// OperationRequest carries an operation to execute on the
+	// replicated state machine
+	OperationRequest RequestKind = iota
+
+	// BatchRequest carries several operations to execute on the
+	// replicated state machine one after another, in order
+	BatchRequest
+
+	// ReconfigurationRequest carries a membership reconfiguration
+	// executed by the replicas themselves
+	ReconfigurationRequest
+)
+
+// CommitFeed streams committed operations to external observers.
+//
+// SubscribeCommitted returns a channel to receive committed
+// operations from the specified position on, in the order of commit.
+// If from is zero then the operations are streamed from the oldest
+// one still retained by the replica. The channel is closed once the
+// done channel is closed or if the subscriber falls too far behind;
+// the subscription can then be resumed from the next position. An
+// error is returned if the operation at the specified position is no
+// longer retained.
+type CommitFeed interface {
+	SubscribeCommitted(from uint64, done <-chan struct{}) (<-chan *CommittedOperation, error)
+}
+
+// Introspector reports what a replica is doing, e.g. for monitoring
+// and debugging.
+//
+// Status method returns a snapshot of the internal state of the
+// replica. The state is collected piece by piece while the replica
+// keeps running, so different pieces may be slightly out of sync.
+type Introspector interface {
+	Status() *ReplicaStatus
+}
+
+// ReplicaStatus represents the internal state of a replica.
+//
+// CurrentView is the view the replica is in, whereas ExpectedView is
+// the view it is changing to; they differ while a view change is in
+// progress. Primary is the primary replica of the current view.
+// Epoch, F and Members describe the membership of the current view;
+// Addresses holds the network addresses of Members in the same
+// order, empty for the members of the initial membership.
+// LastExecuted identifies the request executed most recently, if any.
+// Pending lists requests accepted but not yet committed. Clients
+// lists the request sequence state of each known client, and Peers
+// the last accepted UI counter of each known replica.
+type ReplicaStatus struct {
+	ReplicaID    uint32
+	CurrentView  uint64
+	ExpectedView uint64
+	Primary      uint32
+	Epoch        uint64
+	F            uint32
+	Members      []uint32
+	Addresses    []string
+	LastExecuted *RequestID
+	Pending      []RequestID
+	Clients      []ClientStatus
+	Peers        []PeerStatus
+}
+
+// RequestID identifies a request by its client and sequence number.
+type RequestID struct {
+	ClientID uint32
+	Seq      uint64
+}
+
+// ClientStatus represents the request sequence state of a client.
+// LastAcceptedSeq is the sequence number of the last request accepted
+// for processing, LastPreparedSeq of the last prepared request, and
+// LastCommittedSeq of the last committed request.
+type ClientStatus struct {
+	ClientID         uint32
+	LastAcceptedSeq  uint64
+	LastPreparedSeq  uint64
+	LastCommittedSeq uint64
+}
+
+// PeerStatus represents the state of a replica as seen by another
+// replica: the UI counter of the last message accepted from it.
+type PeerStatus struct {
+	ReplicaID     uint32
+	LastUICounter uint64
+}
+
+// Membership represents the set of replicas running the consensus
+// protocol in a range of views.
+//
+// Epoch is incremented by each reconfiguration, starting from zero
+// for the initial membership given by the configuration. F is the
+// number of faulty replicas tolerated. Replicas lists the members in
+// the order of their IDs; the primary of a view is the member at the
+// position of the view number modulo the number of members.
+type Membership struct {
+	Epoch    uint64
+	F        uint32
+	Replicas []ReplicaInfo
+}
+
+// ReplicaInfo describes a member replica.
+//
+// Address is the network address to reach the replica at. Identity
+// holds the public keys to authenticate the replica, including its
+// USIG identity, in the format of the Authenticator implementation.
+// Both are empty for the members of the initial membership.
+type ReplicaInfo struct {
+	ID       uint32
+	Address  string
+	Identity []byte
+}
+
+// Reconfiguration describes a change of membership.
+//
+// Epoch is the epoch of the membership to change; the
+// reconfiguration fails if the membership has changed meanwhile.
+// Remove lists the IDs of the replicas to leave, and Add describes
+// the replicas to join. A replica ID can never be reused once
+// removed, so keys or USIG identity of a replica are replaced by
+// removing the replica and adding it under a new ID. F is the number
+// of faulty replicas to tolerate by the new membership.
+type Reconfiguration struct {
+	Epoch  uint64
+	Remove []uint32
+	Add    []ReplicaInfo
+	F      uint32
+}
+
+// MembershipObserver is notified whenever the membership changes,
+// e.g. to authenticate and connect to the replicas joined.
+//
+// MembershipChanged is invoked with the new membership before the
+// replica moves into the first view of the new membership. It is
+// invoked in the order of reconfiguration, with no concurrency.
+type MembershipObserver interface {
+	MembershipChanged(m *Membership) error
 }
 
 //======= Interface for module 'config' =======
@@ -112,6 +284,10 @@ const (
 
 	// ClientAuthen specifies authentication of client messages
 	ClientAuthen
+
+	// OperatorAuthen specifies authentication of administrative
+	// requests issued by operators of the replicas
+	OperatorAuthen
 )
 
 func (r AuthenticationRole) String() string {
@@ -122,6 +298,8 @@ func (r AuthenticationRole) String() string {
 		return "usig"
 	case ClientAuthen:
 		return "client"
+	case OperatorAuthen:
+		return "operator"
 	}
 	return fmt.Sprintf("AuthenticationRole(%d)", r)
 }
@@ -157,3 +335,118 @@ type RequestConsumer interface {
 	Deliver(op []byte) <-chan []byte
 	StateDigest() []byte
 }
+
+// Snapshotter is an optional extension of RequestConsumer to
+// checkpoint and restore the state of the replicated state machine.
+//
+// Snapshot takes a consistent snapshot of the state resulted from
+// execution of all operations delivered before the invocation. The
+// snapshot is not affected by operations delivered afterwards.
+//
+// Restore replaces the current state with the state from the
+// snapshot. It fails if the snapshot is malformed or the digest of
+// the restored state does not match the digest of the snapshot, in
+// which case the current state is left intact. No operation may be
+// delivered concurrently with Restore.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+	Restore(snapshot Snapshot) error
+}
+
+// Snapshot represents a snapshot of the replicated state machine
+// streamed in chunks.
+//
+// Digest returns the state digest, as reported by StateDigest, of
+// the state captured in the snapshot.
+//
+// NextChunk returns the next chunk of the snapshot. It returns
+// io.EOF after the last chunk. The chunks are opaque to everyone
+// except the RequestConsumer implementation.
+type Snapshot interface {
+	Digest() []byte
+	NextChunk() ([]byte, error)
+}
+
+// ConflictKeyer is an optional extension of RequestConsumer allowing
+// operations that do not conflict to be executed concurrently. If the
+// stack of external modules passed to the replica implements this
+// interface, then Deliver may be invoked before execution of earlier
+// non-conflicting operations is complete, i.e. their results are
+// ready. The results and the resulting state have to be the same as
+// if the operations were executed serially in the delivery order.
+//
+// ConflictKeys returns the keys identifying the parts of the state
+// the operation reads and writes. Two operations conflict if either
+// of them writes a key the other one reads or writes. If ok is
+// false, the operation is considered to conflict with any other
+// operation, e.g. if the operation is malformed. ConflictKeys must be
+// deterministic and have no side effect.
+type ConflictKeyer interface {
+	ConflictKeys(op []byte) (reads, writes []string, ok bool)
+}
+
+// OperationValidator is an optional extension of RequestConsumer to
+// reject invalid operations, e.g. malformed transactions, before they
+// are ordered. If the stack of external modules passed to the replica
+// implements this interface, then requests with invalid operations
+// are rejected by the replicas, and a primary replica preparing an
+// invalid operation is considered faulty.
+//
+// ValidateOperation checks the operation without regard to the
+// current state of the replicated state machine. It returns an error
+// describing why the operation is invalid, if so. ValidateOperation
+// must be deterministic, have no side effect, and be safe to invoke
+// concurrently, also with Deliver.
+type OperationValidator interface {
+	ValidateOperation(op []byte) error
+}
+
+// ExecutionInput is non-deterministic input for executing an
+// operation, chosen by the primary replica ordering the operation and
+// agreed on by the replicas.
+//
+// Timestamp is the time of ordering the operation by the clock of the
+// primary. Timestamps never decrease in the order of delivery. Seed
+// is a random value to deterministically derive pseudo-random numbers
+// from. Note that a faulty primary can choose the seed at will and
+// the timestamp within the bounds accepted by other replicas.
+type ExecutionInput struct {
+	Timestamp time.Time
+	Seed      []byte
+}
+
+// InputConsumer is an optional extension of RequestConsumer to
+// execute operations depending on non-deterministic input, e.g. to
+// timestamp blocks or to draw random numbers. If the stack of
+// external modules passed to the replica implements this interface,
+// then DeliverWithInput is invoked instead of Deliver.
+//
+// DeliverWithInput is the same as Deliver, except it also supplies
+// the input for executing the operation.
+type InputConsumer interface {
+	DeliverWithInput(op []byte, input ExecutionInput) <-chan []byte
+}
+
+// ExecutionResult is the outcome of executing an operation.
+//
+// Result is the result of execution, as returned by Deliver. Error,
+// if not nil, indicates that the application failed to execute the
+// operation; it is reported to the client as a string, so that its
+// message has to be deterministic, i.e. the same on every replica.
+type ExecutionResult struct {
+	Result []byte
+	Error  error
+}
+
+// StatusConsumer is an optional extension of RequestConsumer to
+// report the status of execution along with the result, e.g. to let
+// clients tell failed operations apart from successful ones. If the
+// stack of external modules passed to the replica implements this
+// interface, then DeliverWithStatus is invoked instead of Deliver
+// and DeliverWithInput.
+//
+// DeliverWithStatus is the same as DeliverWithInput, except it
+// returns a channel to receive the outcome of execution from.
+type StatusConsumer interface {
+	DeliverWithStatus(op []byte, input ExecutionInput) <-chan ExecutionResult
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/hyperledger-labs/minbft/api (interfaces: Configer,Authenticator,RequestConsumer,MessageStreamHandler,ConnectionHandler)
+// Source: github.com/hyperledger-labs/minbft/api (interfaces: Configer,Authenticator,RequestConsumer,InputConsumer,StatusConsumer,OperationValidator,MessageStreamHandler,ConnectionHandler)
 
 // Package mock_api is a generated GoMock package.
 package mock_api
@@ -235,6 +235,117 @@ func (mr *MockRequestConsumerMockRecorder) StateDigest() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StateDigest", reflect.TypeOf((*MockRequestConsumer)(nil).StateDigest))
 }
 
+// MockInputConsumer is a mock of InputConsumer interface
+type MockInputConsumer struct {
+	ctrl     *gomock.Controller
+	recorder *MockInputConsumerMockRecorder
+}
+
+// MockInputConsumerMockRecorder is the mock recorder for MockInputConsumer
+type MockInputConsumerMockRecorder struct {
+	mock *MockInputConsumer
+}
+
+// NewMockInputConsumer creates a new mock instance
+func NewMockInputConsumer(ctrl *gomock.Controller) *MockInputConsumer {
+	mock := &MockInputConsumer{ctrl: ctrl}
+	mock.recorder = &MockInputConsumerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockInputConsumer) EXPECT() *MockInputConsumerMockRecorder {
+	return m.recorder
+}
+
+// DeliverWithInput mocks base method
+func (m *MockInputConsumer) DeliverWithInput(arg0 []byte, arg1 api.ExecutionInput) <-chan []byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeliverWithInput", arg0, arg1)
+	ret0, _ := ret[0].(<-chan []byte)
+	return ret0
+}
+
+// DeliverWithInput indicates an expected call of DeliverWithInput
+func (mr *MockInputConsumerMockRecorder) DeliverWithInput(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeliverWithInput", reflect.TypeOf((*MockInputConsumer)(nil).DeliverWithInput), arg0, arg1)
+}
+
+// MockStatusConsumer is a mock of StatusConsumer interface
+type MockStatusConsumer struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusConsumerMockRecorder
+}
+
+// MockStatusConsumerMockRecorder is the mock recorder for MockStatusConsumer
+type MockStatusConsumerMockRecorder struct {
+	mock *MockStatusConsumer
+}
+
+// NewMockStatusConsumer creates a new mock instance
+func NewMockStatusConsumer(ctrl *gomock.Controller) *MockStatusConsumer {
+	mock := &MockStatusConsumer{ctrl: ctrl}
+	mock.recorder = &MockStatusConsumerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockStatusConsumer) EXPECT() *MockStatusConsumerMockRecorder {
+	return m.recorder
+}
+
+// DeliverWithStatus mocks base method
+func (m *MockStatusConsumer) DeliverWithStatus(arg0 []byte, arg1 api.ExecutionInput) <-chan api.ExecutionResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeliverWithStatus", arg0, arg1)
+	ret0, _ := ret[0].(<-chan api.ExecutionResult)
+	return ret0
+}
+
+// DeliverWithStatus indicates an expected call of DeliverWithStatus
+func (mr *MockStatusConsumerMockRecorder) DeliverWithStatus(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeliverWithStatus", reflect.TypeOf((*MockStatusConsumer)(nil).DeliverWithStatus), arg0, arg1)
+}
+
+// MockOperationValidator is a mock of OperationValidator interface
+type MockOperationValidator struct {
+	ctrl     *gomock.Controller
+	recorder *MockOperationValidatorMockRecorder
+}
+
+// MockOperationValidatorMockRecorder is the mock recorder for MockOperationValidator
+type MockOperationValidatorMockRecorder struct {
+	mock *MockOperationValidator
+}
+
+// NewMockOperationValidator creates a new mock instance
+func NewMockOperationValidator(ctrl *gomock.Controller) *MockOperationValidator {
+	mock := &MockOperationValidator{ctrl: ctrl}
+	mock.recorder = &MockOperationValidatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockOperationValidator) EXPECT() *MockOperationValidatorMockRecorder {
+	return m.recorder
+}
+
+// ValidateOperation mocks base method
+func (m *MockOperationValidator) ValidateOperation(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateOperation", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ValidateOperation indicates an expected call of ValidateOperation
+func (mr *MockOperationValidatorMockRecorder) ValidateOperation(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateOperation", reflect.TypeOf((*MockOperationValidator)(nil).ValidateOperation), arg0)
+}
+
 // MockMessageStreamHandler is a mock of MessageStreamHandler interface
 type MockMessageStreamHandler struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,152 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages/batch"
+)
+
+// batchingClient implements Client interface by gathering operations
+// into batches, each submitted as a single request. Certified
+// requests are not batched, since the certificate would prove
+// execution of the whole batch.
+type batchingClient struct {
+	requestHandler
+	*membershipTracker
+	execute operationBatcher
+}
+
+// Request implements Client interface on batchingClient
+func (c batchingClient) Request(operation []byte) <-chan []byte {
+	return outcomeResult(c.execute(operation))
+}
+
+// Execute implements Client interface on batchingClient
+func (c batchingClient) Execute(operation []byte) <-chan Outcome {
+	return c.execute(operation)
+}
+
+// operationBatcher adds the specified operation to the batch being
+// gathered and returns a channel to receive the outcome of executing
+// the operation from, once the batch is executed. It is safe to
+// invoke concurrently.
+type operationBatcher func(operation []byte) <-chan Outcome
+
+// makeOperationBatcher constructs an instance of operationBatcher
+// using the supplied request handler to submit batches with. A batch
+// is submitted once the window has elapsed since its first operation
+// was added, or once it holds maxOps operations, unless maxOps is
+// zero. A batch of a single operation is submitted as a plain
+// request.
+func makeOperationBatcher(handleRequest requestHandler, window time.Duration, maxOps int) operationBatcher {
+	var (
+		lock sync.Mutex
+
+		pending []batchedOperation // batch being gathered
+		timer   *time.Timer        // to submit the pending batch
+	)
+
+	// submit submits the pending batch. The lock must be held.
+	submit := func() {
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+
+		ops := pending
+		pending = nil
+
+		var certChan <-chan *ReplyCertificate
+		if len(ops) == 1 {
+			certChan = handleRequest(api.OperationRequest, ops[0].op)
+		} else {
+			batchOps := make([][]byte, len(ops))
+			for i, o := range ops {
+				batchOps[i] = o.op
+			}
+			certChan = handleRequest(api.BatchRequest, batch.MakeOperation(batchOps))
+		}
+		go splitOutcome(ops, certChan)
+	}
+
+	return func(operation []byte) <-chan Outcome {
+		lock.Lock()
+		defer lock.Unlock()
+
+		outcomeChan := make(chan Outcome, 1)
+		pending = append(pending, batchedOperation{operation, outcomeChan})
+
+		if maxOps > 0 && len(pending) >= maxOps {
+			submit()
+		} else if len(pending) == 1 {
+			var t *time.Timer
+			t = time.AfterFunc(window, func() {
+				lock.Lock()
+				defer lock.Unlock()
+
+				if timer == t { // not submitted yet
+					submit()
+				}
+			})
+			timer = t
+		}
+
+		return outcomeChan
+	}
+}
+
+// batchedOperation is an operation gathered into a batch together
+// with the channel to send the outcome of its execution to.
+type batchedOperation struct {
+	op          []byte
+	outcomeChan chan<- Outcome
+}
+
+// splitOutcome receives the certified result of executing a batch of
+// the supplied operations from the channel and sends the outcome of
+// executing each operation to the respective channel. If the batch
+// as a whole was not executed, then each operation fails the same.
+func splitOutcome(ops []batchedOperation, certChan <-chan *ReplyCertificate) {
+	cert := <-certChan
+
+	if len(ops) == 1 {
+		ops[0].outcomeChan <- Outcome{cert.Result, cert.Err()}
+		return
+	}
+
+	err := cert.Err()
+	var results []batch.Result
+	if err == nil {
+		results, err = batch.ParseResult(cert.Result)
+	}
+	if err == nil && len(results) != len(ops) {
+		err = fmt.Errorf("Batch of %d operations with %d results", len(ops), len(results))
+	}
+
+	for i, o := range ops {
+		if err != nil {
+			o.outcomeChan <- Outcome{Err: err}
+		} else if e := results[i].Error; e != "" {
+			o.outcomeChan <- Outcome{results[i].Result, &ExecutionError{e}}
+		} else {
+			o.outcomeChan <- Outcome{Result: results[i].Result}
+		}
+	}
+}
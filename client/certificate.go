@@ -0,0 +1,168 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+)
+
+// ReplyCertificate proves to a third party that an operation was
+// executed by the replicated state machine with the given result.
+//
+// Request is the serialized Request message signed by the client.
+// Replies holds the serialized Reply messages with the matching
+// result signed by f+1 distinct replicas. Rejection holds the reason
+// if the replicas rejected the request without executing it, e.g.
+// due to exceeded rate limit; Result is empty then. ExecutionError
+// holds the error reported by the application if it failed to
+// execute the operation.
+type ReplyCertificate struct {
+	Request        []byte
+	Result         []byte
+	Rejection      string `json:",omitempty"`
+	ExecutionError string `json:",omitempty"`
+	Replies        []SignedReply
+}
+
+// Err returns an error if the certified request was not executed
+// successfully, i.e. *RejectionError if the replicas rejected it or
+// *ExecutionError if the application failed to execute it.
+func (cert *ReplyCertificate) Err() error {
+	if cert.Rejection != "" {
+		return &RejectionError{cert.Rejection}
+	} else if cert.ExecutionError != "" {
+		return &ExecutionError{cert.ExecutionError}
+	}
+	return nil
+}
+
+// RejectionError indicates that the replicas rejected the request
+// without executing it for the given reason.
+type RejectionError struct {
+	Reason string
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("Request rejected: %s", e.Reason)
+}
+
+// ExecutionError indicates that the application failed to execute
+// the requested operation with the given error message.
+type ExecutionError struct {
+	Message string
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Message
+}
+
+// SignedReply is a serialized Reply message signed by the replica.
+type SignedReply struct {
+	ReplicaID uint32
+	Reply     []byte
+}
+
+// makeReplyCertificate constructs a ReplyCertificate given the
+// Request message and the matching Reply messages.
+func makeReplyCertificate(request messages.Request, replies []messages.Reply) *ReplyCertificate {
+	reqBytes, err := request.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	cert := &ReplyCertificate{
+		Request:        reqBytes,
+		Result:         replies[0].Result(),
+		Rejection:      replies[0].Rejection(),
+		ExecutionError: replies[0].ExecutionError(),
+	}
+	for _, reply := range replies {
+		replyBytes, err := reply.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		cert.Replies = append(cert.Replies, SignedReply{reply.ReplicaID(), replyBytes})
+	}
+
+	return cert
+}
+
+// VerifyReplyCertificate checks that the certificate proves execution
+// of the certified Request message with the certified result and
+// error, or its rejection with the certified reason, given
+// the number of tolerated faulty replicas. The supplied authenticator
+// has to be able to verify signatures of the client and the replicas,
+// e.g. one initialized from the keystore. It does not require a
+// running client instance.
+func VerifyReplyCertificate(cert *ReplyCertificate, f uint32, authen api.Authenticator) error {
+	msg, err := messageImpl.NewFromBinary(cert.Request)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal Request: %s", err)
+	}
+	request, ok := msg.(messages.Request)
+	if !ok {
+		return fmt.Errorf("Certificate does not contain Request")
+	}
+	clientID := request.ClientID()
+	err = authen.VerifyMessageAuthenTag(api.ClientAuthen, clientID,
+		messages.AuthenBytes(request), request.Signature())
+	if err != nil {
+		return fmt.Errorf("Invalid Request signature: %s", err)
+	}
+
+	replicas := make(map[uint32]bool)
+	for _, r := range cert.Replies {
+		msg, err := messageImpl.NewFromBinary(r.Reply)
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal Reply from replica %d: %s", r.ReplicaID, err)
+		}
+		reply, ok := msg.(messages.Reply)
+		if !ok {
+			return fmt.Errorf("Unexpected message in certificate")
+		}
+
+		replicaID := reply.ReplicaID()
+		if replicaID != r.ReplicaID {
+			return fmt.Errorf("Replica ID mismatch: %d != %d", replicaID, r.ReplicaID)
+		} else if replicas[replicaID] {
+			return fmt.Errorf("Duplicated Reply from replica %d", replicaID)
+		}
+
+		if reply.ClientID() != clientID || reply.Sequence() != request.Sequence() {
+			return fmt.Errorf("Reply from replica %d for another Request", replicaID)
+		} else if !bytes.Equal(reply.Result(), cert.Result) || reply.Rejection() != cert.Rejection ||
+			reply.ExecutionError() != cert.ExecutionError {
+			return fmt.Errorf("Reply from replica %d with another result", replicaID)
+		}
+
+		err = authen.VerifyMessageAuthenTag(api.ReplicaAuthen, replicaID,
+			messages.AuthenBytes(reply), reply.Signature())
+		if err != nil {
+			return fmt.Errorf("Invalid Reply signature from replica %d: %s", replicaID, err)
+		}
+
+		replicas[replicaID] = true
+	}
+
+	if len(replicas) <= int(f) {
+		return fmt.Errorf("Not enough Replies: %d", len(replicas))
+	}
+
+	return nil
+}
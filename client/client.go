@@ -20,6 +20,7 @@ package client
 
 import (
 	"fmt"
+	"time"
 
 	logging "github.com/op/go-logging"
 
@@ -47,30 +48,165 @@ type Stack interface {
 //
 // Request requests execution of the supplied operation on the
 // replicated state machine and returns a channel to receive the
-// result of execution from.
+// result of execution from. The channel is closed without receiving
+// a result if the replicas reject the request or fail to execute it,
+// so that the caller has to check whether a result was received,
+// e.g. with the two-value form of the receive operation, rather than
+// take the channel receiving for success. Execute gives the reason of
+// failure and should be preferred.
+//
+// Execute is the same as Request, except it returns a channel to
+// receive the outcome of execution from. The outcome holds either the
+// result or the error, e.g. *ExecutionError if the application failed
+// to execute the operation or *RejectionError if the replicas
+// rejected the request. Either way, f+1 replicas agree on the outcome.
+//
+// RequestCertified is the same as Request, except it returns a
+// channel to receive the result of execution together with the
+// certificate proving it to a third party. The certificate can be
+// checked with VerifyReplyCertificate. Such operations are never
+// batched.
+//
+// Reconfigure is the same as Execute, except it requests a membership
+// reconfiguration, as made by minbft.MakeReconfigurationOperation,
+// executed by the replicas themselves. Reconfigurations are never
+// batched.
+//
+// MembershipChanged makes the client follow the membership changed
+// by reconfiguration, so that Client implements
+// api.MembershipObserver. The client connects to the replicas joined
+// through the stack, which has to be able to reach them by then, and
+// takes into account Reply messages from the members only, requiring
+// F+1 of them to match. Memberships with an epoch not newer than the
+// current one are ignored. Unless notified, the client keeps using
+// the membership it was created with.
 type Client interface {
 	Request(operation []byte) (resultChan <-chan []byte)
+	Execute(operation []byte) (outcomeChan <-chan Outcome)
+	RequestCertified(operation []byte) (certChan <-chan *ReplyCertificate)
+	Reconfigure(operation []byte) (outcomeChan <-chan Outcome)
+	MembershipChanged(m *api.Membership) error
+}
+
+// Outcome is the outcome of executing an operation, as received from
+// Execute method of Client. Err is nil if the operation was executed
+// successfully.
+type Outcome struct {
+	Result []byte
+	Err    error
+}
+
+// Option represents a parameter to initialize Client with.
+type Option func(*options)
+
+type options struct {
+	batchWindow time.Duration
+	batchSize   int
+	membership  *api.Membership
+}
+
+// WithBatching enables gathering operations requested with Request
+// and Execute into batches, each submitted as a single request. A
+// batch is submitted once the window has elapsed since its first
+// operation was requested, or once it holds maxOps operations, unless
+// maxOps is zero. Replicas execute the operations of a batch one
+// after another, in order. Operations are not batched by default.
+func WithBatching(window time.Duration, maxOps int) Option {
+	return func(opts *options) {
+		opts.batchWindow = window
+		opts.batchSize = maxOps
+	}
+}
+
+// WithMembership makes the client start from the supplied membership
+// instead of the initial one, e.g. from the current membership
+// reported by the replicas, as if notified with MembershipChanged.
+func WithMembership(m *api.Membership) Option {
+	return func(opts *options) {
+		opts.membership = m
+	}
+}
+
+// simpleClient implements Client interface by submitting each
+// operation in a separate request.
+type simpleClient struct {
+	requestHandler
+	*membershipTracker
 }
 
 // New creates an instance of Client given a client ID, total number
 // of replica nodes n, number of tolerated faulty replica nodes f, and
-// a stack of external interfaces.
-func New(id uint32, n, f uint32, stack Stack) (Client, error) {
-	if n < f*2+1 {
-		return nil, fmt.Errorf("Insufficient number of replica nodes")
+// a stack of external interfaces. Optional arguments opts specify
+// initialization parameters.
+func New(id uint32, n, f uint32, stack Stack, opts ...Option) (Client, error) {
+	opt := options{membership: initialMembership(n, f)}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	if err := checkMembership(opt.membership); err != nil {
+		return nil, err
 	}
 
 	buf := requestbuffer.New()
 
-	if err := startReplicaConnections(id, n, buf, stack); err != nil {
+	membership, err := newMembershipTracker(opt.membership, makeReplicaConnectionStarter(id, buf, stack))
+	if err != nil {
 		return nil, fmt.Errorf("Failed to initiate connections to replicas: %s", err)
 	}
 
 	seq := makeSequenceGenerator()
-	return makeRequestHandler(id, seq, stack, buf, f), nil
+	handler := makeRequestHandler(id, seq, stack, buf, membership.membership)
+	if opt.batchWindow > 0 || opt.batchSize > 1 {
+		return batchingClient{handler, membership, makeOperationBatcher(handler, opt.batchWindow, opt.batchSize)}, nil
+	}
+
+	return simpleClient{handler, membership}, nil
 }
 
 // Request implements Client interface on requestHandler
 func (handler requestHandler) Request(operation []byte) <-chan []byte {
-	return handler(operation)
+	return outcomeResult(handler.Execute(operation))
+}
+
+// Execute implements Client interface on requestHandler
+func (handler requestHandler) Execute(operation []byte) <-chan Outcome {
+	return handler.execute(api.OperationRequest, operation)
+}
+
+// Reconfigure implements Client interface on requestHandler
+func (handler requestHandler) Reconfigure(operation []byte) <-chan Outcome {
+	return handler.execute(api.ReconfigurationRequest, operation)
+}
+
+// execute initiates the operation of a request of the specified kind
+// and returns a channel to receive the outcome of execution from.
+func (handler requestHandler) execute(kind api.RequestKind, operation []byte) <-chan Outcome {
+	outcomeChan := make(chan Outcome, 1)
+	certChan := handler(kind, operation)
+	go func() {
+		cert := <-certChan
+		outcomeChan <- Outcome{cert.Result, cert.Err()}
+	}()
+	return outcomeChan
+}
+
+// outcomeResult returns a channel to receive the result of successful
+// execution from, given the channel to receive the outcome from. The
+// returned channel is closed without receiving a result if the
+// execution is not successful.
+func outcomeResult(outcomeChan <-chan Outcome) <-chan []byte {
+	resultChan := make(chan []byte, 1)
+	go func() {
+		defer close(resultChan)
+		if out := <-outcomeChan; out.Err == nil {
+			resultChan <- out.Result
+		}
+	}()
+	return resultChan
+}
+
+// RequestCertified implements Client interface on requestHandler
+func (handler requestHandler) RequestCertified(operation []byte) <-chan *ReplyCertificate {
+	return handler(api.OperationRequest, operation)
 }
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// membershipProvider returns the current membership of replicas.
+type membershipProvider func() *api.Membership
+
+// replicaConnectionStarter initiates message exchange with the
+// specified replica.
+type replicaConnectionStarter func(replicaID uint32) error
+
+// membershipTracker keeps track of the membership of replicas the
+// client communicates with. It implements MembershipChanged method
+// of Client interface.
+type membershipTracker struct {
+	connect replicaConnectionStarter
+
+	lock      sync.Mutex
+	current   *api.Membership
+	connected map[uint32]bool
+}
+
+// newMembershipTracker creates an instance of membershipTracker
+// starting from the supplied membership. It connects to the members
+// using the supplied abstraction.
+func newMembershipTracker(initial *api.Membership, connect replicaConnectionStarter) (*membershipTracker, error) {
+	t := &membershipTracker{
+		connect:   connect,
+		current:   initial,
+		connected: make(map[uint32]bool),
+	}
+	if err := t.connectMembers(initial); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// MembershipChanged implements Client interface on membershipTracker
+func (t *membershipTracker) MembershipChanged(m *api.Membership) error {
+	if err := checkMembership(m); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if m.Epoch <= t.current.Epoch {
+		return nil
+	}
+	if err := t.connectMembers(m); err != nil {
+		return err
+	}
+	t.current = m
+
+	return nil
+}
+
+// membership returns the current membership.
+func (t *membershipTracker) membership() *api.Membership {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.current
+}
+
+// connectMembers connects to the members not connected yet.
+func (t *membershipTracker) connectMembers(m *api.Membership) error {
+	for _, r := range m.Replicas {
+		if t.connected[r.ID] {
+			continue
+		}
+		if err := t.connect(r.ID); err != nil {
+			return fmt.Errorf("Error connecting to replica %d: %s", r.ID, err)
+		}
+		t.connected[r.ID] = true
+	}
+	return nil
+}
+
+// initialMembership returns the membership of n replicas with IDs
+// from zero to n-1, tolerating f faulty replicas.
+func initialMembership(n, f uint32) *api.Membership {
+	m := &api.Membership{F: f}
+	for id := uint32(0); id < n; id++ {
+		m.Replicas = append(m.Replicas, api.ReplicaInfo{ID: id})
+	}
+	return m
+}
+
+// checkMembership checks if the membership has enough replicas to
+// tolerate the number of faulty replicas it specifies.
+func checkMembership(m *api.Membership) error {
+	if len(m.Replicas) < int(m.F)*2+1 {
+		return fmt.Errorf("Insufficient number of replica nodes")
+	}
+	return nil
+}
+
+// isMember returns true if the replica with the specified ID is a
+// member of the supplied membership.
+func isMember(m *api.Membership, replicaID uint32) bool {
+	for _, r := range m.Replicas {
+		if r.ID == replicaID {
+			return true
+		}
+	}
+	return false
+}
@@ -25,25 +25,21 @@ import (
 	"github.com/hyperledger-labs/minbft/messages"
 )
 
-// startReplicaConnections initiates connections to all replicas and
-// starts message exchange with them given a total number of replicas,
-// request buffer to add/fetch messages to/from and a stack of
-// interfaces to external modules.
-func startReplicaConnections(clientID, n uint32, buf *requestbuffer.T, stack Stack) error {
+// makeReplicaConnectionStarter constructs an instance of
+// replicaConnectionStarter to initiate connections to replicas and
+// start message exchange with them given request buffer to add/fetch
+// messages to/from and a stack of interfaces to external modules.
+func makeReplicaConnectionStarter(clientID uint32, buf *requestbuffer.T, stack Stack) replicaConnectionStarter {
 	outHandler := makeOutgoingMessageHandler(buf)
 	authenticator := makeReplyAuthenticator(clientID, stack)
 	consumer := makeReplyConsumer(buf)
 	handleReply := makeReplyMessageHandler(consumer, authenticator)
 
-	for i := uint32(0); i < n; i++ {
-		connector := makeReplicaConnector(i, stack)
-		inHandler := makeIncomingMessageHandler(i, handleReply)
-		if err := startReplicaConnection(outHandler, inHandler, connector); err != nil {
-			return fmt.Errorf("Error connecting to replica %d: %s", i, err)
-		}
+	return func(replicaID uint32) error {
+		connector := makeReplicaConnector(replicaID, stack)
+		inHandler := makeIncomingMessageHandler(replicaID, handleReply)
+		return startReplicaConnection(outHandler, inHandler, connector)
 	}
-
-	return nil
 }
 
 // outgoingMessageHandler supplies the channel passed to it with a
@@ -26,49 +26,51 @@ import (
 	"github.com/hyperledger-labs/minbft/messages"
 )
 
-// requestHandler initiates the specified operation to execute on the
-// replicated state machine and returns a channel to receive the
+// requestHandler initiates the specified operation of a request of
+// the specified kind and returns a channel to receive the certified
 // result from.
-type requestHandler func(operation []byte) <-chan []byte
+type requestHandler func(kind api.RequestKind, operation []byte) <-chan *ReplyCertificate
 
 // makeRequestHandler constructs a requestHandler uisng the supplied
 // clientID, sequence number generator, authenticator, request buffer,
-// and number of tolerated faulty replicas.
-func makeRequestHandler(clientID uint32, seq sequenceGenerator, authen api.Authenticator, buf *requestbuffer.T, f uint32) requestHandler {
+// and provider of the current membership.
+func makeRequestHandler(clientID uint32, seq sequenceGenerator, authen api.Authenticator, buf *requestbuffer.T, membership membershipProvider) requestHandler {
 	submitter := makeRequestSubmitter(clientID, seq, authen, buf)
-	collector := makeReplyCollector(f, buf)
-	return func(operation []byte) <-chan []byte {
-		return handleRequest(operation, submitter, collector)
+	collector := makeReplyCollector(membership, buf)
+	return func(kind api.RequestKind, operation []byte) <-chan *ReplyCertificate {
+		return handleRequest(kind, operation, submitter, collector)
 	}
 }
 
-// requestSubmitter initiates processing of a request to execute an
-// operation on the replicated state machine and returns a channel to
-// fetch corresponding Reply messages from.
-type requestSubmitter func(operation []byte) <-chan messages.Reply
+// requestSubmitter initiates processing of a request of the specified
+// kind to execute an operation. It returns the Request message and a
+// channel to fetch corresponding Reply messages from.
+type requestSubmitter func(kind api.RequestKind, operation []byte) (messages.Request, <-chan messages.Reply)
 
-// replyCollector collects f+1 matching Reply messages received from
+// replyCollector collects F+1 matching Reply messages from members
+// of the current membership received from
 // the passed channel, finishes the request processing, and sends the
-// result of request execution to the passed channel.
-type replyCollector func(in <-chan messages.Reply, out chan<- []byte)
-
-// handleRequest initiates the specified operation to execute on the
-// replicated state machine using the passed request submitter and
-// returns a channel to receive the result of execution from.
-func handleRequest(operation []byte, submitter requestSubmitter, collector replyCollector) <-chan []byte {
-	resultChan := make(chan []byte, 1)
-	replyChan := submitter(operation)
-	go collector(replyChan, resultChan)
-	return resultChan
+// result of request execution certified by the Reply messages to the
+// passed channel.
+type replyCollector func(request messages.Request, in <-chan messages.Reply, out chan<- *ReplyCertificate)
+
+// handleRequest initiates the specified operation of a request of the
+// specified kind using the passed request submitter and returns a
+// channel to receive the certified result of execution from.
+func handleRequest(kind api.RequestKind, operation []byte, submitter requestSubmitter, collector replyCollector) <-chan *ReplyCertificate {
+	certChan := make(chan *ReplyCertificate, 1)
+	request, replyChan := submitter(kind, operation)
+	go collector(request, replyChan, certChan)
+	return certChan
 }
 
 // makeReplyCollector constructs a replyCollector using the supplied
-// tolerance and request buffer to remove the request from when its
-// processing is finished.
-func makeReplyCollector(f uint32, buf *requestbuffer.T) replyCollector {
+// membership provider and request buffer to remove the request from
+// when its processing is finished.
+func makeReplyCollector(membership membershipProvider, buf *requestbuffer.T) replyCollector {
 	remover := makeRequestRemover(buf)
-	return func(in <-chan messages.Reply, out chan<- []byte) {
-		collectReplies(f, in, remover, out)
+	return func(request messages.Request, in <-chan messages.Reply, out chan<- *ReplyCertificate) {
+		collectReplies(membership, request, in, remover, out)
 	}
 }
 
@@ -76,21 +78,36 @@ func makeReplyCollector(f uint32, buf *requestbuffer.T) replyCollector {
 // given its sequence number.
 type requestRemover func(seq uint64)
 
-// collectReplies collects f+1 matching Reply messages fetched from
+// collectReplies collects F+1 matching Reply messages fetched from
 // the supplied channel, removes the corresponding request using the
 // supplied request remover, and sends the result of request execution
-// to the supplied channel.
-func collectReplies(f uint32, replyChan <-chan messages.Reply, remover requestRemover, resultChan chan<- []byte) {
-	type resultHashType [sha256.Size]byte
-	matchingResults := make(map[resultHashType]uint32)
+// certified by the matching Reply messages to the supplied channel.
+// Reply messages match if they have the same result, the same reason
+// of rejection, and the same error of execution, if any. Only Reply
+// messages from members of the membership current at the time of
+// counting are taken into account, with F of that membership.
+func collectReplies(membership membershipProvider, request messages.Request, replyChan <-chan messages.Reply, remover requestRemover, certChan chan<- *ReplyCertificate) {
+	type replyKey struct {
+		resultHash [sha256.Size]byte
+		rejection  string
+		execError  string
+	}
+	matchingReplies := make(map[replyKey][]messages.Reply)
 
 	for reply := range replyChan {
-		result := reply.Result()
-		hash := sha256.Sum256(result)
-		matchingResults[hash]++
-		if matchingResults[hash] > f {
+		key := replyKey{sha256.Sum256(reply.Result()), reply.Rejection(), reply.ExecutionError()}
+		matchingReplies[key] = append(matchingReplies[key], reply)
+
+		m := membership()
+		var replies []messages.Reply
+		for _, r := range matchingReplies[key] {
+			if isMember(m, r.ReplicaID()) {
+				replies = append(replies, r)
+			}
+		}
+		if len(replies) > int(m.F) {
 			remover(reply.Sequence())
-			resultChan <- result
+			certChan <- makeReplyCertificate(request, replies)
 			break
 		}
 	}
@@ -114,14 +131,14 @@ type sequenceGenerator func() uint64
 func makeRequestSubmitter(clientID uint32, seq sequenceGenerator, authen api.Authenticator, buf *requestbuffer.T) requestSubmitter {
 	preparer := makeRequestPreparer(clientID, authen, seq)
 	consumer := makeRequestConsumer(buf)
-	return func(operation []byte) <-chan messages.Reply {
-		return submitRequest(operation, preparer, consumer)
+	return func(kind api.RequestKind, operation []byte) (messages.Request, <-chan messages.Reply) {
+		return submitRequest(kind, operation, preparer, consumer)
 	}
 }
 
-// requestPreparer prepares a new signed Request message given an
-// operation to execute by the replicated state machine
-type requestPreparer func(operation []byte) messages.Request
+// requestPreparer prepares a new signed Request message given the
+// kind of request and the operation to execute
+type requestPreparer func(kind api.RequestKind, operation []byte) messages.Request
 
 // requestConsumer consumes a signed Request message for further
 // processing and returns a channel to fetch corresponding Reply
@@ -129,17 +146,17 @@ type requestPreparer func(operation []byte) messages.Request
 // message was accepted.
 type requestConsumer func(request messages.Request) (<-chan messages.Reply, bool)
 
-// submitRequest makes a new Request message for a given operation to
-// execute by the replicated state machine using the supplied
-// requestPreparer and passes it to the supplied requestConsumer. It
-// returns a channel to fetch corresponding messages from.
-func submitRequest(operation []byte, preparer requestPreparer, consumer requestConsumer) <-chan messages.Reply {
-	request := preparer(operation)
+// submitRequest makes a new Request message of a given kind for a
+// given operation to execute using the supplied requestPreparer and
+// passes it to the supplied requestConsumer. It returns the Request
+// message and a channel to fetch corresponding messages from.
+func submitRequest(kind api.RequestKind, operation []byte, preparer requestPreparer, consumer requestConsumer) (messages.Request, <-chan messages.Reply) {
+	request := preparer(kind, operation)
 	replyChan, ok := consumer(request)
 	if !ok {
 		panic("Request message rejected")
 	}
-	return replyChan
+	return request, replyChan
 }
 
 // makeRequestPreparer constructs a requestPreparer using the supplied
@@ -148,8 +165,8 @@ func makeRequestPreparer(clientID uint32, authenticator api.Authenticator, seq s
 	constructor := makeRequestConstructor(clientID, seq)
 	signer := makeRequestSigner(authenticator)
 
-	return func(operation []byte) messages.Request {
-		return prepareRequest(operation, constructor, signer)
+	return func(kind api.RequestKind, operation []byte) messages.Request {
+		return prepareRequest(kind, operation, constructor, signer)
 	}
 }
 
@@ -163,17 +180,17 @@ func makeRequestConsumer(buf *requestbuffer.T) requestConsumer {
 }
 
 // requestConstructor constructs a new Request message ready to sign,
-// given an operation to execute by the replicated state machine.
-type requestConstructor func(operation []byte) messages.Request
+// given the kind of request and the operation to execute.
+type requestConstructor func(kind api.RequestKind, operation []byte) messages.Request
 
 // requestSigner signs the supplied Request message
 type requestSigner func(request messages.Request) error
 
-// prepareRequest prepares a new singed Request message given an
-// operation to execute by the replicated state machine, request
-// constructor and signer.
-func prepareRequest(operation []byte, constructor requestConstructor, signer requestSigner) messages.Request {
-	request := constructor(operation)
+// prepareRequest prepares a new singed Request message given the kind
+// of request, the operation to execute, request constructor and
+// signer.
+func prepareRequest(kind api.RequestKind, operation []byte, constructor requestConstructor, signer requestSigner) messages.Request {
+	request := constructor(kind, operation)
 	if err := signer(request); err != nil {
 		logger.Fatalf("Failed to sign request message: %s", err)
 	}
@@ -184,8 +201,8 @@ func prepareRequest(operation []byte, constructor requestConstructor, signer req
 // makeRequestConstructor constructs a requestConstructor using the
 // supplied client ID and sequenceGenerator
 func makeRequestConstructor(clientID uint32, seq sequenceGenerator) requestConstructor {
-	return func(operation []byte) messages.Request {
-		return messageImpl.NewRequest(clientID, seq(), operation)
+	return func(kind api.RequestKind, operation []byte) messages.Request {
+		return messageImpl.NewRequestWithKind(clientID, seq(), kind, operation)
 	}
 }
 
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"fmt"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/messages/batch"
+)
+
+// makeBatchRequestValidator constructs an instance of
+// requestValidator that additionally checks batches of operations to
+// be well-formed.
+func makeBatchRequestValidator(validateRequest requestValidator) requestValidator {
+	return func(request messages.Request) error {
+		if err := validateRequest(request); err != nil {
+			return err
+		}
+
+		if request.Kind() != api.BatchRequest {
+			return nil
+		}
+
+		if _, err := batch.ParseOperation(request.Operation()); err != nil {
+			return fmt.Errorf("Malformed batch: %s", err)
+		}
+
+		return nil
+	}
+}
+
+// makeBatchExecutor constructs an instance of operationExecutor that
+// executes batches of operations by passing each operation of the
+// batch to the supplied executor in order, and passes any other
+// operation to the supplied executor as is. All operations of a batch
+// are executed with the same input. Errors of execution are reported
+// in the result of the batch for each operation.
+func makeBatchExecutor(execute operationExecutor) operationExecutor {
+	return func(kind api.RequestKind, op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		if kind != api.BatchRequest {
+			return execute(kind, op, input)
+		}
+
+		ops, err := batch.ParseOperation(op)
+		if err != nil {
+			panic(err) // validated before
+		}
+
+		resultChans := make([]<-chan api.ExecutionResult, len(ops))
+		for i, op := range ops {
+			resultChans[i] = execute(api.OperationRequest, op, input)
+		}
+
+		resultChan := make(chan api.ExecutionResult, 1)
+		go func() {
+			results := make([]batch.Result, len(ops))
+			for i, ch := range resultChans {
+				res := <-ch
+				results[i].Result = res.Result
+				if res.Error != nil {
+					results[i].Error = res.Error.Error()
+				}
+			}
+			resultChan <- api.ExecutionResult{Result: batch.MakeResult(results)}
+		}()
+
+		return resultChan
+	}
+}
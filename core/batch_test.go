@@ -0,0 +1,104 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testifymock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/messages/batch"
+)
+
+func TestMakeBatchRequestValidator(t *testing.T) {
+	mock := new(testifymock.Mock)
+	defer mock.AssertExpectations(t)
+
+	validateRequest := func(request messages.Request) error {
+		args := mock.MethodCalled("requestValidator", request)
+		return args.Error(0)
+	}
+	validate := makeBatchRequestValidator(validateRequest)
+
+	request := messageImpl.NewRequest(0, rand.Uint64(), []byte("operation"))
+	mock.On("requestValidator", request).Return(fmt.Errorf("invalid signature")).Once()
+	assert.Error(t, validate(request))
+	mock.On("requestValidator", request).Return(nil).Once()
+	assert.NoError(t, validate(request))
+
+	// Plain operations are not parsed as batches
+	request = messageImpl.NewRequest(0, rand.Uint64(), batch.MakeOperation(nil))
+	mock.On("requestValidator", request).Return(nil).Once()
+	assert.NoError(t, validate(request))
+
+	for _, c := range []struct {
+		op []byte
+		ok bool
+	}{
+		{batch.MakeOperation([][]byte{[]byte("op1"), []byte("op2")}), true},
+		{batch.MakeOperation(nil), false},
+		{[]byte("op1"), false},
+	} {
+		request := messageImpl.NewRequestWithKind(0, rand.Uint64(), api.BatchRequest, c.op)
+		mock.On("requestValidator", request).Return(nil).Once()
+		if c.ok {
+			assert.NoError(t, validate(request))
+		} else {
+			assert.Error(t, validate(request))
+		}
+	}
+}
+
+func TestMakeBatchExecutor(t *testing.T) {
+	mock := new(testifymock.Mock)
+	defer mock.AssertExpectations(t)
+
+	execute := func(kind api.RequestKind, op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		args := mock.MethodCalled("operationExecutor", kind, op, input)
+		return args.Get(0).(chan api.ExecutionResult)
+	}
+	executor := makeBatchExecutor(execute)
+
+	input := api.ExecutionInput{Timestamp: time.Unix(0, rand.Int63()), Seed: []byte("seed")}
+
+	op := []byte("operation")
+	resultChan := make(chan api.ExecutionResult, 1)
+	mock.On("operationExecutor", api.OperationRequest, op, input).Return(resultChan).Once()
+	assert.Equal(t, (<-chan api.ExecutionResult)(resultChan), executor(api.OperationRequest, op, input))
+
+	op1, op2 := []byte("op1"), []byte("op2")
+	resultChan1, resultChan2 := make(chan api.ExecutionResult, 1), make(chan api.ExecutionResult, 1)
+	mock.On("operationExecutor", api.OperationRequest, op1, input).Return(resultChan1).Once()
+	mock.On("operationExecutor", api.OperationRequest, op2, input).Return(resultChan2).Once()
+	batchResultChan := executor(api.BatchRequest, batch.MakeOperation([][]byte{op1, op2}), input)
+
+	resultChan2 <- api.ExecutionResult{Result: []byte("res2"), Error: fmt.Errorf("failed")}
+	resultChan1 <- api.ExecutionResult{Result: []byte("res1")}
+	res := <-batchResultChan
+	require.NoError(t, res.Error)
+	results, err := batch.ParseResult(res.Result)
+	require.NoError(t, err)
+	assert.Equal(t, []batch.Result{
+		{Result: []byte("res1")},
+		{Result: []byte("res2"), Error: "failed"},
+	}, results)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/hyperledger-labs/minbft/api"
+	cl "github.com/hyperledger-labs/minbft/client"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	"github.com/hyperledger-labs/minbft/testing/cluster"
+)
+
+// echoConsumer is a request consumer returning the operation as the
+// result of its execution. It introduces negligible overhead so that
+// benchmarks measure the cost of the consensus protocol.
+type echoConsumer struct{}
+
+func (echoConsumer) Deliver(operation []byte) <-chan []byte {
+	resultChan := make(chan []byte, 1)
+	resultChan <- operation
+	return resultChan
+}
+
+func (echoConsumer) StateDigest() []byte {
+	return nil
+}
+
+func newBenchCluster(b *testing.B, n, m int) *cluster.Cluster {
+	logging.SetLevel(logging.ERROR, "client")
+
+	c, err := cluster.New(n, m, func(uint32) api.RequestConsumer {
+		return echoConsumer{}
+	}, cluster.WithReplicaOptions(minbft.WithLogLevel(logging.ERROR)))
+	if err != nil {
+		b.Fatalf("Failed to create cluster: %s", err)
+	}
+	b.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			b.Errorf("Failed to close cluster: %s", err)
+		}
+	})
+
+	// Warm up connections before measuring
+	for _, client := range c.Clients() {
+		if out := <-client.Execute([]byte("warm-up")); out.Err != nil {
+			b.Fatalf("Warm-up request failed: %s", out.Err)
+		}
+	}
+
+	return c
+}
+
+func benchmarkNormalCase(b *testing.B, c *cluster.Cluster, payloadSize int) {
+	m := len(c.Clients())
+	operation := make([]byte, payloadSize)
+
+	b.SetBytes(int64(payloadSize))
+	b.ResetTimer()
+
+	wg := new(sync.WaitGroup)
+	for i, client := range c.Clients() {
+		count := b.N / m
+		if i < b.N%m {
+			count++
+		}
+
+		wg.Add(1)
+		go func(client cl.Client, count int) {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				if out := <-client.Execute(operation); out.Err != nil {
+					b.Errorf("Request failed: %s", out.Err)
+				}
+			}
+		}(client, count)
+	}
+	wg.Wait()
+}
+
+func BenchmarkNormalCase(b *testing.B) {
+	for _, n := range []int{3, 5} {
+		for _, m := range []int{1, 8} {
+			n, m := n, m
+			// The cluster is shared by the sub-benchmarks, which
+			// are run repeatedly with increasing b.N
+			b.Run(fmt.Sprintf("r=%d/c=%d", n, m), func(b *testing.B) {
+				c := newBenchCluster(b, n, m)
+				for _, payloadSize := range []int{32, 1024} {
+					payloadSize := payloadSize
+					b.Run(fmt.Sprintf("size=%d", payloadSize), func(b *testing.B) {
+						benchmarkNormalCase(b, c, payloadSize)
+					})
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+)
+
+// VerifyCommittedOperation checks that the committed operation
+// received from the commit feed of a replica is certified by f+1
+// distinct members of the membership in the view it was committed in,
+// given the membership history. To keep track of the membership, the
+// committed operations have to be verified and applied to the history
+// in the order of commit, starting from the first one. The supplied
+// authenticator has to be able to verify USIG certificates of the
+// replicas, including those joined by reconfiguration.
+func VerifyCommittedOperation(op *api.CommittedOperation, history *MembershipHistory, authen api.Authenticator) error {
+	verifyUI := makeUIVerifier(authen, messages.AuthenBytes)
+
+	if len(op.Certificate) == 0 {
+		return fmt.Errorf("Empty certificate")
+	}
+
+	prepare, err := parseCertificateMessage(op.Certificate[0])
+	if err != nil {
+		return err
+	}
+	p, ok := prepare.(messages.Prepare)
+	if !ok {
+		return fmt.Errorf("Certificate does not start with Prepare")
+	}
+	if history.Primary(p.View()) != p.ReplicaID() {
+		return fmt.Errorf("Prepare not from primary")
+	}
+	m := history.Membership(p.View())
+	members := make(map[uint32]bool)
+	for _, r := range m.Replicas {
+		members[r.ID] = true
+	}
+	ui, err := verifyUI(p)
+	if err != nil {
+		return fmt.Errorf("Invalid Prepare: %s", err)
+	}
+
+	req := p.Request()
+	if p.View() != op.View || ui.Counter != op.UICounter ||
+		req.ClientID() != op.ClientID || req.Sequence() != op.Seq ||
+		req.Kind() != op.Kind || !bytes.Equal(req.Operation(), op.Operation) {
+		return fmt.Errorf("Prepare does not match committed operation")
+	}
+
+	prepareAuthenBytes := messages.AuthenBytes(p)
+	replicas := map[uint32]bool{p.ReplicaID(): true}
+	for _, certBytes := range op.Certificate[1:] {
+		msg, err := parseCertificateMessage(certBytes)
+		if err != nil {
+			return err
+		}
+		c, ok := msg.(messages.Commit)
+		if !ok {
+			return fmt.Errorf("Unexpected message in certificate")
+		}
+
+		id := c.ReplicaID()
+		if !members[id] {
+			return fmt.Errorf("Commit from non-member replica %d", id)
+		} else if replicas[id] {
+			return fmt.Errorf("Duplicated commitment from replica %d", id)
+		}
+
+		cp := c.Prepare()
+		if cp.ReplicaID() != p.ReplicaID() ||
+			!bytes.Equal(messages.AuthenBytes(cp), prepareAuthenBytes) ||
+			!bytes.Equal(cp.UIBytes(), p.UIBytes()) {
+			return fmt.Errorf("Commit from replica %d for another Prepare", id)
+		}
+		if _, err := verifyUI(c); err != nil {
+			return fmt.Errorf("Invalid Commit from replica %d: %s", id, err)
+		}
+
+		replicas[id] = true
+	}
+
+	if len(replicas) <= int(m.F) {
+		return fmt.Errorf("Not enough commitments: %d", len(replicas))
+	}
+
+	return nil
+}
+
+func parseCertificateMessage(msgBytes []byte) (messages.Message, error) {
+	msg, err := messageImpl.NewFromBinary(msgBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal certificate message: %s", err)
+	}
+	return msg, nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
 	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
 	"github.com/hyperledger-labs/minbft/messages"
 )
@@ -60,9 +61,25 @@ type commitmentCollector func(replicaID uint32, prepare messages.Prepare) error
 // detected.
 type commitmentCounter func(replicaID uint32, prepare messages.Prepare) (done bool, err error)
 
+// commitmentRecorder records commitment on prepared Request.
+//
+// The supplied message is either a Prepare or a Commit message. It is
+// assumed to be valid and should have a UI assigned. Recorded
+// messages make up the commit certificate of the prepared Request.
+// It is safe to invoke concurrently.
+type commitmentRecorder func(msg messages.CertifiedMessage)
+
+// committedRequestPublisher publishes committed Request.
+//
+// The supplied Prepare message is assumed to be valid and have
+// enough commitments recorded to commit the prepared Request. It
+// should be invoked in the order of commit. It is safe to invoke
+// concurrently.
+type committedRequestPublisher func(prepare messages.Prepare)
+
 // makeCommitValidator constructs an instance of commitValidator using
-// the supplied abstractions.
-func makeCommitValidator(verifyUI uiVerifier, validatePrepare prepareValidator) commitValidator {
+// the supplied membership history and abstractions.
+func makeCommitValidator(history membership.State, verifyUI uiVerifier, validatePrepare prepareValidator) commitValidator {
 	return func(commit messages.Commit) error {
 		prepare := commit.Prepare()
 
@@ -70,6 +87,10 @@ func makeCommitValidator(verifyUI uiVerifier, validatePrepare prepareValidator)
 			return fmt.Errorf("Commit from primary")
 		}
 
+		if !history.IsMember(prepare.View(), commit.ReplicaID()) {
+			return fmt.Errorf("Commit from non-member %d", commit.ReplicaID())
+		}
+
 		if err := validatePrepare(prepare); err != nil {
 			return fmt.Errorf("Invalid Prepare: %s", err)
 		}
@@ -84,11 +105,13 @@ func makeCommitValidator(verifyUI uiVerifier, validatePrepare prepareValidator)
 
 // makeCommitApplier constructs an instance of commitApplier using the
 // supplied abstractions.
-func makeCommitApplier(collectCommitment commitmentCollector) commitApplier {
+func makeCommitApplier(recordCommitment commitmentRecorder, collectCommitment commitmentCollector) commitApplier {
 	return func(commit messages.Commit, active bool) error {
 		replicaID := commit.ReplicaID()
 		prepare := commit.Prepare()
 
+		recordCommitment(commit)
+
 		if err := collectCommitment(replicaID, prepare); err != nil {
 			return fmt.Errorf("Commit cannot be taken into account: %s", err)
 		}
@@ -99,7 +122,7 @@ func makeCommitApplier(collectCommitment commitmentCollector) commitApplier {
 
 // makeCommitmentCollector constructs an instance of
 // commitmentCollector using the supplied abstractions.
-func makeCommitmentCollector(countCommitment commitmentCounter, retireSeq requestSeqRetirer, pendingReq requestlist.List, stopReqTimer requestTimerStopper, executeRequest requestExecutor) commitmentCollector {
+func makeCommitmentCollector(countCommitment commitmentCounter, retireSeq requestSeqRetirer, pendingReq requestlist.List, stopReqTimer requestTimerStopper, executeRequest requestExecutor, publishCommitted committedRequestPublisher) commitmentCollector {
 	var lock sync.Mutex
 
 	return func(replicaID uint32, prepare messages.Prepare) error {
@@ -120,15 +143,20 @@ func makeCommitmentCollector(countCommitment commitmentCounter, retireSeq reques
 
 		pendingReq.Remove(request.ClientID())
 		stopReqTimer(request)
-		executeRequest(request)
+		rejection := prepare.Rejection()
+		if rejection == "" {
+			publishCommitted(prepare)
+		}
+		executeRequest(request, prepareInput(prepare), rejection)
 
 		return nil
 	}
 }
 
 // makeCommitmentCounter constructs an instance of commitmentCounter
-// given the number of tolerated faulty nodes.
-func makeCommitmentCounter(f uint32) commitmentCounter {
+// using the supplied membership history to get the number of
+// tolerated faulty nodes in each view.
+func makeCommitmentCounter(history membership.State) commitmentCounter {
 	// Replica ID -> committed
 	type replicasCommittedMap map[uint32]bool
 
@@ -136,6 +164,9 @@ func makeCommitmentCounter(f uint32) commitmentCounter {
 		// Current view number
 		view uint64
 
+		// Number of tolerated faulty nodes in the view
+		f = history.Membership(0).F
+
 		// UI counter of the first Prepare in the view
 		firstCV uint64 = 1
 
@@ -159,6 +190,7 @@ func makeCommitmentCounter(f uint32) commitmentCounter {
 			return false, nil
 		} else if prepareView > view {
 			view = prepareView
+			f = history.Membership(view).F
 			firstCV = prepareCV
 			lastDoneCV = 0
 			prepareStates = make(map[uint64]replicasCommittedMap)
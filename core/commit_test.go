@@ -29,6 +29,7 @@ import (
 
 	testifymock "github.com/stretchr/testify/mock"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
 	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
 	"github.com/hyperledger-labs/minbft/messages"
@@ -54,7 +55,7 @@ func TestMakeCommitValidator(t *testing.T) {
 		args := mock.MethodCalled("prepareValidator", prepare)
 		return args.Error(0)
 	}
-	validate := makeCommitValidator(verifyUI, validatePrepare)
+	validate := makeCommitValidator(staticMembership(n, (n-1)/2), verifyUI, validatePrepare)
 
 	request := messageImpl.NewRequest(0, rand.Uint64(), nil)
 	prepare := messageImpl.NewPrepare(primary, view, request)
@@ -89,11 +90,14 @@ func TestMakeCommitApplier(t *testing.T) {
 	mock := new(testifymock.Mock)
 	defer mock.AssertExpectations(t)
 
+	recordCommitment := func(msg messages.CertifiedMessage) {
+		mock.MethodCalled("commitmentRecorder", msg)
+	}
 	collectCommitment := func(id uint32, prepare messages.Prepare) error {
 		args := mock.MethodCalled("commitmentCollector", id, prepare)
 		return args.Error(0)
 	}
-	apply := makeCommitApplier(collectCommitment)
+	apply := makeCommitApplier(recordCommitment, collectCommitment)
 
 	n := randN()
 	view := randView()
@@ -104,6 +108,8 @@ func TestMakeCommitApplier(t *testing.T) {
 	prepare := messageImpl.NewPrepare(primary, view, request)
 	commit := messageImpl.NewCommit(id, prepare)
 
+	mock.On("commitmentRecorder", commit).Times(3)
+
 	mock.On("commitmentCollector", id, prepare).Return(fmt.Errorf("Error")).Once()
 	err := apply(commit, true)
 	assert.Error(t, err, "Failed to collect commitment")
@@ -135,11 +141,14 @@ func TestMakeCommitmentCollector(t *testing.T) {
 	stopReqTimer := func(request messages.Request) {
 		mock.MethodCalled("requestTimerStopper", request)
 	}
-	executeRequest := func(request messages.Request) {
-		mock.MethodCalled("requestExecutor", request)
+	executeRequest := func(request messages.Request, input api.ExecutionInput, rejection string) {
+		mock.MethodCalled("requestExecutor", request, input, rejection)
+	}
+	publishCommitted := func(prepare messages.Prepare) {
+		mock.MethodCalled("committedRequestPublisher", prepare)
 	}
 	pendingReq := mock_requestlist.NewMockList(ctrl)
-	collect := makeCommitmentCollector(countCommitment, retireSeq, pendingReq, stopReqTimer, executeRequest)
+	collect := makeCommitmentCollector(countCommitment, retireSeq, pendingReq, stopReqTimer, executeRequest, publishCommitted)
 
 	n := randN()
 	view := randView()
@@ -148,7 +157,10 @@ func TestMakeCommitmentCollector(t *testing.T) {
 	clientID := rand.Uint32()
 
 	request := messageImpl.NewRequest(clientID, rand.Uint64(), nil)
-	prepare := messageImpl.NewPrepare(primary, view, request)
+	timestamp, seed := rand.Int63(), make([]byte, inputSeedSize)
+	rand.Read(seed)
+	prepare := messageImpl.NewPrepareWithInput(primary, view, request, timestamp, seed)
+	input := api.ExecutionInput{Timestamp: time.Unix(0, timestamp), Seed: seed}
 
 	mock.On("commitmentCounter", id, prepare).Return(false, fmt.Errorf("Error")).Once()
 	err := collect(id, prepare)
@@ -167,7 +179,18 @@ func TestMakeCommitmentCollector(t *testing.T) {
 	mock.On("requestSeqRetirer", request).Return(true).Once()
 	pendingReq.EXPECT().Remove(clientID)
 	mock.On("requestTimerStopper", request).Once()
-	mock.On("requestExecutor", request).Once()
+	mock.On("committedRequestPublisher", prepare).Once()
+	mock.On("requestExecutor", request, input, "").Once()
+	err = collect(id, prepare)
+	assert.NoError(t, err)
+
+	rejection := "rejected"
+	prepare = messageImpl.NewRejectingPrepare(primary, view, request, timestamp, seed, rejection)
+	mock.On("commitmentCounter", id, prepare).Return(true, nil).Once()
+	mock.On("requestSeqRetirer", request).Return(true).Once()
+	pendingReq.EXPECT().Remove(clientID)
+	mock.On("requestTimerStopper", request).Once()
+	mock.On("requestExecutor", request, input, rejection).Once()
 	err = collect(id, prepare)
 	assert.NoError(t, err)
 }
@@ -186,12 +209,16 @@ func TestMakeCommitmentCollectorConcurrent(t *testing.T) {
 	retireSeq := makeRequestSeqRetirer(clientStates)
 	pendingReqs := requestlist.New()
 	stopReqTimer := makeRequestTimerStopper(clientStates)
-	countCommitment := makeCommitmentCounter(nrFaulty)
-	executeRequest := func(req messages.Request) {
+	countCommitment := makeCommitmentCounter(staticMembership(2*nrFaulty+1, nrFaulty))
+	executeRequest := func(req messages.Request, input api.ExecutionInput, rejection string) {
 		time.Sleep(time.Millisecond)
 		executedReqs = append(executedReqs, req)
 	}
-	collect := makeCommitmentCollector(countCommitment, retireSeq, pendingReqs, stopReqTimer, executeRequest)
+	var publishedPrepares []messages.Prepare
+	publishCommitted := func(prepare messages.Prepare) {
+		publishedPrepares = append(publishedPrepares, prepare)
+	}
+	collect := makeCommitmentCollector(countCommitment, retireSeq, pendingReqs, stopReqTimer, executeRequest, publishCommitted)
 
 	wg := new(sync.WaitGroup)
 	for id := 0; id < nrReplicas; id++ {
@@ -230,6 +257,10 @@ func TestMakeCommitmentCollectorConcurrent(t *testing.T) {
 	for i, req := range executedReqs {
 		assert.Equal(t, uint64(i+1), req.Sequence())
 	}
+	require.Len(t, publishedPrepares, len(executedReqs))
+	for i, prep := range publishedPrepares {
+		assert.Equal(t, executedReqs[i], prep.Request())
+	}
 }
 
 func TestMakeCommitmentCounter(t *testing.T) {
@@ -366,7 +397,7 @@ func TestMakeCommitmentCounter(t *testing.T) {
 
 	for f, caseList := range cases {
 		n := 2*f + 1
-		counter := makeCommitmentCounter(uint32(f))
+		counter := makeCommitmentCounter(staticMembership(uint32(n), uint32(f)))
 		for _, c := range caseList {
 			desc := fmt.Sprintf("f=%d: %s", f, c.desc)
 			v := c.view
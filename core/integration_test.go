@@ -19,22 +19,23 @@ package minbft_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"math/rand"
+	"sync"
 	"testing"
-	"text/template"
 	"time"
 
 	"github.com/hyperledger-labs/minbft/api"
 	cl "github.com/hyperledger-labs/minbft/client"
 	minbft "github.com/hyperledger-labs/minbft/core"
 	authen "github.com/hyperledger-labs/minbft/sample/authentication"
-	"github.com/hyperledger-labs/minbft/sample/config"
-	"github.com/hyperledger-labs/minbft/sample/conn/common/replicastub"
-	dummyConnector "github.com/hyperledger-labs/minbft/sample/conn/dummy/connector"
 	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+	"github.com/hyperledger-labs/minbft/testing/cluster"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -43,156 +44,177 @@ const (
 	waitDuration = 200 * time.Millisecond
 )
 
-type testReplicaStack struct {
-	api.ReplicaConnector
-	api.Authenticator
-	*requestconsumer.SimpleLedger
-}
+var testRequestMessage = []byte("test request message")
 
-type testClientStack struct {
-	api.ReplicaConnector
-	api.Authenticator
-}
+const usigEnclaveFile = "../usig/sgx/enclave/libusig.signed.so"
 
-var (
-	replicas      []api.Replica
-	replicaStacks []*testReplicaStack
+// SGX USIG is used unless software USIG is requested, e.g.
+// "go test -args -soft-usig"
+var softUSIG = flag.Bool("soft-usig", false, "run integration tests with software USIG instead of SGX USIG")
 
-	clients      []cl.Client
-	clientStacks []*testClientStack
+func newTestCluster(t *testing.T, n, m int, newConsumer cluster.ConsumerFactory, opts ...cluster.Option) *cluster.Cluster {
+	if !*softUSIG {
+		opts = append(opts, cluster.WithSGXUSIG(usigEnclaveFile))
+	}
 
-	replicaStubs []replicastub.ReplicaStub
+	c, err := cluster.New(n, m, newConsumer, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, c.Close()) })
 
-	testRequestMessage = []byte("test request message")
-)
+	return c
+}
 
-const cfgTemplate = `
-protocol:
-  "n": {{.N}}
-  f: {{getF .N}}
-  checkpointPeriod: 10
-  logsize: 20
-  timeout:
-    request: 2s
-    viewchange: 3s
-`
+// execute requests execution of the operation and requires it to be
+// executed successfully. It returns the result of execution.
+func execute(t *testing.T, client cl.Client, operation []byte) []byte {
+	out := <-client.Execute(operation)
+	require.NoError(t, out.Err)
+	return out.Result
+}
 
-const usigEnclaveFile = "../usig/sgx/enclave/libusig.signed.so"
+func testAcceptOneRequest(t *testing.T, c *cluster.Cluster) {
+	client := c.Client(testClientID)
+	execute(t, client, testRequestMessage)
 
-// createTestnetCfgFiles create config file and keystore files for `numReplica`
-// replicas and 1 client
-func createTestnetCfg(numReplica int, numClient int) ([]byte, []byte) {
-	var err error
-	var testCfg bytes.Buffer
-	var testKeys bytes.Buffer
+	// Wait for all replicas to finish request processing; client
+	// waits only for f+1 replies
+	time.Sleep(waitDuration)
 
-	t := template.New("cfgTemplate")
-	t = t.Funcs(template.FuncMap{
-		"getF": func(n int) int { return (n - 1) / 2 },
-	})
-	t = template.Must(t.Parse(cfgTemplate))
-	if err = t.Execute(&testCfg, struct{ N int }{numReplica}); err != nil {
-		panic(err)
+	for _, r := range c.Replicas() {
+		ledger := r.Consumer().(*requestconsumer.SimpleLedger)
+		assert.Equal(t, uint64(1), ledger.GetLength())
 	}
+}
 
-	const testKeySpec = "ECDSA"
-	if err = authen.GenerateTestnetKeys(&testKeys, &authen.TestnetKeyOpts{
-		NumberReplicas:  numReplica,
-		ReplicaKeySpec:  testKeySpec,
-		ReplicaSecParam: 256,
-		NumberClients:   numClient,
-		ClientKeySpec:   testKeySpec,
-		ClientSecParam:  256,
-		UsigEnclaveFile: usigEnclaveFile,
-	}); err != nil {
-		log.Fatalf("Failed to generate testnet keys: %v", err)
+func testConcurrentExecution(t *testing.T, c *cluster.Cluster) {
+	const nrRequests = 20
+
+	var wg sync.WaitGroup
+	for _, client := range c.Clients() {
+		wg.Add(1)
+		go func(client cl.Client) {
+			defer wg.Done()
+			for i := 0; i < nrRequests; i++ {
+				op := &requestconsumer.KVOperation{
+					Op:    requestconsumer.KVPut,
+					Key:   fmt.Sprintf("key%d", rand.Intn(3)),
+					Value: []byte(fmt.Sprint(i)),
+				}
+				switch rand.Intn(4) {
+				case 0:
+					op.Op = requestconsumer.KVGet
+				case 1:
+					op.Op = requestconsumer.KVRange
+				}
+				opJSON, err := json.Marshal(op)
+				require.NoError(t, err)
+				<-client.Execute(opJSON) // may fail, e.g. missing key
+			}
+		}(client)
 	}
+	wg.Wait()
 
-	return testCfg.Bytes(), testKeys.Bytes()
-}
+	// Wait for all replicas to finish request processing
+	time.Sleep(waitDuration)
 
-func resetFixture() {
-	replicas = nil
-	replicaStacks = nil
-	clients = nil
-	clientStacks = nil
-	replicaStubs = nil
+	digest := c.Replica(0).Consumer().StateDigest()
+	for _, r := range c.Replicas() {
+		assert.Equal(t, digest, r.Consumer().StateDigest(), "replica %d", r.ID())
+	}
 }
 
-func initTestnetPeers(numReplica int, numClient int) {
-	resetFixture()
+func testInvalidOperation(t *testing.T, c *cluster.Cluster) {
+	f := c.Config().F()
+	client := c.Client(testClientID)
 
-	// generate config, keys
-	testCfg, testKeys := createTestnetCfg(numReplica, numClient)
+	cert := <-client.RequestCertified([]byte("malformed"))
+	assert.NotEmpty(t, cert.Rejection)
+	assert.Empty(t, cert.Result)
+	assert.NoError(t, cl.VerifyReplyCertificate(cert, f, c.Replica(0).Authenticator()))
 
-	cfg := config.New() // configer shared by all replicas
-	err := cfg.ReadConfig(bytes.NewBuffer(testCfg), "yaml")
-	if err != nil {
-		panic(err)
-	}
+	// Subsequent requests are not affected
+	out := <-client.Execute([]byte(`{"op":"get","key":"key0"}`))
+	assert.NoError(t, out.Err)
+}
 
-	// replica stubs
-	for i := 0; i < numReplica; i++ {
-		replicaStubs = append(replicaStubs, replicastub.New())
-	}
+func testCommitFeed(t *testing.T, c *cluster.Cluster) {
+	const nrRequests = 3
 
-	// replicas
-	for i := 0; i < numReplica; i++ {
-		id := uint32(i)
-		sigAuth, _ := authen.NewWithSGXUSIG([]api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}, id, bytes.NewBuffer(testKeys), usigEnclaveFile)
-		ledger := requestconsumer.NewSimpleLedger()
-		conn := newReplicaSideConnector(id)
-		stack := &testReplicaStack{conn, sigAuth, ledger}
-		replicaStacks = append(replicaStacks, stack)
+	done := make(chan struct{})
+	defer close(done)
 
-		replica, _ := minbft.New(id, cfg, stack)
-		replicas = append(replicas, replica)
-		replicaStubs[i].AssignReplica(replica)
+	var feeds []<-chan *api.CommittedOperation
+	for _, r := range c.Replicas() {
+		feed, err := r.Instance().SubscribeCommitted(0, done)
+		require.NoError(t, err)
+		feeds = append(feeds, feed)
 	}
 
-	// clients
-	for i := 0; i < numClient; i++ {
-		au, _ := authen.New([]api.AuthenticationRole{api.ClientAuthen}, testClientID, bytes.NewBuffer(testKeys))
-		conn := newClientSideConnector()
-		stack := &testClientStack{conn, au}
-		clientStacks = append(clientStacks, stack)
-
-		client, _ := cl.New(testClientID, cfg.N(), cfg.F(), stack)
-		clients = append(clients, client)
+	client := c.Client(testClientID)
+	for i := 0; i < nrRequests; i++ {
+		execute(t, client, []byte(fmt.Sprintf("feed request %d", i)))
 	}
-}
 
-func newReplicaSideConnector(replicaID uint32) api.ReplicaConnector {
-	conn := dummyConnector.NewReplicaSide()
-	for i, stub := range replicaStubs {
-		id := uint32(i)
-		if id == replicaID {
-			continue
+	verifier := c.Replica(0).Authenticator()
+	for _, feed := range feeds {
+		history := minbft.NewMembershipHistory(c.Config())
+		var first *api.CommittedOperation
+		for i := 0; i < nrRequests; {
+			var op *api.CommittedOperation
+			select {
+			case op = <-feed:
+			case <-time.After(time.Second):
+				require.FailNow(t, "no committed operation received")
+			}
+			assert.NoError(t, minbft.VerifyCommittedOperation(op, history, verifier))
+			require.NoError(t, history.Apply(op))
+
+			if first == nil {
+				if !bytes.HasPrefix(op.Operation, []byte("feed request")) {
+					continue // committed before
+				}
+				first = op
+			}
+			assert.Equal(t, first.Position+uint64(i), op.Position)
+			assert.Equal(t, []byte(fmt.Sprintf("feed request %d", i)), op.Operation)
+
+			tampered := *op
+			tampered.Operation = []byte("tampered")
+			assert.Error(t, minbft.VerifyCommittedOperation(&tampered, history, verifier))
+
+			incomplete := *op
+			incomplete.Certificate = op.Certificate[:1]
+			assert.Error(t, minbft.VerifyCommittedOperation(&incomplete, history, verifier))
+
+			i++
 		}
-		conn.AssignReplicaStub(id, stub)
 	}
-	return conn
 }
 
-func newClientSideConnector() api.ReplicaConnector {
-	conn := dummyConnector.NewClientSide()
-	for i, stub := range replicaStubs {
-		conn.AssignReplicaStub(uint32(i), stub)
-	}
-	return conn
-}
+func testReplyCertificate(t *testing.T, c *cluster.Cluster) {
+	f := c.Config().F()
+	verifier := c.Replica(0).Authenticator()
 
-func testAcceptOneRequest(t *testing.T) {
-	client := clients[0]
-	<-client.Request(testRequestMessage)
+	cert := <-c.Client(testClientID).RequestCertified([]byte("certified request"))
+	require.Len(t, cert.Replies, int(f)+1)
+	assert.NoError(t, cl.VerifyReplyCertificate(cert, f, verifier))
 
-	// Wait for all replicas to finish request processing; client
-	// waits only for f+1 replies
-	time.Sleep(waitDuration)
+	tampered := *cert
+	tampered.Result = []byte("tampered")
+	assert.Error(t, cl.VerifyReplyCertificate(&tampered, f, verifier))
 
-	for _, stack := range replicaStacks {
-		assert.Equal(t, uint64(1), stack.SimpleLedger.GetLength())
-	}
+	incomplete := *cert
+	incomplete.Replies = cert.Replies[:f]
+	assert.Error(t, cl.VerifyReplyCertificate(&incomplete, f, verifier))
+
+	duplicated := *cert
+	duplicated.Replies = append(cert.Replies[:f:f], cert.Replies[0])
+	assert.Error(t, cl.VerifyReplyCertificate(&duplicated, f, verifier))
+
+	mislabeled := *cert
+	mislabeled.Replies = append([]cl.SignedReply(nil), cert.Replies...)
+	mislabeled.Replies[0].ReplicaID = c.Config().N()
+	assert.Error(t, cl.VerifyReplyCertificate(&mislabeled, f, verifier))
 }
 
 func TestIntegration(t *testing.T) {
@@ -205,8 +227,293 @@ func TestIntegration(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		// setup
-		initTestnetPeers(tc.numReplica, tc.numClient)
+		c := newTestCluster(t, tc.numReplica, tc.numClient, nil)
+
+		t.Run(fmt.Sprintf("TestnetAcceptOneRequest/r=%d/c=%d", tc.numReplica, tc.numClient), func(t *testing.T) {
+			testAcceptOneRequest(t, c)
+		})
+		t.Run(fmt.Sprintf("CommitFeed/r=%d/c=%d", tc.numReplica, tc.numClient), func(t *testing.T) {
+			testCommitFeed(t, c)
+		})
+		t.Run(fmt.Sprintf("ReplyCertificate/r=%d/c=%d", tc.numReplica, tc.numClient), func(t *testing.T) {
+			testReplyCertificate(t, c)
+		})
+	}
+
+	newKVStore := func(uint32) api.RequestConsumer { return requestconsumer.NewKVStore() }
+	c := newTestCluster(t, 3, 3, newKVStore)
+	t.Run("ConcurrentExecution", func(t *testing.T) {
+		testConcurrentExecution(t, c)
+	})
+	t.Run("InvalidOperation", func(t *testing.T) {
+		testInvalidOperation(t, c)
+	})
+}
+
+// requestReconfiguration submits the reconfiguration signed by
+// operator 0 through the client and returns the result, or the
+// error the reconfiguration failed with.
+func requestReconfiguration(t *testing.T, c *cluster.Cluster, client cl.Client, rc *api.Reconfiguration) (*minbft.ReconfigurationResult, error) {
+	operator, err := authen.New([]api.AuthenticationRole{api.OperatorAuthen}, 0, bytes.NewBuffer(c.Keystore()))
+	require.NoError(t, err)
+	tag, err := operator.GenerateMessageAuthenTag(api.OperatorAuthen, minbft.ReconfigurationAuthenBytes(rc))
+	require.NoError(t, err)
+	out := <-client.Reconfigure(minbft.MakeReconfigurationOperation(rc, 0, tag))
+	if out.Err != nil {
+		return nil, out.Err
+	}
+	res, err := minbft.ParseReconfigurationResult(out.Result)
+	require.NoError(t, err)
+	return res, nil
+}
+
+func TestPlannedViewChange(t *testing.T) {
+	c := newTestCluster(t, 3, 1, nil)
+	client := c.Client(testClientID)
 
-		t.Run(fmt.Sprintf("TestnetAcceptOneRequest/r=%d/c=%d", tc.numReplica, tc.numClient), testAcceptOneRequest)
+	execute(t, client, []byte("before view change"))
+
+	// Reconfiguration keeping the membership hands over the leadership
+	res, err := requestReconfiguration(t, c, client, &api.Reconfiguration{Epoch: 0, F: 1})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), res.Epoch)
+
+	execute(t, client, []byte("after view change"))
+	time.Sleep(waitDuration)
+
+	for _, r := range c.Replicas() {
+		status := r.Instance().Status()
+		assert.Equal(t, uint64(1), status.CurrentView, "replica %d", r.ID())
+		assert.Equal(t, uint32(1), status.Primary, "replica %d", r.ID())
+		assert.Equal(t, []uint32{0, 1, 2}, status.Members, "replica %d", r.ID())
+
+		ledger := r.Consumer().(*requestconsumer.SimpleLedger)
+		assert.Equal(t, uint64(2), ledger.GetLength(), "replica %d", r.ID())
 	}
 }
+
+func TestReconfiguration(t *testing.T) {
+	c := newTestCluster(t, 3, 1, nil, cluster.WithSpareReplicas(1))
+	client := c.Client(testClientID)
+
+	execute(t, client, []byte("before reconfiguration"))
+
+	_, err := c.StartReplica(3)
+	require.NoError(t, err)
+
+	checkView := func(view uint64) {
+		time.Sleep(waitDuration)
+		for _, r := range c.Replicas() {
+			status := r.Instance().Status()
+			assert.Equal(t, view, status.CurrentView, "replica %d", r.ID())
+			assert.Equal(t, uint64(1), status.Epoch, "replica %d", r.ID())
+			assert.Equal(t, []uint32{1, 2, 3}, status.Members, "replica %d", r.ID())
+		}
+	}
+
+	// Replace replica 0 with replica 3
+	rc := &api.Reconfiguration{
+		Epoch:  0,
+		Remove: []uint32{0},
+		Add:    []api.ReplicaInfo{{ID: 3}},
+		F:      1,
+	}
+	res, err := requestReconfiguration(t, c, client, rc)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), res.Epoch)
+	checkView(1)
+
+	// Replayed reconfiguration is rejected without effect
+	_, err = requestReconfiguration(t, c, client, rc)
+	require.IsType(t, &cl.RejectionError{}, err)
+	checkView(1)
+
+	// Replicas 2 and 3 make a quorum in the new membership,
+	// whereas the removed replica takes no part any more
+	c.Replica(1).Disconnect()
+	assert.NotEmpty(t, execute(t, client, []byte("after reconfiguration")))
+	c.Replica(1).Reconnect()
+	checkView(1)
+	for _, r := range c.Replicas() {
+		executed := uint64(2)
+		if r.ID() == 0 {
+			executed = 1
+		}
+		ledger := r.Consumer().(*requestconsumer.SimpleLedger)
+		assert.Equal(t, executed, ledger.GetLength(), "replica %d", r.ID())
+	}
+
+	// Committed operations verify against the membership
+	// history replayed from the feed, but not against the
+	// initial configuration
+	done := make(chan struct{})
+	defer close(done)
+	feed, err := c.Replica(2).Instance().SubscribeCommitted(0, done)
+	require.NoError(t, err)
+	verifier := c.Replica(0).Authenticator()
+	history := minbft.NewMembershipHistory(c.Config())
+	static := minbft.NewMembershipHistory(c.Config())
+	for {
+		var op *api.CommittedOperation
+		select {
+		case op = <-feed:
+		case <-time.After(time.Second):
+			require.FailNow(t, "no committed operation received")
+		}
+		require.NoError(t, minbft.VerifyCommittedOperation(op, history, verifier))
+		require.NoError(t, history.Apply(op))
+		if bytes.Equal(op.Operation, []byte("after reconfiguration")) {
+			assert.Error(t, minbft.VerifyCommittedOperation(op, static, verifier))
+			break
+		}
+	}
+}
+
+func TestAdmissionDisagreement(t *testing.T) {
+	strict := minbft.WithAdmissionPolicy(minbft.AdmissionPolicy{MaxOperationSize: 4})
+	largeOperation := []byte("large operation")
+
+	checkReplicas := func(t *testing.T, c *cluster.Cluster, executed uint64) {
+		time.Sleep(waitDuration)
+		for _, r := range c.Replicas() {
+			assert.Equal(t, uint64(0), r.Instance().Status().CurrentView, "replica %d", r.ID())
+			ledger := r.Consumer().(*requestconsumer.SimpleLedger)
+			assert.Equal(t, executed, ledger.GetLength(), "replica %d", r.ID())
+		}
+	}
+
+	t.Run("PermissivePrimary", func(t *testing.T) {
+		c := newTestCluster(t, 3, 1, nil,
+			cluster.WithReplicaOptionsOf(1, strict),
+			cluster.WithReplicaOptionsOf(2, strict))
+
+		out := <-c.Client(testClientID).Execute(largeOperation)
+		assert.NoError(t, out.Err)
+		checkReplicas(t, c, 1)
+	})
+
+	t.Run("StrictPrimary", func(t *testing.T) {
+		c := newTestCluster(t, 3, 1, nil, cluster.WithReplicaOptionsOf(0, strict))
+		f := c.Config().F()
+		client := c.Client(testClientID)
+
+		cert := <-client.RequestCertified(largeOperation)
+		require.IsType(t, &cl.RejectionError{}, cert.Err())
+		assert.NoError(t, cl.VerifyReplyCertificate(cert, f, c.Replica(0).Authenticator()))
+		checkReplicas(t, c, 0)
+
+		out := <-client.Execute([]byte("op"))
+		assert.NoError(t, out.Err)
+		checkReplicas(t, c, 1)
+	})
+}
+
+func TestExecutionStatus(t *testing.T) {
+	newConsumer := func(uint32) api.RequestConsumer {
+		return &statusLedger{requestconsumer.NewSimpleLedger()}
+	}
+	c := newTestCluster(t, 3, 1, newConsumer)
+	f := c.Config().F()
+	client := c.Client(testClientID)
+
+	out := <-client.Execute([]byte("success"))
+	require.NoError(t, out.Err)
+	assert.NotEmpty(t, out.Result)
+
+	cert := <-client.RequestCertified([]byte("fail"))
+	assert.Equal(t, "operation failed", cert.ExecutionError)
+	assert.NoError(t, cl.VerifyReplyCertificate(cert, f, c.Replica(0).Authenticator()))
+
+	tampered := *cert
+	tampered.ExecutionError = ""
+	assert.Error(t, cl.VerifyReplyCertificate(&tampered, f, c.Replica(0).Authenticator()))
+
+	out = <-client.Execute([]byte("fail"))
+	require.IsType(t, &cl.ExecutionError{}, out.Err)
+	assert.Equal(t, "operation failed", out.Err.Error())
+
+	_, ok := <-client.Request([]byte("fail"))
+	assert.False(t, ok)
+}
+
+func TestKVStoreExecutionError(t *testing.T) {
+	// Operations are not validated before ordering
+	newConsumer := func(uint32) api.RequestConsumer {
+		kv := requestconsumer.NewKVStore()
+		return &struct {
+			api.RequestConsumer
+			api.StatusConsumer
+		}{kv, kv}
+	}
+	c := newTestCluster(t, 3, 1, newConsumer)
+	client := c.Client(testClientID)
+
+	for op, msg := range map[string]string{
+		`{"op":"range","limit":-1}`: "invalid range limit: -1",
+		`{"op":"unknown"}`:          `unknown operation: "unknown"`,
+	} {
+		out := <-client.Execute([]byte(op))
+		require.IsType(t, &cl.ExecutionError{}, out.Err, "operation %s", op)
+		assert.Equal(t, msg, out.Err.Error(), "operation %s", op)
+	}
+
+	out := <-client.Execute([]byte(`{"op":"get","key":"a"}`))
+	assert.NoError(t, out.Err)
+}
+
+func TestClientBatching(t *testing.T) {
+	newConsumer := func(uint32) api.RequestConsumer {
+		return &statusLedger{requestconsumer.NewSimpleLedger()}
+	}
+	c := newTestCluster(t, 3, 1, newConsumer, cluster.WithClientOptions(cl.WithBatching(waitDuration, 0)))
+	client := c.Client(testClientID)
+
+	ops := []string{"op1", "fail", "op3"}
+	outChans := make([]<-chan cl.Outcome, len(ops))
+	for i, op := range ops {
+		outChans[i] = client.Execute([]byte(op))
+	}
+
+	var results [][]byte
+	for i, ch := range outChans {
+		out := <-ch
+		if ops[i] == "fail" {
+			assert.IsType(t, &cl.ExecutionError{}, out.Err)
+			continue
+		}
+		require.NoError(t, out.Err, "operation %s", ops[i])
+		results = append(results, out.Result)
+	}
+
+	// Operations of a batch are executed in order with the same input
+	assert.Contains(t, string(results[0]), `"Height":1`)
+	assert.Contains(t, string(results[1]), `"Height":2`)
+	at := func(res []byte) string { return string(res[bytes.LastIndex(res, []byte(" at ")):]) }
+	assert.Equal(t, at(results[0]), at(results[1]))
+
+	time.Sleep(waitDuration)
+	for _, r := range c.Replicas() {
+		ledger := r.Consumer().(*statusLedger)
+		assert.Equal(t, uint64(2), ledger.GetLength(), "replica %d", r.ID())
+	}
+}
+
+// statusLedger reports execution of operation "fail" as failed.
+// Results of other operations include the timestamp supplied by the
+// primary, so that replicas agree on the result only if they agree on
+// the timestamp.
+type statusLedger struct {
+	*requestconsumer.SimpleLedger
+}
+
+func (l *statusLedger) DeliverWithStatus(op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+	resChan := make(chan api.ExecutionResult, 1)
+	if string(op) == "fail" {
+		resChan <- api.ExecutionResult{Error: fmt.Errorf("operation failed")}
+		return resChan
+	}
+
+	res := <-l.Deliver(op)
+	resChan <- api.ExecutionResult{Result: []byte(fmt.Sprintf("%s at %d", res, input.Timestamp.UnixNano()))}
+	return resChan
+}
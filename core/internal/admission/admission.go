@@ -0,0 +1,227 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission provides functionality to limit the load that
+// clients impose on the replica by rejecting excessive requests.
+package admission
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy specifies the limits on accepting requests from clients.
+// Zero value of a limit means no limit.
+//
+// ClientRate is the sustained number of requests per second accepted
+// from a single client. ClientBurst is the number of requests a
+// single client may submit at once in excess of the sustained rate;
+// it is at least one if the rate is limited.
+//
+// RejectionRate is the sustained number of rejections per second
+// issued to a single client, in addition to a burst of ClientBurst
+// rejections. Every rejection costs a UI and a round of the protocol,
+// so rejections in excess are delayed rather than issued at once.
+//
+// MaxInFlight is the number of requests accepted but not yet
+// executed, all clients together.
+//
+// MaxOperationSize is the size in bytes of the largest operation
+// accepted.
+type Policy struct {
+	ClientRate    float64
+	ClientBurst   int
+	RejectionRate float64
+
+	MaxInFlight int
+
+	MaxOperationSize int
+}
+
+// Controller decides whether to accept requests from clients. All
+// methods are safe to invoke concurrently.
+//
+// Admit checks a request from the specified client with the
+// specified sequence number and operation size against the policy,
+// given the number of requests currently in flight. It returns nil
+// if the request is accepted, or an error describing the exceeded
+// limit otherwise. A request with the sequence number not greater
+// than of one accepted before from the same client is always
+// accepted, e.g. retransmitted by the client, and it does not count
+// against the client's rate.
+//
+// Reject accounts a rejection issued to the specified client and
+// returns the time to wait before issuing it, so that rejections do
+// not exceed the rejection rate. The time is zero if the rejection
+// rate is not limited.
+type Controller interface {
+	Admit(clientID uint32, seq uint64, opSize, inFlight int) error
+	Reject(clientID uint32) time.Duration
+}
+
+// Option represents a parameter to initialize Controller with.
+type Option func(*options)
+
+type options struct {
+	now func() time.Time
+}
+
+var defaultOptions = options{
+	now: time.Now,
+}
+
+// WithClock specifies the function to obtain the current time
+// from. The standard time.Now is used by default.
+func WithClock(now func() time.Time) Option {
+	return func(opts *options) {
+		opts.now = now
+	}
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type client struct {
+	lastSeq uint64
+	bucket
+
+	rejections bucket
+}
+
+type controller struct {
+	sync.Mutex
+	Policy
+	options
+
+	clients map[uint32]*client
+}
+
+// New creates a new instance of Controller enforcing the supplied
+// policy. Optional arguments opts specify initialization parameters.
+func New(policy Policy, opts ...Option) Controller {
+	c := &controller{
+		Policy:  policy,
+		options: defaultOptions,
+		clients: make(map[uint32]*client),
+	}
+
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+
+	if c.ClientBurst < 1 {
+		c.ClientBurst = 1
+	}
+
+	return c
+}
+
+func (c *controller) Admit(clientID uint32, seq uint64, opSize, inFlight int) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cl, ok := c.clients[clientID]
+	if ok && seq <= cl.lastSeq {
+		return nil
+	}
+
+	if max := c.MaxOperationSize; max > 0 && opSize > max {
+		return fmt.Errorf("Operation size %d exceeds limit of %d bytes", opSize, max)
+	}
+
+	if max := c.MaxInFlight; max > 0 && inFlight >= max {
+		return fmt.Errorf("Too many requests in flight, limit is %d", max)
+	}
+
+	now := c.now()
+	if !ok {
+		cl = c.newClient(clientID, now)
+	}
+
+	if c.ClientRate > 0 {
+		if !cl.take(now, c.ClientRate, float64(c.ClientBurst)) {
+			return fmt.Errorf("Request rate exceeds limit of %g per second", c.ClientRate)
+		}
+	}
+
+	cl.lastSeq = seq
+
+	return nil
+}
+
+func (c *controller) Reject(clientID uint32) time.Duration {
+	if c.RejectionRate <= 0 {
+		return 0
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	cl, ok := c.clients[clientID]
+	if !ok {
+		cl = c.newClient(clientID, now)
+	}
+
+	return cl.rejections.reserve(now, c.RejectionRate, float64(c.ClientBurst))
+}
+
+func (c *controller) newClient(clientID uint32, now time.Time) *client {
+	cl := &client{
+		bucket:     bucket{float64(c.ClientBurst), now},
+		rejections: bucket{float64(c.ClientBurst), now},
+	}
+	c.clients[clientID] = cl
+	return cl
+}
+
+// refill refills the bucket at the specified rate up to its
+// capacity.
+func (b *bucket) refill(now time.Time, rate, capacity float64) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+		b.updated = now
+	}
+}
+
+// reserve refills the bucket at the specified rate up to its
+// capacity and takes a token from it, possibly in advance. It
+// returns the time until the taken token becomes available.
+func (b *bucket) reserve(now time.Time, rate, capacity float64) time.Duration {
+	b.refill(now, rate, capacity)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// take refills the bucket at the specified rate up to its capacity
+// and takes a token from it, if available.
+func (b *bucket) take(now time.Time, rate, capacity float64) bool {
+	b.refill(now, rate, capacity)
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmitUnlimited(t *testing.T) {
+	c := New(Policy{})
+
+	clientID := rand.Uint32()
+	for seq := uint64(1); seq <= 100; seq++ {
+		assert.NoError(t, c.Admit(clientID, seq, rand.Intn(1<<20), rand.Int()))
+	}
+}
+
+func TestAdmitOperationSize(t *testing.T) {
+	c := New(Policy{MaxOperationSize: 10})
+
+	clientID := rand.Uint32()
+	assert.NoError(t, c.Admit(clientID, 1, 10, 0))
+	assert.Error(t, c.Admit(clientID, 2, 11, 0))
+	assert.NoError(t, c.Admit(clientID, 2, 0, 0))
+}
+
+func TestAdmitInFlight(t *testing.T) {
+	c := New(Policy{MaxInFlight: 2})
+
+	clientID := rand.Uint32()
+	assert.NoError(t, c.Admit(clientID, 1, 0, 1))
+	assert.Error(t, c.Admit(clientID, 2, 0, 2))
+	assert.NoError(t, c.Admit(clientID, 2, 0, 1))
+
+	// Accepted before
+	assert.NoError(t, c.Admit(clientID, 2, 0, 2))
+}
+
+func TestAdmitRate(t *testing.T) {
+	now := time.Now()
+	c := New(Policy{ClientRate: 10, ClientBurst: 2}, WithClock(func() time.Time { return now }))
+
+	client1, client2 := uint32(1), uint32(2)
+
+	assert.NoError(t, c.Admit(client1, 1, 0, 0))
+	assert.NoError(t, c.Admit(client1, 2, 0, 0))
+	assert.Error(t, c.Admit(client1, 3, 0, 0))
+
+	// Retransmitted requests are accepted for free
+	assert.NoError(t, c.Admit(client1, 1, 0, 0))
+	assert.NoError(t, c.Admit(client1, 2, 0, 0))
+
+	// Other clients have their own allowance
+	assert.NoError(t, c.Admit(client2, 1, 0, 0))
+
+	now = now.Add(50 * time.Millisecond)
+	assert.Error(t, c.Admit(client1, 3, 0, 0))
+
+	now = now.Add(50 * time.Millisecond)
+	assert.NoError(t, c.Admit(client1, 3, 0, 0))
+	assert.Error(t, c.Admit(client1, 4, 0, 0))
+
+	// Allowance does not accumulate beyond burst
+	now = now.Add(time.Hour)
+	assert.NoError(t, c.Admit(client1, 4, 0, 0))
+	assert.NoError(t, c.Admit(client1, 5, 0, 0))
+	assert.Error(t, c.Admit(client1, 6, 0, 0))
+}
+
+func TestRejectRate(t *testing.T) {
+	now := time.Now()
+	c := New(Policy{RejectionRate: 10, ClientBurst: 2}, WithClock(func() time.Time { return now }))
+
+	client1, client2 := uint32(1), uint32(2)
+
+	assert.Zero(t, c.Reject(client1))
+	assert.Zero(t, c.Reject(client1))
+	assert.Equal(t, 100*time.Millisecond, c.Reject(client1))
+	assert.Equal(t, 200*time.Millisecond, c.Reject(client1))
+
+	// Other clients have their own allowance
+	assert.Zero(t, c.Reject(client2))
+
+	now = now.Add(200 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, c.Reject(client1))
+
+	// Allowance does not accumulate beyond burst
+	now = now.Add(time.Hour)
+	assert.Zero(t, c.Reject(client1))
+	assert.Zero(t, c.Reject(client1))
+	assert.Equal(t, 100*time.Millisecond, c.Reject(client1))
+
+	// Unlimited by default
+	c = New(Policy{ClientRate: 10})
+	for i := 0; i < 100; i++ {
+		assert.Zero(t, c.Reject(client1))
+	}
+}
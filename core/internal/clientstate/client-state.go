@@ -20,6 +20,7 @@
 package clientstate
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -34,24 +35,65 @@ type Provider func(clientID uint32) State
 // NewProvider creates an instance of Provider. Optional parameters
 // can be specified as opts.
 func NewProvider(requestTimeout func() time.Duration, prepareTimeout func() time.Duration, opts ...Option) Provider {
+	provider, _ := NewProviderWithLister(requestTimeout, prepareTimeout, opts...)
+	return provider
+}
+
+// Status represents the request identifiers recorded for a client,
+// see State.
+type Status struct {
+	ClientID        uint32
+	LastCapturedSeq uint64
+	LastPreparedSeq uint64
+	LastRetiredSeq  uint64
+}
+
+// Lister returns the status of each client that the associated
+// Provider has been invoked for, ordered by client ID. It is safe to
+// invoke concurrently.
+type Lister func() []Status
+
+// NewProviderWithLister creates an instance of Provider along with
+// the associated Lister. Optional parameters can be specified as
+// opts.
+func NewProviderWithLister(requestTimeout func() time.Duration, prepareTimeout func() time.Duration, opts ...Option) (Provider, Lister) {
 	var (
 		lock sync.Mutex
 		// Client ID -> client state
-		clientStates = make(map[uint32]State)
+		clientStates = make(map[uint32]*clientState)
 	)
 
-	return func(clientID uint32) State {
+	provider := func(clientID uint32) State {
 		lock.Lock()
 		defer lock.Unlock()
 
 		state := clientStates[clientID]
 		if state == nil {
-			state = New(requestTimeout, prepareTimeout, opts...)
+			state = New(requestTimeout, prepareTimeout, opts...).(*clientState)
 			clientStates[clientID] = state
 		}
 
 		return state
 	}
+
+	lister := func() []Status {
+		lock.Lock()
+		defer lock.Unlock()
+
+		list := make([]Status, 0, len(clientStates))
+		for clientID, state := range clientStates {
+			status := state.seqState.status()
+			status.ClientID = clientID
+			list = append(list, status)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].ClientID < list[j].ClientID
+		})
+
+		return list
+	}
+
+	return provider, lister
 }
 
 // State represents the state maintained by the replica for each
@@ -60,3 +60,22 @@ func TestProviderConcurrent(t *testing.T) {
 		}
 	}
 }
+
+func TestProviderLister(t *testing.T) {
+	provider, lister := NewProviderWithLister(defaultTimeout, defaultTimeout)
+
+	assert.Empty(t, lister())
+
+	state := provider(2)
+	new, release := state.CaptureRequestSeq(3)
+	assert.True(t, new)
+	release()
+	_, err := state.PrepareRequestSeq(3)
+	assert.NoError(t, err)
+	provider(1)
+
+	assert.Equal(t, []Status{
+		{ClientID: 1},
+		{ClientID: 2, LastCapturedSeq: 3, LastPreparedSeq: 3},
+	}, lister())
+}
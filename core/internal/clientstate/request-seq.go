@@ -110,3 +110,15 @@ func (s *seqState) RetireRequestSeq(seq uint64) (new bool, err error) {
 
 	return true, nil
 }
+
+// status returns the recorded request identifiers.
+func (s *seqState) status() Status {
+	s.Lock()
+	defer s.Unlock()
+
+	return Status{
+		LastCapturedSeq: s.lastCapturedSeq,
+		LastPreparedSeq: s.lastPreparedSeq,
+		LastRetiredSeq:  s.lastRetiredSeq,
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commitfeed provides functionality to maintain a history of
+// committed operations together with their commit certificates and
+// stream it to subscribers.
+package commitfeed
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+// Feed defines methods to collect commit certificates and stream
+// committed operations. All methods are safe to invoke concurrently.
+//
+// AddCommitment records a commitment on a prepared request, i.e. the
+// Prepare message itself or a Commit message. The message is assumed
+// to be valid and have a UI assigned.
+//
+// Commit appends the request prepared by the supplied Prepare message
+// to the history of committed operations. The commit certificate is
+// made up of the commitments recorded for the Prepare.
+//
+// Subscribe returns a channel to receive committed operations from
+// the specified position on, in the order of commit. If from is zero
+// then the operations are streamed from the oldest one retained. The
+// channel is closed once the done channel is closed or if the
+// subscriber falls behind the retained history. An error is returned
+// if the operation at the specified position is no longer retained.
+type Feed interface {
+	AddCommitment(msg messages.CertifiedMessage)
+	Commit(prepare messages.Prepare)
+	Subscribe(from uint64, done <-chan struct{}) (<-chan *api.CommittedOperation, error)
+}
+
+type prepareKey struct {
+	view uint64
+	cv   uint64 // primary UI counter
+}
+
+type commitments struct {
+	prepare messages.Prepare
+	commits map[uint32]messages.Commit
+}
+
+type feed struct {
+	sync.Mutex
+
+	retention int
+
+	// commitments on requests prepared but not yet committed
+	pending map[prepareKey]*commitments
+
+	// key of the last committed Prepare
+	lastCommitted prepareKey
+
+	// retained history of committed operations as a ring buffer;
+	// the operation at position p is stored at p % retention
+	entries []*api.CommittedOperation
+	first   uint64 // position of the first retained operation
+	last    uint64 // position of the last committed operation
+
+	// closed and replaced on each commit
+	notify chan struct{}
+}
+
+// New creates a new instance of Feed interface retaining the
+// specified number of the most recently committed operations.
+func New(retention int) Feed {
+	if retention < 0 {
+		retention = 0
+	}
+
+	return &feed{
+		retention: retention,
+		pending:   make(map[prepareKey]*commitments),
+		entries:   make([]*api.CommittedOperation, retention),
+		first:     1,
+		notify:    make(chan struct{}),
+	}
+}
+
+func (f *feed) AddCommitment(msg messages.CertifiedMessage) {
+	var prepare messages.Prepare
+	switch msg := msg.(type) {
+	case messages.Prepare:
+		prepare = msg
+	case messages.Commit:
+		prepare = msg.Prepare()
+	default:
+		panic("unexpected message type")
+	}
+
+	key := makePrepareKey(prepare)
+
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.lastCommitted.before(key) {
+		return // already committed
+	}
+
+	c := f.pending[key]
+	if c == nil {
+		c = &commitments{prepare, make(map[uint32]messages.Commit)}
+		f.pending[key] = c
+	}
+	if commit, ok := msg.(messages.Commit); ok {
+		c.commits[commit.ReplicaID()] = commit
+	}
+}
+
+func (f *feed) Commit(prepare messages.Prepare) {
+	key := makePrepareKey(prepare)
+
+	f.Lock()
+	defer f.Unlock()
+
+	entry, err := makeEntry(prepare, key, f.pending[key])
+	if err != nil {
+		panic(err)
+	}
+
+	f.lastCommitted = key
+	for k := range f.pending {
+		if !key.before(k) {
+			delete(f.pending, k)
+		}
+	}
+
+	f.last++
+	entry.Position = f.last
+	retention := uint64(f.retention)
+	if retention > 0 {
+		f.entries[f.last%retention] = entry
+	}
+	if f.last-f.first >= retention {
+		f.first = f.last - retention + 1
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *feed) Subscribe(from uint64, done <-chan struct{}) (<-chan *api.CommittedOperation, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if from == 0 {
+		from = f.first
+	} else if from < f.first {
+		return nil, fmt.Errorf("operation %d no longer retained", from)
+	}
+
+	out := make(chan *api.CommittedOperation)
+	go f.stream(from, out, done)
+
+	return out, nil
+}
+
+func (f *feed) stream(next uint64, out chan<- *api.CommittedOperation, done <-chan struct{}) {
+	defer close(out)
+
+	for {
+		f.Lock()
+		if next < f.first {
+			f.Unlock()
+			return // fell behind
+		}
+		if next <= f.last {
+			entry := f.entries[next%uint64(f.retention)]
+			f.Unlock()
+
+			select {
+			case out <- entry:
+				next++
+			case <-done:
+				return
+			}
+			continue
+		}
+		notify := f.notify
+		f.Unlock()
+
+		select {
+		case <-notify:
+		case <-done:
+			return
+		}
+	}
+}
+
+func makeEntry(prepare messages.Prepare, key prepareKey, c *commitments) (*api.CommittedOperation, error) {
+	prepareBytes, err := prepare.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Prepare: %s", err)
+	}
+	cert := [][]byte{prepareBytes}
+
+	if c != nil {
+		ids := make([]int, 0, len(c.commits))
+		for id := range c.commits {
+			ids = append(ids, int(id))
+		}
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			commitBytes, err := c.commits[uint32(id)].MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal Commit: %s", err)
+			}
+			cert = append(cert, commitBytes)
+		}
+	}
+
+	request := prepare.Request()
+
+	return &api.CommittedOperation{
+		View:        key.view,
+		UICounter:   key.cv,
+		ClientID:    request.ClientID(),
+		Seq:         request.Sequence(),
+		Kind:        request.Kind(),
+		Operation:   request.Operation(),
+		Certificate: cert,
+	}, nil
+}
+
+func makePrepareKey(prepare messages.Prepare) prepareKey {
+	ui := new(usig.UI)
+	if err := ui.UnmarshalBinary(prepare.UIBytes()); err != nil {
+		panic(err)
+	}
+
+	return prepareKey{prepare.View(), ui.Counter}
+}
+
+func (k prepareKey) before(other prepareKey) bool {
+	return k.view < other.view || (k.view == other.view && k.cv < other.cv)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commitfeed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+var messageImpl = protobufMessages.NewImpl()
+
+const waitDuration = 50 * time.Millisecond
+
+func TestFeed(t *testing.T) {
+	t.Run("Certificate", testCertificate)
+	t.Run("Subscribe", testSubscribe)
+	t.Run("Retention", testRetention)
+}
+
+func testCertificate(t *testing.T) {
+	f := New(10)
+
+	p1 := makePrepare(0, 1, 1)
+	p2 := makePrepare(0, 2, 2)
+	f.AddCommitment(p1)
+	f.AddCommitment(makeCommit(2, p1))
+	f.AddCommitment(makeCommit(1, p1))
+	f.AddCommitment(makeCommit(1, p1)) // duplicate
+	f.AddCommitment(makeCommit(1, p2))
+	f.Commit(p1)
+
+	// Late commitment is ignored
+	f.AddCommitment(makeCommit(3, p1))
+	f.Commit(p2)
+
+	ch, err := f.Subscribe(0, nil)
+	require.NoError(t, err)
+
+	op := receive(t, ch)
+	assert.Equal(t, uint64(1), op.Position)
+	assert.Equal(t, uint64(0), op.View)
+	assert.Equal(t, uint64(1), op.UICounter)
+	assert.Equal(t, uint32(0), op.ClientID)
+	assert.Equal(t, uint64(1), op.Seq)
+	assert.Equal(t, []byte("op1"), op.Operation)
+	assertCertificate(t, op, p1, 1, 2)
+
+	op = receive(t, ch)
+	assert.Equal(t, uint64(2), op.Position)
+	assert.Equal(t, uint64(2), op.UICounter)
+	assertCertificate(t, op, p2, 1)
+
+	// Commitments on Prepares superseded by committed ones are
+	// discarded
+	p3 := makePrepare(0, 3, 3)
+	p4 := makePrepare(0, 4, 4)
+	f.AddCommitment(makeCommit(1, p3))
+	f.AddCommitment(makeCommit(1, p4))
+	f.Commit(p4)
+	assert.Empty(t, f.(*feed).pending)
+}
+
+func testSubscribe(t *testing.T) {
+	f := New(10)
+
+	done := make(chan struct{})
+	ch, err := f.Subscribe(2, done)
+	require.NoError(t, err)
+
+	// Subscription from a future position
+	f.Commit(makePrepare(0, 1, 1))
+	assertNothing(t, ch)
+	f.Commit(makePrepare(0, 2, 2))
+	assert.Equal(t, uint64(2), receive(t, ch).Position)
+	f.Commit(makePrepare(0, 3, 3))
+	assert.Equal(t, uint64(3), receive(t, ch).Position)
+
+	// Resuming subscription
+	ch2, err := f.Subscribe(2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), receive(t, ch2).Position)
+	assert.Equal(t, uint64(3), receive(t, ch2).Position)
+
+	close(done)
+	_, more := <-ch
+	assert.False(t, more)
+}
+
+func testRetention(t *testing.T) {
+	f := New(2)
+
+	slow, err := f.Subscribe(1, nil)
+	require.NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		f.Commit(makePrepare(0, uint64(i), uint64(i)))
+	}
+
+	_, err = f.Subscribe(3, nil)
+	assert.Error(t, err)
+
+	ch, err := f.Subscribe(0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), receive(t, ch).Position)
+	assert.Equal(t, uint64(5), receive(t, ch).Position)
+
+	// Subscriber fell behind
+	for op := range slow {
+		assert.Equal(t, uint64(1), op.Position)
+	}
+
+	// History wraps around the retained entries
+	f.Commit(makePrepare(0, 6, 6))
+	ch, err = f.Subscribe(0, nil)
+	require.NoError(t, err)
+	for i := uint64(5); i <= 6; i++ {
+		op := receive(t, ch)
+		assert.Equal(t, i, op.Position)
+		assert.Equal(t, i, op.Seq)
+	}
+
+	// Nothing retained
+	f = New(0)
+	f.Commit(makePrepare(0, 1, 1))
+	_, err = f.Subscribe(1, nil)
+	assert.Error(t, err)
+}
+
+func makePrepare(view, cv, seq uint64) messages.Prepare {
+	request := messageImpl.NewRequest(0, seq, []byte(fmt.Sprintf("op%d", seq)))
+	prepare := messageImpl.NewPrepare(uint32(view), view, request)
+	uiBytes, err := (&usig.UI{Counter: cv}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	prepare.SetUIBytes(uiBytes)
+	return prepare
+}
+
+func makeCommit(id uint32, prepare messages.Prepare) messages.Commit {
+	commit := messageImpl.NewCommit(id, prepare)
+	commit.SetUIBytes([]byte{byte(id)})
+	return commit
+}
+
+func assertCertificate(t *testing.T, op *api.CommittedOperation, prepare messages.Prepare, commitIDs ...uint32) {
+	require.Len(t, op.Certificate, len(commitIDs)+1)
+
+	prepareBytes, err := prepare.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, prepareBytes, op.Certificate[0])
+
+	for i, id := range commitIDs {
+		commitBytes, err := makeCommit(id, prepare).MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, commitBytes, op.Certificate[i+1])
+	}
+}
+
+func receive(t *testing.T, ch <-chan *api.CommittedOperation) *api.CommittedOperation {
+	select {
+	case op, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return op
+	case <-time.After(time.Second):
+		require.Fail(t, "no operation received")
+		return nil
+	}
+}
+
+func assertNothing(t *testing.T, ch <-chan *api.CommittedOperation) {
+	select {
+	case op := <-ch:
+		assert.Fail(t, "unexpected operation", "position %d", op.Position)
+	case <-time.After(waitDuration):
+	}
+}
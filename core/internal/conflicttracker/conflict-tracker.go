@@ -0,0 +1,162 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conflicttracker provides functionality to order execution
+// of conflicting operations while letting non-conflicting operations
+// execute concurrently.
+package conflicttracker
+
+import (
+	"sync"
+)
+
+// Tracker keeps track of operations in execution and the keys they
+// access. All methods are safe to invoke concurrently.
+//
+// Acquire registers an operation reading and writing the specified
+// keys. If all is true, the operation is considered to access all
+// keys. Operations have to be acquired in the order of execution.
+// The returned channel is closed once all previously acquired
+// operations conflicting with this one are released; the operation
+// may then be executed. Two operations conflict if either of them
+// writes a key the other one reads or writes. The returned release
+// function has to be invoked once the execution is complete.
+type Tracker interface {
+	Acquire(reads, writes []string, all bool) (ready <-chan struct{}, release func())
+}
+
+type operation struct {
+	reads, writes []string
+	done          chan struct{}
+}
+
+type opSet map[*operation]struct{}
+
+type tracker struct {
+	sync.Mutex
+
+	// operations in execution
+	inflight opSet
+
+	// last operation accessing all keys, if in execution
+	barrier *operation
+
+	// last operation writing the key, if in execution
+	writers map[string]*operation
+
+	// operations reading the key after the last writer, if in
+	// execution
+	readers map[string]opSet
+}
+
+// New creates a new instance of Tracker interface.
+func New() Tracker {
+	return &tracker{
+		inflight: make(opSet),
+		writers:  make(map[string]*operation),
+		readers:  make(map[string]opSet),
+	}
+}
+
+func (t *tracker) Acquire(reads, writes []string, all bool) (ready <-chan struct{}, release func()) {
+	t.Lock()
+	defer t.Unlock()
+
+	op := &operation{done: make(chan struct{})}
+	deps := make(opSet)
+
+	if all {
+		// Operations after the barrier depend on it, and it
+		// depends on all operations in execution
+		for o := range t.inflight {
+			deps[o] = struct{}{}
+		}
+		t.barrier = op
+	} else {
+		op.reads, op.writes = reads, writes
+
+		if t.barrier != nil {
+			deps[t.barrier] = struct{}{}
+		}
+		for _, k := range reads {
+			if w := t.writers[k]; w != nil {
+				deps[w] = struct{}{}
+			}
+		}
+		for _, k := range writes {
+			if w := t.writers[k]; w != nil {
+				deps[w] = struct{}{}
+			}
+			for r := range t.readers[k] {
+				deps[r] = struct{}{}
+			}
+
+			// Later operations depend on the readers
+			// through this writer
+			t.writers[k] = op
+			delete(t.readers, k)
+		}
+		for _, k := range reads {
+			if t.readers[k] == nil {
+				t.readers[k] = make(opSet)
+			}
+			t.readers[k][op] = struct{}{}
+		}
+	}
+	t.inflight[op] = struct{}{}
+
+	return waitAll(deps), func() { t.release(op) }
+}
+
+func (t *tracker) release(op *operation) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.inflight, op)
+	if t.barrier == op {
+		t.barrier = nil
+	}
+	for _, k := range op.writes {
+		if t.writers[k] == op {
+			delete(t.writers, k)
+		}
+	}
+	for _, k := range op.reads {
+		if rs := t.readers[k]; rs != nil {
+			delete(rs, op)
+			if len(rs) == 0 {
+				delete(t.readers, k)
+			}
+		}
+	}
+
+	close(op.done)
+}
+
+func waitAll(ops opSet) <-chan struct{} {
+	ready := make(chan struct{})
+	if len(ops) == 0 {
+		close(ready)
+		return ready
+	}
+
+	go func() {
+		for o := range ops {
+			<-o.done
+		}
+		close(ready)
+	}()
+
+	return ready
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conflicttracker
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const waitDuration = 50 * time.Millisecond
+
+func TestAcquire(t *testing.T) {
+	tr := New()
+
+	w1Ready, w1Release := tr.Acquire(nil, []string{"a"}, false)
+	assertReady(t, w1Ready)
+
+	// Disjoint keys
+	w2Ready, w2Release := tr.Acquire([]string{"c"}, []string{"b"}, false)
+	assertReady(t, w2Ready)
+
+	// Readers wait for the writer, but not for each other
+	r1Ready, r1Release := tr.Acquire([]string{"a"}, nil, false)
+	r2Ready, r2Release := tr.Acquire([]string{"a", "c"}, nil, false)
+	assertNotReady(t, r1Ready)
+	assertNotReady(t, r2Ready)
+
+	// Writer waits for readers and the previous writer
+	w3Ready, w3Release := tr.Acquire(nil, []string{"a"}, false)
+	assertNotReady(t, w3Ready)
+
+	// Operation accessing all keys waits for all operations
+	allReady, allRelease := tr.Acquire(nil, nil, true)
+	assertNotReady(t, allReady)
+
+	// Any operation waits for the operation accessing all keys
+	r3Ready, r3Release := tr.Acquire([]string{"d"}, nil, false)
+	assertNotReady(t, r3Ready)
+
+	w1Release()
+	assertReady(t, r1Ready)
+	assertReady(t, r2Ready)
+	assertNotReady(t, w3Ready)
+
+	r1Release()
+	assertNotReady(t, w3Ready)
+	r2Release()
+	assertReady(t, w3Ready)
+	assertNotReady(t, allReady)
+
+	w3Release()
+	assertNotReady(t, allReady)
+	w2Release()
+	assertReady(t, allReady)
+	assertNotReady(t, r3Ready)
+
+	allRelease()
+	assertReady(t, r3Ready)
+	r3Release()
+
+	// Nothing is left in execution
+	ready, release := tr.Acquire(nil, []string{"a", "b", "c", "d"}, false)
+	assertReady(t, ready)
+	release()
+	ready, release = tr.Acquire(nil, nil, true)
+	assertReady(t, ready)
+	release()
+}
+
+func TestConcurrent(t *testing.T) {
+	const nrOps = 1000
+	keys := []string{"a", "b", "c", "d"}
+
+	tr := New()
+
+	// Each key is a counter; operation writing the key increments
+	// it. Operations reading the key check the counter is not
+	// modified during execution.
+	var lock sync.Mutex
+	counters := make(map[string]int)
+	get := func(k string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return counters[k]
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < nrOps; i++ {
+		var reads, writes []string
+		for _, k := range keys {
+			switch rand.Intn(4) {
+			case 0:
+				reads = append(reads, k)
+			case 1:
+				writes = append(writes, k)
+			}
+		}
+		all := rand.Intn(50) == 0
+
+		ready, release := tr.Acquire(reads, writes, all)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release()
+			<-ready
+
+			before := make(map[string]int)
+			for _, k := range reads {
+				before[k] = get(k)
+			}
+			for _, k := range writes {
+				v := get(k)
+				time.Sleep(time.Microsecond)
+				lock.Lock()
+				assert.Equal(t, v, counters[k], "concurrent write")
+				counters[k]++
+				lock.Unlock()
+			}
+			for _, k := range reads {
+				assert.Equal(t, before[k], get(k), "write during read")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func assertReady(t *testing.T, ready <-chan struct{}) {
+	select {
+	case <-ready:
+	case <-time.After(waitDuration):
+		assert.Fail(t, "operation not ready")
+	}
+}
+
+func assertNotReady(t *testing.T, ready <-chan struct{}) {
+	select {
+	case <-ready:
+		assert.Fail(t, "operation unexpectedly ready")
+	case <-time.After(waitDuration):
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package membership provides means to keep track of the set of
+// replicas running the consensus protocol in each view.
+//
+// A reconfiguration is ordered as a regular request. The view it is
+// prepared in is closed by the reconfiguration: no request can be
+// prepared in that view after the reconfiguration. Once the
+// reconfiguration is executed, the new membership takes effect from
+// the next view on.
+package membership
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// State defines operations on the membership history. All methods
+// are safe to invoke concurrently.
+//
+// Membership method returns the membership in the specified view.
+// The returned value must not be modified.
+//
+// Primary method returns the ID of the primary replica of the
+// specified view.
+//
+// IsMember method returns true if the replica with the specified ID
+// is a member in the specified view.
+//
+// Removed method returns true if the replica with the specified ID
+// has been a member before the specified view, but is not a member
+// in that view. Replica IDs are never reused, so a removed replica
+// never becomes a member again.
+//
+// Propose method synchronizes generating of Prepare messages by the
+// primary replica. It invokes the supplied prepare function, which
+// returns the UI counter assigned to the generated Prepare, unless
+// the view is already closed or the request identified by the client
+// ID and sequence number has already been proposed in the view. The
+// argument reconfig indicates if the request is a reconfiguration;
+// it closes the view then. The return value indicates if the prepare
+// function was invoked.
+//
+// Admit method checks if a Prepare message with the specified UI
+// counter can be accepted in the specified view. The argument
+// reconfig indicates if the prepared request is a reconfiguration;
+// the first one admitted closes the view. Once the view is closed,
+// only Prepare messages with lower UI counter are admitted.
+//
+// Check method checks if the reconfiguration can be applied to the
+// latest membership, as Reconfigure would do, without changing the
+// history. It returns an error describing the reason otherwise.
+//
+// Reconfigure method applies the executed reconfiguration to the
+// membership of the earliest view closed but not yet ended. The new
+// membership takes effect from the returned view, which follows the
+// closed one. If the reconfiguration is not valid then the
+// membership remains unchanged, but the closed view ends anyway; the
+// returned error describes the reason.
+type State interface {
+	Membership(view uint64) *api.Membership
+	Primary(view uint64) uint32
+	IsMember(view uint64, id uint32) bool
+	Removed(view uint64, id uint32) bool
+	Propose(view uint64, clientID uint32, seq uint64, reconfig bool, prepare func() (cv uint64)) bool
+	Admit(view uint64, cv uint64, reconfig bool) bool
+	Check(rc *api.Reconfiguration) error
+	Reconfigure(rc *api.Reconfiguration) (view uint64, m *api.Membership, err error)
+}
+
+// epoch represents a membership taking effect from a view on.
+type epoch struct {
+	firstView  uint64
+	membership *api.Membership
+}
+
+type state struct {
+	sync.RWMutex
+
+	// Epochs in the order of their first view
+	epochs []epoch
+
+	// IDs of all replicas that have ever been members
+	used map[uint32]bool
+
+	// View number -> UI counter of the reconfiguration, for views
+	// not ended before the latest epoch
+	closed map[uint64]uint64
+
+	// View and requests already proposed in it
+	proposedView uint64
+	proposed     map[uint32]uint64
+}
+
+// New creates a new instance of the membership history starting from
+// the initial membership.
+func New(initial *api.Membership) State {
+	s := &state{
+		used:     make(map[uint32]bool),
+		closed:   make(map[uint64]uint64),
+		proposed: make(map[uint32]uint64),
+	}
+
+	for _, r := range initial.Replicas {
+		s.used[r.ID] = true
+	}
+	s.epochs = append(s.epochs, epoch{0, initial})
+
+	return s
+}
+
+// Initial returns the initial membership of n replicas with IDs from
+// zero to n-1, tolerating f faulty replicas.
+func Initial(n, f uint32) *api.Membership {
+	m := &api.Membership{F: f}
+	for id := uint32(0); id < n; id++ {
+		m.Replicas = append(m.Replicas, api.ReplicaInfo{ID: id})
+	}
+	return m
+}
+
+func (s *state) Membership(view uint64) *api.Membership {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.membership(view)
+}
+
+func (s *state) membership(view uint64) *api.Membership {
+	for i := len(s.epochs) - 1; i >= 0; i-- {
+		if s.epochs[i].firstView <= view {
+			return s.epochs[i].membership
+		}
+	}
+	panic("No membership for view")
+}
+
+func (s *state) Primary(view uint64) uint32 {
+	replicas := s.Membership(view).Replicas
+	return replicas[view%uint64(len(replicas))].ID
+}
+
+func (s *state) IsMember(view uint64, id uint32) bool {
+	for _, r := range s.Membership(view).Replicas {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *state) Removed(view uint64, id uint32) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	wasMember := false
+	for _, e := range s.epochs {
+		if e.firstView > view {
+			break
+		}
+		isMember := false
+		for _, r := range e.membership.Replicas {
+			if r.ID == id {
+				isMember = true
+				break
+			}
+		}
+		if wasMember && !isMember {
+			return true
+		}
+		wasMember = isMember
+	}
+	return false
+}
+
+func (s *state) Propose(view uint64, clientID uint32, seq uint64, reconfig bool, prepare func() (cv uint64)) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, closed := s.closed[view]; closed {
+		return false
+	}
+
+	if view != s.proposedView {
+		s.proposedView = view
+		s.proposed = make(map[uint32]uint64)
+	}
+	if last, ok := s.proposed[clientID]; ok && last >= seq {
+		return false
+	}
+	s.proposed[clientID] = seq
+
+	cv := prepare()
+	if reconfig {
+		s.closed[view] = cv
+	}
+
+	return true
+}
+
+func (s *state) Admit(view uint64, cv uint64, reconfig bool) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	closingCV, closed := s.closed[view]
+	if !closed {
+		if reconfig {
+			s.closed[view] = cv
+		}
+		return true
+	}
+
+	if reconfig {
+		return cv == closingCV
+	}
+	return cv < closingCV
+}
+
+func (s *state) Check(rc *api.Reconfiguration) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, err := s.apply(s.epochs[len(s.epochs)-1].membership, rc)
+	return err
+}
+
+func (s *state) Reconfigure(rc *api.Reconfiguration) (view uint64, m *api.Membership, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	last := s.epochs[len(s.epochs)-1]
+
+	closedView, found := uint64(0), false
+	for v := range s.closed {
+		if v >= last.firstView && (!found || v < closedView) {
+			closedView, found = v, true
+		}
+	}
+	if !found {
+		panic("Reconfiguration executed in no closed view")
+	}
+
+	// Views before the closed one have ended and been left
+	for v := range s.closed {
+		if v < closedView {
+			delete(s.closed, v)
+		}
+	}
+
+	view = closedView + 1
+	m, err = s.apply(last.membership, rc)
+	if err != nil {
+		m = last.membership
+	} else {
+		for _, r := range rc.Add {
+			s.used[r.ID] = true
+		}
+	}
+	s.epochs = append(s.epochs, epoch{view, m})
+
+	return view, m, err
+}
+
+// apply returns the membership resulted from applying the
+// reconfiguration to the current one. It must be deterministic.
+func (s *state) apply(current *api.Membership, rc *api.Reconfiguration) (*api.Membership, error) {
+	if rc.Epoch != current.Epoch {
+		return nil, fmt.Errorf("Membership epoch %d is not current", rc.Epoch)
+	}
+
+	members := make(map[uint32]api.ReplicaInfo)
+	for _, r := range current.Replicas {
+		members[r.ID] = r
+	}
+
+	for _, id := range rc.Remove {
+		if _, ok := members[id]; !ok {
+			return nil, fmt.Errorf("Replica %d is not a member", id)
+		}
+		delete(members, id)
+	}
+
+	for _, r := range rc.Add {
+		if _, ok := members[r.ID]; ok || s.used[r.ID] {
+			return nil, fmt.Errorf("Replica ID %d already used", r.ID)
+		}
+		members[r.ID] = r
+	}
+
+	n := uint32(len(members))
+	if n < 2*rc.F+1 {
+		return nil, fmt.Errorf("%d replicas is not enough to tolerate %d faulty", n, rc.F)
+	}
+
+	m := &api.Membership{Epoch: current.Epoch + 1, F: rc.F}
+	for _, r := range members {
+		m.Replicas = append(m.Replicas, r)
+	}
+	sort.Slice(m.Replicas, func(i, j int) bool {
+		return m.Replicas[i].ID < m.Replicas[j].ID
+	})
+
+	return m, nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package membership
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+func TestInitial(t *testing.T) {
+	s := New(Initial(3, 1))
+
+	for view := uint64(0); view < 6; view++ {
+		assert.Equal(t, uint32(view%3), s.Primary(view))
+	}
+	assert.True(t, s.IsMember(5, 2))
+	assert.False(t, s.IsMember(5, 3))
+	assert.Equal(t, uint32(1), s.Membership(7).F)
+}
+
+func TestProposeAdmit(t *testing.T) {
+	s := New(Initial(3, 1))
+
+	cv := uint64(0)
+	prepare := func() uint64 {
+		cv++
+		return cv
+	}
+
+	assert.True(t, s.Propose(0, 1, 1, false, prepare))
+	assert.False(t, s.Propose(0, 1, 1, false, prepare), "duplicate")
+	assert.True(t, s.Propose(0, 1, 2, true, prepare))
+	assert.False(t, s.Propose(0, 2, 1, false, prepare), "view closed")
+	assert.Equal(t, uint64(2), cv)
+	assert.True(t, s.Propose(1, 1, 2, false, prepare), "new view")
+
+	assert.True(t, s.Admit(0, 1, false))
+	assert.True(t, s.Admit(0, 2, true))
+	assert.False(t, s.Admit(0, 3, false))
+	assert.False(t, s.Admit(0, 3, true))
+
+	assert.True(t, s.Admit(3, 5, true))
+	assert.True(t, s.Admit(3, 5, true), "same reconfiguration")
+	assert.True(t, s.Admit(3, 4, false))
+	assert.False(t, s.Admit(3, 6, false))
+}
+
+func TestReconfigure(t *testing.T) {
+	s := New(Initial(3, 1))
+
+	rc := &api.Reconfiguration{
+		Remove: []uint32{0},
+		Add:    []api.ReplicaInfo{{ID: 5, Address: ":8005"}, {ID: 3}},
+		F:      1,
+	}
+	require.NoError(t, s.Check(rc))
+	require.True(t, s.Admit(2, 1, true))
+	view, m, err := s.Reconfigure(rc)
+	require.NoError(t, err)
+	assert.Error(t, s.Check(rc))
+	assert.Equal(t, uint64(3), view)
+	assert.Equal(t, uint64(1), m.Epoch)
+	assert.Equal(t, []api.ReplicaInfo{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 5, Address: ":8005"}}, m.Replicas)
+
+	assert.Equal(t, uint32(2), s.Primary(2))
+	assert.Equal(t, uint32(5), s.Primary(3))
+	assert.True(t, s.IsMember(2, 0))
+	assert.False(t, s.IsMember(3, 0))
+	assert.True(t, s.IsMember(3, 5))
+	assert.False(t, s.Removed(2, 0))
+	assert.True(t, s.Removed(3, 0))
+	assert.False(t, s.Removed(2, 5), "not yet joined")
+	assert.False(t, s.Removed(3, 5))
+
+	cases := []struct {
+		desc string
+		rc   *api.Reconfiguration
+	}{{
+		desc: "Stale epoch",
+		rc:   &api.Reconfiguration{Epoch: 0, F: 1},
+	}, {
+		desc: "Unknown replica",
+		rc:   &api.Reconfiguration{Epoch: 1, Remove: []uint32{0}, F: 1},
+	}, {
+		desc: "Reused ID",
+		rc:   &api.Reconfiguration{Epoch: 1, Add: []api.ReplicaInfo{{ID: 0}}, F: 1},
+	}, {
+		desc: "Too few replicas",
+		rc:   &api.Reconfiguration{Epoch: 1, Remove: []uint32{1, 2}, F: 1},
+	}}
+	for i, c := range cases {
+		assert.Error(t, s.Check(c.rc), c.desc)
+
+		closed := uint64(4 + i)
+		require.True(t, s.Admit(closed, 1, true), c.desc)
+		view, m, err := s.Reconfigure(c.rc)
+		assert.Error(t, err, c.desc)
+		assert.Equal(t, closed+1, view, c.desc)
+		assert.Equal(t, uint64(1), m.Epoch, c.desc)
+	}
+	assert.Len(t, s.(*state).closed, 1, "Ended views pruned")
+
+	assert.Panics(t, func() { s.Reconfigure(&api.Reconfiguration{}) })
+}
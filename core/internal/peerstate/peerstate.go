@@ -17,6 +17,7 @@
 package peerstate
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/hyperledger-labs/minbft/usig"
@@ -29,24 +30,62 @@ type Provider func(replicaID uint32) State
 
 // NewProvider creates an instance of Provider
 func NewProvider() Provider {
+	provider, _ := NewProviderWithLister()
+	return provider
+}
+
+// Status represents the state of a peer replica: the counter of the
+// last captured and released UI.
+type Status struct {
+	ReplicaID uint32
+	LastCV    uint64
+}
+
+// Lister returns the status of each peer replica that the associated
+// Provider has been invoked for, ordered by replica ID. It is safe to
+// invoke concurrently.
+type Lister func() []Status
+
+// NewProviderWithLister creates an instance of Provider along with
+// the associated Lister.
+func NewProviderWithLister() (Provider, Lister) {
 	var (
 		lock sync.Mutex
 		// Replica ID -> replica state
-		peerStates = make(map[uint32]State)
+		peerStates = make(map[uint32]*peerState)
 	)
 
-	return func(replicaID uint32) State {
+	provider := func(replicaID uint32) State {
 		lock.Lock()
 		defer lock.Unlock()
 
 		state := peerStates[replicaID]
 		if state == nil {
-			state = New()
+			state = New().(*peerState)
 			peerStates[replicaID] = state
 		}
 
 		return state
 	}
+
+	lister := func() []Status {
+		lock.Lock()
+		defer lock.Unlock()
+
+		list := make([]Status, 0, len(peerStates))
+		for replicaID, state := range peerStates {
+			state.Lock()
+			list = append(list, Status{replicaID, state.lastReleasedCV})
+			state.Unlock()
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].ReplicaID < list[j].ReplicaID
+		})
+
+		return list
+	}
+
+	return provider, lister
 }
 
 // State represents the state maintained by the replica for each peer
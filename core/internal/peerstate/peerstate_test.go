@@ -135,3 +135,19 @@ func TestProviderConcurrent(t *testing.T) {
 		}
 	}
 }
+
+func TestProviderLister(t *testing.T) {
+	provider, lister := NewProviderWithLister()
+
+	assert.Empty(t, lister())
+
+	state := provider(2)
+	_, release := state.CaptureUI(&usig.UI{Counter: 1})
+	release()
+	_, release = state.CaptureUI(&usig.UI{Counter: 2})
+	provider(0)
+
+	assert.Equal(t, []Status{{0, 0}, {2, 1}}, lister())
+	release()
+	assert.Equal(t, []Status{{0, 0}, {2, 2}}, lister())
+}
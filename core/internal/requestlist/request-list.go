@@ -33,10 +33,13 @@ import (
 // the set, if any.
 //
 // All method returns all messages currently in the set.
+//
+// Len method returns the number of messages currently in the set.
 type List interface {
 	Add(req messages.Request)
 	Remove(clientID uint32)
 	All() []messages.Request
+	Len() int
 }
 
 type msgMap map[uint32]messages.Request
@@ -78,3 +81,10 @@ func (l *list) All() []messages.Request {
 
 	return all
 }
+
+func (l *list) Len() int {
+	l.RLock()
+	defer l.RUnlock()
+
+	return len(l.messages)
+}
@@ -64,6 +64,7 @@ func TestList(t *testing.T) {
 		}
 		msgs := l.All()
 		require.Len(t, msgs, len(c.List), assertMsg)
+		require.Equal(t, len(c.List), l.Len(), assertMsg)
 		for _, m := range msgs {
 			cid := int(m.ClientID())
 			seq := m.Sequence()
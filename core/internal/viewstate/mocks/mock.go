@@ -7,6 +7,7 @@ package mock_viewstate
 import (
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockState is a mock of State interface
@@ -63,6 +64,20 @@ func (mr *MockStateMockRecorder) AdvanceExpectedView(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdvanceExpectedView", reflect.TypeOf((*MockState)(nil).AdvanceExpectedView), arg0)
 }
 
+// AwaitView mocks base method
+func (m *MockState) AwaitView(arg0 uint64, arg1 time.Duration) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AwaitView", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// AwaitView indicates an expected call of AwaitView
+func (mr *MockStateMockRecorder) AwaitView(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AwaitView", reflect.TypeOf((*MockState)(nil).AwaitView), arg0, arg1)
+}
+
 // HoldView mocks base method
 func (m *MockState) HoldView() (uint64, uint64, func()) {
 	m.ctrl.T.Helper()
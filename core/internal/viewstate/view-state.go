@@ -23,7 +23,10 @@
 // active if current and expected view numbers match.
 package viewstate
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // State defines operations on view state. All methods are safe to
 // invoke concurrently.
@@ -47,10 +50,15 @@ import "sync"
 // until the returned release function is invoked. The return value
 // "active" indicates if the current and expected view numbers match,
 // i.e. the current view has become active.
+//
+// AwaitView method blocks until the current view number reaches the
+// supplied value, but no longer than the supplied timeout. It returns
+// true if the current view number has reached the supplied value.
 type State interface {
 	HoldView() (current, expected uint64, release func())
 	AdvanceExpectedView(view uint64) (ok bool, release func())
 	AdvanceCurrentView(view uint64) (ok, active bool, release func())
+	AwaitView(view uint64, timeout time.Duration) (reached bool)
 }
 
 type viewState struct {
@@ -58,11 +66,14 @@ type viewState struct {
 
 	currentView  uint64
 	expectedView uint64
+
+	// closed whenever the current view number increases
+	advanced chan struct{}
 }
 
 // New creates a new instance of the view state.
 func New() State {
-	return &viewState{}
+	return &viewState{advanced: make(chan struct{})}
 }
 
 func (s *viewState) HoldView() (current, expected uint64, release func()) {
@@ -93,6 +104,9 @@ func (s *viewState) AdvanceCurrentView(view uint64) (ok, active bool, release fu
 	if s.currentView < view {
 		s.currentView = view
 
+		close(s.advanced)
+		s.advanced = make(chan struct{})
+
 		if s.currentView == s.expectedView {
 			active = true
 		}
@@ -103,3 +117,29 @@ func (s *viewState) AdvanceCurrentView(view uint64) (ok, active bool, release fu
 	release()
 	return false, false, nil
 }
+
+func (s *viewState) AwaitView(view uint64, timeout time.Duration) (reached bool) {
+	var expired <-chan time.Time
+
+	s.RLock()
+	for s.currentView < view {
+		advanced := s.advanced
+		s.RUnlock()
+
+		if expired == nil {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+
+		select {
+		case <-advanced:
+		case <-expired:
+			return false
+		}
+		s.RLock()
+	}
+	s.RUnlock()
+
+	return true
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -160,3 +161,33 @@ func TestConcurrent(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestAwaitView(t *testing.T) {
+	s := New()
+
+	assert.True(t, s.AwaitView(0, 0)) // must not block
+	assert.False(t, s.AwaitView(1, 10*time.Millisecond))
+
+	done := make(chan struct{})
+	go func() {
+		assert.True(t, s.AwaitView(2, time.Minute))
+		close(done)
+	}()
+
+	for view := uint64(1); view <= 2; view++ {
+		select {
+		case <-done:
+			t.Fatalf("Returned in view %d", view-1)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		ok, release := s.AdvanceExpectedView(view)
+		require.True(t, ok)
+		release()
+		ok, _, release = s.AdvanceCurrentView(view)
+		require.True(t, ok)
+		release()
+	}
+
+	<-done
+}
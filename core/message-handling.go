@@ -18,15 +18,21 @@ package minbft
 
 import (
 	"fmt"
+	"io"
 	"sync"
+	"time"
 
 	logging "github.com/op/go-logging"
 
 	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/admission"
 	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
+	"github.com/hyperledger-labs/minbft/core/internal/commitfeed"
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
 	"github.com/hyperledger-labs/minbft/core/internal/messagelog"
 	"github.com/hyperledger-labs/minbft/core/internal/peerstate"
 	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
+	"github.com/hyperledger-labs/minbft/core/internal/timer"
 	"github.com/hyperledger-labs/minbft/core/internal/viewstate"
 	"github.com/hyperledger-labs/minbft/messages"
 )
@@ -142,10 +148,10 @@ type generatedMessageConsumer func(msg messages.ReplicaMessage)
 
 // defaultIncomingMessageHandler construct a standard
 // incomingMessageHandler using id as the current replica ID and the
-// supplied interfaces.
-func defaultIncomingMessageHandler(id uint32, log messagelog.MessageLog, config api.Configer, stack Stack, logger *logging.Logger) incomingMessageHandler {
-	n := config.N()
-	f := config.F()
+// supplied interfaces. It also returns an instance of
+// replicaStatusReporter to report the state it maintains.
+func defaultIncomingMessageHandler(id uint32, log messagelog.MessageLog, feed commitfeed.Feed, config api.Configer, stack Stack, observers []api.MembershipObserver, timerProvider timer.Provider, admissionPolicy admission.Policy, maxClockSkew, maxTimestampAge time.Duration, logger *logging.Logger) (incomingMessageHandler, replicaStatusReporter) {
+	initialMembership := membership.Initial(config.N(), config.F())
 
 	reqTimeout := makeRequestTimeoutProvider(config)
 	prepTimeout := makePrepareTimeoutProvider(config)
@@ -154,10 +160,13 @@ func defaultIncomingMessageHandler(id uint32, log messagelog.MessageLog, config
 	signMessage := makeMessageSigner(stack, messages.AuthenBytes)
 	verifyUI := makeUIVerifier(stack, messages.AuthenBytes)
 	assignUI := makeUIAssigner(stack, messages.AuthenBytes)
+	consumer := stackConsumer(stack)
 
-	clientStates := clientstate.NewProvider(reqTimeout, prepTimeout)
-	peerStates := peerstate.NewProvider()
+	clientStates, listClients := clientstate.NewProviderWithLister(reqTimeout, prepTimeout,
+		clientstate.WithTimerProvider(timerProvider))
+	peerStates, listPeers := peerstate.NewProviderWithLister()
 	viewState := viewstate.New()
+	history := membership.New(initialMembership)
 
 	captureSeq := makeRequestSeqCapturer(clientStates)
 	prepareSeq := makeRequestSeqPreparer(clientStates)
@@ -170,25 +179,38 @@ func defaultIncomingMessageHandler(id uint32, log messagelog.MessageLog, config
 
 	requestViewChange := makeViewChangeRequestor(id, viewState, handleGeneratedMessage)
 	handleReqTimeout := makeRequestTimeoutHandler(requestViewChange, logger)
+	handlePrimaryFault := makePrimaryFaultHandler(requestViewChange, logger)
 	startReqTimer := makeRequestTimerStarter(clientStates, handleReqTimeout, logger)
 	stopReqTimer := makeRequestTimerStopper(clientStates)
 	startPrepTimer := makePrepareTimerStarter(clientStates, logger)
 	stopPrepTimer := makePrepareTimerStopper(clientStates)
 
-	countCommitment := makeCommitmentCounter(f)
-	executeOperation := makeOperationExecutor(stack)
-	executeRequest := makeRequestExecutor(id, executeOperation, handleGeneratedMessage)
-	collectCommitment := makeCommitmentCollector(countCommitment, retireSeq, pendingReq, stopReqTimer, executeRequest)
+	validateOperation := makeReconfigurationOperationValidator(history, makeOperationValidator(consumer))
+	admitRequest := makeRequestAdmitter(validateOperation, admission.New(admissionPolicy), pendingReq, logger)
+	forwardRequest := makeRequestForwarder(initialMembership, stack, logger)
+	applyRequest := makeRequestApplier(id, history, admitRequest, makeInputGenerator(time.Now), handleGeneratedMessage, startReqTimer, startPrepTimer, forwardRequest)
+	supplyPeerMessages := makePeerMessageSupplier(log)
+	connectPeer := func(peerID uint32) error {
+		return startPeerConnection(makePeerConnector(peerID, stack), supplyPeerMessages)
+	}
+	switchMembership := makeMembershipSwitcher(id, initialMembership, observers, connectPeer, viewState, pendingReq, applyRequest, logger)
+
+	countCommitment := makeCommitmentCounter(history)
+	executeOperation := makeReconfigurationExecutor(history, switchMembership, makeBatchExecutor(makeOperationExecutor(consumer)), logger)
+	handleReply, lastExecuted := makeExecutionTracker(handleGeneratedMessage)
+	executeRequest := makeRequestExecutor(id, executeOperation, handleReply)
+	collectCommitment := makeCommitmentCollector(countCommitment, retireSeq, pendingReq, stopReqTimer, executeRequest, feed.Commit)
 
-	validateRequest := makeRequestValidator(verifyMessageSignature)
-	validatePrepare := makePrepareValidator(n, verifyUI, validateRequest)
-	validateCommit := makeCommitValidator(verifyUI, validatePrepare)
-	validateMessage := makeMessageValidator(validateRequest, validatePrepare, validateCommit)
+	validateRequest := makeBatchRequestValidator(makeReconfigurationRequestValidator(stack, makeRequestValidator(verifyMessageSignature)))
+	validateInput := makeInputValidator(time.Now, maxClockSkew)
+	validatePrepare := makePrepareValidator(history, verifyUI, validateRequest, validateInput)
+	validateCommit := makeCommitValidator(history, verifyUI, validatePrepare)
+	validateMessage := makeViewAwaitingValidator(viewState, makeViewChangeTimeoutProvider(config), makeMessageValidator(validateRequest, validatePrepare, validateCommit))
 
-	applyCommit := makeCommitApplier(collectCommitment)
-	applyPrepare := makePrepareApplier(id, prepareSeq, collectCommitment, handleGeneratedMessage, stopPrepTimer)
-	applyPeerMessage := makePeerMessageApplier(applyPrepare, applyCommit)
-	applyRequest := makeRequestApplier(id, n, handleGeneratedMessage, startReqTimer, startPrepTimer)
+	applyCommit := makeCommitApplier(feed.AddCommitment, collectCommitment)
+	checkInputAge := makeInputAgeChecker(time.Now, maxTimestampAge)
+	applyPrepare := makePrepareApplier(id, history, validateOperation, checkInputAge, handlePrimaryFault, prepareSeq, feed.AddCommitment, collectCommitment, handleGeneratedMessage, stopPrepTimer)
+	applyPeerMessage := makePeerMessageApplier(id, history, applyPrepare, applyCommit)
 
 	var processMessage messageProcessor
 
@@ -212,7 +234,9 @@ func defaultIncomingMessageHandler(id uint32, log messagelog.MessageLog, config
 	replyRequest := makeRequestReplier(clientStates)
 	replyMessage := makeMessageReplier(replyRequest)
 
-	return makeIncomingMessageHandler(validateMessage, processMessage, replyMessage)
+	reportStatus := makeReplicaStatusReporter(id, history, viewState, pendingReq, listClients, listPeers, lastExecuted)
+
+	return makeIncomingMessageHandler(validateMessage, processMessage, replyMessage), reportStatus
 }
 
 // makeMessageStreamHandler construct an instance of
@@ -301,6 +325,18 @@ func handleGeneratedPeerMessages(log messagelog.MessageLog, handle incomingMessa
 	}
 }
 
+// recordGeneratedMessages writes messages generated by the local
+// replica to the supplied stream in order. Recording stops if the
+// stream fails.
+func recordGeneratedMessages(log messagelog.MessageLog, w io.Writer, logger *logging.Logger) {
+	for msg := range log.Stream(nil) {
+		if err := messages.WriteMessage(w, msg); err != nil {
+			logger.Errorf("Failed to record generated message: %s", err)
+			return
+		}
+	}
+}
+
 // makePeerMessageSupplier construct a peerMessageSupplier using the
 // supplied message log.
 func makePeerMessageSupplier(log messagelog.MessageLog) peerMessageSupplier {
@@ -403,6 +439,10 @@ func makePeerMessageProcessor(processEmbedded embeddedMessageProcessor, processU
 		switch msg := msg.(type) {
 		case messages.CertifiedMessage:
 			return processUIMessage(msg)
+		case messages.ReqViewChange:
+			// Only own ReqViewChange messages get here since
+			// validation of those from peers is not implemented
+			return false, nil
 		default:
 			panic("Unknown message type")
 		}
@@ -491,9 +531,23 @@ func makeViewMessageProcessor(viewState viewstate.State, applyPeerMessage peerMe
 }
 
 // makePeerMessageApplier constructs an instance of peerMessageApplier using
-// the supplied abstractions.
-func makePeerMessageApplier(applyPrepare prepareApplier, applyCommit commitApplier) peerMessageApplier {
+// id as the current replica ID, the supplied membership history, and
+// the supplied abstractions. Once removed from the membership, the
+// replica ignores messages of further views, so that it neither
+// executes nor replies to any request ordered without it.
+func makePeerMessageApplier(id uint32, history membership.State, applyPrepare prepareApplier, applyCommit commitApplier) peerMessageApplier {
 	return func(msg messages.PeerMessage, active bool) error {
+		var view uint64
+		switch msg := msg.(type) {
+		case messages.Prepare:
+			view = msg.View()
+		case messages.Commit:
+			view = msg.Prepare().View()
+		}
+		if history.Removed(view, id) {
+			return nil
+		}
+
 		switch msg := msg.(type) {
 		case messages.Prepare:
 			return applyPrepare(msg, active)
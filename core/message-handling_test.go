@@ -29,6 +29,7 @@ import (
 	logging "github.com/op/go-logging"
 	testifymock "github.com/stretchr/testify/mock"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
 	"github.com/hyperledger-labs/minbft/messages"
 
@@ -274,6 +275,14 @@ func TestMakePeerMessageProcessor(t *testing.T) {
 		msg := mock_messages.NewMockPeerMessage(ctrl)
 		assert.Panics(t, func() { process(msg) }, "Unknown message type")
 	})
+	t.Run("ReqViewChange", func(t *testing.T) {
+		msg := messageImpl.NewReqViewChange(rand.Uint32(), rand.Uint64())
+
+		mock.On("embeddedMessageProcessor", msg).Once()
+		new, err := process(msg)
+		assert.NoError(t, err)
+		assert.False(t, new)
+	})
 	t.Run("CertifiedMessage", func(t *testing.T) {
 		type certifiedPeerMessage interface {
 			messages.CertifiedMessage
@@ -481,7 +490,9 @@ func TestMakePeerMessageApplier(t *testing.T) {
 		args := mock.MethodCalled("commitApplier", msg, active)
 		return args.Error(0)
 	}
-	apply := makePeerMessageApplier(applyPrepare, applyCommit)
+	id := uint32(1)
+	history := staticMembership(3, 1)
+	apply := makePeerMessageApplier(id, history, applyPrepare, applyCommit)
 
 	reqSeq := rand.Uint64()
 	request := messageImpl.NewRequest(0, reqSeq, nil)
@@ -518,6 +529,15 @@ func TestMakePeerMessageApplier(t *testing.T) {
 		err = apply(commit, false)
 		assert.NoError(t, err)
 	})
+	t.Run("Removed", func(t *testing.T) {
+		require.True(t, history.Admit(0, 1, true))
+		_, _, err := history.Reconfigure(&api.Reconfiguration{Remove: []uint32{id}, Add: []api.ReplicaInfo{{ID: 3}}, F: 1})
+		require.NoError(t, err)
+
+		newPrepare := messageImpl.NewPrepare(2, 1, request)
+		assert.NoError(t, apply(newPrepare, true))
+		assert.NoError(t, apply(messageImpl.NewCommit(3, newPrepare), true))
+	})
 }
 
 func TestMakeMessageReplier(t *testing.T) {
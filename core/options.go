@@ -17,14 +17,45 @@
 package minbft
 
 import (
+	"io"
 	"os"
+	"time"
 
 	logging "github.com/op/go-logging"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/admission"
+	"github.com/hyperledger-labs/minbft/core/internal/timer"
 )
 
+// defCommitFeedRetention is the default number of committed
+// operations to retain for subscribers.
+const defCommitFeedRetention = 10000
+
+// defMaxClockSkew is the default maximal time the timestamps chosen
+// by the primary may be ahead of the local clock.
+const defMaxClockSkew = 5 * time.Second
+
+// defMaxTimestampAge is the default maximal time the timestamps
+// chosen by the primary may be behind the local clock.
+const defMaxTimestampAge = 30 * time.Second
+
 type options struct {
 	logLevel logging.Level
 	logFile  *os.File
+
+	commitFeedRetention int
+
+	messageLogWriter io.Writer
+
+	timerProvider timer.Provider
+
+	membershipObservers []api.MembershipObserver
+
+	admissionPolicy admission.Policy
+
+	maxClockSkew    time.Duration
+	maxTimestampAge time.Duration
 }
 
 // Option represents function type to set options.
@@ -34,6 +65,13 @@ func newOptions(opts ...Option) options {
 	opt := options{
 		logLevel: logging.DEBUG,
 		logFile:  os.Stdout,
+
+		commitFeedRetention: defCommitFeedRetention,
+
+		timerProvider: timer.Standard(),
+
+		maxClockSkew:    defMaxClockSkew,
+		maxTimestampAge: defMaxTimestampAge,
 	}
 
 	for _, o := range opts {
@@ -56,3 +94,82 @@ func WithLogFile(f *os.File) Option {
 		opts.logFile = f
 	}
 }
+
+// WithCommitFeedRetention sets the number of the most recently
+// committed operations to retain for subscribers to the commit feed
+func WithCommitFeedRetention(n int) Option {
+	return func(opts *options) {
+		opts.commitFeedRetention = n
+	}
+}
+
+// WithMessageLogWriter sets the stream to record messages generated
+// by the replica to, as written by messages.WriteMessage
+func WithMessageLogWriter(w io.Writer) Option {
+	return func(opts *options) {
+		opts.messageLogWriter = w
+	}
+}
+
+// Timer is an event of elapsed time, as created by TimerProvider
+type Timer = timer.Timer
+
+// TimerProvider is an abstract timer implementation to trigger
+// protocol timeouts
+type TimerProvider = timer.Provider
+
+// WithTimerProvider sets the timer implementation to trigger protocol
+// timeouts, e.g. to replay recorded message exchange with a mocked
+// clock. Standard timer implementation is used by default.
+func WithTimerProvider(p TimerProvider) Option {
+	return func(opts *options) {
+		opts.timerProvider = p
+	}
+}
+
+// WithMembershipObserver adds an observer to notify of membership
+// changes, e.g. the authenticator and the replica connector to pick
+// up the replicas joined. Observers are notified in the order added
+func WithMembershipObserver(o api.MembershipObserver) Option {
+	return func(opts *options) {
+		opts.membershipObservers = append(opts.membershipObservers, o)
+	}
+}
+
+// AdmissionPolicy specifies the limits on accepting requests from
+// clients, as described by the fields of the structure. Zero value of
+// a limit means no limit
+type AdmissionPolicy = admission.Policy
+
+// WithAdmissionPolicy sets the limits on accepting requests from
+// clients while the replica is the primary. Rejected requests are
+// ordered and replied with a signed Reply message giving the reason
+// by all replicas; the rejection rate limits how often this happens
+// for each client. Requests are not limited by default
+func WithAdmissionPolicy(p AdmissionPolicy) Option {
+	return func(opts *options) {
+		opts.admissionPolicy = p
+	}
+}
+
+// WithMaxClockSkew sets the maximal time the timestamp supplied by
+// the primary for executing a request may be ahead of the local
+// clock. Prepare messages with timestamps further ahead are not
+// accepted. Zero value means no limit. Five seconds by default
+func WithMaxClockSkew(d time.Duration) Option {
+	return func(opts *options) {
+		opts.maxClockSkew = d
+	}
+}
+
+// WithMaxTimestampAge sets the maximal time the timestamp supplied by
+// the primary for executing a request may be behind the local clock
+// when the request is about to be committed. The replica does not
+// commit requests with older timestamps, but still executes them
+// once committed by other replicas. Zero value means no limit. Thirty
+// seconds by default
+func WithMaxTimestampAge(d time.Duration) Option {
+	return func(opts *options) {
+		opts.maxTimestampAge = d
+	}
+}
@@ -20,6 +20,8 @@ package minbft
 import (
 	"fmt"
 
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
 	"github.com/hyperledger-labs/minbft/messages"
 )
 
@@ -41,14 +43,13 @@ type prepareValidator func(prepare messages.Prepare) error
 type prepareApplier func(prepare messages.Prepare, active bool) error
 
 // makePrepareValidator constructs an instance of prepareValidator
-// using n as the total number of nodes, and the supplied abstract
-// interfaces.
-func makePrepareValidator(n uint32, verifyUI uiVerifier, validateRequest requestValidator) prepareValidator {
+// using the supplied membership history and abstract interfaces.
+func makePrepareValidator(history membership.State, verifyUI uiVerifier, validateRequest requestValidator, validateInput inputValidator) prepareValidator {
 	return func(prepare messages.Prepare) error {
 		replicaID := prepare.ReplicaID()
 		view := prepare.View()
 
-		if !isPrimary(view, replicaID, n) {
+		if history.Primary(view) != replicaID {
 			return fmt.Errorf("Prepare from backup %d for view %d", replicaID, view)
 		}
 
@@ -56,6 +57,10 @@ func makePrepareValidator(n uint32, verifyUI uiVerifier, validateRequest request
 			return fmt.Errorf("Request invalid: %s", err)
 		}
 
+		if err := validateInput(prepareInput(prepare)); err != nil {
+			return fmt.Errorf("Input invalid: %s", err)
+		}
+
 		if _, err := verifyUI(prepare); err != nil {
 			return fmt.Errorf("UI not valid: %s", err)
 		}
@@ -65,10 +70,33 @@ func makePrepareValidator(n uint32, verifyUI uiVerifier, validateRequest request
 }
 
 // makePrepareApplier constructs an instance of prepareApplier using
-// id as the current replica ID, and the supplied abstract interfaces.
-func makePrepareApplier(id uint32, prepareSeq requestSeqPreparer, collectCommitment commitmentCollector, handleGeneratedMessage generatedMessageHandler, stopPrepTimer prepareTimerStopper) prepareApplier {
+// id as the current replica ID, the supplied membership history, and
+// the supplied abstract interfaces. Only member replicas generate
+// Commit messages. A primary certifying an invalid operation to
+// execute with its UI is faulty; this is reported before rejecting
+// the message. A request to execute with a timestamp too far behind
+// the local clock is not committed by this replica, so that the
+// request timer eventually expires unless other replicas commit it.
+func makePrepareApplier(id uint32, history membership.State, validateOperation operationValidator, checkInputAge inputAgeChecker, handlePrimaryFault primaryFaultHandler, prepareSeq requestSeqPreparer, recordCommitment commitmentRecorder, collectCommitment commitmentCollector, handleGeneratedMessage generatedMessageHandler, stopPrepTimer prepareTimerStopper) prepareApplier {
 	return func(prepare messages.Prepare, active bool) error {
 		request := prepare.Request()
+		view := prepare.View()
+
+		if prepare.Rejection() == "" {
+			if err := validateOperation(request.Kind(), request.Operation()); err != nil {
+				handlePrimaryFault(view)
+				return fmt.Errorf("Operation invalid: %s", err)
+			}
+		}
+
+		ui, err := parseMessageUI(prepare)
+		if err != nil {
+			panic(err)
+		}
+		reconfig := request.Kind() == api.ReconfigurationRequest && prepare.Rejection() == ""
+		if !history.Admit(view, ui.Counter, reconfig) {
+			return fmt.Errorf("View %d closed by reconfiguration", view)
+		}
 
 		if new := prepareSeq(request); !new {
 			return fmt.Errorf("Request already prepared")
@@ -76,6 +104,7 @@ func makePrepareApplier(id uint32, prepareSeq requestSeqPreparer, collectCommitm
 
 		primaryID := prepare.ReplicaID()
 
+		recordCommitment(prepare)
 		if err := collectCommitment(primaryID, prepare); err != nil {
 			return fmt.Errorf("Prepare cannot be taken into account: %s", err)
 		}
@@ -84,10 +113,16 @@ func makePrepareApplier(id uint32, prepareSeq requestSeqPreparer, collectCommitm
 			return nil // primary does not generate Commit
 		}
 
-		if !active {
+		if !active || !history.IsMember(view, id) {
 			return nil
 		}
 
+		if prepare.Rejection() == "" {
+			if err := checkInputAge(prepareInput(prepare)); err != nil {
+				return fmt.Errorf("Prepare not committed: %s", err)
+			}
+		}
+
 		stopPrepTimer(request)
 		handleGeneratedMessage(messageImpl.NewCommit(id, prepare))
 
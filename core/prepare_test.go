@@ -20,11 +20,13 @@ import (
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	testifymock "github.com/stretchr/testify/mock"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/messages"
 	"github.com/hyperledger-labs/minbft/usig"
 )
@@ -40,8 +42,11 @@ func TestMakePrepareValidator(t *testing.T) {
 
 	request := messageImpl.NewRequest(0, rand.Uint64(), nil)
 	ui := &usig.UI{Counter: rand.Uint64()}
+	timestamp, seed := rand.Int63(), make([]byte, inputSeedSize)
+	rand.Read(seed)
+	input := api.ExecutionInput{Timestamp: time.Unix(0, timestamp), Seed: seed}
 	makePrepareMsg := func(id uint32) messages.Prepare {
-		return messageImpl.NewPrepare(id, view, request)
+		return messageImpl.NewPrepareWithInput(id, view, request, timestamp, seed)
 	}
 
 	verifyUI := func(msg messages.CertifiedMessage) (*usig.UI, error) {
@@ -52,7 +57,11 @@ func TestMakePrepareValidator(t *testing.T) {
 		args := mock.MethodCalled("requestValidator", request)
 		return args.Error(0)
 	}
-	validate := makePrepareValidator(n, verifyUI, validateRequest)
+	validateInput := func(input api.ExecutionInput) error {
+		args := mock.MethodCalled("inputValidator", input)
+		return args.Error(0)
+	}
+	validate := makePrepareValidator(staticMembership(n, (n-1)/2), verifyUI, validateRequest, validateInput)
 
 	prepare := makePrepareMsg(backup)
 	err := validate(prepare)
@@ -65,11 +74,18 @@ func TestMakePrepareValidator(t *testing.T) {
 	assert.Error(t, err)
 
 	mock.On("requestValidator", request).Return(nil).Once()
+	mock.On("inputValidator", input).Return(fmt.Errorf("Timestamp ahead")).Once()
+	err = validate(prepare)
+	assert.Error(t, err)
+
+	mock.On("requestValidator", request).Return(nil).Once()
+	mock.On("inputValidator", input).Return(nil).Once()
 	mock.On("uiVerifier", prepare).Return((*usig.UI)(nil), fmt.Errorf("UI not valid")).Once()
 	err = validate(prepare)
 	assert.Error(t, err)
 
 	mock.On("requestValidator", request).Return(nil).Once()
+	mock.On("inputValidator", input).Return(nil).Once()
 	mock.On("uiVerifier", prepare).Return(ui, nil).Once()
 	err = validate(prepare)
 	assert.NoError(t, err)
@@ -87,6 +103,9 @@ func TestMakePrepareApplier(t *testing.T) {
 		args := mock.MethodCalled("requestSeqPreparer", request)
 		return args.Bool(0)
 	}
+	recordCommitment := func(msg messages.CertifiedMessage) {
+		mock.MethodCalled("commitmentRecorder", msg)
+	}
 	collectCommitment := func(id uint32, prepare messages.Prepare) error {
 		args := mock.MethodCalled("commitmentCollector", id, prepare)
 		return args.Error(0)
@@ -97,22 +116,50 @@ func TestMakePrepareApplier(t *testing.T) {
 	stopPrepTimer := func(request messages.Request) {
 		mock.MethodCalled("prepareTimerStopper", request)
 	}
-	apply := makePrepareApplier(id, prepareRequestSeq, collectCommitment, handleGeneratedMessage, stopPrepTimer)
+	validateOperation := func(kind api.RequestKind, operation []byte) error {
+		if string(operation) == "invalid" {
+			return fmt.Errorf("Invalid operation")
+		}
+		return nil
+	}
+	const staleTimestamp = 1
+	checkInputAge := func(input api.ExecutionInput) error {
+		if input.Timestamp.UnixNano() == staleTimestamp {
+			return fmt.Errorf("Stale timestamp")
+		}
+		return nil
+	}
+	handlePrimaryFault := func(view uint64) {
+		mock.MethodCalled("primaryFaultHandler", view)
+	}
+	apply := makePrepareApplier(id, staticMembership(n, (n-1)/2), validateOperation, checkInputAge, handlePrimaryFault, prepareRequestSeq, recordCommitment, collectCommitment, handleGeneratedMessage, stopPrepTimer)
 
 	clientID := rand.Uint32()
 	request := messageImpl.NewRequest(clientID, rand.Uint64(), nil)
 	ownPrepare := messageImpl.NewPrepare(id, viewForPrimary(n, id), request)
+	setUICounter(ownPrepare, rand.Uint64())
 	prepare := messageImpl.NewPrepare(primary, view, request)
+	setUICounter(prepare, rand.Uint64())
 	commit := messageImpl.NewCommit(id, prepare)
 
+	invalidRequest := messageImpl.NewRequest(clientID, rand.Uint64(), []byte("invalid"))
+	invalidPrepare := messageImpl.NewPrepare(primary, view, invalidRequest)
+	setUICounter(invalidPrepare, rand.Uint64())
+	mock.On("primaryFaultHandler", view).Once()
+	err := apply(invalidPrepare, true)
+	assert.Error(t, err, "Operation invalid")
+
 	mock.On("requestSeqPreparer", request).Return(false).Once()
-	err := apply(prepare, true)
+	err = apply(prepare, true)
 	assert.Error(t, err, "Request ID already prepared")
 
 	mock.On("requestSeqPreparer", request).Return(false).Once()
 	err = apply(ownPrepare, true)
 	assert.Error(t, err, "Request ID already prepared")
 
+	mock.On("commitmentRecorder", ownPrepare).Twice()
+	mock.On("commitmentRecorder", prepare).Times(3)
+
 	mock.On("requestSeqPreparer", request).Return(true).Once()
 	mock.On("commitmentCollector", id, ownPrepare).Return(fmt.Errorf("Error")).Once()
 	err = apply(ownPrepare, true)
@@ -135,8 +182,27 @@ func TestMakePrepareApplier(t *testing.T) {
 	err = apply(prepare, true)
 	assert.NoError(t, err)
 
+	// Stale timestamps are not committed
+	staleRequest := messageImpl.NewRequest(clientID, rand.Uint64(), nil)
+	stalePrepare := messageImpl.NewPrepareWithInput(primary, view, staleRequest, staleTimestamp, nil)
+	setUICounter(stalePrepare, rand.Uint64())
+	mock.On("requestSeqPreparer", staleRequest).Return(true).Once()
+	mock.On("commitmentRecorder", stalePrepare).Once()
+	mock.On("commitmentCollector", primary, stalePrepare).Return(nil).Once()
+	err = apply(stalePrepare, true)
+	assert.Error(t, err)
+
 	mock.On("requestSeqPreparer", request).Return(true).Once()
 	mock.On("commitmentCollector", primary, prepare).Return(nil).Once()
 	err = apply(prepare, false)
 	assert.NoError(t, err)
+
+	// Rejected operations are not validated
+	rejectingPrepare := messageImpl.NewRejectingPrepare(primary, view, invalidRequest, 0, nil, "rejected")
+	setUICounter(rejectingPrepare, rand.Uint64())
+	mock.On("requestSeqPreparer", invalidRequest).Return(true).Once()
+	mock.On("commitmentRecorder", rejectingPrepare).Once()
+	mock.On("commitmentCollector", primary, rejectingPrepare).Return(nil).Once()
+	err = apply(rejectingPrepare, false)
+	assert.NoError(t, err)
 }
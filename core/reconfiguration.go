@@ -0,0 +1,386 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
+	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
+	"github.com/hyperledger-labs/minbft/core/internal/viewstate"
+	"github.com/hyperledger-labs/minbft/messages"
+)
+
+// reconfigurationAuthenPrefix distinguishes reconfigurations from
+// any other data authenticated by operators.
+const reconfigurationAuthenPrefix = "minbft: reconfiguration"
+
+// reconfigurationOp is the content of a reconfiguration operation.
+type reconfigurationOp struct {
+	Reconfiguration *api.Reconfiguration `json:"reconfiguration"`
+	OperatorID      uint32               `json:"operator"`
+	Tag             []byte               `json:"tag"`
+}
+
+// ReconfigurationResult is the result of executing a reconfiguration
+// operation. Epoch is the membership epoch after the
+// reconfiguration.
+type ReconfigurationResult struct {
+	Epoch uint64 `json:"epoch"`
+}
+
+// ReconfigurationAuthenBytes returns the data an operator
+// authenticates with OperatorAuthen role to request the supplied
+// reconfiguration. The reconfiguration refers to the membership epoch
+// to change, so that the primary rejects it without ordering once
+// that epoch is over, e.g. if replayed.
+func ReconfigurationAuthenBytes(rc *api.Reconfiguration) []byte {
+	rcBytes, err := json.Marshal(rc)
+	if err != nil {
+		panic(err)
+	}
+	return append([]byte(reconfigurationAuthenPrefix), rcBytes...)
+}
+
+// MakeReconfigurationOperation returns the operation for a client to
+// request the supplied reconfiguration on behalf of the operator with
+// the specified ID, given the tag authenticating the data returned by
+// ReconfigurationAuthenBytes. The operation has to be submitted in a
+// request of api.ReconfigurationRequest kind, e.g. with Reconfigure
+// method of the client. It is ordered as any other operation, but is
+// executed by the replicas themselves rather than passed to the
+// request consumer. The result of the operation is a serialized
+// ReconfigurationResult. A reconfiguration that cannot be applied to
+// the current membership is rejected.
+//
+// Once a reconfiguration is prepared, no more requests are prepared
+// in the current view. After the reconfiguration is executed, the
+// replicas move into the next view, with the new membership taking
+// effect.
+func MakeReconfigurationOperation(rc *api.Reconfiguration, operatorID uint32, tag []byte) []byte {
+	opBytes, err := json.Marshal(&reconfigurationOp{rc, operatorID, tag})
+	if err != nil {
+		panic(err)
+	}
+	return opBytes
+}
+
+// ParseReconfigurationResult parses the result of a reconfiguration
+// operation.
+func ParseReconfigurationResult(result []byte) (*ReconfigurationResult, error) {
+	res := new(ReconfigurationResult)
+	if err := json.Unmarshal(result, res); err != nil {
+		return nil, fmt.Errorf("Malformed reconfiguration result: %s", err)
+	}
+	return res, nil
+}
+
+// MembershipHistory keeps track of the membership in each view by
+// replaying the reconfigurations committed by the replicas, starting
+// from the initial membership given by the consensus configuration,
+// e.g. to verify committed operations or audit recorded messages once
+// the membership has changed. It is safe to use concurrently.
+type MembershipHistory struct {
+	state membership.State
+
+	lock sync.Mutex
+
+	// First view a reconfiguration can be replayed in
+	nextView uint64
+}
+
+// NewMembershipHistory creates a new instance of MembershipHistory
+// starting from the initial membership given by the configuration.
+func NewMembershipHistory(config api.Configer) *MembershipHistory {
+	return &MembershipHistory{state: membership.New(membership.Initial(config.N(), config.F()))}
+}
+
+// Membership returns the membership in the specified view, as far as
+// known from the reconfigurations replayed so far.
+func (h *MembershipHistory) Membership(view uint64) *api.Membership {
+	return h.state.Membership(view)
+}
+
+// Primary returns the ID of the primary replica of the specified
+// view, as far as known from the reconfigurations replayed so far.
+func (h *MembershipHistory) Primary(view uint64) uint32 {
+	return h.state.Primary(view)
+}
+
+// Reconfigure replays the reconfiguration operation prepared in the
+// specified view with the specified UI counter. Reconfigurations have
+// to be replayed in the order of views they were prepared in. It
+// returns the membership taking effect from the next view; as on the
+// replicas, it remains unchanged if the reconfiguration cannot be
+// applied. An error is returned if the operation is malformed or the
+// reconfiguration is replayed out of order.
+func (h *MembershipHistory) Reconfigure(view, cv uint64, op []byte) (*api.Membership, error) {
+	rcOp, err := parseReconfigurationOperation(op)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed reconfiguration: %s", err)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if view < h.nextView || !h.state.Admit(view, cv, true) {
+		return nil, fmt.Errorf("Reconfiguration in view %d out of order", view)
+	}
+	h.nextView = view + 1
+
+	_, m, _ := h.state.Reconfigure(rcOp.Reconfiguration)
+	return m, nil
+}
+
+// Apply replays the committed operation if it is a reconfiguration,
+// as Reconfigure does. Committed operations have to be applied in the
+// order of commit, starting from the first one.
+func (h *MembershipHistory) Apply(op *api.CommittedOperation) error {
+	if op.Kind != api.ReconfigurationRequest {
+		return nil
+	}
+	_, err := h.Reconfigure(op.View, op.UICounter, op.Operation)
+	return err
+}
+
+func parseReconfigurationOperation(op []byte) (*reconfigurationOp, error) {
+	rcOp := new(reconfigurationOp)
+	if err := json.Unmarshal(op, rcOp); err != nil {
+		return nil, err
+	}
+	if rcOp.Reconfiguration == nil {
+		return nil, fmt.Errorf("No reconfiguration")
+	}
+	return rcOp, nil
+}
+
+// membershipSwitcher moves the replica into the specified view, the
+// first one with the supplied membership. It is asynchronous. It is
+// safe to invoke concurrently, but the switches are performed in the
+// order of invocation.
+type membershipSwitcher func(view uint64, m *api.Membership)
+
+// peerConnectionStarter initiates asynchronous message exchange with
+// the specified peer replica.
+type peerConnectionStarter func(peerID uint32) error
+
+// makeReconfigurationRequestValidator constructs an instance of
+// requestValidator that additionally authenticates reconfiguration
+// operations using the supplied authenticator.
+func makeReconfigurationRequestValidator(authen api.Authenticator, validateRequest requestValidator) requestValidator {
+	return func(request messages.Request) error {
+		if err := validateRequest(request); err != nil {
+			return err
+		}
+
+		if request.Kind() != api.ReconfigurationRequest {
+			return nil
+		}
+
+		rcOp, err := parseReconfigurationOperation(request.Operation())
+		if err != nil {
+			return fmt.Errorf("Malformed reconfiguration: %s", err)
+		}
+
+		authenBytes := ReconfigurationAuthenBytes(rcOp.Reconfiguration)
+		if err := authen.VerifyMessageAuthenTag(api.OperatorAuthen, rcOp.OperatorID, authenBytes, rcOp.Tag); err != nil {
+			return fmt.Errorf("Operator authentication failed: %s", err)
+		}
+
+		return nil
+	}
+}
+
+// viewChangeTimeoutProvider returns current view change timeout
+// duration.
+type viewChangeTimeoutProvider func() time.Duration
+
+// makeReconfigurationOperationValidator constructs an instance of
+// operationValidator that additionally checks reconfiguration
+// operations against the latest membership in the supplied history,
+// and passes any other operation to the supplied validator. The
+// latest membership is the one of the view a reconfiguration can be
+// prepared in, so that a stale reconfiguration never gets ordered.
+func makeReconfigurationOperationValidator(history membership.State, validateOperation operationValidator) operationValidator {
+	return func(kind api.RequestKind, op []byte) error {
+		if kind != api.ReconfigurationRequest {
+			return validateOperation(kind, op)
+		}
+
+		rcOp, err := parseReconfigurationOperation(op)
+		if err != nil {
+			return fmt.Errorf("Malformed reconfiguration: %s", err)
+		}
+
+		return history.Check(rcOp.Reconfiguration)
+	}
+}
+
+// makeReconfigurationExecutor constructs an instance of
+// operationExecutor that executes reconfiguration operations by
+// applying them to the membership history and switching the
+// membership, and passes any other operation to the supplied
+// executor. Reconfiguration operations are checked before ordering;
+// should one still fail, the membership remains unchanged, but the
+// replica moves into the next view anyway, and the failure is
+// reported as the execution error.
+func makeReconfigurationExecutor(history membership.State, switchMembership membershipSwitcher, execute operationExecutor, logger *logging.Logger) operationExecutor {
+	return func(kind api.RequestKind, op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		if kind != api.ReconfigurationRequest {
+			return execute(kind, op, input)
+		}
+
+		rcOp, err := parseReconfigurationOperation(op)
+		if err != nil {
+			panic(err) // validated before
+		}
+
+		resultChan := make(chan api.ExecutionResult, 1)
+
+		view, m, err := history.Reconfigure(rcOp.Reconfiguration)
+		if err != nil {
+			logger.Errorf("Reconfiguration failed, membership epoch %d continues from view %d: %s",
+				m.Epoch, view, err)
+			switchMembership(view, m)
+			resultChan <- api.ExecutionResult{Error: fmt.Errorf("Reconfiguration failed: %s", err)}
+			return resultChan
+		}
+		logger.Infof("Membership epoch %d takes effect from view %d", m.Epoch, view)
+		switchMembership(view, m)
+
+		resultBytes, err := json.Marshal(&ReconfigurationResult{Epoch: m.Epoch})
+		if err != nil {
+			panic(err)
+		}
+
+		resultChan <- api.ExecutionResult{Result: resultBytes}
+		return resultChan
+	}
+}
+
+// makeMembershipSwitcher constructs an instance of
+// membershipSwitcher using id as the current replica ID, the
+// supplied initial membership, observers, and abstractions. Upon a
+// switch, it notifies the observers, connects to the replicas joined,
+// moves into the new view, and applies the pending requests again in
+// the new view.
+func makeMembershipSwitcher(id uint32, initial *api.Membership, observers []api.MembershipObserver, connectPeer peerConnectionStarter, viewState viewstate.State, pendingReq requestlist.List, applyRequest requestApplier, logger *logging.Logger) membershipSwitcher {
+	var (
+		lock sync.Mutex
+
+		// Closed once the previous switch is complete
+		prevDone = make(chan struct{})
+
+		// Replica ID -> connection started
+		connected = make(map[uint32]bool)
+	)
+	close(prevDone)
+
+	for _, r := range initial.Replicas {
+		connected[r.ID] = true
+	}
+
+	switchTo := func(view uint64, m *api.Membership) {
+		for _, o := range observers {
+			if err := o.MembershipChanged(m); err != nil {
+				logger.Errorf("Membership observer failed: %s", err)
+			}
+		}
+
+		for _, r := range m.Replicas {
+			if r.ID == id || connected[r.ID] {
+				continue
+			}
+			if err := connectPeer(r.ID); err != nil {
+				logger.Errorf("Cannot connect to replica %d: %s", r.ID, err)
+				continue
+			}
+			connected[r.ID] = true
+		}
+
+		if ok, release := viewState.AdvanceExpectedView(view); ok {
+			release()
+		}
+		if ok, _, release := viewState.AdvanceCurrentView(view); ok {
+			release()
+		}
+		logger.Infof("Moved into view %d with membership epoch %d", view, m.Epoch)
+
+		current, expected, release := viewState.HoldView()
+		defer release()
+
+		if current != view || expected != view {
+			return
+		}
+		for _, req := range pendingReq.All() {
+			if err := applyRequest(req, view); err != nil {
+				logger.Warningf("Failed to apply %s: %s", messages.Stringify(req), err)
+			}
+		}
+	}
+
+	return func(view uint64, m *api.Membership) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		wait, done := prevDone, make(chan struct{})
+		prevDone = done
+
+		go func() {
+			<-wait
+			switchTo(view, m)
+			close(done)
+		}()
+	}
+}
+
+// makeViewAwaitingValidator constructs an instance of
+// messageValidator that, before validating the supplied message with
+// the supplied validator, waits until the replica moves into the
+// view the message refers to. A correct peer replica would ensure
+// that this replica would eventually transition into that view. The
+// message is not valid if the replica does not move into that view
+// within the view change timeout.
+func makeViewAwaitingValidator(viewState viewstate.State, timeout viewChangeTimeoutProvider, validate messageValidator) messageValidator {
+	return func(msg messages.Message) error {
+		var view uint64
+		switch msg := msg.(type) {
+		case messages.Prepare:
+			view = msg.View()
+		case messages.Commit:
+			view = msg.Prepare().View()
+		}
+
+		if !viewState.AwaitView(view, timeout()) {
+			return fmt.Errorf("View %d not reached", view)
+		}
+
+		return validate(msg)
+	}
+}
+
+// makeViewChangeTimeoutProvider constructs an instance of
+// viewChangeTimeoutProvider.
+func makeViewChangeTimeoutProvider(config api.Configer) viewChangeTimeoutProvider {
+	return func() time.Duration {
+		return config.TimeoutViewChange()
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	testifymock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+
+	mock_api "github.com/hyperledger-labs/minbft/api/mocks"
+)
+
+func TestReconfigurationOperation(t *testing.T) {
+	rc := &api.Reconfiguration{
+		Epoch:  1,
+		Remove: []uint32{0},
+		Add:    []api.ReplicaInfo{{ID: 3, Address: ":8003", Identity: []byte("identity")}},
+		F:      1,
+	}
+	tag := []byte("tag")
+
+	op := MakeReconfigurationOperation(rc, 2, tag)
+	rcOp, err := parseReconfigurationOperation(op)
+	require.NoError(t, err)
+	assert.Equal(t, rc, rcOp.Reconfiguration)
+	assert.Equal(t, uint32(2), rcOp.OperatorID)
+	assert.Equal(t, tag, rcOp.Tag)
+
+	_, err = parseReconfigurationOperation([]byte("{}"))
+	assert.Error(t, err)
+	_, err = parseReconfigurationOperation([]byte("operation"))
+	assert.Error(t, err)
+
+	assert.Equal(t, ReconfigurationAuthenBytes(rc), ReconfigurationAuthenBytes(rc))
+	assert.NotEqual(t, ReconfigurationAuthenBytes(rc), ReconfigurationAuthenBytes(&api.Reconfiguration{}))
+}
+
+func TestMakeReconfigurationRequestValidator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := new(testifymock.Mock)
+	defer mock.AssertExpectations(t)
+
+	authen := mock_api.NewMockAuthenticator(ctrl)
+	validateRequest := func(request messages.Request) error {
+		args := mock.MethodCalled("requestValidator", request)
+		return args.Error(0)
+	}
+	validate := makeReconfigurationRequestValidator(authen, validateRequest)
+
+	request := messageImpl.NewRequest(0, rand.Uint64(), []byte("operation"))
+
+	mock.On("requestValidator", request).Return(fmt.Errorf("invalid signature")).Once()
+	err := validate(request)
+	assert.Error(t, err)
+
+	mock.On("requestValidator", request).Return(nil).Once()
+	err = validate(request)
+	assert.NoError(t, err)
+
+	// Plain operations are not parsed as reconfigurations
+	request = messageImpl.NewRequest(0, rand.Uint64(), []byte("malformed"))
+	mock.On("requestValidator", request).Return(nil).Once()
+	err = validate(request)
+	assert.NoError(t, err)
+
+	rc := &api.Reconfiguration{Remove: []uint32{0}, F: 1}
+	operatorID := rand.Uint32()
+	tag := make([]byte, 1)
+	rand.Read(tag)
+	request = messageImpl.NewRequestWithKind(0, rand.Uint64(), api.ReconfigurationRequest, MakeReconfigurationOperation(rc, operatorID, tag))
+
+	mock.On("requestValidator", request).Return(nil).Once()
+	authen.EXPECT().VerifyMessageAuthenTag(api.OperatorAuthen, operatorID, ReconfigurationAuthenBytes(rc), tag).Return(fmt.Errorf("invalid tag"))
+	err = validate(request)
+	assert.Error(t, err)
+
+	mock.On("requestValidator", request).Return(nil).Once()
+	authen.EXPECT().VerifyMessageAuthenTag(api.OperatorAuthen, operatorID, ReconfigurationAuthenBytes(rc), tag).Return(nil)
+	err = validate(request)
+	assert.NoError(t, err)
+
+	request = messageImpl.NewRequestWithKind(0, rand.Uint64(), api.ReconfigurationRequest, []byte("malformed"))
+	mock.On("requestValidator", request).Return(nil).Once()
+	err = validate(request)
+	assert.Error(t, err)
+}
+
+func TestMakeReconfigurationOperationValidator(t *testing.T) {
+	mock := new(testifymock.Mock)
+	defer mock.AssertExpectations(t)
+
+	history := staticMembership(3, 1)
+	validateOperation := func(kind api.RequestKind, op []byte) error {
+		args := mock.MethodCalled("operationValidator", kind, op)
+		return args.Error(0)
+	}
+	validate := makeReconfigurationOperationValidator(history, validateOperation)
+
+	op := []byte("operation")
+	mock.On("operationValidator", api.OperationRequest, op).Return(fmt.Errorf("invalid operation")).Once()
+	assert.Error(t, validate(api.OperationRequest, op))
+	mock.On("operationValidator", api.BatchRequest, op).Return(nil).Once()
+	assert.NoError(t, validate(api.BatchRequest, op))
+
+	rc := &api.Reconfiguration{Add: []api.ReplicaInfo{{ID: 3}}, F: 1}
+	assert.NoError(t, validate(api.ReconfigurationRequest, MakeReconfigurationOperation(rc, 0, nil)))
+	assert.Error(t, validate(api.ReconfigurationRequest, []byte("malformed")))
+
+	stale := &api.Reconfiguration{Epoch: 1, F: 1}
+	assert.Error(t, validate(api.ReconfigurationRequest, MakeReconfigurationOperation(stale, 0, nil)))
+}
+
+func TestMakeReconfigurationExecutor(t *testing.T) {
+	mock := new(testifymock.Mock)
+	defer mock.AssertExpectations(t)
+
+	history := staticMembership(3, 1)
+	switchMembership := func(view uint64, m *api.Membership) {
+		mock.MethodCalled("membershipSwitcher", view, m)
+	}
+	execute := func(kind api.RequestKind, op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		args := mock.MethodCalled("operationExecutor", kind, op, input)
+		return args.Get(0).(chan api.ExecutionResult)
+	}
+	executor := makeReconfigurationExecutor(history, switchMembership, execute, logging.MustGetLogger(module))
+
+	op := []byte("operation")
+	input := api.ExecutionInput{Timestamp: time.Now(), Seed: []byte("seed")}
+	resultChan := make(chan api.ExecutionResult, 1)
+	mock.On("operationExecutor", api.OperationRequest, op, input).Return(resultChan).Once()
+	assert.Equal(t, (<-chan api.ExecutionResult)(resultChan), executor(api.OperationRequest, op, input))
+
+	view := randView()
+	rc := &api.Reconfiguration{Add: []api.ReplicaInfo{{ID: 3}}, F: 1}
+	require.True(t, history.Admit(view, 1, true))
+	mock.On("membershipSwitcher", view+1, testifymock.Anything).Once()
+	res, err := ParseReconfigurationResult((<-executor(api.ReconfigurationRequest, MakeReconfigurationOperation(rc, 0, nil), input)).Result)
+	require.NoError(t, err)
+	assert.Equal(t, &ReconfigurationResult{Epoch: 1}, res)
+	assert.True(t, history.IsMember(view+1, 3))
+
+	// Stale reconfigurations are checked before ordering, but
+	// the view ends even if one fails
+	require.True(t, history.Admit(view+1, 1, true))
+	mock.On("membershipSwitcher", view+2, history.Membership(view+1)).Once()
+	out := <-executor(api.ReconfigurationRequest, MakeReconfigurationOperation(rc, 0, nil), input)
+	assert.Nil(t, out.Result)
+	assert.EqualError(t, out.Error, "Reconfiguration failed: Membership epoch 0 is not current")
+	assert.True(t, history.IsMember(view+2, 3))
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/commitfeed"
 	"github.com/hyperledger-labs/minbft/core/internal/messagelog"
 
 	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
@@ -29,20 +30,54 @@ import (
 const (
 	module           = "minbft"
 	defaultLogPrefix = `%{color}[%{module}] %{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset}`
+
+	// inputSeedSize is the size in bytes of the random seed
+	// supplied by the primary for executing each request
+	inputSeedSize = 32
+
+	// forwardQueueSize is the number of Request messages queued
+	// for forwarding to a replica; more requests are dropped
+	// until the queue drains
+	forwardQueueSize = 1000
 )
 
 var messageImpl = protobufMessages.NewImpl()
 
-// Stack combines interfaces of external modules
+// Stack combines interfaces of external modules. Optional extensions
+// of the request consumer, such as api.ConflictKeyer, are used if
+// implemented by the Stack itself, unless it is created by NewStack.
 type Stack interface {
 	api.ReplicaConnector
 	api.Authenticator
 	api.RequestConsumer
 }
 
+// NewStack combines the supplied modules into a Stack. The replica
+// uses any optional extension implemented by the request consumer.
+func NewStack(connector api.ReplicaConnector, authen api.Authenticator, consumer api.RequestConsumer) Stack {
+	return &stack{connector, authen, consumer}
+}
+
+type stack struct {
+	api.ReplicaConnector
+	api.Authenticator
+	api.RequestConsumer
+}
+
+// stackConsumer returns the request consumer of the stack to look
+// for optional extensions in.
+func stackConsumer(s Stack) api.RequestConsumer {
+	if s, ok := s.(*stack); ok {
+		return s.RequestConsumer
+	}
+	return s
+}
+
 // Replica represents an instance of replica peer
 type replica struct {
 	handleStream messageStreamHandler
+	feed         commitfeed.Feed
+	reportStatus replicaStatusReporter
 }
 
 // New creates a new instance of replica node
@@ -57,18 +92,23 @@ func New(id uint32, configer api.Configer, stack Stack, opts ...Option) (api.Rep
 	logOpts := newOptions(opts...)
 
 	messageLog := messagelog.New()
+	feed := commitfeed.New(logOpts.commitFeedRetention)
 	logger := makeLogger(id, logOpts)
 
 	if err := startPeerConnections(id, n, stack, messageLog, logger); err != nil {
 		return nil, fmt.Errorf("Failed to start peer connections: %s", err)
 	}
 
-	handle := defaultIncomingMessageHandler(id, messageLog, configer, stack, logger)
+	handle, reportStatus := defaultIncomingMessageHandler(id, messageLog, feed, configer, stack,
+		logOpts.membershipObservers, logOpts.timerProvider, logOpts.admissionPolicy, logOpts.maxClockSkew, logOpts.maxTimestampAge, logger)
 	handleStream := makeMessageStreamHandler(handle, logger)
 
 	go handleGeneratedPeerMessages(messageLog, handle, logger)
+	if w := logOpts.messageLogWriter; w != nil {
+		go recordGeneratedMessages(messageLog, w, logger)
+	}
 
-	return &replica{handleStream}, nil
+	return &replica{handleStream, feed, reportStatus}, nil
 }
 
 func (r *replica) PeerMessageStreamHandler() api.MessageStreamHandler {
@@ -81,6 +121,14 @@ func (r *replica) ClientMessageStreamHandler() api.MessageStreamHandler {
 	return r.handleStream
 }
 
+func (r *replica) SubscribeCommitted(from uint64, done <-chan struct{}) (<-chan *api.CommittedOperation, error) {
+	return r.feed.Subscribe(from, done)
+}
+
+func (r *replica) Status() *api.ReplicaStatus {
+	return r.reportStatus()
+}
+
 func (handle messageStreamHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
 	out := make(chan []byte)
 
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger-labs/minbft/api"
+
+	mock_api "github.com/hyperledger-labs/minbft/api/mocks"
+)
+
+func TestStackConsumer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	authen := mock_api.NewMockAuthenticator(ctrl)
+	validator := &struct {
+		*mock_api.MockRequestConsumer
+		*mock_api.MockOperationValidator
+	}{mock_api.NewMockRequestConsumer(ctrl), mock_api.NewMockOperationValidator(ctrl)}
+
+	// Extensions of the consumer are found in stacks made by NewStack
+	consumer := stackConsumer(NewStack(nil, authen, validator))
+	assert.Equal(t, validator, consumer)
+	_, ok := consumer.(api.OperationValidator)
+	assert.True(t, ok)
+	_, ok = consumer.(api.ConflictKeyer)
+	assert.False(t, ok)
+
+	// Custom stacks implement extensions themselves
+	stack := &struct {
+		Stack
+		api.ConflictKeyer
+	}{NewStack(nil, authen, validator), nil}
+	_, ok = stackConsumer(stack).(api.ConflictKeyer)
+	assert.True(t, ok)
+}
@@ -18,17 +18,23 @@
 package minbft
 
 import (
+	"crypto/rand"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	logging "github.com/op/go-logging"
 
 	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/admission"
 	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
+	"github.com/hyperledger-labs/minbft/core/internal/conflicttracker"
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
 	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
 	"github.com/hyperledger-labs/minbft/core/internal/viewstate"
 	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/messages/batch"
 )
 
 // requestReplier provides Reply message given Request message.
@@ -45,6 +51,21 @@ type requestReplier func(request messages.Request) <-chan messages.Reply
 // side-effect. It is safe to invoke concurrently.
 type requestValidator func(request messages.Request) error
 
+// operationValidator checks an operation of a request of the
+// specified kind for validity before ordering. It returns an error if
+// the operation is invalid. It is deterministic, has no side effect,
+// and is safe to invoke concurrently.
+type operationValidator func(kind api.RequestKind, operation []byte) error
+
+// requestAdmitter decides whether to execute a valid Request message
+// being ordered by this replica as the primary.
+//
+// It checks the operation for validity and the supplied message
+// against the admission policy. It returns nil if the request is
+// accepted. Otherwise, it returns an error describing the reason to
+// reject the request. It is safe to invoke concurrently.
+type requestAdmitter func(request messages.Request) error
+
 // requestProcessor processes a valid Request message.
 //
 // It fully processes the supplied message. The supplied message is
@@ -63,15 +84,36 @@ type requestProcessor func(request messages.Request) (new bool, err error)
 type requestApplier func(request messages.Request, view uint64) error
 
 // requestExecutor given a Request message executes the requested
-// operation, produces the corresponding Reply message ready for
-// delivery to the client, and hands it over for further processing.
-type requestExecutor func(request messages.Request)
-
-// operationExecutor executes an operation on the local instance of
-// the replicated state machine. The result of operation execution
-// will be send to the returned channel once it is ready. It is not
-// allowed to invoke concurrently.
-type operationExecutor func(operation []byte) (resultChan <-chan []byte)
+// operation with the supplied non-deterministic input, produces the
+// corresponding Reply message ready for delivery to the client, and
+// hands it over for further processing. If the supplied reason of
+// rejection is not empty then the operation is not executed and the
+// Reply message rejects the request with that reason instead.
+type requestExecutor func(request messages.Request, input api.ExecutionInput, rejection string)
+
+// operationExecutor executes an operation of a request of the
+// specified kind on the local instance of the replicated state
+// machine with the supplied non-deterministic input. The outcome of
+// operation execution will be send to the returned channel once it is
+// ready. Operations are executed as if one after another in the order
+// of invocation. It is not allowed to invoke concurrently.
+type operationExecutor func(kind api.RequestKind, operation []byte, input api.ExecutionInput) (resultChan <-chan api.ExecutionResult)
+
+// inputGenerator chooses non-deterministic input for executing a
+// request being ordered by this replica as the primary. It is safe
+// to invoke concurrently.
+type inputGenerator func() api.ExecutionInput
+
+// inputValidator checks non-deterministic input chosen by the primary
+// for executing a request against the bounds accepted by this
+// replica. It has no side effect and is safe to invoke concurrently.
+type inputValidator func(input api.ExecutionInput) error
+
+// inputAgeChecker checks that the timestamp chosen by the primary for
+// executing a request is not too far behind the local clock, as of
+// committing the request in the active view. It has no side effect
+// and is safe to invoke concurrently.
+type inputAgeChecker func(input api.ExecutionInput) error
 
 // requestSeqCapturer synchronizes beginning of processing of request
 // identifier in Request message.
@@ -147,14 +189,87 @@ type prepareTimerStopper func(request messages.Request)
 // prepareTimeoutProvider returns current prepare timeout duration.
 type prepareTimeoutProvider func() time.Duration
 
+// requestForwarder forwards Request message to the primary replica
+// with the specified ID, unless clients send their requests to that
+// replica directly. It is safe to invoke concurrently.
+type requestForwarder func(request messages.Request, primaryID uint32)
+
 // makeRequestValidator constructs an instance of requestValidator
 // using the supplied abstractions.
 func makeRequestValidator(verify messageSignatureVerifier) requestValidator {
 	return func(request messages.Request) error {
+		switch kind := request.Kind(); kind {
+		case api.OperationRequest, api.BatchRequest, api.ReconfigurationRequest:
+		default:
+			return fmt.Errorf("Unknown request kind %d", kind)
+		}
+
 		return verify(request)
 	}
 }
 
+// makeOperationValidator constructs an instance of
+// operationValidator using the supplied interface to external request
+// consumer module. If the module does not implement
+// api.OperationValidator interface then any operation is valid.
+// Reconfiguration operations are validated separately; each operation
+// of a batch is validated on its own.
+func makeOperationValidator(consumer api.RequestConsumer) operationValidator {
+	validator, ok := consumer.(api.OperationValidator)
+	if !ok {
+		return func(kind api.RequestKind, operation []byte) error { return nil }
+	}
+
+	return func(kind api.RequestKind, operation []byte) error {
+		switch kind {
+		case api.ReconfigurationRequest:
+			return nil
+		case api.BatchRequest:
+		default:
+			return validator.ValidateOperation(operation)
+		}
+
+		ops, err := batch.ParseOperation(operation)
+		if err != nil {
+			return fmt.Errorf("Malformed batch: %s", err)
+		}
+		for i, op := range ops {
+			if err := validator.ValidateOperation(op); err != nil {
+				return fmt.Errorf("Operation %d of batch: %s", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// makeRequestAdmitter constructs an instance of requestAdmitter
+// using the supplied admission controller, the list of pending
+// requests to count the other requests in flight, and the supplied
+// abstractions. A rejection is returned no sooner than the rejection
+// rate of the client allows; the client cannot submit another request
+// meanwhile.
+func makeRequestAdmitter(validateOperation operationValidator, controller admission.Controller, pendingReq requestlist.List, logger *logging.Logger) requestAdmitter {
+	return func(request messages.Request) error {
+		clientID, seq := request.ClientID(), request.Sequence()
+		err := validateOperation(request.Kind(), request.Operation())
+		if err != nil {
+			err = fmt.Errorf("Invalid operation: %s", err)
+		} else {
+			inFlight := pendingReq.Len() - 1 // excluding this request
+			err = controller.Admit(clientID, seq, len(request.Operation()), inFlight)
+		}
+		if err != nil {
+			if d := controller.Reject(clientID); d > 0 {
+				logger.Infof("Delaying rejection of request %d from client %d by %s", seq, clientID, d)
+				time.Sleep(d)
+			}
+			logger.Infof("Rejected request %d from client %d: %s", seq, clientID, err)
+		}
+
+		return err
+	}
+}
+
 // makeRequestProcessor constructs an instance of requestProcessor
 // using id as the current replica ID, n as the total number of nodes,
 // and the supplied abstractions.
@@ -183,8 +298,19 @@ func makeRequestProcessor(captureSeq requestSeqCapturer, pendingReq requestlist.
 	}
 }
 
-func makeRequestApplier(id, n uint32, handleGeneratedMessage generatedMessageHandler, startReqTimer requestTimerStarter, startPrepTimer prepareTimerStarter) requestApplier {
+// makeRequestApplier constructs an instance of requestApplier using
+// id as the current replica ID, the supplied membership history, and
+// the supplied abstractions. Replicas other than members of the view
+// only keep track of the requests. The primary decides on admission
+// of the request and supplies the input for executing the request
+// chosen by generateInput. A rejected request is ordered as well, so
+// that all replicas reply the same rejection.
+func makeRequestApplier(id uint32, history membership.State, admitRequest requestAdmitter, generateInput inputGenerator, handleGeneratedMessage generatedMessageHandler, startReqTimer requestTimerStarter, startPrepTimer prepareTimerStarter, forwardRequest requestForwarder) requestApplier {
 	return func(request messages.Request, view uint64) error {
+		if !history.IsMember(view, id) {
+			return nil
+		}
+
 		// The primary has to start request timer, as well.
 		// Suppose, the primary is correct, but its messages
 		// are delayed, and other replicas switch to a new
@@ -193,16 +319,98 @@ func makeRequestApplier(id, n uint32, handleGeneratedMessage generatedMessageHan
 		// change, should the new primary be faulty.
 		startReqTimer(request, view)
 
-		if isPrimary(view, id, n) {
-			handleGeneratedMessage(messageImpl.NewPrepare(id, view, request))
+		if primaryID := history.Primary(view); primaryID == id {
+			rejection := ""
+			if err := admitRequest(request); err != nil {
+				rejection = err.Error()
+			}
+			reconfig := request.Kind() == api.ReconfigurationRequest && rejection == ""
+			history.Propose(view, request.ClientID(), request.Sequence(), reconfig, func() (cv uint64) {
+				input := generateInput()
+				var prepare messages.Prepare
+				if rejection != "" {
+					prepare = messageImpl.NewRejectingPrepare(id, view, request, input.Timestamp.UnixNano(), input.Seed, rejection)
+				} else {
+					prepare = messageImpl.NewPrepareWithInput(id, view, request, input.Timestamp.UnixNano(), input.Seed)
+				}
+				handleGeneratedMessage(prepare)
+				if !reconfig {
+					return 0
+				}
+				ui, err := parseMessageUI(prepare)
+				if err != nil {
+					panic(err)
+				}
+				return ui.Counter
+			})
 		} else {
 			startPrepTimer(request, view)
+			forwardRequest(request, primaryID)
 		}
 
 		return nil
 	}
 }
 
+// makeRequestForwarder constructs an instance of requestForwarder
+// using the supplied connector. Clients send their requests to the
+// replicas of the initial membership, but may learn of the replicas
+// joined later with delay, so that only requests to those are
+// forwarded. Requests not fitting into the
+// bounded queue of a replica are dropped, as if lost in the network,
+// so that a slow replica cannot exhaust resources of this one.
+func makeRequestForwarder(initial *api.Membership, connector api.ReplicaConnector, logger *logging.Logger) requestForwarder {
+	var (
+		lock sync.Mutex
+
+		// Replica ID -> stream to forward Request messages
+		streams = make(map[uint32]chan<- []byte)
+	)
+
+	for _, r := range initial.Replicas {
+		streams[r.ID] = nil
+	}
+
+	return func(request messages.Request, primaryID uint32) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		out, ok := streams[primaryID]
+		if !ok {
+			sh := connector.ReplicaMessageStreamHandler(primaryID)
+			if sh == nil {
+				logger.Errorf("Cannot forward requests to replica %d", primaryID)
+				return
+			}
+
+			c := make(chan []byte, forwardQueueSize)
+			in := sh.HandleMessageStream(c)
+			go func() {
+				for range in {
+					// Replies are delivered to clients directly
+				}
+			}()
+
+			out = c
+			streams[primaryID] = out
+		}
+		if out == nil {
+			return
+		}
+
+		msgBytes, err := request.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		select {
+		case out <- msgBytes:
+		default:
+			logger.Warningf("Dropped %s forwarded to replica %d: queue full",
+				messages.Stringify(request), primaryID)
+		}
+	}
+}
+
 // makeRequestReplier constructs an instance of requestReplier using
 // the supplied client state provider.
 func makeRequestReplier(provider clientstate.Provider) requestReplier {
@@ -214,35 +422,207 @@ func makeRequestReplier(provider clientstate.Provider) requestReplier {
 
 // makeRequestExecutor constructs an instance of requestExecutor using
 // the supplied replica ID, operation executor, message signer, and
-// reply consumer.
+// reply consumer. Replies are generated in the order of execution,
+// even if the results become ready in a different order; rejections
+// are replied in that order, too. Timestamps supplied to the
+// operation executor never decrease, even if chosen by primaries with
+// clocks apart.
 func makeRequestExecutor(id uint32, executor operationExecutor, handleGeneratedMessage generatedMessageHandler) requestExecutor {
-	return func(request messages.Request) {
-		resultChan := executor(request.Operation())
+	// Closed once the replies to all requests executed so far
+	// are generated
+	prevDone := make(chan struct{})
+	close(prevDone)
+
+	var lastTimestamp time.Time
+
+	return func(request messages.Request, input api.ExecutionInput, rejection string) {
+		var resultChan <-chan api.ExecutionResult
+		if rejection == "" {
+			if input.Timestamp.Before(lastTimestamp) {
+				input.Timestamp = lastTimestamp
+			}
+			lastTimestamp = input.Timestamp
+
+			resultChan = executor(request.Kind(), request.Operation(), input)
+		}
+		wait, done := prevDone, make(chan struct{})
+		prevDone = done
 		go func() {
-			result := <-resultChan
-
-			reply := messageImpl.NewReply(id, request.ClientID(), request.Sequence(), result)
+			var result api.ExecutionResult
+			if resultChan != nil {
+				result = <-resultChan
+			}
+			<-wait
+
+			var reply messages.Reply
+			if rejection != "" {
+				reply = messageImpl.NewRejection(id, request.ClientID(), request.Sequence(), rejection)
+			} else if err := result.Error; err != nil {
+				reply = messageImpl.NewFailedReply(id, request.ClientID(), request.Sequence(), result.Result, err.Error())
+			} else {
+				reply = messageImpl.NewReply(id, request.ClientID(), request.Sequence(), result.Result)
+			}
 			handleGeneratedMessage(reply)
+			close(done)
 		}()
 	}
 }
 
 // makeOperationExecutor constructs an instance of operationExecutor
 // using the supplied interface to external request consumer module.
+// Only operations of api.OperationRequest kind are executed; other
+// kinds have to be handled before. If the module implements
+// api.ConflictKeyer interface then
+// operations that do not conflict are executed concurrently. The
+// input is supplied to the module only if it implements
+// api.InputConsumer or api.StatusConsumer interface; errors of
+// execution are reported only by the latter.
 func makeOperationExecutor(consumer api.RequestConsumer) operationExecutor {
 	busy := uint32(0) // atomic flag to check for concurrent execution
 
-	return func(op []byte) <-chan []byte {
+	var deliver operationDeliverer
+	if statusConsumer, ok := consumer.(api.StatusConsumer); ok {
+		deliver = statusConsumer.DeliverWithStatus
+	} else if inputConsumer, ok := consumer.(api.InputConsumer); ok {
+		deliver = func(op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+			return successfulResult(inputConsumer.DeliverWithInput(op, input))
+		}
+	} else {
+		deliver = func(op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+			return successfulResult(consumer.Deliver(op))
+		}
+	}
+	if keyer, ok := consumer.(api.ConflictKeyer); ok {
+		deliver = makeConcurrentDeliverer(deliver, keyer)
+	}
+
+	return func(kind api.RequestKind, op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		if kind != api.OperationRequest {
+			panic("Unexpected request kind")
+		}
 		if wasBusy := atomic.SwapUint32(&busy, uint32(1)); wasBusy != uint32(0) {
 			panic("Concurrent operation execution detected")
 		}
-		resultChan := consumer.Deliver(op)
+		resultChan := deliver(op, input)
 		atomic.StoreUint32(&busy, uint32(0))
 
 		return resultChan
 	}
 }
 
+// operationDeliverer delivers an operation to the request consumer
+// module for execution with the supplied input and returns a channel
+// to receive the outcome from.
+type operationDeliverer func(operation []byte, input api.ExecutionInput) (resultChan <-chan api.ExecutionResult)
+
+// makeConcurrentDeliverer constructs an instance of
+// operationDeliverer using the supplied one. Delivery of an operation
+// is postponed until execution of all previously delivered
+// conflicting operations is complete.
+func makeConcurrentDeliverer(deliver operationDeliverer, keyer api.ConflictKeyer) operationDeliverer {
+	tracker := conflicttracker.New()
+
+	return func(op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		reads, writes, ok := keyer.ConflictKeys(op)
+		ready, release := tracker.Acquire(reads, writes, !ok)
+
+		resultChan := make(chan api.ExecutionResult, 1)
+		go func() {
+			<-ready
+			result := <-deliver(op, input)
+			release()
+			resultChan <- result
+		}()
+
+		return resultChan
+	}
+}
+
+// successfulResult converts results of execution received from the
+// supplied channel into outcomes of successful execution.
+func successfulResult(in <-chan []byte) <-chan api.ExecutionResult {
+	out := make(chan api.ExecutionResult, 1)
+	go func() {
+		out <- api.ExecutionResult{Result: <-in}
+	}()
+	return out
+}
+
+// makeInputGenerator constructs an instance of inputGenerator using
+// the supplied clock. Timestamps never decrease; seeds are random.
+func makeInputGenerator(now func() time.Time) inputGenerator {
+	var (
+		lock          sync.Mutex
+		lastTimestamp time.Time
+	)
+
+	return func() api.ExecutionInput {
+		seed := make([]byte, inputSeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			panic(err)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		timestamp := now()
+		if timestamp.Before(lastTimestamp) {
+			timestamp = lastTimestamp
+		}
+		lastTimestamp = timestamp
+
+		return api.ExecutionInput{Timestamp: timestamp, Seed: seed}
+	}
+}
+
+// makeInputValidator constructs an instance of inputValidator using
+// the supplied clock and the maximal clock skew to tolerate between
+// the primary and this replica; zero skew means no limit. Timestamps
+// in the past are accepted, since Prepare messages are also
+// validated long after ordering, e.g. embedded into Commit messages;
+// their age is checked only as of committing, by inputAgeChecker.
+func makeInputValidator(now func() time.Time, maxClockSkew time.Duration) inputValidator {
+	return func(input api.ExecutionInput) error {
+		if len(input.Seed) != inputSeedSize {
+			return fmt.Errorf("Seed of %d bytes, expected %d", len(input.Seed), inputSeedSize)
+		}
+
+		if maxClockSkew != 0 {
+			if ahead := input.Timestamp.Sub(now()); ahead > maxClockSkew {
+				return fmt.Errorf("Timestamp %s ahead of local clock", ahead)
+			}
+		}
+
+		return nil
+	}
+}
+
+// makeInputAgeChecker constructs an instance of inputAgeChecker
+// using the supplied clock and the maximal age of timestamps to
+// tolerate; zero age means no limit. Since the timestamps never
+// decrease in the order of execution, a primary with its clock behind
+// would otherwise hold back the time observed by request consumers.
+func makeInputAgeChecker(now func() time.Time, maxAge time.Duration) inputAgeChecker {
+	return func(input api.ExecutionInput) error {
+		if maxAge != 0 {
+			if behind := now().Sub(input.Timestamp); behind > maxAge {
+				return fmt.Errorf("Timestamp %s behind local clock", behind)
+			}
+		}
+
+		return nil
+	}
+}
+
+// prepareInput returns non-deterministic input for executing the
+// request chosen by the primary in the Prepare message.
+func prepareInput(prepare messages.Prepare) api.ExecutionInput {
+	return api.ExecutionInput{
+		Timestamp: time.Unix(0, prepare.Timestamp()),
+		Seed:      prepare.Seed(),
+	}
+}
+
 // makeRequestSeqCapturer constructs an instance of requestSeqCapturer
 // using the supplied client state provider.
 func makeRequestSeqCapturer(provideClientState clientstate.Provider) requestSeqCapturer {
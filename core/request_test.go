@@ -29,8 +29,11 @@ import (
 	logging "github.com/op/go-logging"
 	testifymock "github.com/stretchr/testify/mock"
 
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/admission"
 	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
 	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/messages/batch"
 
 	mock_api "github.com/hyperledger-labs/minbft/api/mocks"
 	mock_clientstate "github.com/hyperledger-labs/minbft/core/internal/clientstate/mocks"
@@ -109,8 +112,8 @@ func TestMakeRequestApplier(t *testing.T) {
 
 	n := randN()
 	ownView := randView()
-	otherView := randOtherView(ownView)
 	id := primaryID(n, ownView)
+	otherView := viewForPrimary(n, randOtherReplicaID(id, n))
 
 	handleGeneratedMessage := func(msg messages.ReplicaMessage) {
 		mock.MethodCalled("generatedMessageHandler", msg)
@@ -121,23 +124,155 @@ func TestMakeRequestApplier(t *testing.T) {
 	startPrepTimer := func(request messages.Request, view uint64) {
 		mock.MethodCalled("prepareTimerStarter", request, view)
 	}
-	apply := makeRequestApplier(id, n, handleGeneratedMessage, startReqTimer, startPrepTimer)
+	forwardRequest := func(request messages.Request, primaryID uint32) {
+		mock.MethodCalled("requestForwarder", request, primaryID)
+	}
+	admitRequest := func(request messages.Request) error {
+		args := mock.MethodCalled("requestAdmitter", request)
+		return args.Error(0)
+	}
+	input := api.ExecutionInput{Timestamp: time.Unix(0, rand.Int63()), Seed: []byte("seed")}
+	generateInput := func() api.ExecutionInput {
+		return input
+	}
+	apply := makeRequestApplier(id, staticMembership(n, (n-1)/2), admitRequest, generateInput, handleGeneratedMessage, startReqTimer, startPrepTimer, forwardRequest)
 
 	clientID := rand.Uint32()
 	request := messageImpl.NewRequest(clientID, rand.Uint64(), nil)
-	prepare := messageImpl.NewPrepare(id, ownView, request)
+	prepare := messageImpl.NewPrepareWithInput(id, ownView, request, input.Timestamp.UnixNano(), input.Seed)
 
 	mock.On("requestTimerStarter", request, otherView).Once()
 	mock.On("prepareTimerStarter", request, otherView).Once()
+	mock.On("requestForwarder", request, primaryID(n, otherView)).Once()
 	err := apply(request, otherView)
 	assert.NoError(t, err)
 
 	mock.On("requestTimerStarter", request, ownView).Once()
+	mock.On("requestAdmitter", request).Return(nil).Once()
+	mock.On("generatedMessageHandler", prepare).Once()
+	err = apply(request, ownView)
+	assert.NoError(t, err)
+
+	request = messageImpl.NewRequest(clientID, request.Sequence()+1, nil)
+	prepare = messageImpl.NewRejectingPrepare(id, ownView, request, input.Timestamp.UnixNano(), input.Seed, "rejected")
+
+	mock.On("requestTimerStarter", request, ownView).Once()
+	mock.On("requestAdmitter", request).Return(fmt.Errorf("rejected")).Once()
 	mock.On("generatedMessageHandler", prepare).Once()
 	err = apply(request, ownView)
 	assert.NoError(t, err)
 }
 
+func TestMakeRequestForwarder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const joinedID = 3
+
+	var out <-chan []byte
+	sh := mock_api.NewMockMessageStreamHandler(ctrl)
+	sh.EXPECT().HandleMessageStream(gomock.Any()).DoAndReturn(func(in <-chan []byte) <-chan []byte {
+		out = in
+		return make(chan []byte)
+	})
+	connector := replicaConnectorFunc(func(replicaID uint32) api.MessageStreamHandler {
+		require.Equal(t, uint32(joinedID), replicaID)
+		return sh
+	})
+	forward := makeRequestForwarder(staticMembership(3, 1).Membership(0), connector, logging.MustGetLogger(module))
+
+	request := messageImpl.NewRequest(rand.Uint32(), rand.Uint64(), nil)
+	forward(request, 0) // initial replica, not forwarded
+
+	// Requests beyond the queue are dropped without blocking
+	for i := 0; i <= forwardQueueSize; i++ {
+		forward(request, joinedID)
+	}
+	require.Len(t, out, forwardQueueSize)
+
+	reqBytes, err := request.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, reqBytes, <-out)
+}
+
+// replicaConnectorFunc implements api.ReplicaConnector with a function.
+type replicaConnectorFunc func(replicaID uint32) api.MessageStreamHandler
+
+func (f replicaConnectorFunc) ReplicaMessageStreamHandler(replicaID uint32) api.MessageStreamHandler {
+	return f(replicaID)
+}
+
+func TestMakeRequestAdmitter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pendingReq := mock_requestlist.NewMockList(ctrl)
+	validateOperation := func(kind api.RequestKind, operation []byte) error {
+		if len(operation) > 0 && operation[0] != 0 {
+			return fmt.Errorf("invalid operation")
+		}
+		return nil
+	}
+	controller := admission.New(admission.Policy{MaxOperationSize: 1, MaxInFlight: 1})
+	admit := makeRequestAdmitter(validateOperation, controller, pendingReq, logging.MustGetLogger(module))
+
+	clientID := rand.Uint32()
+	request := messageImpl.NewRequest(clientID, 1, []byte{1})
+	err := admit(request)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation")
+
+	request = messageImpl.NewRequest(clientID, 1, []byte{0})
+	pendingReq.EXPECT().Len().Return(1)
+	assert.NoError(t, admit(request))
+
+	request = messageImpl.NewRequest(clientID, 2, []byte{0, 1})
+	pendingReq.EXPECT().Len().Return(1)
+	assert.Error(t, admit(request))
+
+	request = messageImpl.NewRequest(clientID, 2, []byte{0})
+	pendingReq.EXPECT().Len().Return(2)
+	assert.Error(t, admit(request))
+}
+
+func TestMakeOperationValidator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := mock_api.NewMockRequestConsumer(ctrl)
+	validate := makeOperationValidator(consumer)
+	assert.NoError(t, validate(api.OperationRequest, []byte("operation")))
+
+	validator := mock_api.NewMockOperationValidator(ctrl)
+	validate = makeOperationValidator(&struct {
+		api.RequestConsumer
+		api.OperationValidator
+	}{consumer, validator})
+
+	validator.EXPECT().ValidateOperation([]byte("invalid")).Return(fmt.Errorf("invalid"))
+	assert.Error(t, validate(api.OperationRequest, []byte("invalid")))
+
+	validator.EXPECT().ValidateOperation([]byte("valid")).Return(nil)
+	assert.NoError(t, validate(api.OperationRequest, []byte("valid")))
+
+	// Reconfiguration operations are not passed to the consumer
+	rc := &api.Reconfiguration{Remove: []uint32{0}, F: 1}
+	assert.NoError(t, validate(api.ReconfigurationRequest, MakeReconfigurationOperation(rc, 0, nil)))
+
+	// Each operation of a batch is validated
+	validator.EXPECT().ValidateOperation([]byte("valid")).Return(nil)
+	validator.EXPECT().ValidateOperation([]byte("invalid")).Return(fmt.Errorf("invalid"))
+	assert.Error(t, validate(api.BatchRequest, batch.MakeOperation([][]byte{[]byte("valid"), []byte("invalid")})))
+
+	validator.EXPECT().ValidateOperation([]byte("valid")).Return(nil).Times(2)
+	assert.NoError(t, validate(api.BatchRequest, batch.MakeOperation([][]byte{[]byte("valid"), []byte("valid")})))
+
+	// Batches are validated as a whole only in requests of batch kind
+	op := batch.MakeOperation([][]byte{[]byte("valid")})
+	validator.EXPECT().ValidateOperation(op).Return(fmt.Errorf("invalid"))
+	assert.Error(t, validate(api.OperationRequest, op))
+}
+
 func TestMakeRequestValidator(t *testing.T) {
 	mock := new(testifymock.Mock)
 	defer mock.AssertExpectations(t)
@@ -157,6 +292,10 @@ func TestMakeRequestValidator(t *testing.T) {
 	mock.On("messageSignatureVerifier", request).Return(nil).Once()
 	err = validate(request)
 	assert.NoError(t, err)
+
+	request = messageImpl.NewRequestWithKind(0, rand.Uint64(), api.RequestKind(-1), nil)
+	err = validate(request)
+	assert.Error(t, err)
 }
 
 func TestMakeRequestExecutor(t *testing.T) {
@@ -175,23 +314,93 @@ func TestMakeRequestExecutor(t *testing.T) {
 	request := messageImpl.NewRequest(clientID, seq, expectedOperation)
 	expectedReply := messageImpl.NewReply(replicaID, clientID, seq, expectedResult)
 
-	execute := func(operation []byte) <-chan []byte {
-		args := mock.MethodCalled("operationExecutor", operation)
-		return args.Get(0).(chan []byte)
+	execute := func(kind api.RequestKind, operation []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+		args := mock.MethodCalled("operationExecutor", kind, operation, input)
+		return args.Get(0).(chan api.ExecutionResult)
 	}
 	handleGeneratedMessage := func(msg messages.ReplicaMessage) {
 		mock.MethodCalled("generatedMessageHandler", msg)
 	}
 	requestExecutor := makeRequestExecutor(replicaID, execute, handleGeneratedMessage)
 
-	resultChan := make(chan []byte, 1)
-	resultChan <- expectedResult
+	input := api.ExecutionInput{Timestamp: time.Unix(0, rand.Int63()), Seed: []byte("seed")}
+
+	resultChan := make(chan api.ExecutionResult, 1)
+	resultChan <- api.ExecutionResult{Result: expectedResult}
 	done := make(chan struct{})
-	mock.On("operationExecutor", expectedOperation).Return(resultChan).Once()
+	mock.On("operationExecutor", api.OperationRequest, expectedOperation, input).Return(resultChan).Once()
+	mock.On("generatedMessageHandler", expectedReply).Run(
+		func(testifymock.Arguments) { close(done) },
+	).Once()
+	requestExecutor(request, input, "")
+	<-done
+
+	// Replies are generated in the order of execution
+	request2 := messageImpl.NewRequest(clientID, seq+1, expectedOperation)
+	expectedReply2 := messageImpl.NewReply(replicaID, clientID, seq+1, expectedResult)
+	resultChan1, resultChan2 := make(chan api.ExecutionResult, 1), make(chan api.ExecutionResult, 1)
+	input2 := api.ExecutionInput{Timestamp: input.Timestamp.Add(-time.Second), Seed: []byte("seed2")}
+	mock.On("operationExecutor", api.OperationRequest, expectedOperation, input).Return(resultChan1).Once()
+	// Timestamps never decrease
+	mock.On("operationExecutor", api.OperationRequest, expectedOperation, api.ExecutionInput{Timestamp: input.Timestamp, Seed: input2.Seed}).Return(resultChan2).Once()
+	requestExecutor(request, input, "")
+	requestExecutor(request2, input2, "")
+
+	replied := make(chan struct{})
+	done = make(chan struct{})
 	mock.On("generatedMessageHandler", expectedReply).Run(
+		func(testifymock.Arguments) { close(replied) },
+	).Once()
+	mock.On("generatedMessageHandler", expectedReply2).Run(
+		func(testifymock.Arguments) {
+			select {
+			case <-replied:
+			default:
+				t.Error("Reply generated out of order")
+			}
+			close(done)
+		},
+	).Once()
+	resultChan2 <- api.ExecutionResult{Result: expectedResult}
+	resultChan1 <- api.ExecutionResult{Result: expectedResult}
+	<-done
+
+	// Errors of execution are replied
+	request3 := messageImpl.NewRequest(clientID, seq+2, expectedOperation)
+	expectedReply3 := messageImpl.NewFailedReply(replicaID, clientID, seq+2, expectedResult, "failed")
+	resultChan = make(chan api.ExecutionResult, 1)
+	resultChan <- api.ExecutionResult{Result: expectedResult, Error: fmt.Errorf("failed")}
+	done = make(chan struct{})
+	mock.On("operationExecutor", api.OperationRequest, expectedOperation, input).Return(resultChan).Once()
+	mock.On("generatedMessageHandler", expectedReply3).Run(
 		func(testifymock.Arguments) { close(done) },
 	).Once()
-	requestExecutor(request)
+	requestExecutor(request3, input, "")
+	<-done
+
+	// Rejections are replied in order without execution
+	request4 := messageImpl.NewRequest(clientID, seq+3, expectedOperation)
+	expectedReply4 := messageImpl.NewRejection(replicaID, clientID, seq+3, "rejected")
+	resultChan = make(chan api.ExecutionResult, 1)
+	replied = make(chan struct{})
+	done = make(chan struct{})
+	mock.On("operationExecutor", api.OperationRequest, expectedOperation, input).Return(resultChan).Once()
+	mock.On("generatedMessageHandler", expectedReply3).Run(
+		func(testifymock.Arguments) { close(replied) },
+	).Once()
+	mock.On("generatedMessageHandler", expectedReply4).Run(
+		func(testifymock.Arguments) {
+			select {
+			case <-replied:
+			default:
+				t.Error("Reply generated out of order")
+			}
+			close(done)
+		},
+	).Once()
+	requestExecutor(request3, input, "")
+	requestExecutor(request4, input, "rejected")
+	resultChan <- api.ExecutionResult{Result: expectedResult, Error: fmt.Errorf("failed")}
 	<-done
 }
 
@@ -211,8 +420,8 @@ func TestMakeOperationExecutor(t *testing.T) {
 	// Normal execution
 	resChan <- expectedRes
 	consumer.EXPECT().Deliver(op).Return(resChan)
-	res := <-executor(op)
-	assert.Equal(t, expectedRes, res)
+	res := <-executor(api.OperationRequest, op, api.ExecutionInput{})
+	assert.Equal(t, api.ExecutionResult{Result: expectedRes}, res)
 
 	// Concurrent execution
 	started := make(chan struct{})
@@ -223,19 +432,198 @@ func TestMakeOperationExecutor(t *testing.T) {
 		<-exit
 	})
 	go func() {
-		res := <-executor(op)
-		assert.Equal(t, expectedRes, res)
+		res := <-executor(api.OperationRequest, op, api.ExecutionInput{})
+		assert.Equal(t, api.ExecutionResult{Result: expectedRes}, res)
 		done <- struct{}{}
 	}()
 	<-started
 	assert.Panics(t, func() {
-		_ = executor(op)
+		_ = executor(api.OperationRequest, op, api.ExecutionInput{})
 	})
 	close(exit)
 	resChan <- expectedRes
 	<-done
 }
 
+func TestMakeOperationExecutorWithInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := &inputConsumer{
+		mock_api.NewMockRequestConsumer(ctrl),
+		mock_api.NewMockInputConsumer(ctrl),
+	}
+	executor := makeOperationExecutor(consumer)
+
+	op := make([]byte, 1)
+	expectedRes := make([]byte, 1)
+	rand.Read(op)
+	rand.Read(expectedRes)
+	input := api.ExecutionInput{Timestamp: time.Unix(0, rand.Int63()), Seed: []byte("seed")}
+
+	resChan := make(chan []byte, 1)
+	resChan <- expectedRes
+	consumer.MockInputConsumer.EXPECT().DeliverWithInput(op, input).Return(resChan)
+	res := <-executor(api.OperationRequest, op, input)
+	assert.Equal(t, api.ExecutionResult{Result: expectedRes}, res)
+}
+
+func TestMakeOperationExecutorWithStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := &statusConsumer{
+		mock_api.NewMockRequestConsumer(ctrl),
+		mock_api.NewMockStatusConsumer(ctrl),
+	}
+	executor := makeOperationExecutor(consumer)
+
+	op := make([]byte, 1)
+	rand.Read(op)
+	input := api.ExecutionInput{Timestamp: time.Unix(0, rand.Int63()), Seed: []byte("seed")}
+	expectedRes := api.ExecutionResult{Error: fmt.Errorf("failed")}
+
+	resChan := make(chan api.ExecutionResult, 1)
+	resChan <- expectedRes
+	consumer.MockStatusConsumer.EXPECT().DeliverWithStatus(op, input).Return(resChan)
+	res := <-executor(api.OperationRequest, op, input)
+	assert.Equal(t, expectedRes, res)
+}
+
+// inputConsumer implements api.InputConsumer in addition to
+// api.RequestConsumer.
+type inputConsumer struct {
+	*mock_api.MockRequestConsumer
+	*mock_api.MockInputConsumer
+}
+
+// statusConsumer implements api.StatusConsumer in addition to
+// api.RequestConsumer.
+type statusConsumer struct {
+	*mock_api.MockRequestConsumer
+	*mock_api.MockStatusConsumer
+}
+
+func TestMakeOperationExecutorConcurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consumer := &conflictKeyerConsumer{mock_api.NewMockRequestConsumer(ctrl)}
+	executor := makeOperationExecutor(consumer)
+
+	started := make(chan string, 4)
+	resChans := make(map[string]chan []byte)
+	expect := func(op string) {
+		resChan := make(chan []byte, 1)
+		resChans[op] = resChan
+		consumer.EXPECT().Deliver([]byte(op)).Return(resChan).Do(func([]byte) {
+			started <- op
+		})
+	}
+	assertStarted := func(ops ...string) {
+		var actual []string
+		for range ops {
+			select {
+			case op := <-started:
+				actual = append(actual, op)
+			case <-time.After(time.Second):
+				require.Fail(t, "operation not started")
+			}
+		}
+		assert.ElementsMatch(t, ops, actual)
+		select {
+		case op := <-started:
+			assert.Fail(t, "unexpected operation started", op)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	complete := func(op string, resChan <-chan api.ExecutionResult) {
+		resChans[op] <- []byte(op)
+		assert.Equal(t, []byte(op), (<-resChan).Result)
+	}
+
+	for _, op := range []string{"wa", "wb", "ra", "rb", "*"} {
+		expect(op)
+	}
+	waRes := executor(api.OperationRequest, []byte("wa"), api.ExecutionInput{})
+	wbRes := executor(api.OperationRequest, []byte("wb"), api.ExecutionInput{})
+	raRes := executor(api.OperationRequest, []byte("ra"), api.ExecutionInput{})
+	rbRes := executor(api.OperationRequest, []byte("rb"), api.ExecutionInput{})
+	allRes := executor(api.OperationRequest, []byte("*"), api.ExecutionInput{})
+	assertStarted("wa", "wb")
+
+	complete("wb", wbRes)
+	assertStarted("rb")
+	complete("wa", waRes)
+	assertStarted("ra")
+	complete("ra", raRes)
+	assertStarted()
+	complete("rb", rbRes)
+	assertStarted("*")
+	complete("*", allRes)
+}
+
+// conflictKeyerConsumer interprets operation "r<key>" as reading the
+// key and "w<key>" as writing the key. Any other operation conflicts
+// with all operations.
+type conflictKeyerConsumer struct {
+	*mock_api.MockRequestConsumer
+}
+
+func (conflictKeyerConsumer) ConflictKeys(op []byte) (reads, writes []string, ok bool) {
+	switch op[0] {
+	case 'r':
+		return []string{string(op[1:])}, nil, true
+	case 'w':
+		return nil, []string{string(op[1:])}, true
+	default:
+		return nil, nil, false
+	}
+}
+
+func TestMakeInputGenerator(t *testing.T) {
+	now := time.Now()
+	generate := makeInputGenerator(func() time.Time { return now })
+
+	input1 := generate()
+	assert.Equal(t, now, input1.Timestamp)
+	assert.Len(t, input1.Seed, inputSeedSize)
+
+	// Timestamps never decrease
+	now = now.Add(-time.Second)
+	input2 := generate()
+	assert.Equal(t, input1.Timestamp, input2.Timestamp)
+	assert.NotEqual(t, input1.Seed, input2.Seed)
+}
+
+func TestMakeInputValidator(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	seed := make([]byte, inputSeedSize)
+
+	validate := makeInputValidator(clock, time.Second)
+	assert.NoError(t, validate(api.ExecutionInput{Timestamp: now.Add(time.Second), Seed: seed}))
+	assert.NoError(t, validate(api.ExecutionInput{Timestamp: now.Add(-time.Hour), Seed: seed}))
+	assert.Error(t, validate(api.ExecutionInput{Timestamp: now.Add(2 * time.Second), Seed: seed}))
+	assert.Error(t, validate(api.ExecutionInput{Timestamp: now, Seed: seed[1:]}))
+
+	validate = makeInputValidator(clock, 0)
+	assert.NoError(t, validate(api.ExecutionInput{Timestamp: now.Add(time.Hour), Seed: seed}))
+}
+
+func TestMakeInputAgeChecker(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	check := makeInputAgeChecker(clock, time.Second)
+	assert.NoError(t, check(api.ExecutionInput{Timestamp: now.Add(-time.Second)}))
+	assert.NoError(t, check(api.ExecutionInput{Timestamp: now.Add(time.Hour)}))
+	assert.Error(t, check(api.ExecutionInput{Timestamp: now.Add(-2 * time.Second)}))
+
+	check = makeInputAgeChecker(clock, 0)
+	assert.NoError(t, check(api.ExecutionInput{Timestamp: now.Add(-time.Hour)}))
+}
+
 func TestMakeRequestSeqCapturer(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
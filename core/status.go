@@ -0,0 +1,120 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
+	"github.com/hyperledger-labs/minbft/core/internal/peerstate"
+	"github.com/hyperledger-labs/minbft/core/internal/requestlist"
+	"github.com/hyperledger-labs/minbft/core/internal/viewstate"
+	"github.com/hyperledger-labs/minbft/messages"
+)
+
+// replicaStatusReporter returns a snapshot of the replica state.
+//
+// It is safe to invoke concurrently.
+type replicaStatusReporter func() *api.ReplicaStatus
+
+// lastExecutedProvider returns the request executed most recently,
+// or nil if none has been executed yet.
+//
+// It is safe to invoke concurrently.
+type lastExecutedProvider func() *api.RequestID
+
+// makeExecutionTracker constructs a generatedMessageHandler that
+// passes generated messages on to the supplied handler, keeping track
+// of the request executed most recently, since a Reply message is
+// generated upon execution of each request. It also returns an
+// instance of lastExecutedProvider to get the tracked request.
+func makeExecutionTracker(handleGeneratedMessage generatedMessageHandler) (generatedMessageHandler, lastExecutedProvider) {
+	var (
+		lock sync.Mutex
+		last *api.RequestID
+	)
+
+	track := func(msg messages.ReplicaMessage) {
+		if reply, ok := msg.(messages.Reply); ok && reply.Rejection() == "" {
+			lock.Lock()
+			last = &api.RequestID{ClientID: reply.ClientID(), Seq: reply.Sequence()}
+			lock.Unlock()
+		}
+		handleGeneratedMessage(msg)
+	}
+
+	lastExecuted := func() *api.RequestID {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if last == nil {
+			return nil
+		}
+		id := *last
+		return &id
+	}
+
+	return track, lastExecuted
+}
+
+// makeReplicaStatusReporter constructs an instance of
+// replicaStatusReporter using id as the current replica ID, the
+// supplied membership history, and the supplied abstract interfaces.
+func makeReplicaStatusReporter(id uint32, history membership.State, viewState viewstate.State, pendingReq requestlist.List, listClients clientstate.Lister, listPeers peerstate.Lister, lastExecuted lastExecutedProvider) replicaStatusReporter {
+	return func() *api.ReplicaStatus {
+		current, expected, release := viewState.HoldView()
+		release()
+
+		m := history.Membership(current)
+
+		status := &api.ReplicaStatus{
+			ReplicaID:    id,
+			CurrentView:  current,
+			ExpectedView: expected,
+			Primary:      history.Primary(current),
+			Epoch:        m.Epoch,
+			F:            m.F,
+			LastExecuted: lastExecuted(),
+		}
+
+		for _, r := range m.Replicas {
+			status.Members = append(status.Members, r.ID)
+			status.Addresses = append(status.Addresses, r.Address)
+		}
+
+		for _, req := range pendingReq.All() {
+			status.Pending = append(status.Pending,
+				api.RequestID{ClientID: req.ClientID(), Seq: req.Sequence()})
+		}
+
+		for _, c := range listClients() {
+			status.Clients = append(status.Clients, api.ClientStatus{
+				ClientID:         c.ClientID,
+				LastAcceptedSeq:  c.LastCapturedSeq,
+				LastPreparedSeq:  c.LastPreparedSeq,
+				LastCommittedSeq: c.LastRetiredSeq,
+			})
+		}
+
+		for _, p := range listPeers() {
+			status.Peers = append(status.Peers,
+				api.PeerStatus{ReplicaID: p.ReplicaID, LastUICounter: p.LastCV})
+		}
+
+		return status
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minbft
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/core/internal/clientstate"
+	"github.com/hyperledger-labs/minbft/core/internal/peerstate"
+	"github.com/hyperledger-labs/minbft/messages"
+
+	mock_requestlist "github.com/hyperledger-labs/minbft/core/internal/requestlist/mocks"
+	mock_viewstate "github.com/hyperledger-labs/minbft/core/internal/viewstate/mocks"
+)
+
+func TestMakeExecutionTracker(t *testing.T) {
+	var handled []messages.ReplicaMessage
+	handle := func(msg messages.ReplicaMessage) {
+		handled = append(handled, msg)
+	}
+
+	track, lastExecuted := makeExecutionTracker(handle)
+	assert.Nil(t, lastExecuted())
+
+	commit := messageImpl.NewCommit(1, messageImpl.NewPrepare(0, 0, messageImpl.NewRequest(2, 3, nil)))
+	track(commit)
+	assert.Nil(t, lastExecuted())
+
+	reply := messageImpl.NewReply(1, 2, 3, nil)
+	track(reply)
+	assert.Equal(t, &api.RequestID{ClientID: 2, Seq: 3}, lastExecuted())
+
+	rejection := messageImpl.NewRejection(1, 2, 4, "rejected")
+	track(rejection)
+	assert.Equal(t, &api.RequestID{ClientID: 2, Seq: 3}, lastExecuted())
+
+	assert.Equal(t, []messages.ReplicaMessage{commit, reply, rejection}, handled)
+}
+
+func TestMakeReplicaStatusReporter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const id, n = 1, 3
+
+	viewState := mock_viewstate.NewMockState(ctrl)
+	pendingReq := mock_requestlist.NewMockList(ctrl)
+	listClients := func() []clientstate.Status {
+		return []clientstate.Status{{ClientID: 2, LastCapturedSeq: 5, LastPreparedSeq: 4, LastRetiredSeq: 3}}
+	}
+	listPeers := func() []peerstate.Status {
+		return []peerstate.Status{{ReplicaID: 0, LastCV: 7}, {ReplicaID: 2, LastCV: 6}}
+	}
+	lastExecuted := func() *api.RequestID {
+		return &api.RequestID{ClientID: 2, Seq: 3}
+	}
+
+	report := makeReplicaStatusReporter(id, staticMembership(n, 1), viewState, pendingReq, listClients, listPeers, lastExecuted)
+
+	released := false
+	viewState.EXPECT().HoldView().Return(uint64(4), uint64(5), func() { released = true })
+	pendingReq.EXPECT().All().Return([]messages.Request{
+		messageImpl.NewRequest(2, 4, nil),
+		messageImpl.NewRequest(2, 5, nil),
+	})
+
+	assert.Equal(t, &api.ReplicaStatus{
+		ReplicaID:    id,
+		CurrentView:  4,
+		ExpectedView: 5,
+		Primary:      1,
+		F:            1,
+		Members:      []uint32{0, 1, 2},
+		Addresses:    []string{"", "", ""},
+		LastExecuted: &api.RequestID{ClientID: 2, Seq: 3},
+		Pending:      []api.RequestID{{ClientID: 2, Seq: 4}, {ClientID: 2, Seq: 5}},
+		Clients: []api.ClientStatus{{
+			ClientID:         2,
+			LastAcceptedSeq:  5,
+			LastPreparedSeq:  4,
+			LastCommittedSeq: 3,
+		}},
+		Peers: []api.PeerStatus{{ReplicaID: 0, LastUICounter: 7}, {ReplicaID: 2, LastUICounter: 6}},
+	}, report())
+	assert.True(t, released)
+}
@@ -18,6 +18,10 @@ package minbft
 
 import (
 	"math/rand"
+
+	"github.com/hyperledger-labs/minbft/core/internal/membership"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
 )
 
 // randN returns a random number of replicas for testing
@@ -63,3 +67,18 @@ func randOtherReplicaID(id, n uint32) uint32 {
 	offset := rand.Intn(int(n)-1) + 1
 	return (id + uint32(offset)) % n
 }
+
+// staticMembership returns the membership history of n replicas
+// tolerating f faulty ones with no reconfiguration
+func staticMembership(n, f uint32) membership.State {
+	return membership.New(membership.Initial(n, f))
+}
+
+// setUICounter assigns a UI with the supplied counter to the message
+func setUICounter(msg messages.CertifiedMessage, cv uint64) {
+	uiBytes, err := (&usig.UI{Counter: cv}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	msg.SetUIBytes(uiBytes)
+}
@@ -27,6 +27,22 @@ import (
 // safe to invoke concurrently.
 type viewChangeRequestor func(newView uint64) (ok bool)
 
+// primaryFaultHandler handles evidence of the primary replica of the
+// specified view being faulty. It is safe to invoke concurrently.
+type primaryFaultHandler func(view uint64)
+
+// makePrimaryFaultHandler constructs an instance of
+// primaryFaultHandler given the supplied abstractions.
+func makePrimaryFaultHandler(requestViewChange viewChangeRequestor, logger *logging.Logger) primaryFaultHandler {
+	return func(view uint64) {
+		newView := view + 1
+
+		if requestViewChange(newView) {
+			logger.Warningf("Requested view change to view %d due to faulty primary", newView)
+		}
+	}
+}
+
 // makeRequestTimeoutHandler constructs an instance of
 // requestTimeoutHandler given the supplied abstractions.
 func makeRequestTimeoutHandler(requestViewChange viewChangeRequestor, logger *logging.Logger) requestTimeoutHandler {
@@ -75,12 +75,6 @@ func makeMessageSignatureVerifier(authen api.Authenticator, extractAuthenBytes a
 	}
 }
 
-// isPrimary returns true if the replica is the primary node for the
-// current view.
-func isPrimary(view uint64, id uint32, n uint32) bool {
-	return uint64(id) == view%uint64(n)
-}
-
 func makeLogger(id uint32, opts options) *logging.Logger {
 	logger := logging.MustGetLogger(module)
 	logFormatString := fmt.Sprintf("%s Replica %d: %%{message}", defaultLogPrefix, id)
@@ -17,15 +17,22 @@ package messages
 
 import (
 	"encoding"
+
+	"github.com/hyperledger-labs/minbft/api"
 )
 
 // MessageImpl provides an implementation of the message representation.
 type MessageImpl interface {
 	NewFromBinary(data []byte) (Message, error)
 	NewRequest(clientID uint32, sequence uint64, operation []byte) Request
+	NewRequestWithKind(clientID uint32, sequence uint64, kind api.RequestKind, operation []byte) Request
 	NewPrepare(replicaID uint32, view uint64, request Request) Prepare
+	NewPrepareWithInput(replicaID uint32, view uint64, request Request, timestamp int64, seed []byte) Prepare
+	NewRejectingPrepare(replicaID uint32, view uint64, request Request, timestamp int64, seed []byte, reason string) Prepare
 	NewCommit(replicaID uint32, prepare Prepare) Commit
 	NewReply(replicaID, clientID uint32, sequence uint64, result []byte) Reply
+	NewRejection(replicaID, clientID uint32, sequence uint64, reason string) Reply
+	NewFailedReply(replicaID, clientID uint32, sequence uint64, result []byte, execError string) Reply
 	NewReqViewChange(replicaID uint32, newView uint64) ReqViewChange
 }
 
@@ -69,18 +76,35 @@ type SignedMessage interface {
 	SetSignature(signature []byte)
 }
 
+// Request represents a request to execute an operation.
+//
+// Kind tells how replicas interpret the operation.
 type Request interface {
 	ClientMessage
 	SignedMessage
 	Sequence() uint64
+	Kind() api.RequestKind
 	Operation() []byte
 	ImplementsRequest()
 }
 
+// Prepare represents a request ordered by the primary replica.
+//
+// Timestamp and Seed return the non-deterministic input for executing
+// the request chosen by the primary: the time of ordering the request
+// as Unix time in nanoseconds and the random seed.
+//
+// Rejection returns the reason for the primary to reject the request
+// instead of executing it, or an empty string if the request is to be
+// executed. Rejected requests are ordered as any other request, so
+// that all replicas reply the same.
 type Prepare interface {
 	CertifiedMessage
 	View() uint64
 	Request() Request
+	Timestamp() int64
+	Seed() []byte
+	Rejection() string
 	ImplementsPeerMessage()
 	ImplementsPrepare()
 }
@@ -92,12 +116,22 @@ type Commit interface {
 	ImplementsCommit()
 }
 
+// Reply represents a result of executing the requested operation.
+//
+// Rejection returns the reason for rejecting the request without
+// executing it, or an empty string if the request was accepted.
+//
+// ExecutionError returns the error reported by the application
+// executing the requested operation, or an empty string if the
+// operation succeeded. Result may still hold data then.
 type Reply interface {
 	ReplicaMessage
 	SignedMessage
 	ClientID() uint32
 	Sequence() uint64
 	Result() []byte
+	Rejection() string
+	ExecutionError() string
 	ImplementsReply()
 }
 
@@ -53,13 +53,19 @@ func writeAuthenBytes(buf io.Writer, m Message) {
 	switch m := m.(type) {
 	case Request:
 		_ = binary.Write(buf, binary.BigEndian, m.Sequence())
+		_ = binary.Write(buf, binary.BigEndian, int32(m.Kind()))
 		_, _ = buf.Write(hashsum(m.Operation()))
 	case Reply:
 		_ = binary.Write(buf, binary.BigEndian, m.ClientID())
 		_ = binary.Write(buf, binary.BigEndian, m.Sequence())
 		_, _ = buf.Write(hashsum(m.Result()))
+		_, _ = buf.Write(hashsum([]byte(m.Rejection())))
+		_, _ = buf.Write(hashsum([]byte(m.ExecutionError())))
 	case Prepare:
 		_ = binary.Write(buf, binary.BigEndian, m.View())
+		_ = binary.Write(buf, binary.BigEndian, m.Timestamp())
+		_, _ = buf.Write(hashsum(m.Seed()))
+		_, _ = buf.Write(hashsum([]byte(m.Rejection())))
 		req := m.Request()
 		_ = binary.Write(buf, binary.BigEndian, req.ClientID())
 		writeAuthenBytes(buf, req)
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package batch defines the envelope to carry several operations in
+// a single Request message of api.BatchRequest kind, as well as their
+// results in a single Reply message. Replicas execute the operations
+// of a batch one after another, in order.
+package batch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Result is the outcome of executing a single operation of a batch.
+// Error holds the error reported by the application, if any.
+type Result struct {
+	Result []byte
+	Error  string
+}
+
+// MakeOperation returns the operation carrying the supplied
+// operations as a batch.
+func MakeOperation(ops [][]byte) []byte {
+	buf := new(bytes.Buffer)
+	writeUvarint(buf, uint64(len(ops)))
+	for _, op := range ops {
+		writeBytes(buf, op)
+	}
+	return buf.Bytes()
+}
+
+// ParseOperation returns the operations carried by the supplied
+// batch, as made by MakeOperation.
+func ParseOperation(op []byte) ([][]byte, error) {
+	r := bytes.NewReader(op)
+	n, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("Empty batch")
+	}
+
+	ops := make([][]byte, n)
+	for i := range ops {
+		if ops[i], err = readBytes(r); err != nil {
+			return nil, fmt.Errorf("Operation %d: %s", i, err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("Trailing data")
+	}
+
+	return ops, nil
+}
+
+// MakeResult returns the result of executing a batch given the
+// outcomes of its operations, in order.
+func MakeResult(results []Result) []byte {
+	buf := new(bytes.Buffer)
+	writeUvarint(buf, uint64(len(results)))
+	for _, res := range results {
+		writeBytes(buf, res.Result)
+		writeBytes(buf, []byte(res.Error))
+	}
+	return buf.Bytes()
+}
+
+// ParseResult returns the outcomes of executing the operations of a
+// batch given its result, as made by MakeResult.
+func ParseResult(res []byte) ([]Result, error) {
+	r := bytes.NewReader(res)
+	n, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, n)
+	for i := range results {
+		if results[i].Result, err = readBytes(r); err != nil {
+			return nil, fmt.Errorf("Result %d: %s", i, err)
+		}
+		errBytes, err := readBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("Result %d: %s", i, err)
+		}
+		results[i].Error = string(errBytes)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("Trailing data")
+	}
+
+	return results, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], x)])
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// readCount reads the number of items, each taking at least one
+// byte, so that the count cannot exceed the remaining data.
+func readCount(r *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, fmt.Errorf("Incomplete count")
+	}
+	if n > uint64(r.Len()) {
+		return 0, fmt.Errorf("Count %d exceeds data", n)
+	}
+	return int(n), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("Incomplete length")
+	}
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("Incomplete data")
+	}
+	data := make([]byte, n)
+	_, _ = r.Read(data)
+	return data, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperation(t *testing.T) {
+	ops := [][]byte{[]byte("op1"), {}, []byte("op3")}
+
+	op := MakeOperation(ops)
+
+	parsed, err := ParseOperation(op)
+	require.NoError(t, err)
+	assert.Equal(t, ops, parsed)
+
+	_, err = ParseOperation([]byte("op1"))
+	assert.Error(t, err)
+	_, err = ParseOperation(MakeOperation(nil))
+	assert.Error(t, err)
+	_, err = ParseOperation(op[:len(op)-1])
+	assert.Error(t, err)
+	_, err = ParseOperation(append(op, 0))
+	assert.Error(t, err)
+	_, err = ParseOperation([]byte("\xff\xff\xff\xff\x0f"))
+	assert.Error(t, err)
+}
+
+func TestResult(t *testing.T) {
+	results := []Result{
+		{Result: []byte("res1")},
+		{Result: []byte{}, Error: "failed"},
+	}
+
+	parsed, err := ParseResult(MakeResult(results))
+	require.NoError(t, err)
+	assert.Equal(t, results, parsed)
+
+	res := MakeResult(results)
+	_, err = ParseResult(res[:len(res)-1])
+	assert.Error(t, err)
+	_, err = ParseResult(append(res, 0))
+	assert.Error(t, err)
+}
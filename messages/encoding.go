@@ -0,0 +1,255 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+// EncodeJSON returns a structured human-readable JSON representation
+// of the message, e.g. to dump a message log. Embedded messages are
+// represented in place and UIs are decoded. Signatures and UI
+// certificates are represented in hex. Operations and results are
+// represented as strings if valid UTF-8, otherwise as an object with
+// a single Hex field.
+func EncodeJSON(msg Message) ([]byte, error) {
+	v := jsonValue(msg)
+	if v == nil {
+		return nil, fmt.Errorf("unknown message type")
+	}
+	return json.Marshal(v)
+}
+
+type hexBytes []byte
+
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+type payload []byte
+
+func (p payload) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(p) {
+		return json.Marshal(string(p))
+	}
+	return json.Marshal(struct{ Hex hexBytes }{hexBytes(p)})
+}
+
+type jsonUI struct {
+	Counter uint64
+	Cert    hexBytes
+}
+
+type jsonRequest struct {
+	Type      string
+	ClientID  uint32
+	Sequence  uint64
+	Kind      string `json:",omitempty"`
+	Operation payload
+	Signature hexBytes
+}
+
+type jsonReply struct {
+	Type           string
+	ReplicaID      uint32
+	ClientID       uint32
+	Sequence       uint64
+	Result         payload
+	Rejection      string `json:",omitempty"`
+	ExecutionError string `json:",omitempty"`
+	Signature      hexBytes
+}
+
+type jsonPrepare struct {
+	Type      string
+	ReplicaID uint32
+	View      uint64
+	UI        *jsonUI
+	Timestamp int64    `json:",omitempty"`
+	Seed      hexBytes `json:",omitempty"`
+	Rejection string   `json:",omitempty"`
+	Request   *jsonRequest
+}
+
+type jsonCommit struct {
+	Type      string
+	ReplicaID uint32
+	UI        *jsonUI
+	Prepare   *jsonPrepare
+}
+
+type jsonReqViewChange struct {
+	Type      string
+	ReplicaID uint32
+	NewView   uint64
+	Signature hexBytes
+}
+
+func jsonValue(msg Message) interface{} {
+	switch msg := msg.(type) {
+	case Request:
+		return jsonRequestValue(msg)
+	case Reply:
+		return &jsonReply{"Reply", msg.ReplicaID(), msg.ClientID(), msg.Sequence(),
+			msg.Result(), msg.Rejection(), msg.ExecutionError(), msg.Signature()}
+	case Prepare:
+		return jsonPrepareValue(msg)
+	case Commit:
+		return &jsonCommit{"Commit", msg.ReplicaID(), jsonUIValue(msg),
+			jsonPrepareValue(msg.Prepare())}
+	case ReqViewChange:
+		return &jsonReqViewChange{"ReqViewChange", msg.ReplicaID(), msg.NewView(),
+			msg.Signature()}
+	default:
+		return nil
+	}
+}
+
+func jsonRequestValue(req Request) *jsonRequest {
+	return &jsonRequest{"Request", req.ClientID(), req.Sequence(),
+		kindName(req.Kind()), req.Operation(), req.Signature()}
+}
+
+// kindName returns the name of a request kind other than a plain
+// operation, or an empty string otherwise.
+func kindName(kind api.RequestKind) string {
+	switch kind {
+	case api.OperationRequest:
+		return ""
+	case api.BatchRequest:
+		return "batch"
+	case api.ReconfigurationRequest:
+		return "reconfiguration"
+	default:
+		return fmt.Sprintf("unknown(%d)", kind)
+	}
+}
+
+func jsonPrepareValue(prep Prepare) *jsonPrepare {
+	return &jsonPrepare{"Prepare", prep.ReplicaID(), prep.View(),
+		jsonUIValue(prep), prep.Timestamp(), prep.Seed(), prep.Rejection(),
+		jsonRequestValue(prep.Request())}
+}
+
+// jsonUIValue returns the decoded UI of the message, or nil if the
+// message has no valid UI assigned.
+func jsonUIValue(msg CertifiedMessage) *jsonUI {
+	ui := new(usig.UI)
+	if err := ui.UnmarshalBinary(msg.UIBytes()); err != nil {
+		return nil
+	}
+	return &jsonUI{ui.Counter, ui.Cert}
+}
+
+// TableWriter writes messages as rows of a text table aligned in
+// columns. The header row is written before the first message.
+// Flush has to be invoked to write buffered rows.
+type TableWriter struct {
+	tw     *tabwriter.Writer
+	header bool
+}
+
+// NewTableWriter creates a new TableWriter to write the table to w.
+func NewTableWriter(w io.Writer) *TableWriter {
+	return &TableWriter{tw: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}
+}
+
+// Write writes a row representing the message.
+func (t *TableWriter) Write(msg Message) error {
+	if !t.header {
+		t.header = true
+		if _, err := fmt.Fprintln(t.tw, "TYPE\tREPLICA\tCV\tVIEW\tCLIENT\tSEQ\tDETAILS"); err != nil {
+			return err
+		}
+	}
+
+	replica, cv, view, client, seq, details := "-", "-", "-", "-", "-", ""
+	switch msg := msg.(type) {
+	case Request:
+		client, seq = fmt.Sprint(msg.ClientID()), fmt.Sprint(msg.Sequence())
+		details = fmt.Sprintf("operation=%q", shortString(string(msg.Operation()), maxStringWidth))
+	case Reply:
+		replica = fmt.Sprint(msg.ReplicaID())
+		client, seq = fmt.Sprint(msg.ClientID()), fmt.Sprint(msg.Sequence())
+		if r := msg.Rejection(); r != "" {
+			details = fmt.Sprintf("rejection=%q", shortString(r, maxStringWidth))
+		} else if e := msg.ExecutionError(); e != "" {
+			details = fmt.Sprintf("error=%q", shortString(e, maxStringWidth))
+		} else {
+			details = fmt.Sprintf("result=%q", shortString(string(msg.Result()), maxStringWidth))
+		}
+	case Prepare:
+		req := msg.Request()
+		replica, cv, view = fmt.Sprint(msg.ReplicaID()), formatCV(msg), fmt.Sprint(msg.View())
+		client, seq = fmt.Sprint(req.ClientID()), fmt.Sprint(req.Sequence())
+		if r := msg.Rejection(); r != "" {
+			details = fmt.Sprintf("rejection=%q", shortString(r, maxStringWidth))
+		} else {
+			details = fmt.Sprintf("operation=%q", shortString(string(req.Operation()), maxStringWidth))
+		}
+	case Commit:
+		prep := msg.Prepare()
+		req := prep.Request()
+		replica, cv, view = fmt.Sprint(msg.ReplicaID()), formatCV(msg), fmt.Sprint(prep.View())
+		client, seq = fmt.Sprint(req.ClientID()), fmt.Sprint(req.Sequence())
+		details = fmt.Sprintf("prepare: replica=%d cv=%s", prep.ReplicaID(), formatCV(prep))
+	case ReqViewChange:
+		replica = fmt.Sprint(msg.ReplicaID())
+		details = fmt.Sprintf("newView=%d", msg.NewView())
+	default:
+		return fmt.Errorf("unknown message type")
+	}
+
+	_, err := fmt.Fprintf(t.tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		typeName(msg), replica, cv, view, client, seq, details)
+	return err
+}
+
+// Flush writes buffered rows.
+func (t *TableWriter) Flush() error {
+	return t.tw.Flush()
+}
+
+func typeName(msg Message) string {
+	switch msg.(type) {
+	case Request:
+		return "REQUEST"
+	case Reply:
+		return "REPLY"
+	case Prepare:
+		return "PREPARE"
+	case Commit:
+		return "COMMIT"
+	case ReqViewChange:
+		return "REQ-VIEW-CHANGE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func formatCV(msg CertifiedMessage) string {
+	if ui := jsonUIValue(msg); ui != nil {
+		return fmt.Sprint(ui.Counter)
+	}
+	return "-"
+}
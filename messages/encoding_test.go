@@ -0,0 +1,189 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	impl := protobufMessages.NewImpl()
+
+	req := impl.NewRequest(1, 2, []byte("operation"))
+	req.SetSignature([]byte{0xab, 0xcd})
+	prep := impl.NewPrepare(0, 3, req)
+	prep.SetUIBytes(makeUI(t, 4, []byte{0x01}))
+	comm := impl.NewCommit(1, prep)
+	comm.SetUIBytes(makeUI(t, 5, []byte{0x02}))
+
+	data, err := messages.EncodeJSON(comm)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Commit",
+		"ReplicaID": 1,
+		"UI": {"Counter": 5, "Cert": "02"},
+		"Prepare": {
+			"Type": "Prepare",
+			"ReplicaID": 0,
+			"View": 3,
+			"UI": {"Counter": 4, "Cert": "01"},
+			"Request": {
+				"Type": "Request",
+				"ClientID": 1,
+				"Sequence": 2,
+				"Operation": "operation",
+				"Signature": "abcd"
+			}
+		}
+	}`, string(data))
+
+	prep = impl.NewPrepareWithInput(0, 3, req, 1000, []byte{0x42})
+	data, err = messages.EncodeJSON(prep)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Prepare",
+		"ReplicaID": 0,
+		"View": 3,
+		"UI": null,
+		"Timestamp": 1000,
+		"Seed": "42",
+		"Request": {
+			"Type": "Request",
+			"ClientID": 1,
+			"Sequence": 2,
+			"Operation": "operation",
+			"Signature": "abcd"
+		}
+	}`, string(data))
+
+	prep = impl.NewRejectingPrepare(0, 3, req, 1000, []byte{0x42}, "rejected")
+	data, err = messages.EncodeJSON(prep)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Prepare",
+		"ReplicaID": 0,
+		"View": 3,
+		"UI": null,
+		"Timestamp": 1000,
+		"Seed": "42",
+		"Rejection": "rejected",
+		"Request": {
+			"Type": "Request",
+			"ClientID": 1,
+			"Sequence": 2,
+			"Operation": "operation",
+			"Signature": "abcd"
+		}
+	}`, string(data))
+
+	reply := impl.NewReply(2, 1, 2, []byte{0xff, 0xfe})
+	reply.SetSignature([]byte{0x12})
+	data, err = messages.EncodeJSON(reply)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Reply",
+		"ReplicaID": 2,
+		"ClientID": 1,
+		"Sequence": 2,
+		"Result": {"Hex": "fffe"},
+		"Signature": "12"
+	}`, string(data))
+
+	reply = impl.NewRejection(2, 1, 3, "rejected")
+	data, err = messages.EncodeJSON(reply)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Reply",
+		"ReplicaID": 2,
+		"ClientID": 1,
+		"Sequence": 3,
+		"Result": "",
+		"Rejection": "rejected",
+		"Signature": ""
+	}`, string(data))
+
+	reply = impl.NewFailedReply(2, 1, 4, nil, "failed")
+	data, err = messages.EncodeJSON(reply)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Reply",
+		"ReplicaID": 2,
+		"ClientID": 1,
+		"Sequence": 4,
+		"Result": "",
+		"ExecutionError": "failed",
+		"Signature": ""
+	}`, string(data))
+
+	req = impl.NewRequestWithKind(1, 5, api.BatchRequest, []byte("batch"))
+	data, err = messages.EncodeJSON(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"Type": "Request",
+		"ClientID": 1,
+		"Sequence": 5,
+		"Kind": "batch",
+		"Operation": "batch",
+		"Signature": ""
+	}`, string(data))
+
+	rvc := impl.NewReqViewChange(2, 1)
+	data, err = messages.EncodeJSON(rvc)
+	require.NoError(t, err)
+	v := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, "ReqViewChange", v["Type"])
+	assert.Equal(t, float64(1), v["NewView"])
+}
+
+func TestTableWriter(t *testing.T) {
+	impl := protobufMessages.NewImpl()
+
+	req := impl.NewRequest(1, 2, []byte("operation"))
+	prep := impl.NewPrepare(0, 3, req)
+	prep.SetUIBytes(makeUI(t, 4, nil))
+	comm := impl.NewCommit(1, prep)
+	comm.SetUIBytes(makeUI(t, 5, nil))
+
+	buf := new(bytes.Buffer)
+	tw := messages.NewTableWriter(buf)
+	require.NoError(t, tw.Write(prep))
+	require.NoError(t, tw.Write(comm))
+	require.NoError(t, tw.Flush())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"TYPE", "REPLICA", "CV", "VIEW", "CLIENT", "SEQ", "DETAILS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"PREPARE", "0", "4", "3", "1", "2", `operation="operation"`}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"COMMIT", "1", "5", "3", "1", "2", "prepare:", "replica=0", "cv=4"}, strings.Fields(lines[2]))
+}
+
+func makeUI(t *testing.T, cv uint64, cert []byte) []byte {
+	uiBytes, err := (&usig.UI{Counter: cv, Cert: cert}).MarshalBinary()
+	require.NoError(t, err)
+	return uiBytes
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/messages"
 	"github.com/hyperledger-labs/minbft/messages/protobuf/pb"
 )
@@ -42,11 +43,25 @@ func (*impl) NewFromBinary(data []byte) (messages.Message, error) {
 }
 
 func (*impl) NewRequest(cl uint32, seq uint64, op []byte) messages.Request {
-	return newRequest(cl, seq, op)
+	return newRequest(cl, seq, api.OperationRequest, op)
+}
+
+func (*impl) NewRequestWithKind(cl uint32, seq uint64, kind api.RequestKind, op []byte) messages.Request {
+	return newRequest(cl, seq, kind, op)
 }
 
 func (*impl) NewPrepare(r uint32, v uint64, req messages.Request) messages.Prepare {
-	return newPrepare(r, v, req)
+	return newPrepare(r, v, req, 0, nil)
+}
+
+func (*impl) NewPrepareWithInput(r uint32, v uint64, req messages.Request, ts int64, seed []byte) messages.Prepare {
+	return newPrepare(r, v, req, ts, seed)
+}
+
+func (*impl) NewRejectingPrepare(r uint32, v uint64, req messages.Request, ts int64, seed []byte, reason string) messages.Prepare {
+	prep := newPrepare(r, v, req, ts, seed)
+	prep.pbMsg.Rejection = reason
+	return prep
 }
 
 func (*impl) NewCommit(r uint32, prep messages.Prepare) messages.Commit {
@@ -57,6 +72,14 @@ func (*impl) NewReply(r, cl uint32, seq uint64, res []byte) messages.Reply {
 	return newReply(r, cl, seq, res)
 }
 
+func (*impl) NewRejection(r, cl uint32, seq uint64, reason string) messages.Reply {
+	return newRejection(r, cl, seq, reason)
+}
+
+func (*impl) NewFailedReply(r, cl uint32, seq uint64, res []byte, execErr string) messages.Reply {
+	return newFailedReply(r, cl, seq, res, execErr)
+}
+
 func (*impl) NewReqViewChange(r uint32, nv uint64) messages.ReqViewChange {
 	return newReqViewChange(r, nv)
 }
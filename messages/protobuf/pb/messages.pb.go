@@ -22,6 +22,34 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type Request_Kind int32
+
+const (
+	Request_OPERATION       Request_Kind = 0
+	Request_BATCH           Request_Kind = 1
+	Request_RECONFIGURATION Request_Kind = 2
+)
+
+var Request_Kind_name = map[int32]string{
+	0: "OPERATION",
+	1: "BATCH",
+	2: "RECONFIGURATION",
+}
+
+var Request_Kind_value = map[string]int32{
+	"OPERATION":       0,
+	"BATCH":           1,
+	"RECONFIGURATION": 2,
+}
+
+func (x Request_Kind) String() string {
+	return proto.EnumName(Request_Kind_name, int32(x))
+}
+
+func (Request_Kind) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_4dc296cbfe5ffcd5, []int{1, 0}
+}
+
 // Message represents arbitrary protocol message.
 type Message struct {
 	// Types that are valid to be assigned to Typed:
@@ -157,10 +185,12 @@ type Request struct {
 	// Operation to execute on replicated state machine
 	Operation []byte `protobuf:"bytes,3,opt,name=operation,proto3" json:"operation,omitempty"`
 	// Client's signature
-	Signature            []byte   `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Signature []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Kind of request telling how to interpret the operation
+	Kind                 Request_Kind `protobuf:"varint,5,opt,name=kind,proto3,enum=pb.Request_Kind" json:"kind,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
 }
 
 func (m *Request) Reset()         { *m = Request{} }
@@ -216,6 +246,13 @@ func (m *Request) GetSignature() []byte {
 	return nil
 }
 
+func (m *Request) GetKind() Request_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Request_OPERATION
+}
+
 // Reply represents REPLY message.
 type Reply struct {
 	// Replica identifier
@@ -227,7 +264,11 @@ type Reply struct {
 	// Result of requested operation execution
 	Result []byte `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
 	// Replica's signature
-	Signature            []byte   `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	Signature []byte `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Reason for rejecting the request without execution, if any
+	Rejection string `protobuf:"bytes,6,opt,name=rejection,proto3" json:"rejection,omitempty"`
+	// Error reported by the application executing the request, if any
+	ExecutionError       string   `protobuf:"bytes,7,opt,name=execution_error,json=executionError,proto3" json:"execution_error,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -293,6 +334,20 @@ func (m *Reply) GetSignature() []byte {
 	return nil
 }
 
+func (m *Reply) GetRejection() string {
+	if m != nil {
+		return m.Rejection
+	}
+	return ""
+}
+
+func (m *Reply) GetExecutionError() string {
+	if m != nil {
+		return m.ExecutionError
+	}
+	return ""
+}
+
 // Prepare represents PREPARE message.
 type Prepare struct {
 	// Replica identifier
@@ -302,7 +357,13 @@ type Prepare struct {
 	// Client's REQUEST
 	Request *Request `protobuf:"bytes,3,opt,name=request,proto3" json:"request,omitempty"`
 	// Replica's UI
-	Ui                   []byte   `protobuf:"bytes,4,opt,name=ui,proto3" json:"ui,omitempty"`
+	Ui []byte `protobuf:"bytes,4,opt,name=ui,proto3" json:"ui,omitempty"`
+	// Time of ordering the request as Unix time in nanoseconds
+	Timestamp int64 `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Random seed for executing the request
+	Seed []byte `protobuf:"bytes,6,opt,name=seed,proto3" json:"seed,omitempty"`
+	// Reason for rejecting the request instead of executing it, if any
+	Rejection            string   `protobuf:"bytes,7,opt,name=rejection,proto3" json:"rejection,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -361,6 +422,27 @@ func (m *Prepare) GetUi() []byte {
 	return nil
 }
 
+func (m *Prepare) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *Prepare) GetSeed() []byte {
+	if m != nil {
+		return m.Seed
+	}
+	return nil
+}
+
+func (m *Prepare) GetRejection() string {
+	if m != nil {
+		return m.Rejection
+	}
+	return ""
+}
+
 // Commit represents COMMIT message.
 type Commit struct {
 	// Replica identifier
@@ -480,6 +562,7 @@ func (m *ReqViewChange) GetSignature() []byte {
 }
 
 func init() {
+	proto.RegisterEnum("pb.Request_Kind", Request_Kind_name, Request_Kind_value)
 	proto.RegisterType((*Message)(nil), "pb.Message")
 	proto.RegisterType((*Request)(nil), "pb.Request")
 	proto.RegisterType((*Reply)(nil), "pb.Reply")
@@ -491,30 +574,39 @@ func init() {
 func init() { proto.RegisterFile("messages.proto", fileDescriptor_4dc296cbfe5ffcd5) }
 
 var fileDescriptor_4dc296cbfe5ffcd5 = []byte{
-	// 398 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x53, 0x4d, 0x8f, 0x94, 0x40,
-	0x10, 0x1d, 0x60, 0x80, 0xa5, 0x76, 0x67, 0xd5, 0x3e, 0x18, 0x8c, 0x9a, 0x28, 0x71, 0xa3, 0xa7,
-	0x39, 0xe8, 0xd1, 0x9b, 0x7b, 0x61, 0x0f, 0x26, 0xa6, 0x0f, 0x1e, 0x25, 0x0c, 0x54, 0xb0, 0x13,
-	0x06, 0x7a, 0xba, 0x1b, 0xc9, 0xfc, 0x06, 0xff, 0xa9, 0xbf, 0xc2, 0xf4, 0x87, 0xf6, 0xb2, 0xb3,
-	0xc9, 0xdc, 0x9a, 0x57, 0x45, 0xd5, 0x7b, 0xaf, 0x5f, 0xc3, 0xf5, 0x1e, 0xa5, 0xac, 0x3b, 0x94,
-	0x5b, 0x2e, 0x46, 0x35, 0x92, 0x90, 0xef, 0x8a, 0x3f, 0x01, 0xa4, 0x5f, 0x2d, 0x4c, 0xde, 0x43,
-	0x2a, 0xf0, 0x30, 0xa1, 0x54, 0x79, 0xf0, 0x26, 0xf8, 0x70, 0xf9, 0xf1, 0x72, 0xcb, 0x77, 0x5b,
-	0x6a, 0xa1, 0x72, 0x45, 0xff, 0x55, 0xc9, 0x5b, 0x88, 0x05, 0xf2, 0xfe, 0x98, 0x87, 0xa6, 0x2d,
-	0xb3, 0x6d, 0xbc, 0x3f, 0x96, 0x2b, 0x6a, 0x2b, 0x7a, 0x16, 0x17, 0xc8, 0x6b, 0x81, 0x79, 0xe4,
-	0x67, 0x7d, 0xb3, 0x90, 0x9e, 0xe5, 0xaa, 0xe4, 0x1d, 0x24, 0xcd, 0xb8, 0xdf, 0x33, 0x95, 0xaf,
-	0x4d, 0x1f, 0xe8, 0xbe, 0x5b, 0x83, 0x94, 0x2b, 0xea, 0x6a, 0xe4, 0x33, 0x3c, 0x11, 0x78, 0xa8,
-	0x7e, 0x31, 0x9c, 0xab, 0xe6, 0x67, 0x3d, 0x74, 0x98, 0xc7, 0xa6, 0xfd, 0x99, 0xa3, 0xf8, 0x9d,
-	0xe1, 0x7c, 0x6b, 0x0a, 0xe5, 0x8a, 0x6e, 0xc4, 0x7d, 0xe0, 0x4b, 0x0a, 0xb1, 0x3a, 0x72, 0x6c,
-	0x0b, 0x05, 0xa9, 0x53, 0x43, 0x5e, 0x42, 0xd6, 0xf4, 0x0c, 0x07, 0x55, 0xb1, 0xd6, 0xa8, 0xdd,
-	0xd0, 0x0b, 0x0b, 0xdc, 0xb5, 0xe4, 0x29, 0x44, 0x12, 0x0f, 0x46, 0xdd, 0x9a, 0xea, 0x23, 0x79,
-	0x05, 0xd9, 0xc8, 0x51, 0xd4, 0x8a, 0x8d, 0x83, 0x11, 0x74, 0x45, 0x3d, 0xa0, 0xab, 0x92, 0x75,
-	0x43, 0xad, 0x26, 0x81, 0x46, 0xc6, 0x15, 0xf5, 0x40, 0xf1, 0x3b, 0x80, 0xd8, 0xb8, 0x43, 0x5e,
-	0x03, 0x68, 0x77, 0x58, 0x53, 0xfb, 0xad, 0x99, 0x43, 0xee, 0xda, 0x25, 0xa7, 0xf0, 0x71, 0x4e,
-	0x91, 0xe7, 0xf4, 0x1c, 0x12, 0x81, 0x72, 0xea, 0x95, 0x5b, 0xe9, 0xbe, 0x96, 0x6c, 0xe2, 0x87,
-	0x6c, 0x24, 0xa4, 0xee, 0x16, 0xce, 0xd1, 0x21, 0xb0, 0xd6, 0x7e, 0x3b, 0x1b, 0xcc, 0x99, 0xdc,
-	0xf8, 0x88, 0x44, 0x27, 0x11, 0xf1, 0x01, 0xb9, 0x86, 0x70, 0x62, 0x8e, 0x56, 0x38, 0xb1, 0xe2,
-	0x07, 0x24, 0xf6, 0x4a, 0xcf, 0xed, 0xbc, 0xf1, 0xb1, 0x09, 0x4f, 0x62, 0xe3, 0x43, 0x63, 0xe7,
-	0x47, 0xff, 0xe7, 0x77, 0xb0, 0x59, 0x64, 0xe0, 0xdc, 0x9a, 0x17, 0x70, 0x31, 0xe0, 0x5c, 0xdd,
-	0x93, 0x97, 0x0e, 0x38, 0xeb, 0xff, 0x97, 0xee, 0x45, 0x0f, 0xdc, 0xdb, 0x25, 0xe6, 0xe5, 0x7c,
-	0xfa, 0x1b, 0x00, 0x00, 0xff, 0xff, 0x78, 0x07, 0xe7, 0x22, 0x4b, 0x03, 0x00, 0x00,
+	// 531 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x94, 0x5f, 0x6f, 0xd3, 0x3c,
+	0x14, 0xc6, 0x9b, 0xa4, 0x69, 0x96, 0xb3, 0xfe, 0x7b, 0xfd, 0x4a, 0x28, 0x88, 0x21, 0x8d, 0x68,
+	0xd3, 0x76, 0xd5, 0x8b, 0x21, 0xae, 0xb8, 0xda, 0xaa, 0x42, 0x2b, 0xc4, 0x3a, 0x59, 0x83, 0x4b,
+	0xaa, 0x34, 0x39, 0x2a, 0x86, 0x36, 0x49, 0x1d, 0x87, 0xd2, 0xcf, 0xc7, 0x27, 0x80, 0x8f, 0xc1,
+	0xa7, 0x40, 0x76, 0x3c, 0xdc, 0x74, 0x48, 0xbd, 0xb3, 0x9f, 0xe7, 0xd4, 0x39, 0xbf, 0xe3, 0xc7,
+	0x85, 0xee, 0x0a, 0x8b, 0x22, 0x5a, 0x60, 0x31, 0xc8, 0x79, 0x26, 0x32, 0x62, 0xe7, 0xf3, 0xf0,
+	0xb7, 0x05, 0xde, 0xfb, 0x4a, 0x26, 0x17, 0xe0, 0x71, 0x5c, 0x97, 0x58, 0x88, 0xc0, 0x3a, 0xb5,
+	0x2e, 0x8f, 0xaf, 0x8e, 0x07, 0xf9, 0x7c, 0x40, 0x2b, 0x69, 0xdc, 0xa0, 0x0f, 0x2e, 0x79, 0x01,
+	0x2e, 0xc7, 0x7c, 0xb9, 0x0d, 0x6c, 0x55, 0xe6, 0x57, 0x65, 0xf9, 0x72, 0x3b, 0x6e, 0xd0, 0xca,
+	0x91, 0x67, 0xe5, 0x1c, 0xf3, 0x88, 0x63, 0xe0, 0x98, 0xb3, 0xee, 0x2a, 0x49, 0x9e, 0xa5, 0x5d,
+	0x72, 0x06, 0xad, 0x38, 0x5b, 0xad, 0x98, 0x08, 0x9a, 0xaa, 0x0e, 0x64, 0xdd, 0x50, 0x29, 0xe3,
+	0x06, 0xd5, 0x1e, 0x79, 0x0d, 0x3d, 0x8e, 0xeb, 0xd9, 0x37, 0x86, 0x9b, 0x59, 0xfc, 0x39, 0x4a,
+	0x17, 0x18, 0xb8, 0xaa, 0xfc, 0x3f, 0xdd, 0xe2, 0x47, 0x86, 0x9b, 0xa1, 0x32, 0xc6, 0x0d, 0xda,
+	0xe1, 0xbb, 0xc2, 0x8d, 0x07, 0xae, 0xd8, 0xe6, 0x98, 0x84, 0x3f, 0x2d, 0xf0, 0x34, 0x0e, 0x79,
+	0x06, 0x7e, 0xbc, 0x64, 0x98, 0x8a, 0x19, 0x4b, 0x14, 0x6e, 0x87, 0x1e, 0x55, 0xc2, 0x24, 0x21,
+	0x7d, 0x70, 0x0a, 0x5c, 0x2b, 0xbc, 0x26, 0x95, 0x4b, 0x72, 0x02, 0x7e, 0x96, 0x23, 0x8f, 0x04,
+	0xcb, 0x52, 0x45, 0xd4, 0xa6, 0x46, 0x90, 0x6e, 0xc1, 0x16, 0x69, 0x24, 0x4a, 0x8e, 0x8a, 0xa3,
+	0x4d, 0x8d, 0x40, 0xce, 0xa0, 0xf9, 0x95, 0xa5, 0x89, 0xea, 0xb8, 0x7b, 0xd5, 0xdf, 0x19, 0xea,
+	0xe0, 0x1d, 0x4b, 0x13, 0xaa, 0xdc, 0xf0, 0x15, 0x34, 0xe5, 0x8e, 0x74, 0xc0, 0x9f, 0xde, 0x8d,
+	0xe8, 0xf5, 0xfd, 0x64, 0x7a, 0xdb, 0x6f, 0x10, 0x1f, 0xdc, 0x9b, 0xeb, 0xfb, 0xe1, 0xb8, 0x6f,
+	0x91, 0xff, 0xa1, 0x47, 0x47, 0xc3, 0xe9, 0xed, 0x9b, 0xc9, 0xdb, 0x0f, 0xda, 0xb7, 0xc3, 0x5f,
+	0x16, 0xb8, 0x6a, 0xf6, 0xe4, 0x39, 0x80, 0x9c, 0x3d, 0x8b, 0x23, 0x83, 0xe4, 0x6b, 0x65, 0x92,
+	0xd4, 0x81, 0xed, 0x7f, 0x03, 0x3b, 0x06, 0xf8, 0x09, 0xb4, 0x38, 0x16, 0xe5, 0x52, 0x68, 0x1e,
+	0xbd, 0xab, 0xa3, 0xba, 0xfb, 0xa8, 0x27, 0xe0, 0x73, 0xfc, 0x82, 0xb1, 0x1a, 0x53, 0xeb, 0xd4,
+	0xba, 0xf4, 0xa9, 0x11, 0xc8, 0x05, 0xf4, 0xf0, 0x3b, 0xc6, 0xa5, 0xdc, 0xcc, 0x90, 0xf3, 0x8c,
+	0x07, 0x9e, 0xaa, 0xe9, 0xfe, 0x95, 0x47, 0x52, 0x0d, 0x7f, 0x58, 0xe0, 0xe9, 0xac, 0x1c, 0xc2,
+	0x22, 0xd0, 0x94, 0xa9, 0xd0, 0x77, 0xa5, 0xd6, 0xe4, 0xdc, 0x04, 0xd9, 0x79, 0x14, 0x64, 0x13,
+	0xe3, 0x2e, 0xd8, 0x25, 0xd3, 0x78, 0x76, 0xc9, 0x64, 0xf3, 0x82, 0xad, 0xb0, 0x10, 0xd1, 0x2a,
+	0x57, 0x68, 0x0e, 0x35, 0x82, 0xfc, 0x50, 0x81, 0x98, 0x28, 0xaa, 0x36, 0x55, 0xeb, 0x3a, 0xae,
+	0xb7, 0x87, 0x1b, 0x7e, 0x82, 0x56, 0x15, 0xe4, 0x43, 0x0c, 0xe7, 0xe6, 0xb1, 0xd8, 0x8f, 0x1e,
+	0x8b, 0x79, 0x2a, 0x55, 0xbf, 0xce, 0x43, 0xbf, 0xe1, 0x02, 0x3a, 0xb5, 0xe4, 0x1f, 0xfa, 0xcc,
+	0x53, 0x38, 0x4a, 0x71, 0x33, 0xdb, 0x19, 0x97, 0x97, 0xe2, 0x46, 0xfe, 0xbe, 0x7e, 0xab, 0xce,
+	0xde, 0xad, 0xce, 0x5b, 0xea, 0xff, 0xe2, 0xe5, 0x9f, 0x01, 0x00, 0x00, 0x94, 0x63, 0x2e, 0x41,
+	0x04, 0x00, 0x00,
 }
@@ -32,6 +32,7 @@ func RequestFromAPI(req messages.Request) *Request {
 	return &Request{
 		ClientId:  req.ClientID(),
 		Seq:       req.Sequence(),
+		Kind:      Request_Kind(req.Kind()),
 		Operation: req.Operation(),
 		Signature: req.Signature(),
 	}
@@ -43,5 +44,8 @@ func PrepareFromAPI(prep messages.Prepare) *Prepare {
 		View:      prep.View(),
 		Request:   RequestFromAPI(prep.Request()),
 		Ui:        prep.UIBytes(),
+		Timestamp: prep.Timestamp(),
+		Seed:      prep.Seed(),
+		Rejection: prep.Rejection(),
 	}
 }
@@ -23,11 +23,13 @@ type prepare struct {
 	pbMsg *pb.Prepare
 }
 
-func newPrepare(r uint32, v uint64, req messages.Request) *prepare {
+func newPrepare(r uint32, v uint64, req messages.Request, ts int64, seed []byte) *prepare {
 	return &prepare{pbMsg: &pb.Prepare{
 		ReplicaId: r,
 		View:      v,
 		Request:   pbRequestFromAPI(req),
+		Timestamp: ts,
+		Seed:      seed,
 	}}
 }
 
@@ -51,6 +53,18 @@ func (m *prepare) Request() messages.Request {
 	return newRequestFromPb(m.pbMsg.GetRequest())
 }
 
+func (m *prepare) Timestamp() int64 {
+	return m.pbMsg.GetTimestamp()
+}
+
+func (m *prepare) Seed() []byte {
+	return m.pbMsg.GetSeed()
+}
+
+func (m *prepare) Rejection() string {
+	return m.pbMsg.GetRejection()
+}
+
 func (m *prepare) UIBytes() []byte {
 	return m.pbMsg.Ui
 }
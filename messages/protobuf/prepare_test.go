@@ -34,6 +34,31 @@ func TestPrepare(t *testing.T) {
 		require.Equal(t, r, prep.ReplicaID())
 		require.Equal(t, v, prep.View())
 		requireReqEqual(t, req, prep.Request())
+		require.Zero(t, prep.Timestamp())
+		require.Empty(t, prep.Seed())
+		require.Empty(t, prep.Rejection())
+	})
+	t.Run("Input", func(t *testing.T) {
+		ts := rand.Int63()
+		seed := randBytes()
+		prep := impl.NewPrepareWithInput(rand.Uint32(), rand.Uint64(), randReq(impl), ts, seed)
+		require.Equal(t, ts, prep.Timestamp())
+		require.Equal(t, seed, prep.Seed())
+		require.NotEqual(t, messages.AuthenBytes(prep), messages.AuthenBytes(
+			impl.NewPrepare(prep.ReplicaID(), prep.View(), prep.Request())))
+		requirePrepEqual(t, prep, remarshalMsg(impl, prep).(messages.Prepare))
+	})
+	t.Run("Rejection", func(t *testing.T) {
+		ts := rand.Int63()
+		seed := randBytes()
+		reason := "rejected"
+		prep := impl.NewRejectingPrepare(rand.Uint32(), rand.Uint64(), randReq(impl), ts, seed, reason)
+		require.Equal(t, ts, prep.Timestamp())
+		require.Equal(t, seed, prep.Seed())
+		require.Equal(t, reason, prep.Rejection())
+		require.NotEqual(t, messages.AuthenBytes(prep), messages.AuthenBytes(
+			impl.NewPrepareWithInput(prep.ReplicaID(), prep.View(), prep.Request(), ts, seed)))
+		requirePrepEqual(t, prep, remarshalMsg(impl, prep).(messages.Prepare))
 	})
 	t.Run("SetUIBytes", func(t *testing.T) {
 		prep := randPrep(impl)
@@ -62,5 +87,8 @@ func requirePrepEqual(t *testing.T, prep1, prep2 messages.Prepare) {
 	require.Equal(t, prep1.ReplicaID(), prep2.ReplicaID())
 	require.Equal(t, prep1.View(), prep2.View())
 	requireReqEqual(t, prep1.Request(), prep2.Request())
+	require.Equal(t, prep1.Timestamp(), prep2.Timestamp())
+	require.Equal(t, prep1.Seed(), prep2.Seed())
+	require.Equal(t, prep1.Rejection(), prep2.Rejection())
 	require.Equal(t, prep1.UIBytes(), prep2.UIBytes())
 }
@@ -31,6 +31,25 @@ func newReply(r, cl uint32, seq uint64, res []byte) *reply {
 	}}
 }
 
+func newRejection(r, cl uint32, seq uint64, reason string) *reply {
+	return &reply{pbMsg: &pb.Reply{
+		ReplicaId: r,
+		ClientId:  cl,
+		Seq:       seq,
+		Rejection: reason,
+	}}
+}
+
+func newFailedReply(r, cl uint32, seq uint64, res []byte, execErr string) *reply {
+	return &reply{pbMsg: &pb.Reply{
+		ReplicaId:      r,
+		ClientId:       cl,
+		Seq:            seq,
+		Result:         res,
+		ExecutionError: execErr,
+	}}
+}
+
 func newReplyFromPb(pbMsg *pb.Reply) *reply {
 	return &reply{pbMsg: pbMsg}
 }
@@ -55,6 +74,14 @@ func (m *reply) Result() []byte {
 	return m.pbMsg.GetResult()
 }
 
+func (m *reply) Rejection() string {
+	return m.pbMsg.GetRejection()
+}
+
+func (m *reply) ExecutionError() string {
+	return m.pbMsg.GetExecutionError()
+}
+
 func (m *reply) Signature() []byte {
 	return m.pbMsg.Signature
 }
@@ -36,6 +36,40 @@ func TestReply(t *testing.T) {
 		require.Equal(t, cl, reply.ClientID())
 		require.Equal(t, seq, reply.Sequence())
 		require.Equal(t, res, reply.Result())
+		require.Empty(t, reply.Rejection())
+		require.Empty(t, reply.ExecutionError())
+	})
+	t.Run("Rejection", func(t *testing.T) {
+		r := rand.Uint32()
+		cl := rand.Uint32()
+		seq := rand.Uint64()
+		reply := impl.NewRejection(r, cl, seq, "rejected")
+		require.Equal(t, r, reply.ReplicaID())
+		require.Equal(t, cl, reply.ClientID())
+		require.Equal(t, seq, reply.Sequence())
+		require.Empty(t, reply.Result())
+		require.Equal(t, "rejected", reply.Rejection())
+		require.NotEqual(t, messages.AuthenBytes(reply),
+			messages.AuthenBytes(impl.NewReply(r, cl, seq, nil)))
+		requireReplyEqual(t, reply, remarshalMsg(impl, reply).(messages.Reply))
+	})
+	t.Run("ExecutionError", func(t *testing.T) {
+		r := rand.Uint32()
+		cl := rand.Uint32()
+		seq := rand.Uint64()
+		res := randBytes()
+		reply := impl.NewFailedReply(r, cl, seq, res, "failed")
+		require.Equal(t, r, reply.ReplicaID())
+		require.Equal(t, cl, reply.ClientID())
+		require.Equal(t, seq, reply.Sequence())
+		require.Equal(t, res, reply.Result())
+		require.Empty(t, reply.Rejection())
+		require.Equal(t, "failed", reply.ExecutionError())
+		require.NotEqual(t, messages.AuthenBytes(reply),
+			messages.AuthenBytes(impl.NewReply(r, cl, seq, res)))
+		require.NotEqual(t, messages.AuthenBytes(impl.NewRejection(r, cl, seq, "failed")),
+			messages.AuthenBytes(impl.NewFailedReply(r, cl, seq, nil, "failed")))
+		requireReplyEqual(t, reply, remarshalMsg(impl, reply).(messages.Reply))
 	})
 	t.Run("SetSignature", func(t *testing.T) {
 		reply := randReply(impl)
@@ -64,5 +98,7 @@ func requireReplyEqual(t *testing.T, reply1, reply2 messages.Reply) {
 	require.Equal(t, reply1.ClientID(), reply2.ClientID())
 	require.Equal(t, reply1.Sequence(), reply2.Sequence())
 	require.Equal(t, reply1.Result(), reply2.Result())
+	require.Equal(t, reply1.Rejection(), reply2.Rejection())
+	require.Equal(t, reply1.ExecutionError(), reply2.ExecutionError())
 	require.Equal(t, reply1.Signature(), reply2.Signature())
 }
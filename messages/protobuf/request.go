@@ -15,6 +15,7 @@
 package protobuf
 
 import (
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/messages"
 	"github.com/hyperledger-labs/minbft/messages/protobuf/pb"
 )
@@ -23,10 +24,11 @@ type request struct {
 	pbMsg *pb.Request
 }
 
-func newRequest(cl uint32, seq uint64, op []byte) *request {
+func newRequest(cl uint32, seq uint64, kind api.RequestKind, op []byte) *request {
 	return &request{pbMsg: &pb.Request{
 		ClientId:  cl,
 		Seq:       seq,
+		Kind:      pb.Request_Kind(kind),
 		Operation: op,
 	}}
 }
@@ -47,6 +49,10 @@ func (m *request) Sequence() uint64 {
 	return m.pbMsg.GetSeq()
 }
 
+func (m *request) Kind() api.RequestKind {
+	return api.RequestKind(m.pbMsg.GetKind())
+}
+
 func (m *request) Operation() []byte {
 	return m.pbMsg.GetOperation()
 }
@@ -20,6 +20,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/messages"
 )
 
@@ -33,6 +34,11 @@ func TestRequest(t *testing.T) {
 		req := impl.NewRequest(cl, seq, op)
 		require.Equal(t, cl, req.ClientID())
 		require.Equal(t, seq, req.Sequence())
+		require.Equal(t, api.OperationRequest, req.Kind())
+		require.Equal(t, op, req.Operation())
+
+		req = impl.NewRequestWithKind(cl, seq, api.BatchRequest, op)
+		require.Equal(t, api.BatchRequest, req.Kind())
 		require.Equal(t, op, req.Operation())
 	})
 	t.Run("SetSignature", func(t *testing.T) {
@@ -44,6 +50,9 @@ func TestRequest(t *testing.T) {
 	t.Run("Marshaling", func(t *testing.T) {
 		req := randReq(impl)
 		requireReqEqual(t, req, remarshalMsg(impl, req).(messages.Request))
+
+		req = impl.NewRequestWithKind(rand.Uint32(), rand.Uint64(), api.ReconfigurationRequest, randBytes())
+		requireReqEqual(t, req, remarshalMsg(impl, req).(messages.Request))
 	})
 }
 
@@ -60,6 +69,7 @@ func newTestReq(impl messages.MessageImpl, cl uint32, seq uint64, op []byte) mes
 func requireReqEqual(t *testing.T, req1, req2 messages.Request) {
 	require.Equal(t, req1.ClientID(), req2.ClientID())
 	require.Equal(t, req1.Sequence(), req2.Sequence())
+	require.Equal(t, req1.Kind(), req2.Kind())
 	require.Equal(t, req1.Operation(), req2.Operation())
 	require.Equal(t, req1.Signature(), req2.Signature())
 }
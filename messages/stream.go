@@ -0,0 +1,63 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxStreamedMessageSize limits the size of a message read with
+// ReadMessage to detect corrupted streams.
+const maxStreamedMessageSize = 64 << 20
+
+// WriteMessage writes the serialized message to the stream, prefixed
+// with its length as 32-bit big-endian integer.
+func WriteMessage(w io.Writer, m Message) error {
+	msgBytes, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+len(msgBytes))
+	binary.BigEndian.PutUint32(buf, uint32(len(msgBytes)))
+	copy(buf[4:], msgBytes)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadMessage reads a message written to the stream with
+// WriteMessage and unmarshals it using the supplied implementation.
+// It returns io.EOF if there are no more messages in the stream and
+// io.ErrUnexpectedEOF if the last message is incomplete.
+func ReadMessage(r io.Reader, impl MessageImpl) (Message, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	} else if size > maxStreamedMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+
+	msgBytes := make([]byte, size)
+	if _, err := io.ReadFull(r, msgBytes); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	return impl.NewFromBinary(msgBytes)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/messages"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+func TestStream(t *testing.T) {
+	impl := protobufMessages.NewImpl()
+
+	req := impl.NewRequest(1, 2, []byte("operation"))
+	req.SetSignature([]byte("signature"))
+	prep := impl.NewPrepare(0, 1, req)
+	prep.SetUIBytes([]byte("ui"))
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, messages.WriteMessage(buf, req))
+	require.NoError(t, messages.WriteMessage(buf, prep))
+	data := buf.Bytes()
+
+	r := bytes.NewReader(data)
+	for _, expected := range []messages.Message{req, prep} {
+		msg, err := messages.ReadMessage(r, impl)
+		require.NoError(t, err)
+		expectedBytes, err := expected.MarshalBinary()
+		require.NoError(t, err)
+		msgBytes, err := msg.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, expectedBytes, msgBytes)
+	}
+	_, err := messages.ReadMessage(r, impl)
+	assert.Equal(t, io.EOF, err)
+
+	r = bytes.NewReader(data[:len(data)-1])
+	_, err = messages.ReadMessage(r, impl)
+	require.NoError(t, err)
+	_, err = messages.ReadMessage(r, impl)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -40,6 +40,16 @@ func Stringify(msg Message) string {
 			msg.ClientID(), msg.Sequence(),
 			shortString(string(msg.Operation()), maxStringWidth))
 	case Reply:
+		if r := msg.Rejection(); r != "" {
+			return fmt.Sprintf("<REPLY replica=%d seq=%d rejection=%q>",
+				msg.ReplicaID(), msg.Sequence(),
+				shortString(r, maxStringWidth))
+		}
+		if e := msg.ExecutionError(); e != "" {
+			return fmt.Sprintf("<REPLY replica=%d seq=%d error=%q>",
+				msg.ReplicaID(), msg.Sequence(),
+				shortString(e, maxStringWidth))
+		}
 		return fmt.Sprintf("<REPLY replica=%d seq=%d result=%q>",
 			msg.ReplicaID(), msg.Sequence(),
 			shortString(string(msg.Result()), maxStringWidth))
@@ -0,0 +1,426 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements offline auditing of messages recorded
+// from replicas. Since every Prepare and Commit message is certified
+// with a USIG UI, a recorded message log proves the sequence of
+// actions a replica took. The auditor checks the UIs, looks for gaps
+// and equivocation in the sequence of UI counters of each replica,
+// and checks that Commit messages are consistent with the Prepare
+// messages they commit. Reconfigurations committed in the recorded
+// messages are replayed to check Prepare messages against the
+// membership in each view.
+package audit
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+// UIVerifier verifies the UI assigned to the message by the USIG of
+// the replica and returns the epoch of the USIG instance.
+type UIVerifier func(replicaID uint32, msg []byte, ui *usig.UI) (epoch uint64, err error)
+
+// MembershipHistory keeps track of the membership in each view,
+// starting from the initial one, e.g. minbft.MembershipHistory.
+//
+// Primary returns the ID of the primary replica of the view.
+//
+// Membership returns the membership in the view.
+//
+// Reconfigure replays the reconfiguration operation prepared in the
+// view with the UI counter. Reconfigurations are replayed in the
+// order of views. An error is returned if the operation is malformed
+// or cannot be replayed in that order.
+type MembershipHistory interface {
+	Primary(view uint64) uint32
+	Membership(view uint64) *api.Membership
+	Reconfigure(view, cv uint64, op []byte) (*api.Membership, error)
+}
+
+// Problem is the kind of problem found by the auditor.
+type Problem int
+
+// Kinds of problems found by the auditor
+const (
+	// A UI or a signature is not valid
+	InvalidCertificate Problem = iota
+
+	// Some UI counters of a USIG instance are missing
+	CounterGap
+
+	// The same UI counter is assigned to different messages
+	Equivocation
+
+	// Messages violate the protocol, e.g. a Commit is not
+	// consistent with the committed Prepare
+	ProtocolViolation
+
+	// UIs from more than one USIG instance of a replica
+	MultipleInstances
+)
+
+func (p Problem) String() string {
+	switch p {
+	case InvalidCertificate:
+		return "invalid certificate"
+	case CounterGap:
+		return "counter gap"
+	case Equivocation:
+		return "equivocation"
+	case ProtocolViolation:
+		return "protocol violation"
+	case MultipleInstances:
+		return "multiple USIG instances"
+	default:
+		return fmt.Sprintf("problem %d", int(p))
+	}
+}
+
+// Finding describes a problem with messages of a replica.
+type Finding struct {
+	Problem     Problem
+	ReplicaID   uint32
+	Description string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("replica %d: %s: %s", f.ReplicaID, f.Problem, f.Description)
+}
+
+// instance identifies a USIG instance of a replica
+type instance struct {
+	replicaID uint32
+	epoch     uint64
+}
+
+// prepared identifies a Prepare message
+type prepared struct {
+	view    uint64
+	primary instance
+	cv      uint64
+}
+
+// instanceLog holds UIs produced by a USIG instance
+type instanceLog struct {
+	// digest of the certified message by UI counter
+	certified map[uint64][sha256.Size]byte
+
+	// Prepare committed by Commit message with the UI counter
+	commits map[uint64]prepared
+}
+
+// commitKey identifies a commitment of a replica on a Prepare
+type commitKey struct {
+	replicaID uint32
+	prepared  prepared
+}
+
+// Auditor checks messages recorded from replicas. Messages can be
+// added in any order; message logs recorded by different replicas
+// can be combined. Messages embedded into added messages are checked
+// as well.
+type Auditor struct {
+	history  MembershipHistory
+	verifyUI UIVerifier
+	authen   api.Authenticator
+
+	instances map[instance]*instanceLog
+	prepares  map[prepared]messages.Prepare
+	commits   map[commitKey]uint64
+	findings  []Finding
+	reported  map[Finding]bool
+}
+
+// New creates a new auditor given the membership history to replay
+// reconfigurations on, a function to verify UIs, and an
+// authenticator to verify signatures of replicas and clients.
+func New(history MembershipHistory, verifyUI UIVerifier, authen api.Authenticator) *Auditor {
+	return &Auditor{
+		history:   history,
+		verifyUI:  verifyUI,
+		authen:    authen,
+		instances: make(map[instance]*instanceLog),
+		prepares:  make(map[prepared]messages.Prepare),
+		commits:   make(map[commitKey]uint64),
+		reported:  make(map[Finding]bool),
+	}
+}
+
+// Add audits the message.
+func (a *Auditor) Add(msg messages.Message) {
+	switch msg := msg.(type) {
+	case messages.Prepare:
+		a.auditPrepare(msg)
+	case messages.Commit:
+		a.auditCommit(msg)
+	case messages.Reply:
+		a.auditSignature(msg.ReplicaID(), msg, msg.Signature())
+	case messages.ReqViewChange:
+		a.auditSignature(msg.ReplicaID(), msg, msg.Signature())
+	}
+}
+
+// Finish completes the audit and returns all problems found.
+func (a *Auditor) Finish() []Finding {
+	a.replayMembership()
+	findings := a.findings
+
+	var instances []instance
+	for inst := range a.instances {
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].replicaID != instances[j].replicaID {
+			return instances[i].replicaID < instances[j].replicaID
+		}
+		return instances[i].epoch < instances[j].epoch
+	})
+
+	nrInstances := make(map[uint32]int)
+	for _, inst := range instances {
+		nrInstances[inst.replicaID]++
+		log := a.instances[inst]
+		findings = append(findings, checkCounters(inst, log)...)
+		findings = append(findings, checkCommitOrder(inst, log)...)
+	}
+
+	for _, inst := range instances {
+		if nr := nrInstances[inst.replicaID]; nr > 1 {
+			findings = append(findings, Finding{MultipleInstances, inst.replicaID,
+				fmt.Sprintf("UIs from %d USIG instances", nr)})
+			delete(nrInstances, inst.replicaID)
+		}
+	}
+
+	return findings
+}
+
+func (a *Auditor) auditPrepare(prepare messages.Prepare) (p prepared, ok bool) {
+	replicaID := prepare.ReplicaID()
+	view := prepare.View()
+
+	// The primary must only accept a Request with a valid
+	// signature
+	request := prepare.Request()
+	err := a.authen.VerifyMessageAuthenTag(api.ClientAuthen, request.ClientID(),
+		messages.AuthenBytes(request), request.Signature())
+	if err != nil {
+		a.report(InvalidCertificate, replicaID,
+			"Invalid Request signature from client %d: %s", request.ClientID(), err)
+	}
+
+	inst, cv, ok := a.recordUI(prepare)
+	if !ok {
+		return prepared{}, false
+	}
+
+	p = prepared{view, inst, cv}
+	a.prepares[p] = prepare
+
+	return p, true
+}
+
+// replayMembership goes through the recorded Prepare messages in the
+// order of views, checking that each is from the primary of its view
+// and replaying the reconfigurations committed in the recorded
+// messages to follow the membership.
+func (a *Auditor) replayMembership() {
+	var ps []prepared
+	for p := range a.prepares {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		pi, pj := ps[i], ps[j]
+		if pi.view != pj.view {
+			return pi.view < pj.view
+		} else if pi.primary.replicaID != pj.primary.replicaID {
+			return pi.primary.replicaID < pj.primary.replicaID
+		} else if pi.primary.epoch != pj.primary.epoch {
+			return pi.primary.epoch < pj.primary.epoch
+		}
+		return pi.cv < pj.cv
+	})
+
+	for _, p := range ps {
+		replicaID := p.primary.replicaID
+		if a.history.Primary(p.view) != replicaID {
+			a.report(ProtocolViolation, replicaID,
+				"Prepare with UI counter %d in view %d not from primary", p.cv, p.view)
+			continue
+		}
+
+		prepare := a.prepares[p]
+		request := prepare.Request()
+		if request.Kind() != api.ReconfigurationRequest ||
+			prepare.Rejection() != "" || !a.committed(p) {
+			continue
+		}
+		if _, err := a.history.Reconfigure(p.view, p.cv, request.Operation()); err != nil {
+			a.report(ProtocolViolation, replicaID,
+				"Reconfiguration prepared with UI counter %d in view %d: %s", p.cv, p.view, err)
+		}
+	}
+}
+
+// committed returns true if the Prepare is committed by more than f
+// members of the membership in its view, counting the primary.
+func (a *Auditor) committed(p prepared) bool {
+	m := a.history.Membership(p.view)
+	nrCommitted := 0
+	for _, r := range m.Replicas {
+		if r.ID == p.primary.replicaID {
+			nrCommitted++
+		} else if _, ok := a.commits[commitKey{r.ID, p}]; ok {
+			nrCommitted++
+		}
+	}
+	return nrCommitted > int(m.F)
+}
+
+func (a *Auditor) auditCommit(commit messages.Commit) {
+	replicaID := commit.ReplicaID()
+	prepare := commit.Prepare()
+
+	p, prepareOK := a.auditPrepare(prepare)
+	inst, cv, commitOK := a.recordUI(commit)
+	if !prepareOK || !commitOK {
+		return
+	}
+
+	if replicaID == prepare.ReplicaID() {
+		a.report(ProtocolViolation, replicaID,
+			"Commit with UI counter %d on own Prepare", cv)
+		return
+	}
+
+	key := commitKey{replicaID, p}
+	if other, dup := a.commits[key]; dup && other != cv {
+		a.report(ProtocolViolation, replicaID,
+			"Prepare from replica %d with UI counter %d committed twice with UI counters %d and %d",
+			p.primary.replicaID, p.cv, other, cv)
+	}
+	a.commits[key] = cv
+	a.instances[inst].commits[cv] = p
+}
+
+// recordUI checks the UI of the message and records it. It returns
+// the USIG instance and the UI counter if the UI is valid.
+func (a *Auditor) recordUI(msg messages.CertifiedMessage) (inst instance, cv uint64, ok bool) {
+	replicaID := msg.ReplicaID()
+	authenBytes := messages.AuthenBytes(msg)
+
+	ui := new(usig.UI)
+	if err := ui.UnmarshalBinary(msg.UIBytes()); err != nil {
+		a.report(InvalidCertificate, replicaID, "Malformed UI: %s", err)
+		return instance{}, 0, false
+	}
+	epoch, err := a.verifyUI(replicaID, authenBytes, ui)
+	if err != nil {
+		a.report(InvalidCertificate, replicaID,
+			"Invalid UI with counter %d: %s", ui.Counter, err)
+		return instance{}, 0, false
+	}
+
+	inst = instance{replicaID, epoch}
+	log := a.instances[inst]
+	if log == nil {
+		log = &instanceLog{
+			certified: make(map[uint64][sha256.Size]byte),
+			commits:   make(map[uint64]prepared),
+		}
+		a.instances[inst] = log
+	}
+
+	digest := sha256.Sum256(authenBytes)
+	if other, seen := log.certified[ui.Counter]; !seen {
+		log.certified[ui.Counter] = digest
+	} else if other != digest {
+		a.report(Equivocation, replicaID,
+			"UI counter %d assigned to different messages", ui.Counter)
+	}
+
+	return inst, ui.Counter, true
+}
+
+func (a *Auditor) auditSignature(replicaID uint32, msg messages.Message, signature []byte) {
+	err := a.authen.VerifyMessageAuthenTag(api.ReplicaAuthen, replicaID,
+		messages.AuthenBytes(msg), signature)
+	if err != nil {
+		a.report(InvalidCertificate, replicaID, "Invalid signature: %s", err)
+	}
+}
+
+// report records a finding unless reported before; the same problem
+// is found again each time an embedded message is repeated.
+func (a *Auditor) report(p Problem, replicaID uint32, format string, args ...interface{}) {
+	f := Finding{p, replicaID, fmt.Sprintf(format, args...)}
+	if !a.reported[f] {
+		a.reported[f] = true
+		a.findings = append(a.findings, f)
+	}
+}
+
+// checkCounters checks that UI counters of the USIG instance are
+// contiguous starting from one.
+func checkCounters(inst instance, log *instanceLog) (findings []Finding) {
+	var counters []uint64
+	for cv := range log.certified {
+		counters = append(counters, cv)
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i] < counters[j] })
+
+	next := uint64(1)
+	for _, cv := range counters {
+		if cv == next+1 {
+			findings = append(findings, Finding{CounterGap, inst.replicaID,
+				fmt.Sprintf("UI counter %d missing (epoch %d)", next, inst.epoch)})
+		} else if cv > next {
+			findings = append(findings, Finding{CounterGap, inst.replicaID,
+				fmt.Sprintf("UI counters %d to %d missing (epoch %d)", next, cv-1, inst.epoch)})
+		}
+		next = cv + 1
+	}
+
+	return findings
+}
+
+// checkCommitOrder checks that the USIG instance certified Commit
+// messages in the order of the committed Prepare messages, i.e. in
+// the order of views and the order of UI counters of the primary
+// within a view.
+func checkCommitOrder(inst instance, log *instanceLog) (findings []Finding) {
+	var counters []uint64
+	for cv := range log.commits {
+		counters = append(counters, cv)
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i] < counters[j] })
+
+	for i := 1; i < len(counters); i++ {
+		prev, p := log.commits[counters[i-1]], log.commits[counters[i]]
+		if p.view < prev.view || (p.view == prev.view &&
+			p.primary == prev.primary && p.cv <= prev.cv) {
+			findings = append(findings, Finding{ProtocolViolation, inst.replicaID,
+				fmt.Sprintf("Commit with UI counter %d on Prepare with UI counter %d out of order",
+					counters[i], p.cv)})
+		}
+	}
+
+	return findings
+}
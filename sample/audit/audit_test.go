@@ -0,0 +1,256 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+const (
+	n = 3
+	f = 1
+)
+
+var messageImpl = protobufMessages.NewImpl()
+
+var invalidSignature = []byte("invalid")
+
+func TestAuditor(t *testing.T) {
+	t.Run("Consistent", testConsistent)
+	t.Run("InvalidCertificate", testInvalidCertificate)
+	t.Run("CounterGap", testCounterGap)
+	t.Run("Equivocation", testEquivocation)
+	t.Run("ProtocolViolation", testProtocolViolation)
+	t.Run("MultipleInstances", testMultipleInstances)
+	t.Run("Reconfiguration", testReconfiguration)
+}
+
+func testConsistent(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p2 := makePrepare(0, 0, 2, 2)
+	addAll(a, p1, p2)
+	for id := uint32(1); id < n; id++ {
+		addAll(a, makeCommit(id, 0, 1, p1), makeCommit(id, 0, 2, p2))
+	}
+	a.Add(makeReqViewChange(1, 1, []byte("signature")))
+
+	assert.Empty(t, a.Finish())
+}
+
+func testInvalidCertificate(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p2 := makePrepare(0, 0, 2, 2)
+	p2.Request().SetSignature(invalidSignature)
+	c1 := makeCommit(1, 0, 1, p1)
+	c1.SetUIBytes(makeUI(0, 1, []byte("another message")))
+
+	addAll(a, p1, p2, c1, makeCommit(1, 0, 2, p2), makeCommit(1, 0, 2, p2))
+	a.Add(makeReqViewChange(2, 1, invalidSignature))
+
+	findings := a.Finish()
+	assertFinding(t, findings, InvalidCertificate, 0)
+	assertFinding(t, findings, InvalidCertificate, 1)
+	assertFinding(t, findings, InvalidCertificate, 2)
+	assert.Len(t, findings, 3+1) // replica 1 misses a valid UI 1
+}
+
+func testCounterGap(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p4 := makePrepare(0, 0, 4, 2)
+	addAll(a, p1, p4, makeCommit(1, 0, 1, p1), makeCommit(1, 0, 2, p4))
+
+	findings := a.Finish()
+	require.Len(t, findings, 1)
+	assert.Equal(t, Finding{CounterGap, 0, "UI counters 2 to 3 missing (epoch 0)"}, findings[0])
+}
+
+func testEquivocation(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p1x := makePrepare(0, 0, 1, 2)
+	addAll(a, p1, makeCommit(1, 0, 1, p1), makeCommit(2, 0, 1, p1x))
+
+	findings := a.Finish()
+	require.Len(t, findings, 1)
+	assert.Equal(t, Equivocation, findings[0].Problem)
+	assert.Equal(t, uint32(0), findings[0].ReplicaID)
+}
+
+func testProtocolViolation(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p2 := makePrepare(0, 0, 2, 2)
+	p3 := makePrepare(1, 0, 1, 3) // not from primary
+
+	// Replica 1 commits out of order and twice
+	addAll(a, p1, p2, p3,
+		makeCommit(1, 0, 2, p2),
+		makeCommit(1, 0, 3, p1),
+		makeCommit(1, 0, 4, p1),
+		makeCommit(0, 0, 3, p2)) // on own Prepare
+
+	findings := a.Finish()
+	for _, f := range findings {
+		assert.Equal(t, ProtocolViolation, f.Problem)
+	}
+	assertFinding(t, findings, ProtocolViolation, 0)
+	assertFinding(t, findings, ProtocolViolation, 1)
+	assert.Len(t, findings, 5)
+}
+
+func testMultipleInstances(t *testing.T) {
+	a := newAuditor()
+
+	p1 := makePrepare(0, 0, 1, 1)
+	p2 := makePrepare(0, 1, 1, 2)
+	addAll(a, p1, p2, makeCommit(1, 0, 1, p1), makeCommit(1, 0, 2, p2))
+
+	findings := a.Finish()
+	require.Len(t, findings, 1)
+	assert.Equal(t, Finding{MultipleInstances, 0, "UIs from 2 USIG instances"}, findings[0])
+}
+
+func testReconfiguration(t *testing.T) {
+	// Replace replica 0 with replica 3; replica 2 is the
+	// primary of view 1 in the new membership
+	rc := &api.Reconfiguration{Remove: []uint32{0}, Add: []api.ReplicaInfo{{ID: 3}}, F: f}
+	op := minbft.MakeReconfigurationOperation(rc, 0, []byte("tag"))
+	request := messageImpl.NewRequestWithKind(0, 1, api.ReconfigurationRequest, op)
+	request.SetSignature([]byte("signature"))
+	rcPrepare := messageImpl.NewPrepare(0, 0, request)
+	rcPrepare.SetUIBytes(makeUI(0, 1, messages.AuthenBytes(rcPrepare)))
+
+	p := makePrepareInView(2, 1, 0, 1, 2)
+
+	t.Run("Committed", func(t *testing.T) {
+		a := newAuditor()
+		addAll(a, rcPrepare, makeCommit(1, 0, 1, rcPrepare), p, makeCommit(3, 0, 1, p))
+		assert.Empty(t, a.Finish())
+	})
+
+	t.Run("NotCommitted", func(t *testing.T) {
+		a := newAuditor()
+		addAll(a, rcPrepare, p)
+
+		findings := a.Finish()
+		require.Len(t, findings, 1)
+		assert.Equal(t, Finding{ProtocolViolation, 2,
+			"Prepare with UI counter 1 in view 1 not from primary"}, findings[0])
+	})
+}
+
+func newAuditor() *Auditor {
+	return New(minbft.NewMembershipHistory(testConfig{}), verifyUI, testAuthenticator{})
+}
+
+func addAll(a *Auditor, msgs ...messages.Message) {
+	for _, m := range msgs {
+		a.Add(m)
+	}
+}
+
+func assertFinding(t *testing.T, findings []Finding, p Problem, replicaID uint32) {
+	for _, f := range findings {
+		if f.Problem == p && f.ReplicaID == replicaID {
+			return
+		}
+	}
+	assert.Fail(t, "finding not reported", "%s by replica %d in %v", p, replicaID, findings)
+}
+
+// makeUI makes a UI with the certificate made up of the epoch and
+// the message digest, as checked by verifyUI.
+func makeUI(epoch byte, cv uint64, msg []byte) []byte {
+	digest := sha256.Sum256(msg)
+	uiBytes, err := (&usig.UI{Counter: cv, Cert: append([]byte{epoch}, digest[:]...)}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return uiBytes
+}
+
+func verifyUI(replicaID uint32, msg []byte, ui *usig.UI) (uint64, error) {
+	digest := sha256.Sum256(msg)
+	if len(ui.Cert) == 0 || !bytes.Equal(ui.Cert[1:], digest[:]) {
+		return 0, fmt.Errorf("UI not valid")
+	}
+	return uint64(ui.Cert[0]), nil
+}
+
+type testAuthenticator struct{}
+
+func (testAuthenticator) VerifyMessageAuthenTag(role api.AuthenticationRole, id uint32, msg []byte, tag []byte) error {
+	if bytes.Equal(tag, invalidSignature) {
+		return fmt.Errorf("signature not valid")
+	}
+	return nil
+}
+
+func (testAuthenticator) GenerateMessageAuthenTag(role api.AuthenticationRole, msg []byte) ([]byte, error) {
+	panic("not implemented")
+}
+
+// testConfig gives the initial membership
+type testConfig struct {
+	api.Configer
+}
+
+func (testConfig) N() uint32 { return n }
+func (testConfig) F() uint32 { return f }
+
+func makePrepare(id uint32, epoch byte, cv, seq uint64) messages.Prepare {
+	return makePrepareInView(id, 0, epoch, cv, seq)
+}
+
+func makePrepareInView(id uint32, view uint64, epoch byte, cv, seq uint64) messages.Prepare {
+	request := messageImpl.NewRequest(0, seq, []byte(fmt.Sprintf("op%d", seq)))
+	request.SetSignature([]byte("signature"))
+	prepare := messageImpl.NewPrepare(id, view, request)
+	prepare.SetUIBytes(makeUI(epoch, cv, messages.AuthenBytes(prepare)))
+	return prepare
+}
+
+func makeCommit(id uint32, epoch byte, cv uint64, prepare messages.Prepare) messages.Commit {
+	commit := messageImpl.NewCommit(id, prepare)
+	commit.SetUIBytes(makeUI(epoch, cv, messages.AuthenBytes(commit)))
+	return commit
+}
+
+func makeReqViewChange(id uint32, newView uint64, signature []byte) messages.ReqViewChange {
+	rvc := messageImpl.NewReqViewChange(id, newView)
+	rvc.SetSignature(signature)
+	return rvc
+}
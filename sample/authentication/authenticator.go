@@ -19,12 +19,14 @@ package authenticator
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"fmt"
 	"io"
 
 	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/usig"
 	sgxusig "github.com/hyperledger-labs/minbft/usig/sgx"
+	softusig "github.com/hyperledger-labs/minbft/usig/soft"
 )
 
 //========== Authenticator implementations ==========
@@ -38,6 +40,13 @@ type Authenticator struct {
 }
 
 var _ api.Authenticator = (*Authenticator)(nil)
+var _ api.MembershipObserver = (*Authenticator)(nil)
+
+// replicaIdentityAdder is implemented by key stores able to add
+// public keys of replicas joined the consensus network.
+type replicaIdentityAdder interface {
+	AddReplicaIdentity(id uint32, identity []byte) error
+}
 
 // New returns initialized authenticator
 func New(roles []api.AuthenticationRole, id uint32, keystoreFileReader io.Reader) (*Authenticator, error) {
@@ -62,12 +71,38 @@ func NewWithSGXUSIG(roles []api.AuthenticationRole, id uint32, keystoreFileReade
 		return nil, fmt.Errorf("failed to load keystore: %v", err)
 	}
 
-	usigKey := ks.ownerKeys[api.USIGAuthen].privateKey
-	if usigKey == nil {
+	usigKey, ok := ks.ownerKeys[api.USIGAuthen].privateKey.([]byte)
+	if !ok {
 		return nil, fmt.Errorf("failed to get USIG sealed key")
 	}
 
-	usig, err := sgxusig.New(enclaveFile, usigKey.([]byte))
+	usig, err := sgxusig.New(enclaveFile, usigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create USIG: %v", err)
+	}
+
+	au, err := new(roles, id, ks, usig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %v", err)
+	}
+
+	return au, nil
+}
+
+// NewWithSoftUSIG initializes replica authenticator with support of
+// USIGAuthen role by using an instance of software USIG
+func NewWithSoftUSIG(roles []api.AuthenticationRole, id uint32, keystoreFileReader io.Reader) (*Authenticator, error) {
+	ks, err := LoadSimpleKeyStore(keystoreFileReader, roles, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keystore: %v", err)
+	}
+
+	usigKey, ok := ks.ownerKeys[api.USIGAuthen].privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to get software USIG key")
+	}
+
+	usig, err := softusig.New(usigKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create USIG: %v", err)
 	}
@@ -93,7 +128,7 @@ func new(roles []api.AuthenticationRole, id uint32, ks BftKeyStorer, usig usig.U
 	}
 	for _, r := range ks.NodeRoles() {
 		ksName := ks.NodeKeySpec(r)
-		if (r == api.USIGAuthen) != (ksName == keySpecSgxEcdsa) {
+		if (r == api.USIGAuthen) != isUSIGKeySpec(ksName) {
 			return nil, fmt.Errorf("Cannot use %s keyspec for %s role", ksName, r)
 		}
 		switch ksName {
@@ -108,6 +143,15 @@ func new(roles []api.AuthenticationRole, id uint32, ks BftKeyStorer, usig usig.U
 				return nil, fmt.Errorf("Cannot use supplied USIG: %s keyspec requires SGX USIG", ksName)
 			}
 			a.authschemes[r] = NewSGXUSIGAuthenticationScheme(sgxUSIG)
+		case keySpecSoftEcdsa:
+			if usig == nil {
+				continue
+			}
+			softUSIG, ok := usig.(*softusig.USIG)
+			if !ok {
+				return nil, fmt.Errorf("Cannot use supplied USIG: %s keyspec requires software USIG", ksName)
+			}
+			a.authschemes[r] = NewSoftUSIGAuthenticationScheme(softUSIG)
 		default:
 			return nil, fmt.Errorf("Cannot find an authentication scheme corresponding to the keyspec '%s'", ks.KeySpec(r))
 		}
@@ -139,3 +183,25 @@ func (a *Authenticator) GenerateMessageAuthenTag(role api.AuthenticationRole, ms
 	sk := a.ks.PrivateKey(role)
 	return a.authschemes[role].GenerateAuthenticationTag(msg, sk)
 }
+
+// MembershipChanged adds the public keys of the replicas joined the
+// consensus network to the key store, so that their messages can be
+// authenticated. The identity of each joined replica is expected in
+// the format returned by ReplicaIdentity.
+func (a *Authenticator) MembershipChanged(m *api.Membership) error {
+	adder, ok := a.ks.(replicaIdentityAdder)
+	if !ok {
+		return fmt.Errorf("Key store cannot add replica keys")
+	}
+
+	for _, r := range m.Replicas {
+		if len(r.Identity) == 0 {
+			continue
+		}
+		if err := adder.AddReplicaIdentity(r.ID, r.Identity); err != nil {
+			return fmt.Errorf("Failed to add keys of replica %d: %v", r.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -26,13 +26,21 @@ import (
 	"github.com/hyperledger-labs/minbft/api"
 )
 
-func testReplicaAuthenticator(t *testing.T, ks []byte) {
-	a0, err := NewWithSGXUSIG([]api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}, 0, bytes.NewBuffer(ks), usigEnclaveFile)
+func newReplicaAuthenticator(id uint32, ks []byte, usigKeySpec string) (*Authenticator, error) {
+	roles := []api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}
+	if usigKeySpec == keySpecSoftEcdsa {
+		return NewWithSoftUSIG(roles, id, bytes.NewBuffer(ks))
+	}
+	return NewWithSGXUSIG(roles, id, bytes.NewBuffer(ks), usigEnclaveFile)
+}
+
+func testReplicaAuthenticator(t *testing.T, ks []byte, usigKeySpec string) {
+	a0, err := newReplicaAuthenticator(0, ks, usigKeySpec)
 	if !assert.NoError(t, err, "failed to create authenticator") {
 		t.FailNow()
 	}
 
-	a1, err := NewWithSGXUSIG([]api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}, 1, bytes.NewBuffer(ks), usigEnclaveFile)
+	a1, err := newReplicaAuthenticator(1, ks, usigKeySpec)
 	if !assert.NoError(t, err, "failed to create authenticator") {
 		t.FailNow()
 	}
@@ -77,7 +85,7 @@ func TestAuthenticator(t *testing.T) {
 		}
 		ksBytes := ks.Bytes()
 
-		t.Run("Replica", func(t *testing.T) { testReplicaAuthenticator(t, ksBytes) })
+		t.Run("Replica", func(t *testing.T) { testReplicaAuthenticator(t, ksBytes, tc.UsigKeySpec) })
 		t.Run("Client", func(t *testing.T) { testClientAuthenticator(t, ksBytes) })
 	}
 }
@@ -18,6 +18,7 @@
 package authenticator
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
@@ -28,8 +29,10 @@ import (
 	"math/big"
 	"sync"
 
+	"github.com/hyperledger-labs/minbft/api"
 	"github.com/hyperledger-labs/minbft/usig"
 	sgxusig "github.com/hyperledger-labs/minbft/usig/sgx"
+	softusig "github.com/hyperledger-labs/minbft/usig/soft"
 )
 
 // SignatureCipher defines the interface of signature operations used by public cryptographic ciphers
@@ -143,14 +146,29 @@ func makeUSIGKeyFingerprint(pubKey interface{}) (fingerprint usigKeyFingerprint,
 	return fingerprint, nil
 }
 
-// SGXUSIGAuthenticationScheme impelements AuthenticationScheme interface
-// by utilizing SGX USIG to create/verify authentication tags.
-type SGXUSIGAuthenticationScheme struct {
-	usig *sgxusig.USIG
+// usigAuthenticationScheme implements AuthenticationScheme interface
+// by utilizing an instance of USIG to create/verify authentication
+// tags. It is shared by USIG implementations that differ only in the
+// way to parse certificates and compose identities.
+type usigAuthenticationScheme struct {
+	usig usig.USIG
+
+	parseCert func(cert []byte) (epoch uint64, signature []byte, err error)
+	makeID    func(epoch uint64, pubKey interface{}) ([]byte, error)
 
 	// USIG key fingerprint -> captured epoch value
 	epoch map[usigKeyFingerprint]uint64
 	lock  sync.Mutex
+
+	// Epoch value of the own USIG instance, known once it has
+	// generated a UI
+	ownEpoch *uint64
+}
+
+// SGXUSIGAuthenticationScheme impelements AuthenticationScheme interface
+// by utilizing SGX USIG to create/verify authentication tags.
+type SGXUSIGAuthenticationScheme struct {
+	*usigAuthenticationScheme
 }
 
 var _ AuthenticationScheme = (*SGXUSIGAuthenticationScheme)(nil)
@@ -158,21 +176,51 @@ var _ AuthenticationScheme = (*SGXUSIGAuthenticationScheme)(nil)
 // NewSGXUSIGAuthenticationScheme creates a new instance of SGX USIG
 // authentication scheme.
 func NewSGXUSIGAuthenticationScheme(usig *sgxusig.USIG) *SGXUSIGAuthenticationScheme {
-	return &SGXUSIGAuthenticationScheme{
-		usig:  usig,
-		epoch: make(map[usigKeyFingerprint]uint64),
-	}
+	return &SGXUSIGAuthenticationScheme{&usigAuthenticationScheme{
+		usig:      usig,
+		parseCert: sgxusig.ParseCert,
+		makeID:    sgxusig.MakeID,
+		epoch:     make(map[usigKeyFingerprint]uint64),
+	}}
+}
+
+// SoftUSIGAuthenticationScheme impelements AuthenticationScheme
+// interface by utilizing software USIG to create/verify
+// authentication tags.
+type SoftUSIGAuthenticationScheme struct {
+	*usigAuthenticationScheme
+}
+
+var _ AuthenticationScheme = (*SoftUSIGAuthenticationScheme)(nil)
+
+// NewSoftUSIGAuthenticationScheme creates a new instance of software
+// USIG authentication scheme.
+func NewSoftUSIGAuthenticationScheme(usig *softusig.USIG) *SoftUSIGAuthenticationScheme {
+	return &SoftUSIGAuthenticationScheme{&usigAuthenticationScheme{
+		usig:      usig,
+		parseCert: softusig.ParseCert,
+		makeID:    softusig.MakeID,
+		epoch:     make(map[usigKeyFingerprint]uint64),
+	}}
 }
 
 // GenerateAuthenticationTag creates a new authentication for the
 // message. Marshaled USIG UI represents an authentication tag.
 // Supplied private key is ignored.
-func (au *SGXUSIGAuthenticationScheme) GenerateAuthenticationTag(m []byte, privKey interface{}) ([]byte, error) {
+func (au *usigAuthenticationScheme) GenerateAuthenticationTag(m []byte, privKey interface{}) ([]byte, error) {
 	ui, err := au.usig.CreateUI(m)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create UI: %v", err)
 	}
 
+	au.lock.Lock()
+	if au.ownEpoch == nil {
+		if epoch, _, err := au.parseCert(ui.Cert); err == nil {
+			au.ownEpoch = &epoch
+		}
+	}
+	au.lock.Unlock()
+
 	usigBytes, err := ui.MarshalBinary()
 	if err != nil {
 		panic(err)
@@ -183,7 +231,7 @@ func (au *SGXUSIGAuthenticationScheme) GenerateAuthenticationTag(m []byte, privK
 
 // VerifyAuthenticationTag verifies the supplied authentication tag.
 // Marshaled USIG UI represents an authentication tag.
-func (au *SGXUSIGAuthenticationScheme) VerifyAuthenticationTag(m []byte, sig []byte, pubKey interface{}) error {
+func (au *usigAuthenticationScheme) VerifyAuthenticationTag(m []byte, sig []byte, pubKey interface{}) error {
 	var ui usig.UI
 
 	if err := ui.UnmarshalBinary(sig); err != nil {
@@ -216,15 +264,24 @@ func (au *SGXUSIGAuthenticationScheme) VerifyAuthenticationTag(m []byte, sig []b
 	// per each replica and use that identity to verify received
 	// UIs. This, for example, can be achieved using some
 	// bootstrapping procedure.
+	//
+	// The epoch value of the own USIG instance is known, though,
+	// so that the UIs it generated can be verified in any order,
+	// e.g. those the replica gets back embedded in messages of
+	// the others.
 	epoch, ok := au.epoch[fingerprint]
 	if !ok && ui.Counter == uint64(1) {
-		epoch, _, err = sgxusig.ParseCert(ui.Cert)
+		epoch, _, err = au.parseCert(ui.Cert)
 		if err != nil {
 			return fmt.Errorf("Failed to parse UI certificate: %s", err)
 		}
+	} else if !ok && au.ownEpoch != nil {
+		if ownID, err := au.makeID(*au.ownEpoch, pubKey); err == nil && bytes.Equal(ownID, au.usig.ID()) {
+			epoch = *au.ownEpoch
+		}
 	}
 
-	usigID, err := sgxusig.MakeID(epoch, pubKey)
+	usigID, err := au.makeID(epoch, pubKey)
 	if err != nil {
 		return fmt.Errorf("Failed to construct USIG identity: %s", err)
 	}
@@ -237,3 +294,44 @@ func (au *SGXUSIGAuthenticationScheme) VerifyAuthenticationTag(m []byte, sig []b
 
 	return nil
 }
+
+// VerifyUSIGUI verifies the UI assigned to the message by the USIG of
+// the specified replica using the USIG public keys from the keystore.
+// Unlike USIG authentication schemes, it takes the epoch value from
+// the UI certificate, so that UIs can be verified in any order. The
+// epoch is returned to distinguish UIs produced by different USIG
+// instances.
+func VerifyUSIGUI(ks BftKeyStorer, replicaID uint32, msg []byte, ui *usig.UI) (epoch uint64, err error) {
+	pubKey, err := ks.NodePublicKey(api.USIGAuthen, replicaID)
+	if err != nil {
+		return 0, err
+	} else if pubKey == nil {
+		return 0, fmt.Errorf("No USIG key for replica %d", replicaID)
+	}
+
+	var parseCert func(cert []byte) (uint64, []byte, error)
+	var makeID func(epoch uint64, pubKey interface{}) ([]byte, error)
+	var verifyUI func(msg []byte, ui *usig.UI, usigID []byte) error
+	switch keySpec := ks.NodeKeySpec(api.USIGAuthen); keySpec {
+	case keySpecSgxEcdsa:
+		parseCert, makeID, verifyUI = sgxusig.ParseCert, sgxusig.MakeID, sgxusig.VerifyUI
+	case keySpecSoftEcdsa:
+		parseCert, makeID, verifyUI = softusig.ParseCert, softusig.MakeID, softusig.VerifyUI
+	default:
+		return 0, fmt.Errorf("Unsupported USIG keyspec '%s'", keySpec)
+	}
+
+	epoch, _, err = parseCert(ui.Cert)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse UI certificate: %s", err)
+	}
+	usigID, err := makeID(epoch, pubKey)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to construct USIG identity: %s", err)
+	}
+	if err := verifyUI(msg, ui, usigID); err != nil {
+		return 0, err
+	}
+
+	return epoch, nil
+}
@@ -18,6 +18,7 @@
 package authenticator
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -27,7 +28,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger-labs/minbft/api"
 	sgxusig "github.com/hyperledger-labs/minbft/usig/sgx"
+	softusig "github.com/hyperledger-labs/minbft/usig/soft"
 )
 
 var (
@@ -97,6 +100,78 @@ func testUSIGAuthenScheme(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func testSoftUSIGAuthenScheme(t *testing.T) {
+	usig1, err := softusig.New(nil)
+	require.NoError(t, err)
+
+	pubKey := usig1.PublicKey()
+	usigAuthScheme1 := NewSoftUSIGAuthenticationScheme(usig1)
+
+	tag1, err := usigAuthScheme1.GenerateAuthenticationTag(testMessage, nil)
+	require.NoError(t, err)
+
+	err = usigAuthScheme1.VerifyAuthenticationTag(testMessage, tag1, pubKey)
+	assert.NoError(t, err)
+
+	usig2, err := softusig.New(ecdsaPrivKey)
+	require.NoError(t, err)
+
+	usigAuthScheme2 := NewSoftUSIGAuthenticationScheme(usig2)
+
+	tag2, err := usigAuthScheme2.GenerateAuthenticationTag(testMessage, nil)
+	require.NoError(t, err)
+
+	err = usigAuthScheme1.VerifyAuthenticationTag(testMessage, tag2, pubKey)
+	assert.Error(t, err)
+
+	err = usigAuthScheme1.VerifyAuthenticationTag(testMessage, tag2, ecdsaPubKey)
+	assert.NoError(t, err)
+
+	// Own UIs are accepted in any order, but not those of others
+	tag3, err := usigAuthScheme2.GenerateAuthenticationTag(testMessage, nil)
+	require.NoError(t, err)
+	err = usigAuthScheme2.VerifyAuthenticationTag(testMessage, tag3, ecdsaPubKey)
+	assert.NoError(t, err)
+
+	tag4, err := usigAuthScheme1.GenerateAuthenticationTag(testMessage, nil)
+	require.NoError(t, err)
+	err = usigAuthScheme2.VerifyAuthenticationTag(testMessage, tag4, pubKey)
+	assert.Error(t, err)
+}
+
+func testVerifyUSIGUI(t *testing.T) {
+	var keys bytes.Buffer
+	err := GenerateTestnetKeys(&keys, &TestnetKeyOpts{
+		NumberReplicas:  2,
+		ReplicaKeySpec:  "ECDSA",
+		ReplicaSecParam: 256,
+		ClientKeySpec:   "ECDSA",
+		ClientSecParam:  256,
+		UsigKeySpec:     "SOFT_ECDSA",
+	})
+	require.NoError(t, err)
+
+	roles := []api.AuthenticationRole{api.USIGAuthen}
+	ks, err := LoadSimpleKeyStore(bytes.NewReader(keys.Bytes()), roles, 0)
+	require.NoError(t, err)
+
+	usig, err := softusig.New(ks.PrivateKey(api.USIGAuthen).(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	ui, err := usig.CreateUI(testMessage)
+	require.NoError(t, err)
+
+	epoch, err := VerifyUSIGUI(ks, 0, testMessage, ui)
+	assert.NoError(t, err)
+	assert.Equal(t, usig.Epoch(), epoch)
+
+	_, err = VerifyUSIGUI(ks, 0, []byte("tampered"), ui)
+	assert.Error(t, err)
+	_, err = VerifyUSIGUI(ks, 1, testMessage, ui)
+	assert.Error(t, err)
+	_, err = VerifyUSIGUI(ks, 2, testMessage, ui)
+	assert.Error(t, err)
+}
+
 func TestCrypto(t *testing.T) {
 	// setup
 	initTestCredentials(t)
@@ -104,4 +179,6 @@ func TestCrypto(t *testing.T) {
 	t.Run("ecdsaSigCipher", testEcdsaSigCipher)
 	t.Run("ecdsaAuthScheme", testEcdsaAuthenScheme)
 	t.Run("usigAuthScheme", testUSIGAuthenScheme)
+	t.Run("softUSIGAuthScheme", testSoftUSIGAuthenScheme)
+	t.Run("verifyUSIGUI", testVerifyUSIGUI)
 }
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 
 	"github.com/hyperledger-labs/minbft/api"
 	sgxusig "github.com/hyperledger-labs/minbft/usig/sgx"
@@ -51,6 +52,9 @@ type SimpleKeyStore struct {
 	id             uint32
 	ownerKeys      map[api.AuthenticationRole]*ownerKey
 	nodePublicKeys map[api.AuthenticationRole]*publicKeySet // public keys of the other nodes
+
+	// protects public keys added by AddReplicaIdentity
+	lock sync.RWMutex
 }
 
 type ownerKey struct {
@@ -94,6 +98,9 @@ func (ks *SimpleKeyStore) PublicKey(role api.AuthenticationRole) interface{} {
 
 // NodePublicKey returns the public key of a node given his role and id
 func (ks *SimpleKeyStore) NodePublicKey(role api.AuthenticationRole, id uint32) (interface{}, error) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
 	if keymap := ks.nodePublicKeys[role]; keymap != nil {
 		return keymap.keys[id], nil
 	}
@@ -120,6 +127,44 @@ func (ks *SimpleKeyStore) NodeKeySpec(role api.AuthenticationRole) string {
 	return keymap.keyspec
 }
 
+// AddReplicaIdentity adds the public keys of a replica joined the
+// consensus network, given its identity as returned by
+// ReplicaIdentity. Keys already present in the key store are never
+// replaced.
+func (ks *SimpleKeyStore) AddReplicaIdentity(id uint32, identity []byte) error {
+	ri := &replicaIdentity{}
+	if err := yaml.Unmarshal(identity, ri); err != nil {
+		return fmt.Errorf("malformed replica identity: %v", err)
+	}
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	for role, pubKeyStr := range map[api.AuthenticationRole]string{
+		api.ReplicaAuthen: ri.Replica,
+		api.USIGAuthen:    ri.Usig,
+	} {
+		keymap := ks.nodePublicKeys[role]
+		if keymap == nil {
+			return fmt.Errorf("key set not found for role=%v", role)
+		}
+		if keymap.keys[id] != nil {
+			continue
+		}
+		keyspec, err := getKeySpec(keymap.keyspec)
+		if err != nil {
+			return err
+		}
+		pubKey, err := keyspec.parsePublicKey(pubKeyStr)
+		if err != nil {
+			return err
+		}
+		keymap.keys[id] = pubKey
+	}
+
+	return nil
+}
+
 //================ Parse keystore from keystore file ===============
 
 // simpleKeyStoreFile (combines with keySet/keyPair) follows the key store file format that
@@ -144,10 +189,16 @@ func (ks *SimpleKeyStore) NodeKeySpec(role api.AuthenticationRole) string {
 //   keys:
 //     - {id: 0, privatekey: ..., publickey: ... }
 //     - ...
+// operator:
+//   keyspec: ECDSA
+//   keys:
+//     - {id: 0, privatekey: ..., publickey: ... }
+//     - ...
 type simpleKeyStoreFile struct {
-	Replica *keySet `yaml:"replica"`
-	Usig    *keySet `yaml:"usig"`
-	Client  *keySet `yaml:"client"`
+	Replica  *keySet `yaml:"replica"`
+	Usig     *keySet `yaml:"usig"`
+	Client   *keySet `yaml:"client"`
+	Operator *keySet `yaml:"operator,omitempty"`
 }
 
 type keySet struct {
@@ -161,6 +212,14 @@ type keyPair struct {
 	PublicKey  string `yaml:"publicKey"`
 }
 
+// replicaIdentity is the format of replica identity passed in
+// api.ReplicaInfo. It holds the public keys of the replica as they
+// appear in the key store file.
+type replicaIdentity struct {
+	Replica string `yaml:"replica"`
+	Usig    string `yaml:"usig"`
+}
+
 // parseKeyStoreFile parse the key config file and return the struct. Return nil if parse fails.
 func parseSimpleKeyStoreFile(reader io.Reader) (*simpleKeyStoreFile, error) {
 	fileBytes, err := ioutil.ReadAll(reader)
@@ -190,7 +249,8 @@ func LoadSimpleKeyStore(keystoreFileReader io.Reader, roles []api.Authentication
 	keySets := map[api.AuthenticationRole]*keySet{
 		api.ReplicaAuthen: keys.Replica,
 		api.USIGAuthen:    keys.Usig,
-		api.ClientAuthen:  keys.Client,
+		api.ClientAuthen:   keys.Client,
+		api.OperatorAuthen: keys.Operator,
 	}
 
 	for _, r := range roles {
@@ -226,6 +286,40 @@ func LoadSimpleKeyStore(keystoreFileReader io.Reader, roles []api.Authentication
 	return ks, nil
 }
 
+// ReplicaIdentity returns the identity of the specified replica
+// from the key store file to pass in api.ReplicaInfo when the replica
+// joins the consensus network.
+func ReplicaIdentity(keystoreFileReader io.Reader, id uint32) ([]byte, error) {
+	keys, err := parseSimpleKeyStoreFile(keystoreFileReader)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaKey, usigKey := findKeyPair(keys.Replica, id), findKeyPair(keys.Usig, id)
+	if replicaKey == nil || usigKey == nil {
+		return nil, fmt.Errorf("missing key: cannot find keys of replica %d", id)
+	}
+
+	return yaml.Marshal(&replicaIdentity{
+		Replica: replicaKey.PublicKey,
+		Usig:    usigKey.PublicKey,
+	})
+}
+
+// findKeyPair returns the key pair with the specified ID from the
+// key set, or nil if there is no such key pair.
+func findKeyPair(keyset *keySet, id uint32) *keyPair {
+	if keyset == nil {
+		return nil
+	}
+	for _, k := range keyset.Keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
 func (ks *SimpleKeyStore) parseKeyPair(role api.AuthenticationRole, keyspec keySpec, keypair *keyPair) error {
 	pubkeyMap := ks.nodePublicKeys[role].keys
 
@@ -253,10 +347,16 @@ func (ks *SimpleKeyStore) parseKeyPair(role api.AuthenticationRole, keyspec keyS
 
 // key spec names
 const (
-	keySpecSgxEcdsa = "SGX_ECDSA"
-	keySpecEcdsa    = "ECDSA"
+	keySpecSgxEcdsa  = "SGX_ECDSA"
+	keySpecSoftEcdsa = "SOFT_ECDSA"
+	keySpecEcdsa     = "ECDSA"
 )
 
+// isUSIGKeySpec returns true if the key spec is designated for USIG
+func isUSIGKeySpec(keySpecStr string) bool {
+	return keySpecStr == keySpecSgxEcdsa || keySpecStr == keySpecSoftEcdsa
+}
+
 // keySpec defines the interfaces how a (public/private) key spec can be parsed from/to key store file
 type keySpec interface {
 	// return the key spec name
@@ -277,6 +377,8 @@ func getKeySpec(keySpecStr string) (keySpec, error) {
 	switch keySpecStr {
 	case keySpecSgxEcdsa:
 		return &sgxEcdsaKeySpec{}, nil
+	case keySpecSoftEcdsa:
+		return &softEcdsaKeySpec{}, nil
 	case keySpecEcdsa:
 		return &ecdsaKeySpec{}, nil
 	default:
@@ -327,6 +429,24 @@ func (spec *sgxEcdsaKeySpec) generateKeyPair(securityParam int) (string, string,
 	return privKeyBase64, pubKeyBase64, nil
 }
 
+//###### SOFT_ECDSA #######
+
+// softEcdsaKeySpec represents key pairs of software USIG instances.
+// The keys are encoded the same way as in ECDSA key spec.
+type softEcdsaKeySpec struct {
+	ecdsaKeySpec
+}
+
+func (spec *softEcdsaKeySpec) getSpecName() string {
+	return keySpecSoftEcdsa
+}
+
+// generateKeyPair generates a key pair for software USIG. The curve
+// is the same as used by SGX USIG regardless of security parameter.
+func (spec *softEcdsaKeySpec) generateKeyPair(securityParam int) (string, string, error) {
+	return spec.ecdsaKeySpec.generateKeyPair(256)
+}
+
 //###### ECDSA #######
 
 type ecdsaKeySpec struct{}
@@ -412,6 +532,14 @@ type TestnetKeyOpts struct {
 	ClientSecParam int
 
 	UsigEnclaveFile string
+
+	// Key spec for USIG; SGX_ECDSA is used if empty
+	UsigKeySpec string
+
+	// No operator keys are generated if zero
+	NumberOperators  int
+	OperatorKeySpec  string
+	OperatorSecParam int
 }
 
 // GenerateTestnetKeys creates a keystore configuration corresponding
@@ -427,7 +555,14 @@ func GenerateTestnetKeys(w io.Writer, opts *TestnetKeyOpts) error {
 	}
 	keys.Replica = rKeySet
 
-	uKeySet, err := generateKeySet(opts.NumberReplicas, keySpecSgxEcdsa,
+	usigKeySpec := opts.UsigKeySpec
+	if usigKeySpec == "" {
+		usigKeySpec = keySpecSgxEcdsa
+	} else if !isUSIGKeySpec(usigKeySpec) {
+		return fmt.Errorf("Cannot use %s keyspec for USIG", usigKeySpec)
+	}
+
+	uKeySet, err := generateKeySet(opts.NumberReplicas, usigKeySpec,
 		0, opts.UsigEnclaveFile)
 	if err != nil {
 		return err
@@ -441,6 +576,64 @@ func GenerateTestnetKeys(w io.Writer, opts *TestnetKeyOpts) error {
 	}
 	keys.Client = cKeySet
 
+	if opts.NumberOperators > 0 {
+		oKeySet, err := generateKeySet(opts.NumberOperators, opts.OperatorKeySpec,
+			opts.OperatorSecParam, "")
+		if err != nil {
+			return err
+		}
+		keys.Operator = oKeySet
+	}
+
+	enc := yaml.NewEncoder(w)
+	err = enc.Encode(keys)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal simpleKeyStoreFile to yaml: %v", err)
+	}
+	return enc.Close()
+}
+
+// AddReplicaKeys reads a keystore configuration from the supplied
+// Reader, generates replica and USIG keys for a new replica with the
+// specified ID using the same key specs, and writes the resulting
+// keystore configuration to the supplied Writer.
+func AddReplicaKeys(r io.Reader, w io.Writer, id uint32, replicaSecParam int, usigEnclaveFile string) error {
+	keys, err := parseSimpleKeyStoreFile(r)
+	if err != nil {
+		return err
+	}
+	if keys.Replica == nil || keys.Usig == nil {
+		return fmt.Errorf("No replica keys found")
+	}
+	if findKeyPair(keys.Replica, id) != nil || findKeyPair(keys.Usig, id) != nil {
+		return fmt.Errorf("Keys for replica %d already exist", id)
+	}
+
+	for _, ks := range []struct {
+		keyset   *keySet
+		secParam int
+	}{
+		{keys.Replica, replicaSecParam},
+		{keys.Usig, 0},
+	} {
+		spec, err := getKeySpec(ks.keyset.KeySpec)
+		if err != nil {
+			return err
+		}
+		if sgxSpec, ok := spec.(*sgxEcdsaKeySpec); ok {
+			sgxSpec.enclaveFile = usigEnclaveFile
+		}
+		privKey, pubKey, err := spec.generateKeyPair(ks.secParam)
+		if err != nil {
+			return err
+		}
+		ks.keyset.Keys = append(ks.keyset.Keys, &keyPair{
+			ID:         id,
+			PrivateKey: privKey,
+			PublicKey:  pubKey,
+		})
+	}
+
 	enc := yaml.NewEncoder(w)
 	err = enc.Encode(keys)
 	if err != nil {
@@ -20,12 +20,14 @@ package authenticator
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 
 	"github.com/hyperledger-labs/minbft/api"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -40,7 +42,20 @@ var (
 		{
 			4, "ECDSA", 256,
 			1, "ECDSA", 256,
-			usigEnclaveFile,
+			usigEnclaveFile, "",
+			0, "", 0,
+		},
+		{
+			4, "ECDSA", 256,
+			1, "ECDSA", 256,
+			"", "SOFT_ECDSA",
+			0, "", 0,
+		},
+		{
+			4, "ECDSA", 256,
+			1, "ECDSA", 256,
+			"", "SOFT_ECDSA",
+			1, "ECDSA", 256,
 		},
 	}
 )
@@ -120,13 +135,58 @@ func testGenerateSampleKeyFile(t *testing.T) {
 			err := GenerateTestnetKeys(&keyConf, tc)
 			assert.NoError(t, err)
 
-			_, err = LoadSimpleKeyStore(&keyConf, []api.AuthenticationRole{api.ReplicaAuthen}, 0)
+			roles := []api.AuthenticationRole{api.ReplicaAuthen}
+			if tc.NumberOperators > 0 {
+				roles = append(roles, api.OperatorAuthen)
+			}
+			_, err = LoadSimpleKeyStore(&keyConf, roles, 0)
 			assert.NoError(t, err, fmt.Sprintf("Generated key store file cannot be parsed correctly: %v", err))
 		})
 	}
 }
 
+func testAddReplica(t *testing.T) {
+	var keys, newKeys bytes.Buffer
+
+	err := GenerateTestnetKeys(&keys, testnetKeygenCases[1])
+	require.NoError(t, err)
+
+	err = AddReplicaKeys(bytes.NewReader(keys.Bytes()), &newKeys, 7, 256, "")
+	require.NoError(t, err)
+	err = AddReplicaKeys(bytes.NewReader(newKeys.Bytes()), ioutil.Discard, 7, 256, "")
+	assert.Error(t, err, "keys already exist")
+
+	roles := []api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}
+	newKs, err := LoadSimpleKeyStore(bytes.NewReader(newKeys.Bytes()), roles, 7)
+	require.NoError(t, err)
+
+	identity, err := ReplicaIdentity(bytes.NewReader(newKeys.Bytes()), 7)
+	require.NoError(t, err)
+	_, err = ReplicaIdentity(bytes.NewReader(keys.Bytes()), 7)
+	assert.Error(t, err)
+
+	ks, err := LoadSimpleKeyStore(bytes.NewReader(keys.Bytes()), roles, 0)
+	require.NoError(t, err)
+	for _, r := range roles {
+		pk, err := ks.NodePublicKey(r, 7)
+		require.NoError(t, err)
+		assert.Nil(t, pk)
+	}
+
+	err = ks.AddReplicaIdentity(7, identity)
+	require.NoError(t, err)
+	for _, r := range roles {
+		pk, err := ks.NodePublicKey(r, 7)
+		require.NoError(t, err)
+		assert.Equal(t, newKs.PublicKey(r), pk)
+	}
+
+	err = ks.AddReplicaIdentity(8, []byte("malformed"))
+	assert.Error(t, err)
+}
+
 func TestKeyStore(t *testing.T) {
 	t.Run("LoadSimpleKeyStore", testLoadSimpleKeyStore)
 	t.Run("GenerateTestnetKeys", testGenerateSampleKeyFile)
+	t.Run("AddReplica", testAddReplica)
 }
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/a8m/envsubst"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+)
+
+// addReplicaCmd represents the add-replica command
+var addReplicaCmd = &cobra.Command{
+	Use:   "add-replica id",
+	Short: "Add keys of a new replica to keystore file",
+	Long: `
+Generate replica and USIG keys for a new replica with the specified ID
+and add them to the keystore file, using the same key specs as for the
+existing replicas. The resulting keystore file is used to run the new
+replica and to request the reconfiguration adding it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("Failed to parse replica ID "+
+				"from positional argument: %s", err)
+		}
+
+		// Bound here not to override the flags of generate command
+		must(viper.BindPFlag("replicas.secparam",
+			cmd.Flags().Lookup("replica-sec-param")))
+		must(viper.BindPFlag("usig.enclaveFile",
+			cmd.Flags().Lookup("usig-enclave-file")))
+
+		usigEnclaveFile, err := envsubst.String(viper.GetString("usig.enclaveFile"))
+		if err != nil {
+			return fmt.Errorf("Failed to parse USIG enclave filename: %s", err)
+		}
+
+		fileName := viper.GetString("output")
+		fmt.Println("Using keystore file:", fileName)
+
+		keys, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return fmt.Errorf("Failed to read keystore file: %s", err)
+		}
+
+		var out bytes.Buffer
+		err = authen.AddReplicaKeys(bytes.NewReader(keys), &out, uint32(id),
+			viper.GetInt("replicas.secparam"), usigEnclaveFile)
+		if err != nil {
+			return fmt.Errorf("Failed to add keys: %s", err)
+		}
+
+		if err := ioutil.WriteFile(fileName, out.Bytes(), 0600); err != nil {
+			return fmt.Errorf("Failed to write keystore file: %s", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addReplicaCmd)
+
+	addReplicaCmd.Flags().Int("replica-sec-param",
+		defReplicaSecParam, "replica security param")
+
+	addReplicaCmd.Flags().StringP("usig-enclave-file", "u",
+		defUsigEnclaveFile, "USIG enclave file")
+}
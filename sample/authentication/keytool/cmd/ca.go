@@ -0,0 +1,89 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
+)
+
+const defCADir = "tls"
+
+// caCmd represents the ca command
+var caCmd = &cobra.Command{
+	Use:   "ca [numberReplicas [numberClients]]",
+	Short: "Generate test CA and TLS certificates",
+	Long: `
+Generate a test certificate authority and issue TLS certificates bound
+to replica and client IDs. The CA certificate, node certificates and
+private keys are written into the output directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			nrReplicas, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to parse number of replicas "+
+					"from positional argument: %s", err)
+			}
+			viper.Set("ca.replicas", nrReplicas)
+		}
+		if len(args) > 1 {
+			nrClients, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("Failed to parse number of clients "+
+					"from positional argument: %s", err)
+			}
+			viper.Set("ca.clients", nrClients)
+		}
+
+		return generateCA()
+	},
+	Args: cobra.MaximumNArgs(2),
+}
+
+func init() {
+	rootCmd.AddCommand(caCmd)
+
+	caCmd.Flags().IntP("num-replicas", "r",
+		defNrReplicas, "number of replicas")
+	must(viper.BindPFlag("ca.replicas",
+		caCmd.Flags().Lookup("num-replicas")))
+
+	caCmd.Flags().IntP("num-clients", "c",
+		defNrClients, "number of clients")
+	must(viper.BindPFlag("ca.clients",
+		caCmd.Flags().Lookup("num-clients")))
+
+	caCmd.Flags().StringP("dir", "d", defCADir, "output directory")
+	must(viper.BindPFlag("ca.dir",
+		caCmd.Flags().Lookup("dir")))
+}
+
+func generateCA() error {
+	dir := viper.GetString("ca.dir")
+	fmt.Println("Using output directory:", dir)
+
+	err := mtls.GenerateTestCredentials(dir,
+		viper.GetInt("ca.replicas"), viper.GetInt("ca.clients"))
+	if err != nil {
+		return fmt.Errorf("Failed to generate TLS credentials: %s", err)
+	}
+
+	return nil
+}
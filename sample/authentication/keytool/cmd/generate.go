@@ -37,7 +37,12 @@ const (
 	defClientKeySpec   = "ECDSA"
 	defClientSecParam  = 256
 
+	defNrOperators      = 1
+	defOperatorKeySpec  = "ECDSA"
+	defOperatorSecParam = 256
+
 	defUsigEnclaveFile = "libusig.signed.so"
+	defUsigKeySpec     = "SGX_ECDSA"
 )
 
 // generateCmd represents the generate command
@@ -103,10 +108,30 @@ func init() {
 	must(viper.BindPFlag("clients.secparam",
 		generateCmd.Flags().Lookup("client-sec-param")))
 
+	generateCmd.Flags().Int("num-operators",
+		defNrOperators, "number of operators")
+	must(viper.BindPFlag("operators.number",
+		generateCmd.Flags().Lookup("num-operators")))
+
+	generateCmd.Flags().String("operator-key-spec",
+		defOperatorKeySpec, "keyspec for operator")
+	must(viper.BindPFlag("operators.keyspec",
+		generateCmd.Flags().Lookup("operator-key-spec")))
+
+	generateCmd.Flags().Int("operator-sec-param",
+		defOperatorSecParam, "operator security param")
+	must(viper.BindPFlag("operators.secparam",
+		generateCmd.Flags().Lookup("operator-sec-param")))
+
 	generateCmd.Flags().StringP("usig-enclave-file", "u",
 		defUsigEnclaveFile, "USIG enclave file")
 	must(viper.BindPFlag("usig.enclaveFile",
 		generateCmd.Flags().Lookup("usig-enclave-file")))
+
+	generateCmd.Flags().String("usig-key-spec",
+		defUsigKeySpec, "keyspec for USIG (SGX_ECDSA or SOFT_ECDSA)")
+	must(viper.BindPFlag("usig.keyspec",
+		generateCmd.Flags().Lookup("usig-key-spec")))
 }
 
 func generateKeys() error {
@@ -124,6 +149,11 @@ func generateKeys() error {
 		ClientSecParam: viper.GetInt("clients.secparam"),
 
 		UsigEnclaveFile: usigEnclaveFile,
+		UsigKeySpec:     viper.GetString("usig.keyspec"),
+
+		NumberOperators:  viper.GetInt("operators.number"),
+		OperatorKeySpec:  viper.GetString("operators.keyspec"),
+		OperatorSecParam: viper.GetInt("operators.secparam"),
 	}
 
 	outFileName := viper.GetString("output")
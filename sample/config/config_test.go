@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -82,6 +83,47 @@ func testParseParam(t *testing.T) {
 	}
 }
 
+func testDigest(t *testing.T) {
+	digest := func(cfgExample string) []byte {
+		testfn, cleanup := initExampleFile(t, "yaml", []byte(cfgExample))
+		defer cleanup()
+
+		cfg := New()
+		cfg.LoadConfig(testfn)
+		return cfg.Digest()
+	}
+
+	peers := `
+peers:
+    - id: 0
+      addr: ":8000"
+    - id: 1
+      addr: ":8001"
+`
+	reorderedPeers := `
+peers:
+    - id: 1
+      addr: ":8001"
+    - id: 0
+      addr: ":8000"
+`
+	otherPeers := `
+peers:
+    - id: 0
+      addr: ":8000"
+    - id: 1
+      addr: ":9001"
+`
+	otherParam := strings.Replace(string(yamlExample), "f: 1", "f: 2", 1)
+
+	d := digest(string(yamlExample) + peers)
+	assert.Equal(t, d, digest(string(yamlExample)+peers))
+	assert.Equal(t, d, digest(string(yamlExample)+reorderedPeers))
+	assert.NotEqual(t, d, digest(string(yamlExample)+otherPeers))
+	assert.NotEqual(t, d, digest(otherParam+peers))
+}
+
 func TestConfig(t *testing.T) {
 	t.Run("ParseParam", testParseParam)
+	t.Run("Digest", testDigest)
 }
@@ -18,10 +18,13 @@
 package config
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"log"
 	"math"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/spf13/viper"
@@ -169,3 +172,26 @@ func (c *ViperConfiger) Peers() []Peer {
 	}
 	return peers
 }
+
+// Digest returns a hash of the consensus configuration, i.e. the
+// protocol parameters and the list of peers. Replicas loaded with
+// equivalent configuration produce the same digest regardless of
+// the configuration file format or the order of peers.
+func (c *ViperConfiger) Digest() []byte {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "n=%d\nf=%d\ncheckpointPeriod=%d\nlogsize=%d\n",
+		c.N(), c.F(), c.CheckpointPeriod(), c.Logsize())
+	fmt.Fprintf(h, "timeout.request=%d\ntimeout.prepare=%d\ntimeout.viewchange=%d\n",
+		c.TimeoutRequest(), c.TimeoutPrepare(), c.TimeoutViewChange())
+
+	peers := c.Peers()
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].ID < peers[j].ID
+	})
+	for _, p := range peers {
+		fmt.Fprintf(h, "peer=%d %q\n", p.ID, p.Addr)
+	}
+
+	return h.Sum(nil)
+}
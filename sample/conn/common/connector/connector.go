@@ -16,7 +16,11 @@
 // functionality.
 package connector
 
-import "github.com/hyperledger-labs/minbft/api"
+import (
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
 
 // ReplicaConnector represents a generic implementation of
 // connectivity interface. It simply dispatches API method calls to
@@ -25,13 +29,15 @@ import "github.com/hyperledger-labs/minbft/api"
 // can be used.
 //
 // AssignReplica method assigns a replica representation to the
-// replica identifier.
+// replica identifier. It is safe to invoke concurrently with other
+// methods, e.g. to assign replicas joined the consensus network.
 type ReplicaConnector interface {
 	api.ReplicaConnector
 	AssignReplica(id uint32, replica api.ConnectionHandler)
 }
 
 type common struct {
+	lock     sync.RWMutex
 	replicas map[uint32]api.ConnectionHandler
 }
 
@@ -60,7 +66,7 @@ func NewReplicaSide() ReplicaConnector {
 }
 
 func (c *clientSide) ReplicaMessageStreamHandler(id uint32) api.MessageStreamHandler {
-	replica := c.replicas[id]
+	replica := c.replica(id)
 	if replica == nil {
 		return nil
 	}
@@ -69,7 +75,7 @@ func (c *clientSide) ReplicaMessageStreamHandler(id uint32) api.MessageStreamHan
 }
 
 func (c *replicaSide) ReplicaMessageStreamHandler(id uint32) api.MessageStreamHandler {
-	replica := c.replicas[id]
+	replica := c.replica(id)
 	if replica == nil {
 		return nil
 	}
@@ -84,5 +90,15 @@ func newCommon() *common {
 }
 
 func (c *common) AssignReplica(id uint32, replica api.ConnectionHandler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.replicas[id] = replica
 }
+
+func (c *common) replica(id uint32) api.ConnectionHandler {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.replicas[id]
+}
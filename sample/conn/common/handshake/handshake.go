@@ -0,0 +1,313 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package handshake implements a handshake between replicas to
+// perform when a stream of peer messages is set up.
+//
+// The replica initiating the stream first obtains a challenge, i.e. a
+// fresh nonce, from the other replica. Then it sends a hello message
+// with its replica ID, the protocol version and the digest of its
+// consensus configuration together with the challenge and a fresh
+// nonce of its own. The other replica checks that the protocol
+// version and configuration match its own ones, that the challenge
+// was issued by itself and not used before, and responds with its own
+// hello message, which includes the nonce of the initiator. Each
+// hello message is signed with the replica key of its sender, so that
+// neither message can be replayed. The stream is refused if the
+// handshake fails on either side, so that misconfigured replicas are
+// detected before they start exchanging messages. Failures to
+// authenticate the other replica are reported as AuthenticationError
+// since retrying the handshake cannot help.
+package handshake
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// ProtocolVersion is the version of the protocol messages exchanged
+// between replicas. It has to be increased whenever the message
+// format changes in an incompatible way.
+const ProtocolVersion uint32 = 1
+
+const (
+	nonceSize = 16
+
+	// maximal number of outstanding challenges; the oldest
+	// challenge is dropped when exceeded
+	maxChallenges = 1024
+
+	// signed data is prefixed to be distinct from other messages
+	// signed with the replica key
+	signaturePrefix = "minbft-handshake"
+)
+
+// Hello is a handshake message.
+type Hello struct {
+	Version      uint32
+	ReplicaID    uint32
+	ConfigDigest []byte
+
+	// fresh nonce of the sender
+	Nonce []byte
+
+	// nonce of the other replica: the challenge for the initial
+	// hello, the nonce of the initial hello for the response
+	PeerNonce []byte
+
+	Signature []byte
+}
+
+// Handshaker performs the handshake on behalf of a replica.
+type Handshaker struct {
+	id           uint32
+	configDigest []byte
+	authen       api.Authenticator
+
+	lock       sync.Mutex
+	challenges map[string]bool // outstanding challenges
+	issued     []string        // outstanding challenges, oldest first
+}
+
+// AuthenticationError is returned if the other replica failed to
+// authenticate itself during the handshake.
+type AuthenticationError struct {
+	ReplicaID uint32
+	Err       error
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("failed to authenticate replica %d: %s", e.ReplicaID, e.Err)
+}
+
+// New creates a new instance of Handshaker for the replica with the
+// specified ID and configuration digest. The authenticator is used
+// to sign and verify hello messages with replica keys.
+func New(id uint32, configDigest []byte, authen api.Authenticator) *Handshaker {
+	return &Handshaker{
+		id:           id,
+		configDigest: configDigest,
+		authen:       authen,
+		challenges:   make(map[string]bool),
+	}
+}
+
+// Challenge returns a fresh nonce to initiate a handshake with this
+// replica. Each challenge can be responded only once.
+func (h *Handshaker) Challenge() ([]byte, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.issued) == maxChallenges {
+		delete(h.challenges, h.issued[0])
+		h.issued = h.issued[1:]
+	}
+	h.challenges[string(nonce)] = true
+	h.issued = append(h.issued, string(nonce))
+
+	return nonce, nil
+}
+
+// Initiate creates a hello message to start the handshake with in
+// response to the challenge obtained from the other replica.
+func (h *Handshaker) Initiate(challenge []byte) (*Hello, error) {
+	return h.newHello(challenge)
+}
+
+// Respond checks the hello message received from another replica to
+// start the handshake with. It returns a hello message to respond
+// with if the handshake succeeds, or an error describing a mismatch.
+func (h *Handshaker) Respond(hello *Hello) (*Hello, error) {
+	if err := h.check(hello); err != nil {
+		return nil, err
+	}
+	if hello.ReplicaID == h.id {
+		return nil, fmt.Errorf("unexpected replica ID %d", hello.ReplicaID)
+	}
+	if !h.useChallenge(hello.PeerNonce) {
+		return nil, fmt.Errorf("unknown or used challenge")
+	}
+
+	return h.newHello(hello.Nonce)
+}
+
+// Complete checks the hello message received from the replica in
+// response to the initial hello message. It returns nil if the
+// handshake succeeds, or an error describing a mismatch.
+func (h *Handshaker) Complete(initial, response *Hello, replicaID uint32) error {
+	if err := h.check(response); err != nil {
+		return err
+	}
+	if response.ReplicaID != replicaID {
+		return &AuthenticationError{replicaID, fmt.Errorf("unexpected replica ID %d", response.ReplicaID)}
+	}
+	if !bytes.Equal(response.PeerNonce, initial.Nonce) {
+		return fmt.Errorf("response does not match the initial hello")
+	}
+
+	return nil
+}
+
+// useChallenge checks if the challenge is outstanding and prevents
+// it from being used again.
+func (h *Handshaker) useChallenge(challenge []byte) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.challenges[string(challenge)] {
+		return false
+	}
+	delete(h.challenges, string(challenge))
+	for i, c := range h.issued {
+		if c == string(challenge) {
+			h.issued = append(h.issued[:i], h.issued[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+func (h *Handshaker) newHello(peerNonce []byte) (*Hello, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	hello := &Hello{
+		Version:      ProtocolVersion,
+		ReplicaID:    h.id,
+		ConfigDigest: h.configDigest,
+		Nonce:        nonce,
+		PeerNonce:    peerNonce,
+	}
+
+	sig, err := h.authen.GenerateMessageAuthenTag(api.ReplicaAuthen, hello.signedData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign hello: %s", err)
+	}
+	hello.Signature = sig
+
+	return hello, nil
+}
+
+func (h *Handshaker) check(hello *Hello) error {
+	if hello.Version != ProtocolVersion {
+		return fmt.Errorf("protocol version mismatch: replica %d uses version %d, expected %d",
+			hello.ReplicaID, hello.Version, ProtocolVersion)
+	}
+
+	err := h.authen.VerifyMessageAuthenTag(api.ReplicaAuthen, hello.ReplicaID, hello.signedData(), hello.Signature)
+	if err != nil {
+		return &AuthenticationError{hello.ReplicaID, fmt.Errorf("invalid signature: %s", err)}
+	}
+
+	if !bytes.Equal(hello.ConfigDigest, h.configDigest) {
+		return fmt.Errorf("configuration mismatch: replica %d uses configuration digest %x, expected %x",
+			hello.ReplicaID, hello.ConfigDigest, h.configDigest)
+	}
+
+	return nil
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %s", err)
+	}
+	return nonce, nil
+}
+
+// MarshalBinary encodes the hello message into binary form.
+func (hello *Hello) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	hello.marshalUnsigned(buf)
+	writeBytes(buf, hello.Signature)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the hello message from binary form.
+func (hello *Hello) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	// Protocol version and replica ID are encoded the same way in
+	// any version
+	var hdr struct{ Version, ReplicaID uint32 }
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return fmt.Errorf("failed to decode hello: %s", err)
+	}
+	*hello = Hello{Version: hdr.Version, ReplicaID: hdr.ReplicaID}
+	if hello.Version != ProtocolVersion {
+		return nil // let the version mismatch be reported
+	}
+
+	for _, field := range []*[]byte{&hello.ConfigDigest, &hello.Nonce, &hello.PeerNonce, &hello.Signature} {
+		b, err := readBytes(r)
+		if err != nil {
+			return fmt.Errorf("failed to decode hello: %s", err)
+		}
+		*field = b
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("failed to decode hello: unexpected trailing data")
+	}
+
+	return nil
+}
+
+func (hello *Hello) signedData() []byte {
+	buf := bytes.NewBufferString(signaturePrefix)
+	hello.marshalUnsigned(buf)
+	return buf.Bytes()
+}
+
+func (hello *Hello) marshalUnsigned(buf *bytes.Buffer) {
+	_ = binary.Write(buf, binary.BigEndian, hello.Version)
+	_ = binary.Write(buf, binary.BigEndian, hello.ReplicaID)
+	writeBytes(buf, hello.ConfigDigest)
+	writeBytes(buf, hello.Nonce)
+	writeBytes(buf, hello.PeerNonce)
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if uint64(n) > uint64(r.Len()) {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
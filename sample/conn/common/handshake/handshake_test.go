@@ -0,0 +1,181 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handshake
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+)
+
+const nrReplicas = 3
+
+var (
+	digest      = []byte("config digest")
+	otherDigest = []byte("other config digest")
+)
+
+func TestHandshake(t *testing.T) {
+	keys := generateKeys(t)
+	h0 := New(0, digest, newAuthenticator(t, keys, 0))
+	h1 := New(1, digest, newAuthenticator(t, keys, 1))
+
+	initial := initiate(t, h0, h1)
+	initial = reencode(t, initial)
+
+	response, err := h1.Respond(initial)
+	require.NoError(t, err)
+	response = reencode(t, response)
+
+	assert.NoError(t, h0.Complete(initial, response, 1))
+	err = h0.Complete(initial, response, 2)
+	assert.IsType(t, &AuthenticationError{}, err, "unexpected replica")
+
+	// Response to another hello is not accepted
+	other := initiate(t, h0, h1)
+	assert.Error(t, h0.Complete(other, response, 1))
+
+	// Replica cannot connect to itself
+	_, err = h0.Respond(initiate(t, h0, h0))
+	assert.Error(t, err)
+}
+
+func TestHandshakeChallenge(t *testing.T) {
+	keys := generateKeys(t)
+	h0 := New(0, digest, newAuthenticator(t, keys, 0))
+	h1 := New(1, digest, newAuthenticator(t, keys, 1))
+	h2 := New(2, digest, newAuthenticator(t, keys, 2))
+
+	// Replayed hello is not accepted
+	initial := initiate(t, h0, h1)
+	_, err := h1.Respond(initial)
+	require.NoError(t, err)
+	_, err = h1.Respond(initial)
+	assert.Error(t, err)
+
+	// Challenge issued by another replica is not accepted
+	_, err = h1.Respond(initiate(t, h0, h2))
+	assert.Error(t, err)
+
+	// Hello without challenge is not accepted
+	hello, err := h0.Initiate(nil)
+	require.NoError(t, err)
+	_, err = h1.Respond(hello)
+	assert.Error(t, err)
+
+	// Only the most recent challenges are kept
+	initial = initiate(t, h0, h1)
+	for i := 0; i < maxChallenges; i++ {
+		_, err := h1.Challenge()
+		require.NoError(t, err)
+	}
+	_, err = h1.Respond(initial)
+	assert.Error(t, err)
+	_, err = h1.Respond(initiate(t, h0, h1))
+	assert.NoError(t, err)
+}
+
+func TestHandshakeMismatch(t *testing.T) {
+	keys := generateKeys(t)
+	h0 := New(0, digest, newAuthenticator(t, keys, 0))
+	h1 := New(1, digest, newAuthenticator(t, keys, 1))
+
+	misconfigured := New(2, otherDigest, newAuthenticator(t, keys, 2))
+	_, err := h1.Respond(initiate(t, misconfigured, h1))
+	assert.Error(t, err)
+
+	// Handshake fails on the initiating side as well
+	_, err = misconfigured.Respond(initiate(t, h0, misconfigured))
+	assert.Error(t, err)
+
+	hello := initiate(t, h0, h1)
+	hello.Version++
+	_, err = h1.Respond(reencode(t, hello))
+	assert.Error(t, err)
+
+	// Signature by a replica with different keys
+	foreign := New(2, digest, newAuthenticator(t, generateKeys(t), 2))
+	_, err = h1.Respond(initiate(t, foreign, h1))
+	assert.IsType(t, &AuthenticationError{}, err)
+
+	// Tampered hello
+	hello = initiate(t, h0, misconfigured)
+	hello.ConfigDigest = otherDigest
+	_, err = misconfigured.Respond(hello)
+	assert.IsType(t, &AuthenticationError{}, err)
+}
+
+func TestUnmarshal(t *testing.T) {
+	hello := &Hello{
+		Version:      ProtocolVersion,
+		ReplicaID:    1,
+		ConfigDigest: digest,
+		Nonce:        []byte("nonce"),
+		PeerNonce:    []byte("challenge"),
+		Signature:    []byte("signature"),
+	}
+	data, err := hello.MarshalBinary()
+	require.NoError(t, err)
+
+	for i := 0; i < len(data); i++ {
+		assert.Error(t, new(Hello).UnmarshalBinary(data[:i]), "truncated at %d", i)
+	}
+	assert.Error(t, new(Hello).UnmarshalBinary(append(data, 0)))
+}
+
+// initiate creates the hello message of the initiator to start the
+// handshake with the responder.
+func initiate(t *testing.T, initiator, responder *Handshaker) *Hello {
+	challenge, err := responder.Challenge()
+	require.NoError(t, err)
+	hello, err := initiator.Initiate(challenge)
+	require.NoError(t, err)
+	return hello
+}
+
+func reencode(t *testing.T, hello *Hello) *Hello {
+	data, err := hello.MarshalBinary()
+	require.NoError(t, err)
+
+	decoded := new(Hello)
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	return decoded
+}
+
+func newAuthenticator(t *testing.T, keys []byte, id uint32) api.Authenticator {
+	au, err := authen.New([]api.AuthenticationRole{api.ReplicaAuthen}, id, bytes.NewReader(keys))
+	require.NoError(t, err)
+	return au
+}
+
+func generateKeys(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := authen.GenerateTestnetKeys(&buf, &authen.TestnetKeyOpts{
+		NumberReplicas:  nrReplicas,
+		ReplicaKeySpec:  "ECDSA",
+		ReplicaSecParam: 256,
+		NumberClients:   0,
+		ClientKeySpec:   "ECDSA",
+		ClientSecParam:  256,
+		UsigKeySpec:     "SOFT_ECDSA",
+	})
+	require.NoError(t, err)
+	return buf.Bytes()
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-labs/minbft/api"
+	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
+)
+
+// QueryStatus retrieves the internal state of the replica at the
+// gRPC target address through its admin service.
+func QueryStatus(ctx context.Context, target string, dialOpts ...grpc.DialOption) (*api.ReplicaStatus, error) {
+	conn, err := grpc.DialContext(ctx, target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+
+	st, err := pb.NewAdminClient(conn).Status(ctx, &pb.StatusRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error making RPC call: %s", err)
+	}
+
+	res := &api.ReplicaStatus{
+		ReplicaID:    st.GetReplicaId(),
+		CurrentView:  st.GetCurrentView(),
+		ExpectedView: st.GetExpectedView(),
+		Primary:      st.GetPrimary(),
+		Epoch:        st.GetEpoch(),
+		F:            st.GetF(),
+		Members:      st.GetMembers(),
+		Addresses:    st.GetAddresses(),
+	}
+	if r := st.GetLastExecuted(); r != nil {
+		res.LastExecuted = &api.RequestID{ClientID: r.GetClientId(), Seq: r.GetSeq()}
+	}
+	for _, r := range st.GetPending() {
+		res.Pending = append(res.Pending, api.RequestID{ClientID: r.GetClientId(), Seq: r.GetSeq()})
+	}
+	for _, c := range st.GetClients() {
+		res.Clients = append(res.Clients, api.ClientStatus{
+			ClientID:         c.GetClientId(),
+			LastAcceptedSeq:  c.GetLastAcceptedSeq(),
+			LastPreparedSeq:  c.GetLastPreparedSeq(),
+			LastCommittedSeq: c.GetLastCommittedSeq(),
+		})
+	}
+	for _, p := range st.GetPeers() {
+		res.Peers = append(res.Peers, api.PeerStatus{
+			ReplicaID:     p.GetReplicaId(),
+			LastUICounter: p.GetLastUiCounter(),
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	backoffBaseDelay = 100 * time.Millisecond
+	backoffMaxDelay  = 10 * time.Second
+	backoffFactor    = 2
+	backoffJitter    = 0.2
+)
+
+// backoff computes exponentially increasing delays between attempts
+// to re-establish a connection. The delay is reset once a connection
+// has been kept established longer than the maximal delay.
+type backoff struct {
+	delay   time.Duration
+	lastTry time.Time
+}
+
+func newBackoff() *backoff {
+	return &backoff{}
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	now := time.Now()
+	if b.delay == 0 || now.Sub(b.lastTry) > b.delay+backoffMaxDelay {
+		b.delay = backoffBaseDelay
+	} else if b.delay *= backoffFactor; b.delay > backoffMaxDelay {
+		b.delay = backoffMaxDelay
+	}
+
+	// Randomize to avoid synchronized attempts
+	jitter := 1 + backoffJitter*(2*rand.Float64()-1)
+	delay := time.Duration(float64(b.delay) * jitter)
+
+	b.lastTry = now.Add(delay)
+
+	return delay
+}
@@ -20,11 +20,14 @@ package connector
 
 import (
 	"fmt"
+	"sync"
 
 	"google.golang.org/grpc"
 
 	"github.com/hyperledger-labs/minbft/api"
 	common "github.com/hyperledger-labs/minbft/sample/conn/common/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/handshake"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
 	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
 )
 
@@ -52,20 +55,114 @@ func ConnectManyReplicas(conn ReplicaConnector, targets map[uint32]string, dialO
 	return nil
 }
 
+// ConnectManyReplicasTLS is similar to ConnectManyReplicas, but
+// establishes connections with mutual TLS authentication using the
+// supplied credentials. Each replica is required to present a valid
+// certificate bound to its ID.
+func ConnectManyReplicasTLS(conn ReplicaConnector, targets map[uint32]string, creds *mtls.Credentials, dialOpts ...grpc.DialOption) error {
+	for id, target := range targets {
+		opts := append([]grpc.DialOption{creds.DialOption(id)}, dialOpts...)
+		err := conn.ConnectReplica(id, target, opts...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MembershipObserver returns an instance of api.MembershipObserver
+// to connect the supplied connector to the replicas joined the
+// consensus network by their gRPC target addresses given in the
+// membership. Replicas with no address are not connected.
+func MembershipObserver(conn ReplicaConnector, dialOpts ...grpc.DialOption) api.MembershipObserver {
+	return &membershipObserver{
+		conn:      conn,
+		dialOpts:  dialOpts,
+		connected: make(map[uint32]bool),
+	}
+}
+
+// MembershipObserverTLS is similar to MembershipObserver, but
+// connects to the joined replicas with mutual TLS authentication
+// using the supplied credentials.
+func MembershipObserverTLS(conn ReplicaConnector, creds *mtls.Credentials, dialOpts ...grpc.DialOption) api.MembershipObserver {
+	return &membershipObserver{
+		conn:      conn,
+		creds:     creds,
+		dialOpts:  dialOpts,
+		connected: make(map[uint32]bool),
+	}
+}
+
+type membershipObserver struct {
+	conn     ReplicaConnector
+	creds    *mtls.Credentials
+	dialOpts []grpc.DialOption
+
+	lock      sync.Mutex
+	connected map[uint32]bool
+}
+
+func (o *membershipObserver) MembershipChanged(m *api.Membership) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, r := range m.Replicas {
+		if r.Address == "" || o.connected[r.ID] {
+			continue
+		}
+		opts := o.dialOpts
+		if o.creds != nil {
+			opts = append([]grpc.DialOption{o.creds.DialOption(r.ID)}, opts...)
+		}
+		if err := o.conn.ConnectReplica(r.ID, r.Address, opts...); err != nil {
+			return fmt.Errorf("Failed to connect to replica %d: %s", r.ID, err)
+		}
+		o.connected[r.ID] = true
+	}
+
+	return nil
+}
+
+type options struct {
+	handshaker *handshake.Handshaker
+}
+
+// Option represents a parameter to create a connector with.
+type Option func(*options)
+
+// WithHandshake specifies to perform a handshake using the supplied
+// handshaker when setting up streams of peer messages. Streams are
+// not established unless the handshake succeeds.
+func WithHandshake(h *handshake.Handshaker) Option {
+	return func(opts *options) {
+		opts.handshaker = h
+	}
+}
+
 type connector struct {
 	common.ReplicaConnector
+	opts options
 }
 
 // NewClientSide creates a new instance of ReplicaConnector to use at
 // client side, i.e. initiate client-to-replica connections.
-func NewClientSide() ReplicaConnector {
-	return &connector{common.NewClientSide()}
+func NewClientSide(opts ...Option) ReplicaConnector {
+	return newConnector(common.NewClientSide(), opts)
 }
 
 // NewReplicaSide creates a new instance of ReplicaConnector to use at
 // replica side, i.e. initiate replica-to-replica connections.
-func NewReplicaSide() ReplicaConnector {
-	return &connector{common.NewReplicaSide()}
+func NewReplicaSide(opts ...Option) ReplicaConnector {
+	return newConnector(common.NewReplicaSide(), opts)
+}
+
+func newConnector(conn common.ReplicaConnector, opts []Option) *connector {
+	c := &connector{ReplicaConnector: conn}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
 }
 
 // ConnectReplica establishes a connection to a replica by its gRPC
@@ -79,6 +176,7 @@ func (c *connector) ConnectReplica(replicaID uint32, target string, dialOpts ...
 	replica := &replica{
 		rpcClient: pb.NewChannelClient(connection),
 		id:        replicaID,
+		opts:      c.opts,
 	}
 
 	c.AssignReplica(replicaID, replica)
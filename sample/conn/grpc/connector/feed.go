@@ -0,0 +1,88 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-labs/minbft/api"
+	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
+)
+
+// FeedSubscription receives committed operations streamed by the
+// commit feed of a replica.
+//
+// Recv blocks until the next committed operation is received. An
+// error is returned if the stream is terminated, e.g. because the
+// subscriber fell behind the history retained by the replica.
+//
+// Close terminates the subscription and releases the connection.
+type FeedSubscription interface {
+	Recv() (*api.CommittedOperation, error)
+	Close() error
+}
+
+type feedSubscription struct {
+	conn   *grpc.ClientConn
+	stream pb.Feed_SubscribeClient
+	cancel context.CancelFunc
+}
+
+// SubscribeCommitted subscribes to the commit feed of the replica at
+// the gRPC target address. Committed operations are streamed from the
+// specified position on; if from is zero then from the oldest one
+// retained by the replica.
+func SubscribeCommitted(target string, from uint64, dialOpts ...grpc.DialOption) (FeedSubscription, error) {
+	conn, err := grpc.Dial(target, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pb.NewFeedClient(conn).Subscribe(ctx, &pb.SubscribeRequest{From: from})
+	if err != nil {
+		cancel()
+		conn.Close()
+		return nil, fmt.Errorf("error making RPC call: %s", err)
+	}
+
+	return &feedSubscription{conn, stream, cancel}, nil
+}
+
+func (s *feedSubscription) Recv() (*api.CommittedOperation, error) {
+	op, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.CommittedOperation{
+		Position:    op.GetPosition(),
+		View:        op.GetView(),
+		UICounter:   op.GetUiCounter(),
+		ClientID:    op.GetClientId(),
+		Seq:         op.GetSeq(),
+		Kind:        api.RequestKind(op.GetKind()),
+		Operation:   op.GetOperation(),
+		Certificate: op.GetCertificate(),
+	}, nil
+}
+
+func (s *feedSubscription) Close() error {
+	s.cancel()
+	return s.conn.Close()
+}
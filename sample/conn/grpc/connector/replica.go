@@ -16,18 +16,26 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/handshake"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/internal/session"
 	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
 )
 
 type replica struct {
 	id        uint32
 	rpcClient pb.ChannelClient
+	opts      options
 }
 
 func (r *replica) PeerMessageStreamHandler() api.MessageStreamHandler {
@@ -47,76 +55,127 @@ type peerStreamHandler struct {
 }
 
 func (sh *clientStreamHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
-	out := make(chan []byte)
-
-	go func() {
-		defer close(out)
-
-		r := sh.replica
-		stream, err := r.rpcClient.ClientChat(context.Background(), grpc.WaitForReady(true))
-		if err != nil {
-			log.Printf("Error making RPC call to replica %d: %s\n", r.id, err)
-			return
-		}
-
-		go r.handleIn(stream, in)
+	r := sh.replica
+	return r.handleMessageStream(in, nil, func(ctx context.Context) (rpcStream, error) {
+		return r.rpcClient.ClientChat(ctx, grpc.WaitForReady(true))
+	})
+}
 
-		r.handleOut(stream, out)
-	}()
+func (sh *peerStreamHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	r := sh.replica
+	return r.handleMessageStream(in, r.opts.handshaker, func(ctx context.Context) (rpcStream, error) {
+		return r.rpcClient.PeerChat(ctx, grpc.WaitForReady(true))
+	})
+}
 
-	return out
+type rpcStream interface {
+	Send(*pb.Message) error
+	Recv() (*pb.Message, error)
+	grpc.ClientStream
 }
 
-func (sh *peerStreamHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
+// handleMessageStream exchanges messages with the replica within a
+// session established over streams opened by the supplied function.
+// If a stream fails then another one is opened after a backoff delay
+// to resume the session. If the handshaker is not nil then the
+// handshake is performed on each stream opened.
+func (r *replica) handleMessageStream(in <-chan []byte, hs *handshake.Handshaker, openStream func(ctx context.Context) (rpcStream, error)) <-chan []byte {
 	out := make(chan []byte)
+	sess := session.New(in, out)
+	sessionID := session.NewID()
 
 	go func() {
-		defer close(out)
-
-		r := sh.replica
-		stream, err := r.rpcClient.PeerChat(context.Background(), grpc.WaitForReady(true))
-		if err != nil {
-			log.Printf("Error making RPC call to replica %d: %s\n", r.id, err)
-			return
+		var token string
+		b := newBackoff()
+		for {
+			err := r.serveSession(sess, sessionID, &token, hs, openStream)
+			if err == nil {
+				return
+			} else if c := status.Code(err); c == codes.PermissionDenied || c == codes.Unauthenticated {
+				log.Printf("Connection to replica %d refused: %s\n", r.id, err)
+				sess.Abort()
+				return
+			}
+
+			// Other handshake failures are retried since the
+			// replica may get reconfigured meanwhile
+			delay := b.next()
+			log.Printf("Connection to replica %d failed: %s; reconnecting in %v\n", r.id, err, delay)
+			time.Sleep(delay)
 		}
-
-		go r.handleIn(stream, in)
-
-		r.handleOut(stream, out)
 	}()
 
 	return out
 }
 
-type rpcStream interface {
-	Send(*pb.Message) error
-	Recv() (*pb.Message, error)
-	grpc.ClientStream
-}
-
-func (r *replica) handleIn(stream rpcStream, in <-chan []byte) {
-	for msg := range in {
-		m := &pb.Message{Payload: msg}
-		if err := stream.Send(m); err != nil {
-			log.Printf("Error sending to replica %d: %s\n", r.id, err)
-			return
+// serveSession opens a new stream and attaches it to the session. It
+// returns nil if the session has been finished. The token is updated
+// with the one supplied by the replica to detect the replica losing
+// the session state.
+func (r *replica) serveSession(sess *session.Session, sessionID string, token *string, hs *handshake.Handshaker, openStream func(ctx context.Context) (rpcStream, error)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var hello *handshake.Hello
+	if hs != nil {
+		res, err := r.rpcClient.PeerChallenge(ctx, &pb.PeerChallengeRequest{}, grpc.WaitForReady(true))
+		if err != nil {
+			return err
 		}
+		if hello, err = hs.Initiate(res.GetNonce()); err != nil {
+			return err
+		}
+		data, err := hello.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		ctx = session.AppendHello(ctx, data)
 	}
 
-	if err := stream.CloseSend(); err != nil {
-		log.Printf("Error closing RPC stream of replica %d: %s\n", r.id, err)
+	ctx = session.OutgoingContext(ctx, sessionID, sess.Received())
+	stream, err := openStream(ctx)
+	if err != nil {
+		return fmt.Errorf("error making RPC call: %s", err)
 	}
-}
 
-func (r *replica) handleOut(stream rpcStream, out chan<- []byte) {
-	for {
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			return
-		} else if err != nil {
-			log.Printf("Error receiving from replica %d: %s\n", r.id, err)
-			return
+	md, err := stream.Header()
+	if err != nil {
+		return err
+	}
+	newToken, peerReceived, err := session.ParseHeader(md)
+	if err != nil {
+		// The stream may have been terminated with an error
+		if _, recvErr := stream.Recv(); recvErr != nil && recvErr != io.EOF {
+			return recvErr
 		}
-		out <- msg.Payload
+		return err
 	}
+	if hello != nil {
+		if err := completeHandshake(hs, hello, md, r.id); err != nil {
+			if _, ok := err.(*handshake.AuthenticationError); ok {
+				return status.Errorf(codes.Unauthenticated, "handshake failed: %s", err)
+			}
+			return status.Errorf(codes.FailedPrecondition, "handshake failed: %s", err)
+		}
+	}
+	if *token != "" && newToken != *token {
+		sess.Resync()
+	}
+	*token = newToken
+
+	return sess.Serve(stream, peerReceived, stream.CloseSend)
+}
+
+func completeHandshake(hs *handshake.Handshaker, initial *handshake.Hello, md metadata.MD, replicaID uint32) error {
+	data := session.HelloFromHeader(md)
+	if data == nil {
+		return fmt.Errorf("no handshake response from replica")
+	}
+
+	response := new(handshake.Hello)
+	if err := response.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	return hs.Complete(initial, response, replicaID)
 }
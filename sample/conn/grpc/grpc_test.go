@@ -17,17 +17,29 @@
 package grpc
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/hyperledger-labs/minbft/api"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/handshake"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/server"
 
 	mock_api "github.com/hyperledger-labs/minbft/api/mocks"
@@ -65,6 +77,263 @@ func TestReplicaSide(t *testing.T) {
 	testConnector(t, conn, peerHandlers)
 }
 
+func TestMutualTLS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "grpc-tls")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := mtls.GenerateTestCredentials(dir, nrReplicas+1, 1); err != nil {
+		panic(err)
+	}
+
+	replicaConn := connector.NewReplicaSide()
+	clientConn := connector.NewClientSide()
+	refusedConn := connector.NewReplicaSide()
+	joinedConn := connector.NewReplicaSide()
+
+	members := server.NewReplicaSet(nrReplicas)
+	replicas, stop := setupTLSConnectors(ctrl, dir, nrReplicas, members, map[connector.ReplicaConnector]mtls.Identity{
+		replicaConn: mtls.ReplicaIdentity(0),
+		clientConn:  mtls.ClientIdentity(0),
+		refusedConn: mtls.ClientIdentity(0),
+		joinedConn:  mtls.ReplicaIdentity(nrReplicas),
+	})
+	defer stop()
+
+	peerHandlers := setupPeerHandlers(ctrl, replicas)
+	testConnector(t, replicaConn, peerHandlers)
+
+	clientHandlers := setupClientHandlers(ctrl, replicas)
+	testConnector(t, clientConn, clientHandlers)
+
+	// Clients are not permitted to open peer streams
+	for i := 0; i < nrReplicas; i++ {
+		sh := refusedConn.ReplicaMessageStreamHandler(uint32(i))
+		_, more := <-sh.HandleMessageStream(make(chan []byte))
+		assert.False(t, more)
+	}
+
+	// Replicas joined by reconfiguration are served once members
+	assert.False(t, members.Contains(nrReplicas))
+	m := &api.Membership{Epoch: 1}
+	for i := 0; i <= nrReplicas; i++ {
+		m.Replicas = append(m.Replicas, api.ReplicaInfo{ID: uint32(i)})
+	}
+	time.AfterFunc(10*time.Millisecond, func() {
+		require.NoError(t, members.MembershipChanged(m))
+	})
+	testConnector(t, joinedConn, peerHandlers)
+	assert.True(t, members.Contains(nrReplicas))
+}
+
+func TestCommitFeed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ops := []*api.CommittedOperation{
+		{Position: 1, View: 0, UICounter: 1, ClientID: 0, Seq: 1, Operation: []byte("op1"), Certificate: [][]byte{[]byte("p1")}},
+		{Position: 2, View: 1, UICounter: 3, ClientID: 1, Seq: 1, Operation: []byte("op2"), Certificate: [][]byte{[]byte("p2"), []byte("c2")}},
+	}
+	r := &feedReplica{mock_api.NewMockConnectionHandler(ctrl), ops}
+
+	done := make(chan struct{})
+	defer close(done)
+	addr := startNewServer(r, done)
+
+	sub, err := connector.SubscribeCommitted(addr, 2, grpc.WithInsecure())
+	require.NoError(t, err)
+	op, err := sub.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, ops[1], op)
+	_, err = sub.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NoError(t, sub.Close())
+
+	sub, err = connector.SubscribeCommitted(addr, 3, grpc.WithInsecure())
+	require.NoError(t, err)
+	_, err = sub.Recv()
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+	assert.NoError(t, sub.Close())
+}
+
+func TestAdminStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	st := &api.ReplicaStatus{
+		ReplicaID:    1,
+		CurrentView:  2,
+		ExpectedView: 3,
+		Primary:      2,
+		LastExecuted: &api.RequestID{ClientID: 0, Seq: 5},
+		Pending:      []api.RequestID{{ClientID: 1, Seq: 2}},
+		Clients:      []api.ClientStatus{{ClientID: 0, LastAcceptedSeq: 6, LastPreparedSeq: 5, LastCommittedSeq: 5}},
+		Peers:        []api.PeerStatus{{ReplicaID: 0, LastUICounter: 7}},
+	}
+	r := &statusReplica{mock_api.NewMockConnectionHandler(ctrl), st}
+
+	done := make(chan struct{})
+	defer close(done)
+	addr := startNewServer(r, done)
+
+	res, err := connector.QueryStatus(context.Background(), addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	assert.Equal(t, st, res)
+
+	r.status = &api.ReplicaStatus{ReplicaID: 1}
+	res, err = connector.QueryStatus(context.Background(), addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	assert.Equal(t, r.status, res)
+}
+
+func TestHandshake(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var keys bytes.Buffer
+	err := authen.GenerateTestnetKeys(&keys, &authen.TestnetKeyOpts{
+		NumberReplicas:  nrReplicas + 1,
+		ReplicaKeySpec:  "ECDSA",
+		ReplicaSecParam: 256,
+		ClientKeySpec:   "ECDSA",
+		ClientSecParam:  256,
+		UsigKeySpec:     "SOFT_ECDSA",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	var foreignKeys bytes.Buffer
+	err = authen.GenerateTestnetKeys(&foreignKeys, &authen.TestnetKeyOpts{
+		NumberReplicas:  nrReplicas + 1,
+		ReplicaKeySpec:  "ECDSA",
+		ReplicaSecParam: 256,
+		ClientKeySpec:   "ECDSA",
+		ClientSecParam:  256,
+		UsigKeySpec:     "SOFT_ECDSA",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	newHandshakerWithKeys := func(id uint32, digest string, keys []byte) *handshake.Handshaker {
+		au, err := authen.New([]api.AuthenticationRole{api.ReplicaAuthen}, id, bytes.NewReader(keys))
+		if err != nil {
+			panic(err)
+		}
+		return handshake.New(id, []byte(digest), au)
+	}
+	newHandshaker := func(id uint32, digest string) *handshake.Handshaker {
+		return newHandshakerWithKeys(id, digest, keys.Bytes())
+	}
+
+	// The connecting side acts as an extra replica
+	conn := connector.NewReplicaSide(connector.WithHandshake(newHandshaker(nrReplicas, "config")))
+	misconfiguredConn := connector.NewReplicaSide(connector.WithHandshake(newHandshaker(nrReplicas, "other config")))
+	foreignConn := connector.NewReplicaSide(connector.WithHandshake(newHandshakerWithKeys(nrReplicas, "config", foreignKeys.Bytes())))
+
+	done := make(chan struct{})
+	defer close(done)
+
+	addrs := make(map[uint32]string)
+	var replicas []*mock_api.MockConnectionHandler
+	for i := 0; i < nrReplicas; i++ {
+		r := mock_api.NewMockConnectionHandler(ctrl)
+		replicas = append(replicas, r)
+
+		srv := server.New(r, server.WithHandshake(newHandshaker(uint32(i), "config")))
+		go func() {
+			<-done
+			srv.Stop()
+		}()
+
+		addrs[uint32(i)] = listenAndServe(srv)
+	}
+
+	for _, c := range []connector.ReplicaConnector{conn, misconfiguredConn, foreignConn} {
+		if err := connector.ConnectManyReplicas(c, addrs, grpc.WithInsecure()); err != nil {
+			panic(err)
+		}
+	}
+
+	peerHandlers := setupPeerHandlers(ctrl, replicas)
+	testConnector(t, conn, peerHandlers)
+
+	// Replicas with mismatching configuration are refused; no
+	// more streams are expected by the mock handlers
+	var streams []<-chan []byte
+	for i := 0; i < nrReplicas; i++ {
+		sh := misconfiguredConn.ReplicaMessageStreamHandler(uint32(i))
+		out := make(chan []byte, 1)
+		out <- makeMessages(1)[0]
+		streams = append(streams, sh.HandleMessageStream(out))
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, in := range streams {
+		select {
+		case <-in:
+			assert.Fail(t, "Unexpected message received")
+		default:
+		}
+	}
+
+	// Replicas failing to authenticate are refused permanently
+	for i := 0; i < nrReplicas; i++ {
+		sh := foreignConn.ReplicaMessageStreamHandler(uint32(i))
+		out := make(chan []byte, 1)
+		out <- makeMessages(1)[0]
+		select {
+		case _, ok := <-sh.HandleMessageStream(out):
+			assert.False(t, ok, "Unexpected message received")
+		case <-time.After(time.Second):
+			assert.Fail(t, "Stream not closed")
+		}
+	}
+}
+
+func setupTLSConnectors(ctrl *gomock.Controller, dir string, n int, members *server.ReplicaSet, conns map[connector.ReplicaConnector]mtls.Identity) (replicas []*mock_api.MockConnectionHandler, stop func()) {
+	done := make(chan struct{})
+	stop = func() { close(done) }
+
+	addrs := make(map[uint32]string)
+
+	for i := 0; i < n; i++ {
+		r := mock_api.NewMockConnectionHandler(ctrl)
+		replicas = append(replicas, r)
+
+		creds, err := mtls.LoadDir(dir, mtls.ReplicaIdentity(uint32(i)))
+		if err != nil {
+			panic(err)
+		}
+
+		srv := server.New(r, server.WithMutualTLS(creds, members))
+		go func() {
+			<-done
+			srv.Stop()
+		}()
+
+		addrs[uint32(i)] = listenAndServe(srv)
+	}
+
+	for conn, id := range conns {
+		creds, err := mtls.LoadDir(dir, id)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := connector.ConnectManyReplicasTLS(conn, addrs, creds); err != nil {
+			panic(err)
+		}
+	}
+
+	return
+}
+
 func setupConnector(ctrl *gomock.Controller, conn connector.ReplicaConnector, n int) (replicas []*mock_api.MockConnectionHandler, stop func()) {
 	done := make(chan struct{})
 	stop = func() { close(done) }
@@ -182,6 +451,44 @@ func testStream(t *testing.T, out chan<- []byte, in <-chan []byte) {
 	}()
 }
 
+// feedReplica streams a fixed history of committed operations.
+type feedReplica struct {
+	api.ConnectionHandler
+	ops []*api.CommittedOperation
+}
+
+func (r *feedReplica) SubscribeCommitted(from uint64, done <-chan struct{}) (<-chan *api.CommittedOperation, error) {
+	if from == 0 {
+		from = 1
+	} else if from > uint64(len(r.ops)) {
+		return nil, fmt.Errorf("operation %d not available", from)
+	}
+
+	out := make(chan *api.CommittedOperation)
+	go func() {
+		defer close(out)
+		for _, op := range r.ops[from-1:] {
+			select {
+			case out <- op:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// statusReplica reports a fixed replica state.
+type statusReplica struct {
+	api.ConnectionHandler
+	status *api.ReplicaStatus
+}
+
+func (r *statusReplica) Status() *api.ReplicaStatus {
+	return r.status
+}
+
 func makeMessages(n int) (msgs [][]byte) {
 	for i := 0; i < n; i++ {
 		m := make([]byte, msgSize)
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// helloKey is the metadata key to exchange handshake messages with.
+// Binary metadata keys require "-bin" suffix.
+const helloKey = "minbft-hello-bin"
+
+// AppendHello returns a context to start a stream with the encoded
+// handshake message.
+func AppendHello(ctx context.Context, hello []byte) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, helloKey, string(hello))
+}
+
+// HelloFromIncomingContext extracts the encoded handshake message
+// from the context of an incoming stream. It returns nil if there is
+// no handshake message.
+func HelloFromIncomingContext(ctx context.Context) []byte {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return HelloFromHeader(md)
+}
+
+// HelloHeader returns metadata to send the encoded handshake message
+// with as the header of an incoming stream.
+func HelloHeader(hello []byte) metadata.MD {
+	return metadata.Pairs(helloKey, string(hello))
+}
+
+// HelloFromHeader extracts the encoded handshake message from the
+// header of an outgoing stream. It returns nil if there is no
+// handshake message.
+func HelloFromHeader(md metadata.MD) []byte {
+	vals := md.Get(helloKey)
+	if len(vals) != 1 {
+		return nil
+	}
+	return []byte(vals[0])
+}
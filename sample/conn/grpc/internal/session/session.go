@@ -0,0 +1,401 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session implements reliable exchange of messages over a
+// sequence of gRPC streams.
+//
+// A session outlives individual streams: if a stream breaks, another
+// stream can be attached to the session to resume the exchange.
+// Messages are numbered with consecutive sequence numbers within the
+// session and acknowledged by the receiving side. When a new stream
+// is attached, each side tells the other the sequence number of the
+// last message it has received, so that the exchange resumes from the
+// first unacknowledged message without losing or replaying messages.
+//
+// If the peer has lost its session state, e.g. after restart, the
+// session is resynchronized: the exchange continues with the next
+// messages, although some messages may have been lost with the peer
+// state.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
+)
+
+// Metadata keys used to establish a session over a stream.
+const (
+	idKey       = "minbft-session-id"
+	tokenKey    = "minbft-session-token"
+	receivedKey = "minbft-session-received"
+)
+
+// maxUnacked is the maximal number of outgoing messages not yet
+// acknowledged by the peer before further messages are blocked.
+const maxUnacked = 1024
+
+var errSuperseded = errors.New("stream superseded by another one")
+
+// Stream is a bidirectional stream of messages.
+type Stream interface {
+	Send(*pb.Message) error
+	Recv() (*pb.Message, error)
+}
+
+// Session maintains reliable exchange of messages with a peer.
+type Session struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	// outgoing messages not yet acknowledged by the peer
+	unacked []*pb.Message
+	lastSeq uint64
+	outDone bool
+
+	// sequence number of the last message delivered
+	received uint64
+	peerDone bool
+
+	// next message received establishes the sequence
+	resync bool
+
+	// serializes delivery of received messages
+	deliverLock sync.Mutex
+	deliver     chan<- []byte
+
+	// incremented each time a stream is attached
+	gen uint64
+}
+
+// New creates a new session. Messages received from the outgoing
+// channel are sent to the peer; messages received from the peer are
+// delivered to the incoming channel. The incoming channel is closed
+// once the peer finishes the session or the session is aborted.
+func New(outgoing <-chan []byte, incoming chan<- []byte) *Session {
+	s := &Session{deliver: incoming}
+	s.cond = sync.NewCond(&s.lock)
+
+	go s.handleOutgoing(outgoing)
+
+	return s
+}
+
+// Received returns the sequence number of the last message received
+// from the peer and delivered.
+func (s *Session) Received() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.received
+}
+
+// Serve attaches the stream to the session and exchanges messages
+// over it, starting after the message with the specified sequence
+// number the peer has received. Any stream previously attached to
+// the session is superseded. The finish function, if not nil, is
+// invoked when the local side has no more messages to send and all
+// sent messages are acknowledged.
+//
+// Serve returns nil if the session has been finished by both sides.
+// Otherwise it returns an error once the stream fails or is
+// superseded by another stream, so that the session can be resumed
+// over a new stream.
+func (s *Session) Serve(stream Stream, peerReceived uint64, finish func() error) error {
+	s.lock.Lock()
+	s.gen++
+	gen := s.gen
+	s.acknowledge(peerReceived)
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	stopped := false
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- s.receive(stream)
+	}()
+	go func() {
+		errChan <- s.send(stream, gen, peerReceived+1, finish, &stopped)
+	}()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = <-errChan; err != nil {
+			break
+		}
+	}
+
+	s.lock.Lock()
+	stopped = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	return err
+}
+
+// Resync makes the session accept the next message received from
+// the peer regardless of its sequence number. This is necessary to
+// continue the session with a peer which has lost its state.
+func (s *Session) Resync() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.resync = true
+}
+
+// Abort terminates the session prematurely. The incoming channel is
+// closed and no more messages are delivered.
+func (s *Session) Abort() {
+	s.finishIncoming()
+}
+
+func (s *Session) handleOutgoing(outgoing <-chan []byte) {
+	for payload := range outgoing {
+		s.lock.Lock()
+		for len(s.unacked) >= maxUnacked && !s.peerDone {
+			s.cond.Wait()
+		}
+		s.lastSeq++
+		s.unacked = append(s.unacked, &pb.Message{Payload: payload, Seq: s.lastSeq})
+		s.cond.Broadcast()
+		s.lock.Unlock()
+	}
+
+	s.lock.Lock()
+	s.outDone = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+func (s *Session) receive(stream Stream) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			s.finishIncoming()
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		s.lock.Lock()
+		s.acknowledge(msg.Ack)
+		s.cond.Broadcast()
+		s.lock.Unlock()
+
+		if msg.Seq == 0 {
+			continue // acknowledgment only
+		}
+
+		if err := s.deliverMessage(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Session) deliverMessage(msg *pb.Message) error {
+	s.deliverLock.Lock()
+	defer s.deliverLock.Unlock()
+
+	s.lock.Lock()
+	if s.resync {
+		s.resync = false
+		s.received = msg.Seq - 1
+	}
+	received, peerDone := s.received, s.peerDone
+	s.lock.Unlock()
+
+	if peerDone || msg.Seq <= received {
+		return nil // already delivered
+	} else if msg.Seq != received+1 {
+		return fmt.Errorf("unexpected message sequence number %d, expected %d",
+			msg.Seq, received+1)
+	}
+
+	s.deliver <- msg.Payload
+
+	s.lock.Lock()
+	s.received = msg.Seq
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	return nil
+}
+
+func (s *Session) finishIncoming() {
+	s.deliverLock.Lock()
+	defer s.deliverLock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.peerDone {
+		s.peerDone = true
+		close(s.deliver)
+		s.cond.Broadcast()
+	}
+}
+
+func (s *Session) send(stream Stream, gen, next uint64, finish func() error, stopped *bool) error {
+	var ackSent uint64
+
+	for {
+		s.lock.Lock()
+		var msg *pb.Message
+		for msg == nil {
+			if *stopped {
+				s.lock.Unlock()
+				return nil
+			} else if s.gen != gen {
+				s.lock.Unlock()
+				return errSuperseded
+			}
+
+			if m := s.unackedFrom(next); m != nil {
+				msg = &pb.Message{Payload: m.Payload, Seq: m.Seq, Ack: s.received}
+				next = m.Seq + 1
+			} else if s.received != ackSent {
+				msg = &pb.Message{Ack: s.received}
+			} else if s.outDone && (len(s.unacked) == 0 || s.peerDone) {
+				s.lock.Unlock()
+				if finish != nil {
+					return finish()
+				}
+				return nil
+			} else {
+				s.cond.Wait()
+			}
+		}
+		ackSent = msg.Ack
+		if s.peerDone {
+			// The peer does not acknowledge anymore
+			s.acknowledge(msg.Seq)
+		}
+		s.lock.Unlock()
+
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// unackedFrom returns the unacknowledged message with the specified
+// sequence number or the first one following it, if any.
+func (s *Session) unackedFrom(seq uint64) *pb.Message {
+	if len(s.unacked) == 0 {
+		return nil
+	}
+
+	first := s.unacked[0].Seq
+	if seq < first {
+		seq = first
+	}
+	if i := seq - first; i < uint64(len(s.unacked)) {
+		return s.unacked[i]
+	}
+
+	return nil
+}
+
+// acknowledge drops outgoing messages up to the specified sequence
+// number since they have been received by the peer.
+func (s *Session) acknowledge(ack uint64) {
+	i := 0
+	for i < len(s.unacked) && s.unacked[i].Seq <= ack {
+		i++
+	}
+	s.unacked = s.unacked[i:]
+}
+
+// OutgoingContext returns a context to start a stream attached to the
+// session with the specified ID. The value received is the sequence
+// number of the last message received in the session.
+func OutgoingContext(ctx context.Context, id string, received uint64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx,
+		idKey, id, receivedKey, strconv.FormatUint(received, 10))
+}
+
+// FromIncomingContext extracts the session ID and the sequence number
+// of the last message received by the peer from the context of an
+// incoming stream. It returns empty ID if the stream is not attached
+// to any session.
+func FromIncomingContext(ctx context.Context) (id string, peerReceived uint64, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return parseMetadata(md)
+}
+
+// Header returns metadata to send as the header of an incoming
+// stream. It tells the peer the token identifying the session state
+// and the sequence number of the last message received in the
+// session.
+func Header(token string, received uint64) metadata.MD {
+	return metadata.Pairs(tokenKey, token,
+		receivedKey, strconv.FormatUint(received, 10))
+}
+
+// ParseHeader extracts the token identifying the session state and
+// the sequence number of the last message received by the peer from
+// the header of an outgoing stream. A change of the token means the
+// peer has lost the session state.
+func ParseHeader(md metadata.MD) (token string, peerReceived uint64, err error) {
+	tokens := md.Get(tokenKey)
+	vals := md.Get(receivedKey)
+	if len(tokens) != 1 || len(vals) != 1 {
+		return "", 0, fmt.Errorf("session not supported by peer")
+	}
+
+	peerReceived, err = strconv.ParseUint(vals[0], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid sequence number of last received message: %s", err)
+	}
+
+	return tokens[0], peerReceived, nil
+}
+
+// NewID returns a new random session ID or token.
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func parseMetadata(md metadata.MD) (id string, peerReceived uint64, err error) {
+	ids := md.Get(idKey)
+	if len(ids) == 0 {
+		return "", 0, nil
+	} else if len(ids) > 1 || ids[0] == "" {
+		return "", 0, fmt.Errorf("invalid session ID")
+	}
+
+	vals := md.Get(receivedKey)
+	if len(vals) != 1 {
+		return "", 0, fmt.Errorf("missing sequence number of last received message")
+	}
+	peerReceived, err = strconv.ParseUint(vals[0], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid sequence number of last received message: %s", err)
+	}
+
+	return ids[0], peerReceived, nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
+)
+
+const nrMessages = 100
+
+var errBroken = errors.New("stream broken")
+
+func TestResume(t *testing.T) {
+	outA, inA := make(chan []byte), make(chan []byte)
+	outB, inB := make(chan []byte), make(chan []byte)
+	a := New(outA, inA)
+	b := New(outB, inB)
+
+	msgs := makeMessages(nrMessages)
+	go sendMessages(outA, msgs)
+	go sendMessages(outB, msgs)
+
+	// Break the stream after every few messages received
+	for i := 0; ; {
+		endA, endB, breakStream := newPipe()
+		errA := serve(a, endA, b.Received())
+		errB := serve(b, endB, a.Received())
+
+		for j := 0; j < 7 && i < nrMessages; j++ {
+			assert.Equal(t, msgs[i], <-inB)
+			assert.Equal(t, msgs[i], <-inA)
+			i++
+		}
+
+		if i == nrMessages {
+			assert.NoError(t, <-errA)
+			assert.NoError(t, <-errB)
+			break
+		}
+
+		breakStream()
+		assert.Error(t, <-errA)
+		assert.Error(t, <-errB)
+	}
+
+	_, more := <-inA
+	assert.False(t, more)
+	_, more = <-inB
+	assert.False(t, more)
+}
+
+func TestResync(t *testing.T) {
+	outA, inA := make(chan []byte), make(chan []byte)
+	a := New(outA, inA)
+
+	msgs := makeMessages(2)
+	go sendMessages(outA, msgs)
+
+	outB, inB := make(chan []byte), make(chan []byte)
+	b := New(outB, inB)
+	endA, endB, breakStream := newPipe()
+	errA := serve(a, endA, b.Received())
+	serve(b, endB, a.Received())
+	assert.Equal(t, msgs[0], <-inB)
+	waitAcked(a, 1)
+	breakStream()
+	<-errA
+
+	// The peer has lost its state and continues from scratch
+	outB, inB = make(chan []byte), make(chan []byte)
+	b = New(outB, inB)
+	b.Resync()
+	endA, endB, _ = newPipe()
+	serve(a, endA, b.Received())
+	serve(b, endB, a.Received())
+	assert.Equal(t, msgs[1], <-inB)
+}
+
+func TestMetadata(t *testing.T) {
+	md := metadata.Join(metadata.Pairs(idKey, "abc"), Header("token", 42))
+
+	id, received, err := parseMetadata(md)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", id)
+	assert.Equal(t, uint64(42), received)
+
+	token, received, err := ParseHeader(md)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, uint64(42), received)
+
+	id, _, err = parseMetadata(metadata.MD{})
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+
+	_, _, err = ParseHeader(metadata.MD{})
+	assert.Error(t, err)
+
+	_, _, err = parseMetadata(metadata.Pairs(idKey, "abc", receivedKey, "x"))
+	assert.Error(t, err)
+}
+
+func serve(s *Session, end *pipeEnd, peerReceived uint64) <-chan error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.Serve(end, peerReceived, end.closeSend)
+	}()
+	return errChan
+}
+
+// waitAcked waits until the messages sent up to the specified
+// sequence number are acknowledged.
+func waitAcked(s *Session, seq uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.unacked) != 0 && s.unacked[0].Seq <= seq {
+		s.cond.Wait()
+	}
+}
+
+func sendMessages(out chan<- []byte, msgs [][]byte) {
+	for _, m := range msgs {
+		out <- m
+	}
+	close(out)
+}
+
+func makeMessages(n int) (msgs [][]byte) {
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, []byte(fmt.Sprintf("message %d", i)))
+	}
+	return
+}
+
+// pipeEnd is one end of an in-memory stream.
+type pipeEnd struct {
+	out    chan<- *pb.Message
+	in     <-chan *pb.Message
+	broken <-chan struct{}
+}
+
+func newPipe() (a, b *pipeEnd, breakStream func()) {
+	ab, ba := make(chan *pb.Message), make(chan *pb.Message)
+	broken := make(chan struct{})
+
+	a = &pipeEnd{out: ab, in: ba, broken: broken}
+	b = &pipeEnd{out: ba, in: ab, broken: broken}
+
+	return a, b, func() { close(broken) }
+}
+
+func (e *pipeEnd) Send(msg *pb.Message) error {
+	select {
+	case e.out <- msg:
+		return nil
+	case <-e.broken:
+		return errBroken
+	}
+}
+
+func (e *pipeEnd) Recv() (*pb.Message, error) {
+	select {
+	case msg, ok := <-e.in:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-e.broken:
+		return nil, errBroken
+	}
+}
+
+func (e *pipeEnd) closeSend() error {
+	close(e.out)
+	return nil
+}
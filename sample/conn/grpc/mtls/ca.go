@@ -0,0 +1,193 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+const (
+	testCAName = "MinBFT test CA"
+
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+// CA is a simple certificate authority to issue node certificates.
+// It is intended for testing.
+type CA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewCA creates a new certificate authority with a fresh
+// self-signed certificate.
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %s", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: testCAName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %s", err)
+	}
+
+	return &CA{cert, key}, nil
+}
+
+// CertificatePEM returns PEM-encoded certificate of the CA.
+func (ca *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// Issue generates a new key pair and issues a certificate bound to
+// the identity. It returns PEM-encoded certificate and private key.
+func (ca *CA) Issue(id Identity) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %s", err)
+	}
+
+	template, err := certificateTemplate(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %s", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// GenerateTestCredentials creates a new CA and issues certificates
+// for the specified number of replicas and clients. The CA
+// certificate, node certificates and keys are written into the
+// directory, which can be loaded by LoadDir.
+func GenerateTestCredentials(dir string, nrReplicas, nrClients int) error {
+	ca, err := NewCA()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, caFileName), ca.CertificatePEM(), 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %s", err)
+	}
+
+	var ids []Identity
+	for i := 0; i < nrReplicas; i++ {
+		ids = append(ids, ReplicaIdentity(uint32(i)))
+	}
+	for i := 0; i < nrClients; i++ {
+		ids = append(ids, ClientIdentity(uint32(i)))
+	}
+
+	for _, id := range ids {
+		certPEM, keyPEM, err := ca.Issue(id)
+		if err != nil {
+			return fmt.Errorf("failed to issue certificate for %s: %s", id.Name(), err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, CertFileName(id)), certPEM, 0644); err != nil {
+			return fmt.Errorf("failed to write certificate: %s", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, KeyFileName(id)), keyPEM, 0600); err != nil {
+			return fmt.Errorf("failed to write private key: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// certificateTemplate returns a template of certificate bound to the
+// identity. Replica certificates are suitable for both server and
+// client authentication since replicas connect to each other.
+func certificateTemplate(id Identity) (*x509.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	extKeyUsage := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if id.Role == api.ReplicaAuthen {
+		extKeyUsage = append(extKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: id.Name()},
+		DNSNames:     []string{id.Name()},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  extKeyUsage,
+	}, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %s", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mtls implements mutual TLS authentication of gRPC
+// connections between replicas and clients.
+//
+// Each node presents a certificate bound to its role and ID. The
+// identity is encoded as the certificate subject common name and DNS
+// name, e.g. "replica-0" or "client-1". Certificates can be either
+// issued by a certificate authority trusted by all nodes or derived
+// from the sample keystore. In the latter case, each node presents a
+// self-signed certificate for its own key from the keystore, and the
+// remote certificates are authenticated by matching their public key
+// against the keystore.
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/hyperledger-labs/minbft/api"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+)
+
+const (
+	replicaNamePrefix = "replica-"
+	clientNamePrefix  = "client-"
+
+	caFileName = "ca.crt"
+)
+
+// Identity identifies a node authenticated by its certificate.
+type Identity struct {
+	// Role is either ReplicaAuthen or ClientAuthen
+	Role api.AuthenticationRole
+
+	// ID of the replica or client
+	ID uint32
+}
+
+// ReplicaIdentity returns identity of the specified replica.
+func ReplicaIdentity(id uint32) Identity {
+	return Identity{api.ReplicaAuthen, id}
+}
+
+// ClientIdentity returns identity of the specified client.
+func ClientIdentity(id uint32) Identity {
+	return Identity{api.ClientAuthen, id}
+}
+
+// Name returns the name the identity is bound to certificates with.
+func (i Identity) Name() string {
+	switch i.Role {
+	case api.ReplicaAuthen:
+		return replicaNamePrefix + strconv.FormatUint(uint64(i.ID), 10)
+	case api.ClientAuthen:
+		return clientNamePrefix + strconv.FormatUint(uint64(i.ID), 10)
+	default:
+		panic("unsupported identity role")
+	}
+}
+
+// ParseName returns the identity given its name.
+func ParseName(name string) (Identity, error) {
+	var role api.AuthenticationRole
+	var idStr string
+
+	switch {
+	case strings.HasPrefix(name, replicaNamePrefix):
+		role, idStr = api.ReplicaAuthen, strings.TrimPrefix(name, replicaNamePrefix)
+	case strings.HasPrefix(name, clientNamePrefix):
+		role, idStr = api.ClientAuthen, strings.TrimPrefix(name, clientNamePrefix)
+	default:
+		return Identity{}, fmt.Errorf("unknown identity name: %q", name)
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to parse ID from identity name %q: %s", name, err)
+	}
+
+	return Identity{role, uint32(id)}, nil
+}
+
+// CertFileName returns the name of certificate file for the
+// identity, as created by GenerateTestCredentials.
+func CertFileName(i Identity) string {
+	return i.Name() + ".crt"
+}
+
+// KeyFileName returns the name of private key file for the
+// identity, as created by GenerateTestCredentials.
+func KeyFileName(i Identity) string {
+	return i.Name() + ".key"
+}
+
+// Credentials holds the certificate of the node together with the
+// means to authenticate certificates of other nodes.
+type Credentials struct {
+	cert tls.Certificate
+
+	// trusted certificate authorities, if issued by a CA
+	roots *x509.CertPool
+
+	// keystore to authenticate self-signed certificates with
+	ks authen.BftKeyStorer
+}
+
+// LoadFiles loads credentials from PEM-encoded files of the
+// certificate authority, node certificate and node private key.
+func LoadFiles(caFile, certFile, keyFile string) (*Credentials, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair: %s", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %s", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no CA certificate found in %s", caFile)
+	}
+
+	return &Credentials{cert: cert, roots: roots}, nil
+}
+
+// LoadDir loads credentials of the node with the specified identity
+// from the directory, as created by GenerateTestCredentials.
+func LoadDir(dir string, self Identity) (*Credentials, error) {
+	return LoadFiles(filepath.Join(dir, caFileName),
+		filepath.Join(dir, CertFileName(self)),
+		filepath.Join(dir, KeyFileName(self)))
+}
+
+// FromKeystore derives credentials of the node with the specified
+// identity from the keystore. The keystore has to hold the node's
+// own private key for the role of the identity.
+func FromKeystore(ks authen.BftKeyStorer, self Identity) (*Credentials, error) {
+	key, ok := ks.PrivateKey(self.Role).(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("no suitable %s key found in keystore", self.Role)
+	}
+
+	template, err := certificateTemplate(self)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %s", err)
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+
+	return &Credentials{cert: cert, ks: ks}, nil
+}
+
+// replicaIdentityAdder is implemented by keystores able to add
+// public keys of replicas joined the consensus network.
+type replicaIdentityAdder interface {
+	AddReplicaIdentity(id uint32, identity []byte) error
+}
+
+// MembershipChanged adds the public keys of the replicas joined the
+// consensus network to the keystore, so that their self-signed
+// certificates can be authenticated. Credentials issued by a
+// certificate authority need no update.
+func (c *Credentials) MembershipChanged(m *api.Membership) error {
+	if c.ks == nil {
+		return nil
+	}
+
+	adder, ok := c.ks.(replicaIdentityAdder)
+	if !ok {
+		return fmt.Errorf("keystore cannot add replica keys")
+	}
+
+	for _, r := range m.Replicas {
+		if len(r.Identity) == 0 {
+			continue
+		}
+		if err := adder.AddReplicaIdentity(r.ID, r.Identity); err != nil {
+			return fmt.Errorf("failed to add keys of replica %d: %s", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// ClientTLSConfig returns TLS configuration to connect to the
+// specified replica. The replica is required to present a valid
+// certificate bound to its ID.
+func (c *Credentials) ClientTLSConfig(replicaID uint32) *tls.Config {
+	expected := ReplicaIdentity(replicaID)
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{c.cert},
+		ServerName:   expected.Name(),
+	}
+
+	if c.roots != nil {
+		cfg.RootCAs = c.roots
+	} else {
+		// Verification is done by matching the keystore instead
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyKeystore(rawCerts, &expected)
+		}
+	}
+
+	return cfg
+}
+
+// ServerTLSConfig returns TLS configuration to accept connections
+// with. Connecting nodes are required to present a valid
+// certificate bound to their identity.
+func (c *Credentials) ServerTLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{c.cert},
+	}
+
+	if c.roots != nil {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = c.roots
+	} else {
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return c.verifyKeystore(rawCerts, nil)
+		}
+	}
+
+	return cfg
+}
+
+// DialOption returns gRPC dial option to connect to the specified
+// replica with mutual TLS authentication.
+func (c *Credentials) DialOption(replicaID uint32) grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(c.ClientTLSConfig(replicaID)))
+}
+
+// ServerOption returns gRPC server option to accept connections with
+// mutual TLS authentication.
+func (c *Credentials) ServerOption() grpc.ServerOption {
+	return grpc.Creds(credentials.NewTLS(c.ServerTLSConfig()))
+}
+
+// PeerIdentity returns the authenticated identity of the remote node
+// of the gRPC call with the supplied context.
+func PeerIdentity(ctx context.Context) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, fmt.Errorf("no peer information")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return Identity{}, fmt.Errorf("connection not authenticated with TLS")
+	}
+
+	certs := tlsInfo.State.PeerCertificates
+	if len(certs) == 0 {
+		return Identity{}, fmt.Errorf("no peer certificate")
+	}
+
+	return ParseName(certs[0].Subject.CommonName)
+}
+
+// verifyKeystore checks that the public key of the presented
+// certificate matches the key in the keystore for the identity the
+// certificate is bound to. If expected identity is not nil then the
+// certificate has to be bound to that identity.
+func (c *Credentials) verifyKeystore(rawCerts [][]byte, expected *Identity) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %s", err)
+	}
+
+	id, err := ParseName(cert.Subject.CommonName)
+	if err != nil {
+		return err
+	}
+	if expected != nil && id != *expected {
+		return fmt.Errorf("certificate bound to %s, expected %s", id.Name(), expected.Name())
+	}
+
+	pubKey, err := c.ks.NodePublicKey(id.Role, id.ID)
+	if err != nil || pubKey == nil {
+		return fmt.Errorf("no key found in keystore for %s", id.Name())
+	}
+
+	expectedKey, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %s", err)
+	}
+	presentedKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %s", err)
+	}
+	if !bytes.Equal(expectedKey, presentedKey) {
+		return fmt.Errorf("certificate key mismatch for %s", id.Name())
+	}
+
+	return nil
+}
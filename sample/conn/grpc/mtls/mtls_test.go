@@ -0,0 +1,184 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mtls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+)
+
+const (
+	nrReplicas = 3
+	nrClients  = 1
+)
+
+func TestParseName(t *testing.T) {
+	for _, id := range []Identity{ReplicaIdentity(0), ReplicaIdentity(42), ClientIdentity(7)} {
+		parsed, err := ParseName(id.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, id, parsed)
+	}
+
+	for _, name := range []string{"", "replica-", "client-x", "server-1", "replica-4294967296"} {
+		_, err := ParseName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	otherDir, err := ioutil.TempDir("", "mtls")
+	require.NoError(t, err)
+	defer os.RemoveAll(otherDir)
+
+	require.NoError(t, GenerateTestCredentials(dir, nrReplicas, nrClients))
+	require.NoError(t, GenerateTestCredentials(otherDir, nrReplicas, nrClients))
+
+	load := func(dir string, id Identity) *Credentials {
+		creds, err := LoadDir(dir, id)
+		require.NoError(t, err)
+		return creds
+	}
+
+	replica := load(dir, ReplicaIdentity(0))
+	peer := load(dir, ReplicaIdentity(1))
+	client := load(dir, ClientIdentity(0))
+	foreign := load(otherDir, ClientIdentity(0))
+
+	testCredentials(t, replica, peer, client, foreign)
+}
+
+func TestKeystore(t *testing.T) {
+	keys := generateKeys(t)
+	otherKeys := generateKeys(t)
+
+	derive := func(keys []byte, id Identity) *Credentials {
+		ks, err := authen.LoadSimpleKeyStore(bytes.NewBuffer(keys), []api.AuthenticationRole{id.Role}, id.ID)
+		require.NoError(t, err)
+		creds, err := FromKeystore(ks, id)
+		require.NoError(t, err)
+		return creds
+	}
+
+	replica := derive(keys, ReplicaIdentity(0))
+	peer := derive(keys, ReplicaIdentity(1))
+	client := derive(keys, ClientIdentity(0))
+	foreign := derive(otherKeys, ClientIdentity(0))
+
+	testCredentials(t, replica, peer, client, foreign)
+
+	// Keys of replicas joined later are learned from the membership
+	var newKeys bytes.Buffer
+	require.NoError(t, authen.AddReplicaKeys(bytes.NewReader(keys), &newKeys, nrReplicas, 256, ""))
+	identity, err := authen.ReplicaIdentity(bytes.NewReader(newKeys.Bytes()), nrReplicas)
+	require.NoError(t, err)
+	joined := derive(newKeys.Bytes(), ReplicaIdentity(nrReplicas))
+
+	_, err = handshake(joined.ClientTLSConfig(0), replica.ServerTLSConfig())
+	assert.Error(t, err)
+
+	err = replica.MembershipChanged(&api.Membership{Epoch: 1, Replicas: []api.ReplicaInfo{
+		{ID: nrReplicas, Identity: identity},
+	}})
+	require.NoError(t, err)
+
+	id, err := handshake(joined.ClientTLSConfig(0), replica.ServerTLSConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, ReplicaIdentity(nrReplicas), id)
+}
+
+// testCredentials checks authentication given credentials of replica
+// 0 and 1, a client, and a client not trusted by the others.
+func testCredentials(t *testing.T, replica, peer, client, foreign *Credentials) {
+	server := replica.ServerTLSConfig()
+
+	id, err := handshake(client.ClientTLSConfig(0), server)
+	assert.NoError(t, err)
+	assert.Equal(t, ClientIdentity(0), id)
+
+	id, err = handshake(peer.ClientTLSConfig(0), server)
+	assert.NoError(t, err)
+	assert.Equal(t, ReplicaIdentity(1), id)
+
+	// Replica 0 is not replica 1
+	_, err = handshake(client.ClientTLSConfig(1), server)
+	assert.Error(t, err)
+
+	// A client cannot impersonate a replica
+	_, err = handshake(replica.ClientTLSConfig(1), client.ServerTLSConfig())
+	assert.Error(t, err)
+
+	_, err = handshake(foreign.ClientTLSConfig(0), server)
+	assert.Error(t, err)
+
+	_, err = handshake(client.ClientTLSConfig(0), foreign.ServerTLSConfig())
+	assert.Error(t, err)
+}
+
+// handshake performs TLS handshake and returns the identity of the
+// client as authenticated by the server.
+func handshake(clientCfg, serverCfg *tls.Config) (Identity, error) {
+	c, s := net.Pipe()
+
+	errChan := make(chan error, 1)
+	stateChan := make(chan tls.ConnectionState, 1)
+	go func() {
+		defer s.Close()
+		conn := tls.Server(s, serverCfg)
+		errChan <- conn.Handshake()
+		stateChan <- conn.ConnectionState()
+	}()
+
+	conn := tls.Client(c, clientCfg)
+	clientErr := conn.Handshake()
+	c.Close()
+
+	if err := <-errChan; err != nil {
+		return Identity{}, err
+	} else if clientErr != nil {
+		return Identity{}, clientErr
+	}
+
+	state := <-stateChan
+	return ParseName(state.PeerCertificates[0].Subject.CommonName)
+}
+
+func generateKeys(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := authen.GenerateTestnetKeys(&buf, &authen.TestnetKeyOpts{
+		NumberReplicas:  nrReplicas,
+		ReplicaKeySpec:  "ECDSA",
+		ReplicaSecParam: 256,
+		NumberClients:   nrClients,
+		ClientKeySpec:   "ECDSA",
+		ClientSecParam:  256,
+		UsigKeySpec:     "SOFT_ECDSA",
+	})
+	require.NoError(t, err)
+	return buf.Bytes()
+}
@@ -25,7 +25,12 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 type Message struct {
-	Payload              []byte   `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	Payload []byte `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Sequence number of the message within a session; zero if the
+	// message carries no payload but acknowledgment only
+	Seq uint64 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Sequence number of the last message received in the session
+	Ack                  uint64   `protobuf:"varint,3,opt,name=ack,proto3" json:"ack,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -63,22 +68,610 @@ func (m *Message) GetPayload() []byte {
 	return nil
 }
 
+func (m *Message) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *Message) GetAck() uint64 {
+	if m != nil {
+		return m.Ack
+	}
+	return 0
+}
+
+type PeerChallengeRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerChallengeRequest) Reset()         { *m = PeerChallengeRequest{} }
+func (m *PeerChallengeRequest) String() string { return proto.CompactTextString(m) }
+func (*PeerChallengeRequest) ProtoMessage()    {}
+func (*PeerChallengeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{1}
+}
+
+func (m *PeerChallengeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerChallengeRequest.Unmarshal(m, b)
+}
+func (m *PeerChallengeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerChallengeRequest.Marshal(b, m, deterministic)
+}
+func (m *PeerChallengeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerChallengeRequest.Merge(m, src)
+}
+func (m *PeerChallengeRequest) XXX_Size() int {
+	return xxx_messageInfo_PeerChallengeRequest.Size(m)
+}
+func (m *PeerChallengeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerChallengeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerChallengeRequest proto.InternalMessageInfo
+
+type PeerChallengeResponse struct {
+	Nonce                []byte   `protobuf:"bytes,1,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerChallengeResponse) Reset()         { *m = PeerChallengeResponse{} }
+func (m *PeerChallengeResponse) String() string { return proto.CompactTextString(m) }
+func (*PeerChallengeResponse) ProtoMessage()    {}
+func (*PeerChallengeResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{2}
+}
+
+func (m *PeerChallengeResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerChallengeResponse.Unmarshal(m, b)
+}
+func (m *PeerChallengeResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerChallengeResponse.Marshal(b, m, deterministic)
+}
+func (m *PeerChallengeResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerChallengeResponse.Merge(m, src)
+}
+func (m *PeerChallengeResponse) XXX_Size() int {
+	return xxx_messageInfo_PeerChallengeResponse.Size(m)
+}
+func (m *PeerChallengeResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerChallengeResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerChallengeResponse proto.InternalMessageInfo
+
+func (m *PeerChallengeResponse) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	// Position of the first operation to stream; zero means the
+	// oldest operation retained by the replica
+	From                 uint64   `protobuf:"varint,1,opt,name=from,proto3" json:"from,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{3}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetFrom() uint64 {
+	if m != nil {
+		return m.From
+	}
+	return 0
+}
+
+type CommittedOperation struct {
+	Position  uint64 `protobuf:"varint,1,opt,name=position,proto3" json:"position,omitempty"`
+	View      uint64 `protobuf:"varint,2,opt,name=view,proto3" json:"view,omitempty"`
+	UiCounter uint64 `protobuf:"varint,3,opt,name=ui_counter,json=uiCounter,proto3" json:"ui_counter,omitempty"`
+	ClientId  uint32 `protobuf:"varint,4,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Seq       uint64 `protobuf:"varint,5,opt,name=seq,proto3" json:"seq,omitempty"`
+	Operation []byte `protobuf:"bytes,6,opt,name=operation,proto3" json:"operation,omitempty"`
+	// Serialized Prepare message followed by Commit messages
+	Certificate [][]byte `protobuf:"bytes,7,rep,name=certificate,proto3" json:"certificate,omitempty"`
+	// Kind of request as api.RequestKind
+	Kind                 int32    `protobuf:"varint,8,opt,name=kind,proto3" json:"kind,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CommittedOperation) Reset()         { *m = CommittedOperation{} }
+func (m *CommittedOperation) String() string { return proto.CompactTextString(m) }
+func (*CommittedOperation) ProtoMessage()    {}
+func (*CommittedOperation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{4}
+}
+
+func (m *CommittedOperation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CommittedOperation.Unmarshal(m, b)
+}
+func (m *CommittedOperation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CommittedOperation.Marshal(b, m, deterministic)
+}
+func (m *CommittedOperation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CommittedOperation.Merge(m, src)
+}
+func (m *CommittedOperation) XXX_Size() int {
+	return xxx_messageInfo_CommittedOperation.Size(m)
+}
+func (m *CommittedOperation) XXX_DiscardUnknown() {
+	xxx_messageInfo_CommittedOperation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CommittedOperation proto.InternalMessageInfo
+
+func (m *CommittedOperation) GetPosition() uint64 {
+	if m != nil {
+		return m.Position
+	}
+	return 0
+}
+
+func (m *CommittedOperation) GetView() uint64 {
+	if m != nil {
+		return m.View
+	}
+	return 0
+}
+
+func (m *CommittedOperation) GetUiCounter() uint64 {
+	if m != nil {
+		return m.UiCounter
+	}
+	return 0
+}
+
+func (m *CommittedOperation) GetClientId() uint32 {
+	if m != nil {
+		return m.ClientId
+	}
+	return 0
+}
+
+func (m *CommittedOperation) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *CommittedOperation) GetOperation() []byte {
+	if m != nil {
+		return m.Operation
+	}
+	return nil
+}
+
+func (m *CommittedOperation) GetCertificate() [][]byte {
+	if m != nil {
+		return m.Certificate
+	}
+	return nil
+}
+
+func (m *CommittedOperation) GetKind() int32 {
+	if m != nil {
+		return m.Kind
+	}
+	return 0
+}
+
+type StatusRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StatusRequest) Reset()         { *m = StatusRequest{} }
+func (m *StatusRequest) String() string { return proto.CompactTextString(m) }
+func (*StatusRequest) ProtoMessage()    {}
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{5}
+}
+
+func (m *StatusRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StatusRequest.Unmarshal(m, b)
+}
+func (m *StatusRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StatusRequest.Marshal(b, m, deterministic)
+}
+func (m *StatusRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StatusRequest.Merge(m, src)
+}
+func (m *StatusRequest) XXX_Size() int {
+	return xxx_messageInfo_StatusRequest.Size(m)
+}
+func (m *StatusRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StatusRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StatusRequest proto.InternalMessageInfo
+
+type ReplicaStatus struct {
+	ReplicaId    uint32 `protobuf:"varint,1,opt,name=replica_id,json=replicaId,proto3" json:"replica_id,omitempty"`
+	CurrentView  uint64 `protobuf:"varint,2,opt,name=current_view,json=currentView,proto3" json:"current_view,omitempty"`
+	ExpectedView uint64 `protobuf:"varint,3,opt,name=expected_view,json=expectedView,proto3" json:"expected_view,omitempty"`
+	Primary      uint32 `protobuf:"varint,4,opt,name=primary,proto3" json:"primary,omitempty"`
+	// Absent if no request has been executed yet
+	LastExecuted *RequestID      `protobuf:"bytes,5,opt,name=last_executed,json=lastExecuted,proto3" json:"last_executed,omitempty"`
+	Pending      []*RequestID    `protobuf:"bytes,6,rep,name=pending,proto3" json:"pending,omitempty"`
+	Clients      []*ClientStatus `protobuf:"bytes,7,rep,name=clients,proto3" json:"clients,omitempty"`
+	Peers        []*PeerStatus   `protobuf:"bytes,8,rep,name=peers,proto3" json:"peers,omitempty"`
+	// Membership of the current view
+	Epoch   uint64   `protobuf:"varint,9,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Members []uint32 `protobuf:"varint,10,rep,packed,name=members,proto3" json:"members,omitempty"`
+	F       uint32   `protobuf:"varint,11,opt,name=f,proto3" json:"f,omitempty"`
+	// Addresses of the members in the same order, empty for the
+	// members of the initial membership
+	Addresses            []string `protobuf:"bytes,12,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReplicaStatus) Reset()         { *m = ReplicaStatus{} }
+func (m *ReplicaStatus) String() string { return proto.CompactTextString(m) }
+func (*ReplicaStatus) ProtoMessage()    {}
+func (*ReplicaStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{6}
+}
+
+func (m *ReplicaStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReplicaStatus.Unmarshal(m, b)
+}
+func (m *ReplicaStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReplicaStatus.Marshal(b, m, deterministic)
+}
+func (m *ReplicaStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplicaStatus.Merge(m, src)
+}
+func (m *ReplicaStatus) XXX_Size() int {
+	return xxx_messageInfo_ReplicaStatus.Size(m)
+}
+func (m *ReplicaStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplicaStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReplicaStatus proto.InternalMessageInfo
+
+func (m *ReplicaStatus) GetReplicaId() uint32 {
+	if m != nil {
+		return m.ReplicaId
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetCurrentView() uint64 {
+	if m != nil {
+		return m.CurrentView
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetExpectedView() uint64 {
+	if m != nil {
+		return m.ExpectedView
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetPrimary() uint32 {
+	if m != nil {
+		return m.Primary
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetLastExecuted() *RequestID {
+	if m != nil {
+		return m.LastExecuted
+	}
+	return nil
+}
+
+func (m *ReplicaStatus) GetPending() []*RequestID {
+	if m != nil {
+		return m.Pending
+	}
+	return nil
+}
+
+func (m *ReplicaStatus) GetClients() []*ClientStatus {
+	if m != nil {
+		return m.Clients
+	}
+	return nil
+}
+
+func (m *ReplicaStatus) GetPeers() []*PeerStatus {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func (m *ReplicaStatus) GetEpoch() uint64 {
+	if m != nil {
+		return m.Epoch
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetMembers() []uint32 {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
+func (m *ReplicaStatus) GetF() uint32 {
+	if m != nil {
+		return m.F
+	}
+	return 0
+}
+
+func (m *ReplicaStatus) GetAddresses() []string {
+	if m != nil {
+		return m.Addresses
+	}
+	return nil
+}
+
+type RequestID struct {
+	ClientId             uint32   `protobuf:"varint,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Seq                  uint64   `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RequestID) Reset()         { *m = RequestID{} }
+func (m *RequestID) String() string { return proto.CompactTextString(m) }
+func (*RequestID) ProtoMessage()    {}
+func (*RequestID) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{7}
+}
+
+func (m *RequestID) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RequestID.Unmarshal(m, b)
+}
+func (m *RequestID) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RequestID.Marshal(b, m, deterministic)
+}
+func (m *RequestID) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RequestID.Merge(m, src)
+}
+func (m *RequestID) XXX_Size() int {
+	return xxx_messageInfo_RequestID.Size(m)
+}
+func (m *RequestID) XXX_DiscardUnknown() {
+	xxx_messageInfo_RequestID.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RequestID proto.InternalMessageInfo
+
+func (m *RequestID) GetClientId() uint32 {
+	if m != nil {
+		return m.ClientId
+	}
+	return 0
+}
+
+func (m *RequestID) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+type ClientStatus struct {
+	ClientId             uint32   `protobuf:"varint,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	LastAcceptedSeq      uint64   `protobuf:"varint,2,opt,name=last_accepted_seq,json=lastAcceptedSeq,proto3" json:"last_accepted_seq,omitempty"`
+	LastPreparedSeq      uint64   `protobuf:"varint,3,opt,name=last_prepared_seq,json=lastPreparedSeq,proto3" json:"last_prepared_seq,omitempty"`
+	LastCommittedSeq     uint64   `protobuf:"varint,4,opt,name=last_committed_seq,json=lastCommittedSeq,proto3" json:"last_committed_seq,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ClientStatus) Reset()         { *m = ClientStatus{} }
+func (m *ClientStatus) String() string { return proto.CompactTextString(m) }
+func (*ClientStatus) ProtoMessage()    {}
+func (*ClientStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{8}
+}
+
+func (m *ClientStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClientStatus.Unmarshal(m, b)
+}
+func (m *ClientStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClientStatus.Marshal(b, m, deterministic)
+}
+func (m *ClientStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClientStatus.Merge(m, src)
+}
+func (m *ClientStatus) XXX_Size() int {
+	return xxx_messageInfo_ClientStatus.Size(m)
+}
+func (m *ClientStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClientStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClientStatus proto.InternalMessageInfo
+
+func (m *ClientStatus) GetClientId() uint32 {
+	if m != nil {
+		return m.ClientId
+	}
+	return 0
+}
+
+func (m *ClientStatus) GetLastAcceptedSeq() uint64 {
+	if m != nil {
+		return m.LastAcceptedSeq
+	}
+	return 0
+}
+
+func (m *ClientStatus) GetLastPreparedSeq() uint64 {
+	if m != nil {
+		return m.LastPreparedSeq
+	}
+	return 0
+}
+
+func (m *ClientStatus) GetLastCommittedSeq() uint64 {
+	if m != nil {
+		return m.LastCommittedSeq
+	}
+	return 0
+}
+
+type PeerStatus struct {
+	ReplicaId            uint32   `protobuf:"varint,1,opt,name=replica_id,json=replicaId,proto3" json:"replica_id,omitempty"`
+	LastUiCounter        uint64   `protobuf:"varint,2,opt,name=last_ui_counter,json=lastUiCounter,proto3" json:"last_ui_counter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerStatus) Reset()         { *m = PeerStatus{} }
+func (m *PeerStatus) String() string { return proto.CompactTextString(m) }
+func (*PeerStatus) ProtoMessage()    {}
+func (*PeerStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c8f385724121f37b, []int{9}
+}
+
+func (m *PeerStatus) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerStatus.Unmarshal(m, b)
+}
+func (m *PeerStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerStatus.Marshal(b, m, deterministic)
+}
+func (m *PeerStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerStatus.Merge(m, src)
+}
+func (m *PeerStatus) XXX_Size() int {
+	return xxx_messageInfo_PeerStatus.Size(m)
+}
+func (m *PeerStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerStatus proto.InternalMessageInfo
+
+func (m *PeerStatus) GetReplicaId() uint32 {
+	if m != nil {
+		return m.ReplicaId
+	}
+	return 0
+}
+
+func (m *PeerStatus) GetLastUiCounter() uint64 {
+	if m != nil {
+		return m.LastUiCounter
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Message)(nil), "proto.Message")
+	proto.RegisterType((*PeerChallengeRequest)(nil), "proto.PeerChallengeRequest")
+	proto.RegisterType((*PeerChallengeResponse)(nil), "proto.PeerChallengeResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "proto.SubscribeRequest")
+	proto.RegisterType((*CommittedOperation)(nil), "proto.CommittedOperation")
+	proto.RegisterType((*StatusRequest)(nil), "proto.StatusRequest")
+	proto.RegisterType((*ReplicaStatus)(nil), "proto.ReplicaStatus")
+	proto.RegisterType((*RequestID)(nil), "proto.RequestID")
+	proto.RegisterType((*ClientStatus)(nil), "proto.ClientStatus")
+	proto.RegisterType((*PeerStatus)(nil), "proto.PeerStatus")
 }
 
 func init() { proto.RegisterFile("channel.proto", fileDescriptor_c8f385724121f37b) }
 
 var fileDescriptor_c8f385724121f37b = []byte{
-	// 126 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4d, 0xce, 0x48, 0xcc,
-	0xcb, 0x4b, 0xcd, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x53, 0x4a, 0xca, 0x5c,
-	0xec, 0xbe, 0xa9, 0xc5, 0xc5, 0x89, 0xe9, 0xa9, 0x42, 0x12, 0x5c, 0xec, 0x05, 0x89, 0x95, 0x39,
-	0xf9, 0x89, 0x29, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x3c, 0x41, 0x30, 0xae, 0x51, 0x3e, 0x17, 0xbb,
-	0x33, 0x44, 0xb3, 0x90, 0x11, 0x17, 0x97, 0x73, 0x4e, 0x66, 0x6a, 0x5e, 0x89, 0x73, 0x46, 0x62,
-	0x89, 0x10, 0x1f, 0xc4, 0x30, 0x3d, 0xa8, 0x11, 0x52, 0x68, 0x7c, 0x25, 0x06, 0x0d, 0x46, 0x03,
-	0x46, 0x21, 0x03, 0x2e, 0x8e, 0x80, 0xd4, 0xd4, 0x22, 0xe2, 0x75, 0x24, 0xb1, 0x81, 0x05, 0x8d,
-	0x01, 0x01, 0x00, 0x00, 0xff, 0xff, 0xca, 0xac, 0x81, 0xb6, 0xb4, 0x00, 0x00, 0x00,
+	// 731 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xdd, 0x6e, 0xd3, 0x4a,
+	0x10, 0x8e, 0x8f, 0xf3, 0xe7, 0x89, 0x73, 0x9a, 0xee, 0xc9, 0x01, 0x93, 0x16, 0xc9, 0x18, 0xa9,
+	0x44, 0x15, 0xad, 0xaa, 0x20, 0xb8, 0xe0, 0x06, 0x55, 0xe1, 0x47, 0x15, 0x20, 0x2a, 0x47, 0x70,
+	0x1b, 0x6d, 0xd6, 0x93, 0x66, 0xd5, 0xc4, 0x76, 0xd6, 0x36, 0xb4, 0x4f, 0xc4, 0x35, 0x0f, 0xc0,
+	0xeb, 0xf0, 0x1c, 0x68, 0x7f, 0x9c, 0xa4, 0xa1, 0x02, 0xae, 0xbc, 0xf3, 0xed, 0xb7, 0xeb, 0xf9,
+	0xbe, 0x9d, 0x19, 0x68, 0xb3, 0x19, 0x8d, 0x63, 0x9c, 0x1f, 0xa7, 0x22, 0xc9, 0x13, 0x52, 0x53,
+	0x9f, 0xe0, 0x0d, 0x34, 0xde, 0x63, 0x96, 0xd1, 0x0b, 0x24, 0x1e, 0x34, 0x52, 0x7a, 0x3d, 0x4f,
+	0x68, 0xe4, 0x59, 0xbe, 0xd5, 0x77, 0xc3, 0x32, 0x24, 0x1d, 0xb0, 0x33, 0x5c, 0x7a, 0xff, 0xf8,
+	0x56, 0xbf, 0x1a, 0xca, 0xa5, 0x44, 0x28, 0xbb, 0xf4, 0x6c, 0x8d, 0x50, 0x76, 0x19, 0xdc, 0x81,
+	0xee, 0x39, 0xa2, 0x18, 0xce, 0xe8, 0x7c, 0x8e, 0xf1, 0x05, 0x86, 0xb8, 0x2c, 0x30, 0xcb, 0x83,
+	0x23, 0xf8, 0x7f, 0x0b, 0xcf, 0xd2, 0x24, 0xce, 0x90, 0x74, 0xa1, 0x16, 0x27, 0x31, 0x43, 0xf3,
+	0x33, 0x1d, 0x04, 0x07, 0xd0, 0x19, 0x15, 0x93, 0x8c, 0x09, 0x3e, 0x29, 0xaf, 0x20, 0x04, 0xaa,
+	0x53, 0x91, 0x2c, 0x14, 0xb1, 0x1a, 0xaa, 0x75, 0xf0, 0xc3, 0x02, 0x32, 0x4c, 0x16, 0x0b, 0x9e,
+	0xe7, 0x18, 0x7d, 0x48, 0x51, 0xd0, 0x9c, 0x27, 0x31, 0xe9, 0x41, 0x33, 0x4d, 0x32, 0x2e, 0xd7,
+	0x86, 0xbe, 0x8a, 0xe5, 0x35, 0x9f, 0x39, 0x7e, 0x31, 0x32, 0xd4, 0x9a, 0xdc, 0x07, 0x28, 0xf8,
+	0x98, 0x25, 0x45, 0x9c, 0xa3, 0x30, 0x72, 0x9c, 0x82, 0x0f, 0x35, 0x40, 0xf6, 0xc0, 0x61, 0x73,
+	0x8e, 0x71, 0x3e, 0xe6, 0x91, 0x57, 0xf5, 0xad, 0x7e, 0x3b, 0x6c, 0x6a, 0xe0, 0x6c, 0xe5, 0x4a,
+	0x6d, 0xed, 0xca, 0x3e, 0x38, 0x49, 0x99, 0x8a, 0x57, 0x57, 0xb2, 0xd6, 0x00, 0xf1, 0xa1, 0xc5,
+	0x50, 0xe4, 0x7c, 0xca, 0x19, 0xcd, 0xd1, 0x6b, 0xf8, 0x76, 0xdf, 0x0d, 0x37, 0x21, 0x99, 0xe1,
+	0x25, 0x8f, 0x23, 0xaf, 0xe9, 0x5b, 0xfd, 0x5a, 0xa8, 0xd6, 0xc1, 0x0e, 0xb4, 0x47, 0x39, 0xcd,
+	0x8b, 0xac, 0x34, 0xf4, 0xab, 0x0d, 0xed, 0x10, 0xd3, 0x39, 0x67, 0x54, 0x6f, 0x48, 0x11, 0x42,
+	0x03, 0x32, 0x4d, 0x4b, 0xa5, 0xe9, 0x18, 0xe4, 0x2c, 0x22, 0x0f, 0xc0, 0x65, 0x85, 0x10, 0x52,
+	0xc5, 0x86, 0xfe, 0x96, 0xc1, 0x3e, 0x49, 0x1b, 0x1e, 0x42, 0x1b, 0xaf, 0x52, 0x64, 0x39, 0x46,
+	0x9a, 0xa3, 0x9d, 0x70, 0x4b, 0x50, 0x91, 0x64, 0x7d, 0x08, 0xbe, 0xa0, 0xe2, 0xda, 0x58, 0x51,
+	0x86, 0xe4, 0x29, 0xb4, 0xe7, 0x34, 0xcb, 0xc7, 0x78, 0x85, 0xac, 0xc8, 0x31, 0x52, 0x9e, 0xb4,
+	0x06, 0x1d, 0x5d, 0x6a, 0xc7, 0x26, 0xf3, 0xb3, 0x97, 0xa1, 0x2b, 0x69, 0xaf, 0x0c, 0x8b, 0x1c,
+	0x42, 0x23, 0xc5, 0x38, 0xe2, 0xf1, 0x85, 0x57, 0xf7, 0xed, 0x5b, 0x0f, 0x94, 0x04, 0x72, 0x04,
+	0x0d, 0x6d, 0x7c, 0xa6, 0x8c, 0x6b, 0x0d, 0xfe, 0x33, 0xdc, 0xa1, 0x42, 0x8d, 0x45, 0x25, 0x87,
+	0x3c, 0x82, 0x5a, 0x8a, 0x28, 0x32, 0xaf, 0xa9, 0xc8, 0xbb, 0x86, 0x2c, 0x2b, 0xd1, 0x50, 0xf5,
+	0xbe, 0xac, 0x42, 0x4c, 0x13, 0x36, 0xf3, 0x1c, 0xa5, 0x58, 0x07, 0x52, 0xea, 0x02, 0x17, 0x13,
+	0x79, 0x01, 0xf8, 0xb6, 0x94, 0x6a, 0x42, 0xe2, 0x82, 0x35, 0xf5, 0x5a, 0x4a, 0xbe, 0x35, 0x95,
+	0x0f, 0x4e, 0xa3, 0x48, 0x60, 0x96, 0x61, 0xe6, 0xb9, 0xbe, 0xdd, 0x77, 0xc2, 0x35, 0x10, 0x3c,
+	0x07, 0x67, 0xa5, 0xe4, 0x66, 0x29, 0x59, 0xb7, 0x97, 0xd2, 0xba, 0xc1, 0x82, 0x6f, 0x16, 0xb8,
+	0x9b, 0xd2, 0x7e, 0x7f, 0xfe, 0x10, 0x76, 0xd5, 0x03, 0x50, 0xc6, 0x30, 0x95, 0x8f, 0xb8, 0xbe,
+	0x6d, 0x47, 0x6e, 0x9c, 0x1a, 0x7c, 0x84, 0xcb, 0x15, 0x37, 0x15, 0x98, 0x52, 0x61, 0xb8, 0xf6,
+	0x9a, 0x7b, 0x6e, 0x70, 0xc9, 0x7d, 0x0c, 0x44, 0x71, 0x59, 0xd9, 0x69, 0x8a, 0x5c, 0x55, 0xe4,
+	0x8e, 0xdc, 0x59, 0xb5, 0xe0, 0x08, 0x97, 0xc1, 0x08, 0x60, 0x6d, 0xf0, 0x9f, 0xaa, 0xf2, 0x00,
+	0xd4, 0xdf, 0xc6, 0x1b, 0xed, 0xa7, 0x13, 0x56, 0xa5, 0xf4, 0xb1, 0x6c, 0xc1, 0xc1, 0x77, 0x0b,
+	0x1a, 0x43, 0x3d, 0xb9, 0xc8, 0x00, 0x40, 0x7b, 0x32, 0x9c, 0xd1, 0x9c, 0xfc, 0x6b, 0x1e, 0xd5,
+	0xcc, 0xaf, 0xde, 0x56, 0x1c, 0x54, 0xfa, 0xd6, 0x89, 0x45, 0x4e, 0xa0, 0x69, 0xe6, 0xcf, 0xdf,
+	0x9e, 0x78, 0x07, 0xed, 0x1b, 0x13, 0x8b, 0xec, 0x6d, 0x54, 0xcf, 0xf6, 0x7c, 0xeb, 0xed, 0xdf,
+	0xbe, 0xa9, 0x87, 0x5c, 0x50, 0x19, 0xbc, 0x85, 0xea, 0x6b, 0xc4, 0x88, 0x0c, 0xc1, 0x59, 0x0d,
+	0x36, 0x72, 0xd7, 0x1c, 0xda, 0x1e, 0x75, 0xbd, 0x7b, 0x65, 0x55, 0xff, 0x32, 0xda, 0x82, 0xca,
+	0x89, 0x35, 0x78, 0x01, 0xb5, 0xd3, 0x68, 0xc1, 0x63, 0xf2, 0x0c, 0xea, 0xc6, 0xe6, 0x6e, 0x79,
+	0xd5, 0xe6, 0x90, 0xe8, 0x75, 0x57, 0x9d, 0xb4, 0x31, 0x28, 0x82, 0xca, 0xa4, 0xae, 0xe0, 0x27,
+	0x3f, 0x07, 0x00, 0x6a, 0xe2, 0x34, 0x94, 0x0d, 0x06, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -95,6 +688,8 @@ const _ = grpc.SupportPackageIsVersion4
 type ChannelClient interface {
 	ClientChat(ctx context.Context, opts ...grpc.CallOption) (Channel_ClientChatClient, error)
 	PeerChat(ctx context.Context, opts ...grpc.CallOption) (Channel_PeerChatClient, error)
+	// Obtain a challenge to start the handshake with before PeerChat
+	PeerChallenge(ctx context.Context, in *PeerChallengeRequest, opts ...grpc.CallOption) (*PeerChallengeResponse, error)
 }
 
 type channelClient struct {
@@ -167,10 +762,21 @@ func (x *channelPeerChatClient) Recv() (*Message, error) {
 	return m, nil
 }
 
+func (c *channelClient) PeerChallenge(ctx context.Context, in *PeerChallengeRequest, opts ...grpc.CallOption) (*PeerChallengeResponse, error) {
+	out := new(PeerChallengeResponse)
+	err := c.cc.Invoke(ctx, "/proto.Channel/PeerChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChannelServer is the server API for Channel service.
 type ChannelServer interface {
 	ClientChat(Channel_ClientChatServer) error
 	PeerChat(Channel_PeerChatServer) error
+	// Obtain a challenge to start the handshake with before PeerChat
+	PeerChallenge(context.Context, *PeerChallengeRequest) (*PeerChallengeResponse, error)
 }
 
 // UnimplementedChannelServer can be embedded to have forward compatible implementations.
@@ -183,6 +789,9 @@ func (*UnimplementedChannelServer) ClientChat(srv Channel_ClientChatServer) erro
 func (*UnimplementedChannelServer) PeerChat(srv Channel_PeerChatServer) error {
 	return status.Errorf(codes.Unimplemented, "method PeerChat not implemented")
 }
+func (*UnimplementedChannelServer) PeerChallenge(ctx context.Context, req *PeerChallengeRequest) (*PeerChallengeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PeerChallenge not implemented")
+}
 
 func RegisterChannelServer(s *grpc.Server, srv ChannelServer) {
 	s.RegisterService(&_Channel_serviceDesc, srv)
@@ -240,10 +849,33 @@ func (x *channelPeerChatServer) Recv() (*Message, error) {
 	return m, nil
 }
 
+func _Channel_PeerChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerChallengeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChannelServer).PeerChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Channel/PeerChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChannelServer).PeerChallenge(ctx, req.(*PeerChallengeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Channel_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Channel",
 	HandlerType: (*ChannelServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PeerChallenge",
+			Handler:    _Channel_PeerChallenge_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "ClientChat",
@@ -260,3 +892,178 @@ var _Channel_serviceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "channel.proto",
 }
+
+// FeedClient is the client API for Feed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type FeedClient interface {
+	// Stream committed operations in the order of commit
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Feed_SubscribeClient, error)
+}
+
+type feedClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewFeedClient(cc *grpc.ClientConn) FeedClient {
+	return &feedClient{cc}
+}
+
+func (c *feedClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Feed_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Feed_serviceDesc.Streams[0], "/proto.Feed/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &feedSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Feed_SubscribeClient interface {
+	Recv() (*CommittedOperation, error)
+	grpc.ClientStream
+}
+
+type feedSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *feedSubscribeClient) Recv() (*CommittedOperation, error) {
+	m := new(CommittedOperation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FeedServer is the server API for Feed service.
+type FeedServer interface {
+	// Stream committed operations in the order of commit
+	Subscribe(*SubscribeRequest, Feed_SubscribeServer) error
+}
+
+// UnimplementedFeedServer can be embedded to have forward compatible implementations.
+type UnimplementedFeedServer struct {
+}
+
+func (*UnimplementedFeedServer) Subscribe(req *SubscribeRequest, srv Feed_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+
+func RegisterFeedServer(s *grpc.Server, srv FeedServer) {
+	s.RegisterService(&_Feed_serviceDesc, srv)
+}
+
+func _Feed_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FeedServer).Subscribe(m, &feedSubscribeServer{stream})
+}
+
+type Feed_SubscribeServer interface {
+	Send(*CommittedOperation) error
+	grpc.ServerStream
+}
+
+type feedSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *feedSubscribeServer) Send(m *CommittedOperation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Feed_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Feed",
+	HandlerType: (*FeedServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Feed_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "channel.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminClient interface {
+	// Report the internal state of the replica
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*ReplicaStatus, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*ReplicaStatus, error) {
+	out := new(ReplicaStatus)
+	err := c.cc.Invoke(ctx, "/proto.Admin/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+type AdminServer interface {
+	// Report the internal state of the replica
+	Status(context.Context, *StatusRequest) (*ReplicaStatus, error)
+}
+
+// UnimplementedAdminServer can be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (*UnimplementedAdminServer) Status(ctx context.Context, req *StatusRequest) (*ReplicaStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Admin/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler:    _Admin_Status_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "channel.proto",
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// ReplicaSet holds the IDs of the replicas in the current membership
+// of the consensus network. It implements api.MembershipObserver to
+// follow reconfigurations. It is safe to use concurrently.
+type ReplicaSet struct {
+	lock sync.RWMutex
+	ids  map[uint32]bool
+}
+
+// NewReplicaSet creates a new instance of ReplicaSet holding the
+// initial n replicas of the consensus network.
+func NewReplicaSet(n uint32) *ReplicaSet {
+	ids := make(map[uint32]bool)
+	for id := uint32(0); id < n; id++ {
+		ids[id] = true
+	}
+	return &ReplicaSet{ids: ids}
+}
+
+// Contains checks if the replica with the specified ID is in the
+// current membership.
+func (s *ReplicaSet) Contains(id uint32) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.ids[id]
+}
+
+// MembershipChanged replaces the replicas with those of the supplied
+// membership.
+func (s *ReplicaSet) MembershipChanged(m *api.Membership) error {
+	ids := make(map[uint32]bool)
+	for _, r := range m.Replicas {
+		ids[r.ID] = true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ids = ids
+
+	return nil
+}
@@ -20,16 +20,25 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/handshake"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/internal/session"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/proto"
 )
 
@@ -53,23 +62,156 @@ func ListenAndServe(s ReplicaServer, addr string, serverOpts ...grpc.ServerOptio
 	if err != nil {
 		return fmt.Errorf("Error listening on %s: %s", addr, err)
 	}
-	return s.Serve(lis)
+	return s.Serve(lis, serverOpts...)
+}
+
+// Authorizer checks if an incoming stream is permitted to be served
+// given the stream context. It returns nil if the stream is
+// permitted, or an error describing the reason otherwise. Streams
+// are refused with PermissionDenied code, unless the error carries
+// a gRPC status.
+type Authorizer func(ctx context.Context) error
+
+// defSessionExpiry is the default time to keep a session without any
+// stream attached.
+const defSessionExpiry = time.Minute
+
+type options struct {
+	serverOpts       []grpc.ServerOption
+	peerAuthorizer   Authorizer
+	clientAuthorizer Authorizer
+	adminAuthorizer  Authorizer
+	sessionExpiry    time.Duration
+	handshaker       *handshake.Handshaker
+}
+
+// Option represents a parameter to create a server with.
+type Option func(*options)
+
+// WithSessionExpiry specifies the time to keep a session without any
+// stream attached before the session is terminated. Streams can be
+// attached to the session in order to resume message exchange after
+// connection failure.
+func WithSessionExpiry(d time.Duration) Option {
+	return func(opts *options) {
+		opts.sessionExpiry = d
+	}
+}
+
+// WithHandshake specifies to perform a handshake using the supplied
+// handshaker when setting up streams from other replicas. Streams
+// are refused unless the handshake succeeds.
+func WithHandshake(h *handshake.Handshaker) Option {
+	return func(opts *options) {
+		opts.handshaker = h
+	}
+}
+
+// WithPeerAuthorizer specifies the authorizer to check incoming
+// streams from other replicas with.
+func WithPeerAuthorizer(a Authorizer) Option {
+	return func(opts *options) {
+		opts.peerAuthorizer = a
+	}
+}
+
+// WithClientAuthorizer specifies the authorizer to check incoming
+// streams from clients with.
+func WithClientAuthorizer(a Authorizer) Option {
+	return func(opts *options) {
+		opts.clientAuthorizer = a
+	}
+}
+
+// WithAdminAuthorizer specifies the authorizer to check incoming
+// calls to the admin service with.
+func WithAdminAuthorizer(a Authorizer) Option {
+	return func(opts *options) {
+		opts.adminAuthorizer = a
+	}
+}
+
+// WithMutualTLS specifies to accept connections authenticated with
+// mutual TLS using the supplied credentials. Streams from other
+// replicas are only served if the remote node authenticated as one
+// of the supplied replicas; streams from clients are only served if
+// the remote node authenticated as a client. Calls to the admin
+// service are served if the remote node authenticated either way.
+// Replicas not in the current membership are refused with a
+// retryable error, since they may join by reconfiguration later.
+func WithMutualTLS(creds *mtls.Credentials, replicas *ReplicaSet) Option {
+	return func(opts *options) {
+		opts.serverOpts = append(opts.serverOpts, creds.ServerOption())
+		opts.peerAuthorizer = func(ctx context.Context) error {
+			id, err := mtls.PeerIdentity(ctx)
+			if err != nil {
+				return err
+			}
+			if id.Role != api.ReplicaAuthen {
+				return fmt.Errorf("%s is not a replica", id.Name())
+			}
+			if !replicas.Contains(id.ID) {
+				return status.Errorf(codes.Unavailable, "%s is not a member replica", id.Name())
+			}
+			return nil
+		}
+		opts.clientAuthorizer = func(ctx context.Context) error {
+			id, err := mtls.PeerIdentity(ctx)
+			if err != nil {
+				return err
+			}
+			if id.Role != api.ClientAuthen {
+				return fmt.Errorf("%s is not a client", id.Name())
+			}
+			return nil
+		}
+		opts.adminAuthorizer = func(ctx context.Context) error {
+			if opts.peerAuthorizer(ctx) == nil || opts.clientAuthorizer(ctx) == nil {
+				return nil
+			}
+			id, err := mtls.PeerIdentity(ctx)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("%s is neither a member replica nor a client", id.Name())
+		}
+	}
 }
 
 type server struct {
 	replica    api.ConnectionHandler
 	grpcServer *grpc.Server
+	opts       options
+
+	sessionLock sync.Mutex
+	sessions    map[string]*sessionEntry
 }
 
 // New creates a new instance of ReplicaServer using the specified
-// replica instance to connect incoming requests with.
-func New(replica api.ConnectionHandler) ReplicaServer {
-	return &server{replica: replica}
+// replica instance to connect incoming requests with. If the replica
+// implements api.CommitFeed, the server also streams committed
+// operations to subscribers authorized as clients. If the replica
+// implements api.Introspector, the server also reports the replica
+// state through the admin service.
+func New(replica api.ConnectionHandler, opts ...Option) ReplicaServer {
+	s := &server{replica: replica}
+	s.opts.sessionExpiry = defSessionExpiry
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
 }
 
 func (s *server) Serve(lis net.Listener, serverOpts ...grpc.ServerOption) error {
+	serverOpts = append(append([]grpc.ServerOption{}, s.opts.serverOpts...), serverOpts...)
 	s.grpcServer = grpc.NewServer(serverOpts...)
 	proto.RegisterChannelServer(s.grpcServer, s)
+	if feed, ok := s.replica.(api.CommitFeed); ok {
+		proto.RegisterFeedServer(s.grpcServer, &feedServer{feed, s.opts.clientAuthorizer})
+	}
+	if introspector, ok := s.replica.(api.Introspector); ok {
+		proto.RegisterAdminServer(s.grpcServer, &adminServer{introspector, s.opts.adminAuthorizer})
+	}
 
 	err := s.grpcServer.Serve(lis)
 	if err != nil {
@@ -83,22 +225,303 @@ func (s *server) Stop() {
 		s.grpcServer.Stop()
 		s.grpcServer = nil
 	}
+
+	s.sessionLock.Lock()
+	sessions := s.sessions
+	s.sessions = nil
+	s.sessionLock.Unlock()
+
+	for _, e := range sessions {
+		if e.expiry != nil {
+			e.expiry.Stop()
+		}
+		e.sess.Abort()
+	}
 }
 
 func (s *server) ClientChat(stream proto.Channel_ClientChatServer) error {
-	in := make(chan []byte)
-	sh := s.replica.ClientMessageStreamHandler()
-	out := sh.HandleMessageStream(in)
+	if err := authorize(stream.Context(), s.opts.clientAuthorizer); err != nil {
+		return err
+	}
 
-	return handleStream(stream, in, out)
+	return s.serveStream(stream, "client", s.replica.ClientMessageStreamHandler, nil)
 }
 
 func (s *server) PeerChat(stream proto.Channel_PeerChatServer) error {
-	in := make(chan []byte)
-	sh := s.replica.PeerMessageStreamHandler()
-	out := sh.HandleMessageStream(in)
+	if err := authorize(stream.Context(), s.opts.peerAuthorizer); err != nil {
+		return err
+	}
+
+	var header metadata.MD
+	if hs := s.opts.handshaker; hs != nil {
+		hello, err := respondHandshake(stream.Context(), hs)
+		if err != nil {
+			log.Printf("Refused peer stream: handshake failed: %s\n", err)
+			return handshakeError(err)
+		}
+		header = session.HelloHeader(hello)
+	}
+
+	return s.serveStream(stream, "peer", s.replica.PeerMessageStreamHandler, header)
+}
+
+func (s *server) PeerChallenge(ctx context.Context, req *proto.PeerChallengeRequest) (*proto.PeerChallengeResponse, error) {
+	if err := authorize(ctx, s.opts.peerAuthorizer); err != nil {
+		return nil, err
+	}
+	hs := s.opts.handshaker
+	if hs == nil {
+		return nil, status.Errorf(codes.Unimplemented, "handshake not supported by replica")
+	}
+
+	nonce, err := hs.Challenge()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%s", err)
+	}
+
+	return &proto.PeerChallengeResponse{Nonce: nonce}, nil
+}
+
+// feedServer implements the Feed service using the supplied commit
+// feed.
+type feedServer struct {
+	feed       api.CommitFeed
+	authorizer Authorizer
+}
+
+func (s *feedServer) Subscribe(req *proto.SubscribeRequest, stream proto.Feed_SubscribeServer) error {
+	if err := authorize(stream.Context(), s.authorizer); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ops, err := s.feed.SubscribeCommitted(req.GetFrom(), ctx.Done())
+	if err != nil {
+		return status.Errorf(codes.OutOfRange, "%s", err)
+	}
+
+	for op := range ops {
+		err := stream.Send(&proto.CommittedOperation{
+			Position:    op.Position,
+			View:        op.View,
+			UiCounter:   op.UICounter,
+			ClientId:    op.ClientID,
+			Seq:         op.Seq,
+			Kind:        int32(op.Kind),
+			Operation:   op.Operation,
+			Certificate: op.Certificate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
 
-	return handleStream(stream, in, out)
+	// Subscriber fell behind the history retained by the replica
+	return status.Errorf(codes.ResourceExhausted, "subscriber fell behind")
+}
+
+// adminServer implements the Admin service using the supplied
+// introspection interface.
+type adminServer struct {
+	introspector api.Introspector
+	authorizer   Authorizer
+}
+
+func (s *adminServer) Status(ctx context.Context, req *proto.StatusRequest) (*proto.ReplicaStatus, error) {
+	if err := authorize(ctx, s.authorizer); err != nil {
+		return nil, err
+	}
+
+	st := s.introspector.Status()
+	res := &proto.ReplicaStatus{
+		ReplicaId:    st.ReplicaID,
+		CurrentView:  st.CurrentView,
+		ExpectedView: st.ExpectedView,
+		Primary:      st.Primary,
+		Epoch:        st.Epoch,
+		F:            st.F,
+		Members:      st.Members,
+		Addresses:    st.Addresses,
+	}
+	if r := st.LastExecuted; r != nil {
+		res.LastExecuted = &proto.RequestID{ClientId: r.ClientID, Seq: r.Seq}
+	}
+	for _, r := range st.Pending {
+		res.Pending = append(res.Pending, &proto.RequestID{ClientId: r.ClientID, Seq: r.Seq})
+	}
+	for _, c := range st.Clients {
+		res.Clients = append(res.Clients, &proto.ClientStatus{
+			ClientId:         c.ClientID,
+			LastAcceptedSeq:  c.LastAcceptedSeq,
+			LastPreparedSeq:  c.LastPreparedSeq,
+			LastCommittedSeq: c.LastCommittedSeq,
+		})
+	}
+	for _, p := range st.Peers {
+		res.Peers = append(res.Peers, &proto.PeerStatus{
+			ReplicaId:     p.ReplicaID,
+			LastUiCounter: p.LastUICounter,
+		})
+	}
+
+	return res, nil
+}
+
+// respondHandshake checks the handshake message supplied with the
+// incoming stream and returns the encoded response.
+func respondHandshake(ctx context.Context, hs *handshake.Handshaker) ([]byte, error) {
+	data := session.HelloFromIncomingContext(ctx)
+	if data == nil {
+		return nil, fmt.Errorf("no handshake message supplied")
+	}
+
+	hello := new(handshake.Hello)
+	if err := hello.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	response, err := hs.Respond(hello)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.MarshalBinary()
+}
+
+// handshakeError returns the status to refuse a stream with if the
+// handshake failed with the supplied error. Authentication failures
+// are reported distinctly since they are permanent.
+func handshakeError(err error) error {
+	if _, ok := err.(*handshake.AuthenticationError); ok {
+		return status.Errorf(codes.Unauthenticated, "handshake failed: %s", err)
+	}
+	return status.Errorf(codes.FailedPrecondition, "handshake failed: %s", err)
+}
+
+// serveStream serves the incoming stream, attaching it to the session
+// requested by the remote side, if any. A new session is created if
+// there is no session of the kind with the requested ID. The
+// supplied header, if any, is sent together with the session header.
+func (s *server) serveStream(stream rpcStream, kind string, handler func() api.MessageStreamHandler, header metadata.MD) error {
+	id, peerReceived, err := session.FromIncomingContext(stream.Context())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	} else if id == "" {
+		if header != nil {
+			if err := stream.SendHeader(header); err != nil {
+				return err
+			}
+		}
+
+		in := make(chan []byte)
+		out := handler().HandleMessageStream(in)
+
+		return handleStream(stream, in, out)
+	}
+
+	key := kind + "/" + id
+	e := s.attachSession(key, handler)
+
+	err = stream.SendHeader(metadata.Join(header, session.Header(e.token, e.sess.Received())))
+	if err == nil {
+		err = e.sess.Serve(stream, peerReceived, nil)
+	}
+
+	s.detachSession(key, e, err == nil)
+
+	if err != nil {
+		err = fmt.Errorf("Error serving session stream: %s", err)
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// sessionEntry keeps track of a session and streams attached to it.
+type sessionEntry struct {
+	sess     *session.Session
+	token    string
+	attached int
+	expiry   *time.Timer
+}
+
+func (s *server) attachSession(key string, handler func() api.MessageStreamHandler) *sessionEntry {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	if s.sessions == nil {
+		s.sessions = make(map[string]*sessionEntry)
+	}
+
+	e := s.sessions[key]
+	if e == nil {
+		in := make(chan []byte)
+		out := handler().HandleMessageStream(in)
+
+		sess := session.New(out, in)
+		sess.Resync()
+
+		e = &sessionEntry{sess: sess, token: session.NewID()}
+		s.sessions[key] = e
+	}
+
+	e.attached++
+	if e.expiry != nil {
+		e.expiry.Stop()
+		e.expiry = nil
+	}
+
+	return e
+}
+
+func (s *server) detachSession(key string, e *sessionEntry, finished bool) {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	e.attached--
+
+	if finished {
+		if s.sessions[key] == e {
+			delete(s.sessions, key)
+		}
+	} else if e.attached == 0 {
+		e.expiry = time.AfterFunc(s.opts.sessionExpiry, func() {
+			s.expireSession(key, e)
+		})
+	}
+}
+
+func (s *server) expireSession(key string, e *sessionEntry) {
+	s.sessionLock.Lock()
+	if e.attached != 0 || s.sessions[key] != e {
+		s.sessionLock.Unlock()
+		return
+	}
+	delete(s.sessions, key)
+	s.sessionLock.Unlock()
+
+	e.sess.Abort()
+}
+
+func authorize(ctx context.Context, a Authorizer) error {
+	if a == nil {
+		return nil
+	}
+
+	if err := a(ctx); err != nil {
+		log.Printf("Refused stream: %s", err)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.PermissionDenied, "%s", err)
+	}
+
+	return nil
 }
 
 type rpcStream interface {
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connector implements ReplicaConnector interface using
+// length-prefixed framing over plain TCP or Unix domain socket
+// connections to exchange messages with replicas
+package connector
+
+import (
+	"fmt"
+
+	"github.com/hyperledger-labs/minbft/api"
+	common "github.com/hyperledger-labs/minbft/sample/conn/common/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/tcp/internal/wire"
+)
+
+// ReplicaConnector implements connectivity API using plain TCP or
+// Unix domain socket connections as a network communication
+// mechanism.
+//
+// ConnectReplica method assigns an address to connect to the replica
+// at. TCP addresses are specified as "HOST:PORT", Unix domain socket
+// addresses as "unix:PATH". Connections are established once message
+// streams are started.
+type ReplicaConnector interface {
+	api.ReplicaConnector
+	ConnectReplica(replicaID uint32, addr string) error
+}
+
+// ConnectManyReplicas helps to establish connections to multiple
+// replicas. It invokes ConnectReplica on the specified connector for
+// each replica in the supplied map. The map holds addresses indexed
+// by replica ID.
+func ConnectManyReplicas(conn ReplicaConnector, addrs map[uint32]string) error {
+	for id, addr := range addrs {
+		err := conn.ConnectReplica(id, addr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type options struct {
+	maxFrameSize uint32
+}
+
+// Option represents a parameter to create a connector with.
+type Option func(*options)
+
+// WithMaxFrameSize specifies the maximal size of messages to
+// exchange with replicas. Streams are terminated upon an attempt to
+// exchange a larger message.
+func WithMaxFrameSize(size uint32) Option {
+	return func(opts *options) {
+		opts.maxFrameSize = size
+	}
+}
+
+type connector struct {
+	common.ReplicaConnector
+	opts options
+}
+
+// NewClientSide creates a new instance of ReplicaConnector to use at
+// client side, i.e. initiate client-to-replica connections.
+func NewClientSide(opts ...Option) ReplicaConnector {
+	return newConnector(common.NewClientSide(), opts)
+}
+
+// NewReplicaSide creates a new instance of ReplicaConnector to use at
+// replica side, i.e. initiate replica-to-replica connections.
+func NewReplicaSide(opts ...Option) ReplicaConnector {
+	return newConnector(common.NewReplicaSide(), opts)
+}
+
+func newConnector(conn common.ReplicaConnector, opts []Option) *connector {
+	c := &connector{
+		ReplicaConnector: conn,
+		opts:             options{maxFrameSize: wire.DefaultMaxFrameSize},
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
+}
+
+// ConnectReplica assigns the address to connect to the replica at.
+func (c *connector) ConnectReplica(replicaID uint32, addr string) error {
+	network, address := wire.SplitAddress(addr)
+	if address == "" {
+		return fmt.Errorf("Invalid address of replica %d: %q", replicaID, addr)
+	}
+
+	replica := &replica{
+		id:      replicaID,
+		network: network,
+		address: address,
+		opts:    c.opts,
+	}
+
+	c.AssignReplica(replicaID, replica)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connector
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/tcp/internal/wire"
+)
+
+const (
+	dialRetryBaseDelay = 100 * time.Millisecond
+	dialRetryMaxDelay  = 5 * time.Second
+)
+
+type replica struct {
+	id      uint32
+	network string
+	address string
+	opts    options
+}
+
+func (r *replica) PeerMessageStreamHandler() api.MessageStreamHandler {
+	return &streamHandler{r, wire.PeerChannel}
+}
+
+func (r *replica) ClientMessageStreamHandler() api.MessageStreamHandler {
+	return &streamHandler{r, wire.ClientChannel}
+}
+
+type streamHandler struct {
+	replica *replica
+	channel wire.Channel
+}
+
+func (sh *streamHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	out := make(chan []byte)
+
+	go func() {
+		defer close(out)
+
+		r := sh.replica
+		conn := r.dial()
+		defer conn.Close()
+
+		if err := wire.WritePreamble(conn, sh.channel); err != nil {
+			log.Printf("Error connecting to replica %d: %s\n", r.id, err)
+			return
+		}
+
+		wg := new(sync.WaitGroup)
+		defer wg.Wait()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.handleIn(conn, in)
+		}()
+
+		r.handleOut(conn, out)
+	}()
+
+	return out
+}
+
+// dial establishes a connection to the replica. Similar to gRPC
+// streams waiting for the connection to become ready, it keeps
+// retrying with increasing delay until the connection succeeds.
+func (r *replica) dial() net.Conn {
+	delay := dialRetryBaseDelay
+	for {
+		conn, err := net.Dial(r.network, r.address)
+		if err == nil {
+			return conn
+		}
+
+		log.Printf("Error dialing replica %d: %s; retrying in %v\n", r.id, err, delay)
+		time.Sleep(delay)
+
+		if delay *= 2; delay > dialRetryMaxDelay {
+			delay = dialRetryMaxDelay
+		}
+	}
+}
+
+func (r *replica) handleIn(conn net.Conn, in <-chan []byte) {
+	w := bufio.NewWriter(conn)
+	for msg := range in {
+		err := wire.WriteFrame(w, msg, r.opts.maxFrameSize)
+		if err == nil && len(in) == 0 {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Printf("Error sending to replica %d: %s\n", r.id, err)
+			conn.Close()
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Printf("Error sending to replica %d: %s\n", r.id, err)
+		return
+	}
+
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil {
+			log.Printf("Error closing connection to replica %d: %s\n", r.id, err)
+		}
+	}
+}
+
+func (r *replica) handleOut(conn net.Conn, out chan<- []byte) {
+	rd := bufio.NewReader(conn)
+	for {
+		msg, err := wire.ReadFrame(rd, r.opts.maxFrameSize)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Printf("Error receiving from replica %d: %s\n", r.id, err)
+			return
+		}
+		out <- msg
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wire implements the wire format of message streams
+// exchanged over plain stream-oriented connections.
+//
+// Each connection carries a single stream of messages in both
+// directions. The connecting side starts with a preamble consisting
+// of a magic string, the protocol version and the channel the stream
+// is to be connected to. Then each message is transmitted as a frame
+// consisting of 4-byte big-endian payload length followed by the
+// payload itself.
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultMaxFrameSize is the default maximal size of a frame payload.
+const DefaultMaxFrameSize = 16 << 20
+
+// Channel identifies the kind of message stream.
+type Channel byte
+
+// Channels to connect message streams to.
+const (
+	PeerChannel Channel = iota + 1
+	ClientChannel
+)
+
+const (
+	magic   = "MBFT"
+	version = 1
+
+	frameHeaderSize = 4
+)
+
+func (c Channel) String() string {
+	switch c {
+	case PeerChannel:
+		return "peer"
+	case ClientChannel:
+		return "client"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// WritePreamble writes the preamble to connect the stream to the
+// channel.
+func WritePreamble(w io.Writer, c Channel) error {
+	_, err := w.Write(append([]byte(magic), version, byte(c)))
+	return err
+}
+
+// ReadPreamble reads the preamble and returns the channel the stream
+// is to be connected to.
+func ReadPreamble(r io.Reader) (Channel, error) {
+	buf := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, fmt.Errorf("failed to read preamble: %s", err)
+	}
+
+	if string(buf[:len(magic)]) != magic {
+		return 0, fmt.Errorf("invalid preamble")
+	} else if v := buf[len(magic)]; v != version {
+		return 0, fmt.Errorf("unsupported protocol version %d", v)
+	}
+
+	c := Channel(buf[len(magic)+1])
+	if c != PeerChannel && c != ClientChannel {
+		return 0, fmt.Errorf("unknown channel %s", c)
+	}
+
+	return c, nil
+}
+
+// WriteFrame writes a frame with the payload. The payload must not
+// exceed the maximal frame size.
+func WriteFrame(w io.Writer, payload []byte, maxSize uint32) error {
+	if uint64(len(payload)) > uint64(maxSize) {
+		return fmt.Errorf("frame size %d exceeds maximum %d", len(payload), maxSize)
+	}
+
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[frameHeaderSize:], payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame reads a frame and returns its payload. It returns io.EOF
+// if there are no more frames to read. Frames exceeding the maximal
+// frame size are rejected with an error.
+func ReadFrame(r io.Reader, maxSize uint32) ([]byte, error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxSize {
+		return nil, fmt.Errorf("frame size %d exceeds maximum %d", size, maxSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// SplitAddress returns the network and the network address given an
+// address string. Addresses of Unix domain sockets are specified as
+// "unix:PATH"; other addresses are treated as TCP addresses.
+func SplitAddress(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		if strings.HasPrefix(path, "//") {
+			path = strings.TrimPrefix(path, "//")
+		}
+		return "unix", path
+	}
+
+	return "tcp", strings.TrimPrefix(addr, "tcp:")
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const maxSize = 16
+
+func TestPreamble(t *testing.T) {
+	for _, c := range []Channel{PeerChannel, ClientChannel} {
+		buf := new(bytes.Buffer)
+		require.NoError(t, WritePreamble(buf, c))
+		parsed, err := ReadPreamble(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, c, parsed)
+	}
+
+	for _, p := range []string{"", "MBF", "XBFT\x01\x01", "MBFT\x02\x01", "MBFT\x01\x03"} {
+		_, err := ReadPreamble(bytes.NewBufferString(p))
+		assert.Error(t, err, "%q", p)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	buf := new(bytes.Buffer)
+	msgs := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte{'x'}, maxSize)}
+	for _, m := range msgs {
+		require.NoError(t, WriteFrame(buf, m, maxSize))
+	}
+	assert.Error(t, WriteFrame(buf, make([]byte, maxSize+1), maxSize))
+
+	for _, m := range msgs {
+		payload, err := ReadFrame(buf, maxSize)
+		assert.NoError(t, err)
+		assert.Equal(t, m, payload)
+	}
+	_, err := ReadFrame(buf, maxSize)
+	assert.Equal(t, io.EOF, err)
+
+	// Oversized frame
+	require.NoError(t, WriteFrame(buf, make([]byte, maxSize+1), maxSize+1))
+	_, err = ReadFrame(buf, maxSize)
+	assert.Error(t, err)
+
+	// Truncated frame
+	buf.Reset()
+	require.NoError(t, WriteFrame(buf, []byte("truncated"), maxSize))
+	buf.Truncate(buf.Len() - 1)
+	_, err = ReadFrame(buf, maxSize)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestSplitAddress(t *testing.T) {
+	cases := []struct{ addr, network, address string }{
+		{"127.0.0.1:8000", "tcp", "127.0.0.1:8000"},
+		{"tcp:localhost:8000", "tcp", "localhost:8000"},
+		{"unix:/tmp/replica.sock", "unix", "/tmp/replica.sock"},
+		{"unix:///tmp/replica.sock", "unix", "/tmp/replica.sock"},
+		{"unix:replica.sock", "unix", "replica.sock"},
+	}
+	for _, c := range cases {
+		network, address := SplitAddress(c.addr)
+		assert.Equal(t, c.network, network, c.addr)
+		assert.Equal(t, c.address, address, c.addr)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements a counterpart for serving incoming TCP or
+// Unix domain socket connections initiated by ReplicaConnector of the
+// tcp connector package and connects them directly to an instance of
+// MessageStreamHandler interface
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/tcp/internal/wire"
+)
+
+// preambleTimeout is the time to wait for the connecting side to
+// specify the channel to connect the stream to.
+const preambleTimeout = 10 * time.Second
+
+// ReplicaServer implements a server to serve incoming connections
+// from ReplicaConnector of the tcp connector package.
+//
+// Serve method serves incoming connections on the supplied listener.
+// It blocks and returns either on error or if Stop method is called.
+//
+// Stop method stops the server. It immediately closes all open
+// connections and listeners.
+type ReplicaServer interface {
+	Serve(lis net.Listener) error
+	Stop()
+}
+
+// ListenAndServe helps to start a server on an address. TCP
+// addresses are specified as "HOST:PORT", Unix domain socket
+// addresses as "unix:PATH". It starts listening on the address and
+// serving incoming connections.
+func ListenAndServe(s ReplicaServer, addr string) error {
+	lis, err := net.Listen(wire.SplitAddress(addr))
+	if err != nil {
+		return fmt.Errorf("Error listening on %s: %s", addr, err)
+	}
+	return s.Serve(lis)
+}
+
+type options struct {
+	maxFrameSize uint32
+}
+
+// Option represents a parameter to create a server with.
+type Option func(*options)
+
+// WithMaxFrameSize specifies the maximal size of messages to
+// exchange with remote nodes. Connections are closed upon an attempt
+// to exchange a larger message.
+func WithMaxFrameSize(size uint32) Option {
+	return func(opts *options) {
+		opts.maxFrameSize = size
+	}
+}
+
+type server struct {
+	replica api.ConnectionHandler
+	opts    options
+
+	// open listeners and connections
+	lock    sync.Mutex
+	stopped bool
+	open    map[io.Closer]struct{}
+}
+
+// New creates a new instance of ReplicaServer using the specified
+// replica instance to connect incoming connections with.
+func New(replica api.ConnectionHandler, opts ...Option) ReplicaServer {
+	s := &server{
+		replica: replica,
+		opts:    options{maxFrameSize: wire.DefaultMaxFrameSize},
+		open:    make(map[io.Closer]struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	return s
+}
+
+func (s *server) Serve(lis net.Listener) error {
+	if !s.track(lis) {
+		lis.Close()
+		return nil
+	}
+	defer s.untrack(lis)
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if s.isStopped() {
+				return nil
+			}
+			return fmt.Errorf("Error accepting connection: %s", err)
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+func (s *server) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stopped = true
+	for c := range s.open {
+		c.Close()
+	}
+}
+
+func (s *server) handleConn(conn net.Conn) {
+	if !s.track(conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+
+	if err := conn.SetReadDeadline(time.Now().Add(preambleTimeout)); err != nil {
+		log.Printf("Error setting deadline: %s\n", err)
+		return
+	}
+	channel, err := wire.ReadPreamble(rd)
+	if err != nil {
+		log.Printf("Error serving connection from %s: %s\n", conn.RemoteAddr(), err)
+		return
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing deadline: %s\n", err)
+		return
+	}
+
+	var sh api.MessageStreamHandler
+	switch channel {
+	case wire.PeerChannel:
+		sh = s.replica.PeerMessageStreamHandler()
+	case wire.ClientChannel:
+		sh = s.replica.ClientMessageStreamHandler()
+	}
+
+	in := make(chan []byte)
+	out := sh.HandleMessageStream(in)
+
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.handleIn(conn, rd, in)
+	}()
+
+	s.handleOut(conn, out)
+}
+
+func (s *server) handleIn(conn net.Conn, rd io.Reader, in chan<- []byte) {
+	defer close(in)
+
+	for {
+		msg, err := wire.ReadFrame(rd, s.opts.maxFrameSize)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			if !s.isStopped() {
+				log.Printf("Error receiving from %s: %s\n", conn.RemoteAddr(), err)
+			}
+			conn.Close()
+			return
+		}
+
+		in <- msg
+	}
+}
+
+func (s *server) handleOut(conn net.Conn, out <-chan []byte) {
+	w := bufio.NewWriter(conn)
+	for msg := range out {
+		err := wire.WriteFrame(w, msg, s.opts.maxFrameSize)
+		if err == nil && len(out) == 0 {
+			err = w.Flush()
+		}
+		if err != nil {
+			if !s.isStopped() {
+				log.Printf("Error sending to %s: %s\n", conn.RemoteAddr(), err)
+			}
+			conn.Close()
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Printf("Error sending to %s: %s\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil {
+			log.Printf("Error closing connection to %s: %s\n", conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// track registers an open listener or connection to close when the
+// server is stopped. It returns false if the server is already
+// stopped.
+func (s *server) track(c io.Closer) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stopped {
+		return false
+	}
+	s.open[c] = struct{}{}
+	return true
+}
+
+func (s *server) untrack(c io.Closer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.open, c)
+}
+
+func (s *server) isStopped() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stopped
+}
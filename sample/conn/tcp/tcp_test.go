@@ -0,0 +1,279 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/tcp/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/tcp/server"
+
+	mock_api "github.com/hyperledger-labs/minbft/api/mocks"
+)
+
+const (
+	nrReplicas = 3
+	nrMessages = 5
+	msgSize    = 32
+)
+
+func TestClientSide(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := connector.NewClientSide()
+
+	replicas, stop := setupConnector(ctrl, conn, nrReplicas, tcpListener)
+	defer stop()
+
+	clientHandlers := setupClientHandlers(ctrl, replicas)
+	testConnector(t, conn, clientHandlers)
+}
+
+func TestReplicaSide(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := connector.NewReplicaSide()
+
+	replicas, stop := setupConnector(ctrl, conn, nrReplicas, tcpListener)
+	defer stop()
+
+	peerHandlers := setupPeerHandlers(ctrl, replicas)
+	testConnector(t, conn, peerHandlers)
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir, err := ioutil.TempDir("", "tcp-conn")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn := connector.NewReplicaSide()
+
+	replicas, stop := setupConnector(ctrl, conn, nrReplicas, func(i int) (net.Listener, string) {
+		path := filepath.Join(dir, fmt.Sprintf("replica%d.sock", i))
+		lis, err := net.Listen("unix", path)
+		if err != nil {
+			panic(err)
+		}
+		return lis, "unix:" + path
+	})
+	defer stop()
+
+	peerHandlers := setupPeerHandlers(ctrl, replicas)
+	testConnector(t, conn, peerHandlers)
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := connector.NewClientSide(connector.WithMaxFrameSize(msgSize))
+
+	replicas, stop := setupConnector(ctrl, conn, 1, tcpListener, server.WithMaxFrameSize(msgSize))
+	defer stop()
+
+	mockHandler := setupClientHandlers(ctrl, replicas)[0]
+	received := make(chan []byte, 1)
+	mockHandler.EXPECT().HandleMessageStream(gomock.Any()).DoAndReturn(
+		func(in <-chan []byte) <-chan []byte {
+			out := make(chan []byte)
+			go func() {
+				defer close(out)
+				for m := range in {
+					received <- m
+				}
+			}()
+			return out
+		},
+	)
+
+	out := make(chan []byte)
+	in := conn.ReplicaMessageStreamHandler(0).HandleMessageStream(out)
+
+	msg := makeMessages(1)[0]
+	out <- msg
+	assert.Equal(t, msg, <-received)
+
+	// Oversized message terminates the stream
+	out <- make([]byte, msgSize+1)
+	_, more := <-in
+	assert.False(t, more)
+}
+
+func setupConnector(ctrl *gomock.Controller, conn connector.ReplicaConnector, n int, listen func(i int) (net.Listener, string), opts ...server.Option) (replicas []*mock_api.MockConnectionHandler, stop func()) {
+	done := make(chan struct{})
+	stop = func() { close(done) }
+
+	addrs := make(map[uint32]string)
+
+	for i := 0; i < n; i++ {
+		r := mock_api.NewMockConnectionHandler(ctrl)
+		replicas = append(replicas, r)
+
+		srv := server.New(r, opts...)
+		go func() {
+			<-done
+			srv.Stop()
+		}()
+
+		lis, addr := listen(i)
+		go func() {
+			if err := srv.Serve(lis); err != nil {
+				panic(err)
+			}
+		}()
+
+		addrs[uint32(i)] = addr
+	}
+
+	if err := connector.ConnectManyReplicas(conn, addrs); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+func tcpListener(int) (net.Listener, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	return lis, lis.Addr().String()
+}
+
+func setupClientHandlers(ctrl *gomock.Controller, replicas []*mock_api.MockConnectionHandler) (handlers []*mock_api.MockMessageStreamHandler) {
+	for _, r := range replicas {
+		h := mock_api.NewMockMessageStreamHandler(ctrl)
+		handlers = append(handlers, h)
+		r.EXPECT().ClientMessageStreamHandler().Return(h).AnyTimes()
+	}
+
+	return
+}
+
+func setupPeerHandlers(ctrl *gomock.Controller, replicas []*mock_api.MockConnectionHandler) (handlers []*mock_api.MockMessageStreamHandler) {
+	for _, r := range replicas {
+		h := mock_api.NewMockMessageStreamHandler(ctrl)
+		handlers = append(handlers, h)
+		r.EXPECT().PeerMessageStreamHandler().Return(h).AnyTimes()
+	}
+
+	return
+}
+
+func testConnector(t *testing.T, conn connector.ReplicaConnector, handlers []*mock_api.MockMessageStreamHandler) {
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	wg.Add(len(handlers))
+	for i := range handlers {
+		i := i
+		go func() {
+			defer wg.Done()
+
+			sh := conn.ReplicaMessageStreamHandler(uint32(i))
+			testConnection(t, sh, handlers[i])
+		}()
+	}
+}
+
+func testConnection(t *testing.T, sh api.MessageStreamHandler, mockHandler *mock_api.MockMessageStreamHandler) {
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	mockIn := make(chan []byte)
+	mockOut := make(chan []byte)
+
+	mockHandler.EXPECT().HandleMessageStream(gomock.Any()).DoAndReturn(
+		func(in <-chan []byte) <-chan []byte {
+			go func() {
+				for m := range in {
+					mockIn <- m
+				}
+			}()
+
+			return mockOut
+		},
+	)
+
+	out := make(chan []byte)
+	in := sh.HandleMessageStream(out)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		testStream(t, out, mockIn)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		testStream(t, mockOut, in)
+	}()
+}
+
+func testStream(t *testing.T, out chan<- []byte, in <-chan []byte) {
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	msgs := makeMessages(nrMessages)
+
+	wg.Add(1)
+	go func() {
+		defer close(out)
+		defer wg.Done()
+
+		for _, m := range msgs {
+			out <- m
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for _, m := range msgs {
+			assert.Equal(t, m, <-in)
+		}
+	}()
+}
+
+func makeMessages(n int) (msgs [][]byte) {
+	for i := 0; i < n; i++ {
+		m := make([]byte, msgSize)
+		rand.Read(m)
+		msgs = append(msgs, m)
+	}
+
+	return
+}
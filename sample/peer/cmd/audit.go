@@ -0,0 +1,129 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	minbft "github.com/hyperledger-labs/minbft/core"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/sample/audit"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/usig"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit message-log...",
+	Short: "Audit message logs recorded by replicas",
+	Long: `
+Audit message logs recorded by replicas started with "peer run
+--message-log". Every UI is verified against the USIG keys from the
+keyset file, and UI counters of each replica are checked to be
+contiguous and never assigned to different messages. Commit messages
+are checked to be consistent with the Prepare messages they commit.
+Prepare messages are checked to come from the primary given the
+membership in their view, replaying the reconfigurations committed in
+the logs starting from the membership in the consensus configuration.
+Logs of several replicas can be audited together. Any problem found
+is reported, and the command fails if there are any.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		keysFile, err := os.Open(viper.GetString("keys"))
+		if err != nil {
+			return fmt.Errorf("Failed to open keyset file: %s", err)
+		}
+		defer keysFile.Close()
+
+		// Only public keys are needed to verify UIs and signatures
+		ks, err := authen.LoadSimpleKeyStore(keysFile, nil, 0)
+		if err != nil {
+			return fmt.Errorf("Failed to load keystore: %s", err)
+		}
+		au, err := authen.NewWithUSIG(nil, 0, ks, nil)
+		if err != nil {
+			return fmt.Errorf("Failed to create authenticator: %s", err)
+		}
+		verifyUI := func(replicaID uint32, msg []byte, ui *usig.UI) (uint64, error) {
+			return authen.VerifyUSIGUI(ks, replicaID, msg, ui)
+		}
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		auditor := audit.New(minbft.NewMembershipHistory(cfg), verifyUI, au)
+		nrMessages := 0
+		for _, fileName := range args {
+			n, err := auditMessageLog(auditor, fileName)
+			if err != nil {
+				return err
+			}
+			nrMessages += n
+		}
+
+		findings := auditor.Finish()
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		if len(findings) != 0 {
+			return fmt.Errorf("Audited %d messages: %d problems found", nrMessages, len(findings))
+		}
+		fmt.Printf("Audited %d messages: no problems found\n", nrMessages)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+}
+
+// auditMessageLog adds all messages from the message log file to the
+// auditor and returns the number of messages read.
+func auditMessageLog(auditor *audit.Auditor, fileName string) (int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open message log: %s", err)
+	}
+	defer f.Close()
+
+	impl := protobufMessages.NewImpl()
+	r := bufio.NewReader(f)
+	for n := 0; ; n++ {
+		msg, err := messages.ReadMessage(r, impl)
+		if err == io.EOF {
+			return n, nil
+		} else if err == io.ErrUnexpectedEOF {
+			// The replica may have stopped while recording
+			fmt.Printf("%s: incomplete message at the end ignored\n", fileName)
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("Failed to read message log %s: %s", fileName, err)
+		}
+
+		auditor.Add(msg)
+	}
+}
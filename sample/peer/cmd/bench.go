@@ -0,0 +1,273 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/client"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Generate load and measure performance",
+	Long: `
+Submit requests to the consensus network from a number of concurrent
+clients and report the achieved throughput and latency distribution.
+Clients are assigned consecutive IDs starting from the given one; the
+keyset file has to contain keys for all of them. The load is generated
+either until the given number of requests is complete or for the given
+duration, optionally limiting the total request rate.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return bench()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().Int("first-id", 0, "ID of the first client")
+	must(viper.BindPFlag("bench.firstClientID",
+		benchCmd.Flags().Lookup("first-id")))
+
+	benchCmd.Flags().IntP("clients", "c", 1, "number of concurrent clients")
+	must(viper.BindPFlag("bench.clients",
+		benchCmd.Flags().Lookup("clients")))
+
+	benchCmd.Flags().IntP("requests", "n", 1000,
+		"total number of requests (0 means no limit)")
+	must(viper.BindPFlag("bench.requests",
+		benchCmd.Flags().Lookup("requests")))
+
+	benchCmd.Flags().DurationP("duration", "d", 0,
+		"duration to generate load for (0 means no limit)")
+	must(viper.BindPFlag("bench.duration",
+		benchCmd.Flags().Lookup("duration")))
+
+	benchCmd.Flags().IntP("payload-size", "s", 32, "request payload size in bytes")
+	must(viper.BindPFlag("bench.payloadSize",
+		benchCmd.Flags().Lookup("payload-size")))
+
+	benchCmd.Flags().Float64P("rate", "r", 0,
+		"total request rate per second (0 means no limit)")
+	must(viper.BindPFlag("bench.rate",
+		benchCmd.Flags().Lookup("rate")))
+}
+
+// benchResult summarizes load generated by a single client.
+type benchResult struct {
+	latencies []time.Duration
+	failed    int
+}
+
+func bench() error {
+	firstID := viper.GetInt("bench.firstClientID")
+	nrClients := viper.GetInt("bench.clients")
+	nrRequests := viper.GetInt("bench.requests")
+	duration := viper.GetDuration("bench.duration")
+	payloadSize := viper.GetInt("bench.payloadSize")
+	rate := viper.GetFloat64("bench.rate")
+	timeout := viper.GetDuration("client.timeout")
+
+	if firstID < 0 || nrClients < 1 {
+		return fmt.Errorf("Invalid client IDs")
+	}
+	if nrRequests < 0 || duration < 0 || (nrRequests == 0 && duration == 0) {
+		return fmt.Errorf("Either number of requests or duration has to be limited")
+	}
+	if payloadSize < 0 {
+		return fmt.Errorf("Invalid payload size")
+	}
+	var interval time.Duration
+	if rate < 0 {
+		return fmt.Errorf("Invalid request rate")
+	} else if rate > 0 {
+		if interval = time.Duration(float64(time.Second) / rate); interval <= 0 {
+			return fmt.Errorf("Request rate is too high")
+		}
+	}
+
+	// Per-request debug messages would dominate the output
+	logging.SetLevel(logging.WARNING, "client")
+
+	clients := make([]client.Client, nrClients)
+	for i := range clients {
+		c, err := newClient(uint32(firstID + i))
+		if err != nil {
+			return err
+		}
+		clients[i] = c
+	}
+
+	operation := make([]byte, payloadSize)
+	for i := range operation {
+		operation[i] = 'a' + byte(i%26)
+	}
+
+	work := make(chan struct{})
+	results := make(chan *benchResult, nrClients)
+	done := make(chan struct{})
+
+	start := time.Now()
+
+	wg := new(sync.WaitGroup)
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c client.Client) {
+			defer wg.Done()
+			results <- benchClient(c, operation, timeout, work)
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	generateLoad(work, done, nrRequests, duration, interval)
+	<-done
+	elapsed := time.Since(start)
+	close(results)
+
+	var latencies []time.Duration
+	failed := 0
+	for res := range results {
+		latencies = append(latencies, res.latencies...)
+		failed += res.failed
+	}
+
+	printBenchReport(latencies, failed, elapsed)
+
+	return nil
+}
+
+// generateLoad issues a unit of work to the work channel for each
+// request to submit. It stops either when nrRequests units are
+// issued, the duration has elapsed, or the done channel is closed.
+// Zero nrRequests or duration mean no limit. Non-zero interval
+// specifies the minimal interval between the units. The work
+// channel is closed upon return.
+func generateLoad(work chan<- struct{}, done <-chan struct{}, nrRequests int, duration, interval time.Duration) {
+	defer close(work)
+
+	var timeoutChan <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	var throttle <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	for i := 0; nrRequests == 0 || i < nrRequests; i++ {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-timeoutChan:
+				return
+			case <-done:
+				return
+			}
+		}
+
+		select {
+		case work <- struct{}{}:
+		case <-timeoutChan:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// benchClient submits a request using the client for each unit of
+// work received from the work channel and measures its latency.
+// Requests rejected or failed to execute are accounted as failed. The
+// client cannot proceed once a request has timed out, so that such
+// request is accounted as failed as well and the function returns.
+func benchClient(c client.Client, operation []byte, timeout time.Duration, work <-chan struct{}) *benchResult {
+	res := new(benchResult)
+
+	for range work {
+		var timeoutChan <-chan time.Time
+		if timeout > 0 {
+			timeoutChan = time.After(timeout)
+		}
+
+		start := time.Now()
+		select {
+		case out := <-c.Execute(operation):
+			if out.Err != nil {
+				res.failed++
+				continue
+			}
+			res.latencies = append(res.latencies, time.Since(start))
+		case <-timeoutChan:
+			res.failed++
+			return res
+		}
+	}
+
+	return res
+}
+
+func printBenchReport(latencies []time.Duration, failed int, elapsed time.Duration) {
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+
+	fmt.Printf("Requests:   %d completed, %d failed\n", len(latencies), failed)
+	fmt.Printf("Elapsed:    %v\n", elapsed)
+	fmt.Printf("Throughput: %.2f req/s\n", float64(len(latencies))/elapsed.Seconds())
+
+	if len(latencies) == 0 {
+		return
+	}
+
+	fmt.Printf("Latency:    min %v, mean %v, max %v\n", latencies[0],
+		total/time.Duration(len(latencies)), latencies[len(latencies)-1])
+	fmt.Printf("            p50 %v, p99 %v, p999 %v\n",
+		percentile(latencies, 0.5), percentile(latencies, 0.99),
+		percentile(latencies, 0.999))
+}
+
+// percentile returns the p-th percentile of the sorted latencies
+// using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/trace"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+// diagramCmd represents the diagram command
+var diagramCmd = &cobra.Command{
+	Use:   "diagram trace...",
+	Short: "Generate a sequence diagram from traces recorded by replicas",
+	Long: `
+Generate a sequence diagram of the message exchange between clients
+and replicas from traces recorded by replicas started with "peer run
+--trace", in Mermaid or Graphviz DOT format. Each client request is
+introduced with a note, and messages are labeled with the time
+elapsed since the first message of the request. Traces of several
+replicas can be combined; their clocks are supposed to be
+synchronized. View changes are highlighted, as well as messages
+with invalid signature or UI and messages sent by a replica but
+never received by another replica whose trace is given.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		var request *trace.RequestID
+		if s := viper.GetString("diagram.request"); s != "" {
+			request = new(trace.RequestID)
+			if _, err := fmt.Sscanf(s, "%d:%d", &request.ClientID, &request.Seq); err != nil {
+				return fmt.Errorf("Failed to parse request: %s", err)
+			}
+		}
+
+		traces := make(map[uint32][]*trace.Record)
+		for _, fileName := range args {
+			f, err := os.Open(fileName)
+			if err != nil {
+				return fmt.Errorf("Failed to open trace file: %s", err)
+			}
+			records, err := trace.Read(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("Failed to read trace %s: %s", fileName, err)
+			}
+			id, ok := trace.TraceReplicaID(records)
+			if !ok {
+				return fmt.Errorf("Failed to determine replica of trace %s: no message sent", fileName)
+			}
+			if _, dup := traces[id]; dup {
+				return fmt.Errorf("More than one trace of replica %d", id)
+			}
+			traces[id] = records
+		}
+
+		validate, err := newMessageValidator()
+		if err != nil {
+			return err
+		}
+
+		flow := trace.NewFlow(traces, validate)
+		if request != nil {
+			flow = flow.Only(*request)
+			if len(flow.Requests) == 0 {
+				return fmt.Errorf("Request %d:%d not found", request.ClientID, request.Seq)
+			}
+		}
+
+		switch format := viper.GetString("diagram.format"); format {
+		case "mermaid":
+			return flow.WriteMermaid(os.Stdout)
+		case "dot":
+			return flow.WriteDOT(os.Stdout)
+		default:
+			return fmt.Errorf("Unknown output format: %s", format)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diagramCmd)
+
+	diagramCmd.Flags().String("format", "mermaid", "output format (mermaid or dot)")
+	must(viper.BindPFlag("diagram.format", diagramCmd.Flags().Lookup("format")))
+
+	diagramCmd.Flags().String("request", "",
+		"only show messages of the request given as CLIENT:SEQ, and view changes")
+	must(viper.BindPFlag("diagram.request", diagramCmd.Flags().Lookup("request")))
+}
+
+// newMessageValidator creates a validator to verify the signature or
+// UI of messages using public keys from the keyset file.
+func newMessageValidator() (trace.MessageValidator, error) {
+	keysFile, err := os.Open(viper.GetString("keys"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open keyset file: %s", err)
+	}
+	defer keysFile.Close()
+
+	ks, err := authen.LoadSimpleKeyStore(keysFile, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load keystore: %s", err)
+	}
+	au, err := authen.NewWithUSIG(nil, 0, ks, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create authenticator: %s", err)
+	}
+
+	return func(msg messages.Message) error {
+		authenBytes := messages.AuthenBytes(msg)
+		switch msg := msg.(type) {
+		case messages.Request:
+			return au.VerifyMessageAuthenTag(api.ClientAuthen, msg.ClientID(), authenBytes, msg.Signature())
+		case messages.CertifiedMessage:
+			ui := new(usig.UI)
+			if err := ui.UnmarshalBinary(msg.UIBytes()); err != nil {
+				return fmt.Errorf("malformed UI: %s", err)
+			}
+			_, err := authen.VerifyUSIGUI(ks, msg.ReplicaID(), authenBytes, ui)
+			return err
+		case messages.Reply:
+			return au.VerifyMessageAuthenTag(api.ReplicaAuthen, msg.ReplicaID(), authenBytes, msg.Signature())
+		case messages.ReqViewChange:
+			return au.VerifyMessageAuthenTag(api.ReplicaAuthen, msg.ReplicaID(), authenBytes, msg.Signature())
+		default:
+			return nil
+		}
+	}, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+)
+
+// feedCmd represents the feed command
+var feedCmd = &cobra.Command{
+	Use:   "feed",
+	Short: "Stream operations committed by a replica",
+	Long: `
+Subscribe to the commit feed of a replica and output each committed
+operation in JSON, one per line, in the order of commit. The output
+includes the commit certificate, i.e. the Prepare and Commit messages
+the operation was committed with. The subscription can be resumed
+from a given position, provided the replica still retains it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		replicaID := uint32(viper.GetInt("feed.replica"))
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		target, dialOpt, err := replicaAdminEndpoint(cfg, replicaID, uint32(viper.GetInt("feed.id")))
+		if err != nil {
+			return err
+		}
+
+		sub, err := connector.SubscribeCommitted(target, uint64(viper.GetInt64("feed.from")), dialOpt)
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe to commit feed: %s", err)
+		}
+		defer sub.Close()
+
+		for {
+			op, err := sub.Recv()
+			if err != nil {
+				return fmt.Errorf("Commit feed terminated: %s", err)
+			}
+
+			out, err := json.Marshal(op)
+			if err != nil {
+				return fmt.Errorf("Failed to encode committed operation: %s", err)
+			}
+			fmt.Println(string(out))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(feedCmd)
+
+	feedCmd.Flags().Int("replica", 0, "ID of the replica to subscribe to")
+	must(viper.BindPFlag("feed.replica", feedCmd.Flags().Lookup("replica")))
+
+	feedCmd.Flags().Uint64("from", 0,
+		"position to stream committed operations from (0 means the oldest retained)")
+	must(viper.BindPFlag("feed.from", feedCmd.Flags().Lookup("from")))
+
+	feedCmd.Flags().Int("id", 0, "ID of the client to authenticate with TLS as")
+	must(viper.BindPFlag("feed.id", feedCmd.Flags().Lookup("id")))
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/client"
+	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+)
+
+// kvCmd represents the kv command
+var kvCmd = &cobra.Command{
+	Use:   "kv",
+	Short: "Submit key-value store operations to replicas",
+	Long: `
+Submit an operation to the key-value store replicated by the
+consensus network and output the result. Replicas have to run the
+key-value store state machine, i.e. "peer run --state-machine kv".`,
+}
+
+var kvGetCmd = &cobra.Command{
+	Use:   "get key",
+	Short: "Get the value of a key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return kv(cmd, &requestconsumer.KVOperation{
+			Op:  requestconsumer.KVGet,
+			Key: args[0],
+		})
+	},
+}
+
+var kvPutCmd = &cobra.Command{
+	Use:   "put key value",
+	Short: "Set the value of a key",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return kv(cmd, &requestconsumer.KVOperation{
+			Op:    requestconsumer.KVPut,
+			Key:   args[0],
+			Value: []byte(args[1]),
+		})
+	},
+}
+
+var kvDeleteCmd = &cobra.Command{
+	Use:   "delete key",
+	Short: "Delete a key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return kv(cmd, &requestconsumer.KVOperation{
+			Op:  requestconsumer.KVDelete,
+			Key: args[0],
+		})
+	},
+}
+
+var kvCASCmd = &cobra.Command{
+	Use:   "cas key value [expected]",
+	Short: "Set the value of a key if it matches the expected one",
+	Long: `
+Set the value of a key if its current value matches the expected
+one. If no expected value is given, the key is expected to be absent.`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op := &requestconsumer.KVOperation{
+			Op:           requestconsumer.KVCompareAndSwap,
+			Key:          args[0],
+			Value:        []byte(args[1]),
+			ExpectAbsent: len(args) < 3,
+		}
+		if len(args) > 2 {
+			op.Expected = []byte(args[2])
+		}
+		return kv(cmd, op)
+	},
+}
+
+var kvRangeCmd = &cobra.Command{
+	Use:   "range [start [end]]",
+	Short: "List keys in a range",
+	Long: `
+List keys from start (inclusive) to end (exclusive) together with
+their values. All keys are listed if no range is given.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op := &requestconsumer.KVOperation{
+			Op:    requestconsumer.KVRange,
+			Limit: viper.GetInt("kv.limit"),
+		}
+		if len(args) > 0 {
+			op.Key = args[0]
+		}
+		if len(args) > 1 {
+			op.End = args[1]
+		}
+		return kv(cmd, op)
+	},
+}
+
+func init() {
+	requestCmd.AddCommand(kvCmd)
+	kvCmd.AddCommand(kvGetCmd, kvPutCmd, kvDeleteCmd, kvCASCmd, kvRangeCmd)
+
+	kvRangeCmd.Flags().IntP("limit", "l", 0,
+		"maximal number of keys to list (0 means no limit)")
+	must(viper.BindPFlag("kv.limit",
+		kvRangeCmd.Flags().Lookup("limit")))
+}
+
+func kv(cmd *cobra.Command, op *requestconsumer.KVOperation) error {
+	// Arguments are valid, no need to show usage on failure
+	cmd.SilenceUsage = true
+
+	opJSON, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("Failed to encode operation: %s", err)
+	}
+
+	c, err := newClient(uint32(viper.GetInt("client.id")))
+	if err != nil {
+		return err
+	}
+
+	resJSON, err := submit(c, opJSON)
+	if _, ok := err.(*client.ExecutionError); ok {
+		return fmt.Errorf("Operation failed: %s", err)
+	} else if err != nil {
+		return err
+	}
+
+	res := new(requestconsumer.KVResult)
+	if err := json.Unmarshal(resJSON, res); err != nil {
+		return fmt.Errorf("Failed to decode result: %s", err)
+	}
+
+	return printKVResult(op, res)
+}
+
+func printKVResult(op *requestconsumer.KVOperation, res *requestconsumer.KVResult) error {
+	switch op.Op {
+	case requestconsumer.KVGet:
+		if !res.Found {
+			return fmt.Errorf("Key not found: %s", op.Key)
+		}
+		fmt.Println(string(res.Value))
+	case requestconsumer.KVPut:
+		fmt.Println("OK")
+	case requestconsumer.KVDelete:
+		if !res.Found {
+			return fmt.Errorf("Key not found: %s", op.Key)
+		}
+		fmt.Println("OK")
+	case requestconsumer.KVCompareAndSwap:
+		if !res.Swapped {
+			if !res.Found {
+				return fmt.Errorf("Compare failed: key not found")
+			}
+			return fmt.Errorf("Compare failed: current value is %q", res.Value)
+		}
+		fmt.Println("OK")
+	case requestconsumer.KVRange:
+		for _, e := range res.Entries {
+			fmt.Printf("%s=%s\n", e.Key, e.Value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+)
+
+// ledgerProof is a self-contained proof of block inclusion output by
+// the ledger proof command.
+type ledgerProof struct {
+	Block  *requestconsumer.SimpleBlock
+	Proof  *requestconsumer.InclusionProof
+	Digest []byte
+}
+
+// ledgerCmd represents the ledger command
+var ledgerCmd = &cobra.Command{
+	Use:   "ledger",
+	Short: "Inspect the ledger persisted by a replica",
+	Long: `
+Inspect the blocks persisted by a replica started with "peer run
+--ledger-dir". The ledger is read without being modified, so that it
+can be inspected while the replica is running.`,
+}
+
+var ledgerProofCmd = &cobra.Command{
+	Use:   "proof height",
+	Short: "Produce an inclusion proof for a block",
+	Long: `
+Produce a proof that the block at the given height is included in the
+ledger. The proof is output in JSON together with the block and the
+state digest the proof is checked against. By default, the proof is
+produced for the current ledger; another state digest can be selected
+by the number of blocks in the ledger at that time.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		height, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid block height: %s", err)
+		}
+
+		dir := ledgerDir()
+		if dir == "" {
+			return fmt.Errorf("Ledger directory not specified")
+		}
+
+		l, err := requestconsumer.ReadSimpleLedger(dir)
+		if err != nil {
+			return fmt.Errorf("Failed to read ledger: %s", err)
+		}
+
+		treeSize := uint64(viper.GetInt64("ledger.treeSize"))
+		if treeSize == 0 {
+			treeSize = l.GetLength()
+		}
+
+		proof, err := l.ProveInclusion(height, treeSize)
+		if err != nil {
+			return fmt.Errorf("Failed to produce inclusion proof: %s", err)
+		}
+		digest, err := l.StateDigestAt(treeSize)
+		if err != nil {
+			return fmt.Errorf("Failed to get state digest: %s", err)
+		}
+
+		out, err := json.MarshalIndent(&ledgerProof{l.Block(height), proof, digest}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to encode inclusion proof: %s", err)
+		}
+		fmt.Println(string(out))
+
+		return nil
+	},
+}
+
+var ledgerVerifyCmd = &cobra.Command{
+	Use:   "verify proof-file digest",
+	Short: "Verify an inclusion proof for a block",
+	Long: `
+Verify a proof output by "peer ledger proof" against the state digest
+given in base64 encoding, e.g. the digest certified by replicas. The
+proof is read from standard input if the file name is "-".`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read inclusion proof: %s", err)
+		}
+
+		p := new(ledgerProof)
+		if err := json.Unmarshal(data, p); err != nil {
+			return fmt.Errorf("Failed to decode inclusion proof: %s", err)
+		}
+		if p.Block == nil || p.Proof == nil {
+			return fmt.Errorf("Incomplete inclusion proof")
+		}
+
+		digest, err := base64.StdEncoding.DecodeString(args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid state digest: %s", err)
+		}
+
+		if err := requestconsumer.VerifyInclusionProof(p.Block, p.Proof, digest); err != nil {
+			return fmt.Errorf("Inclusion proof is invalid: %s", err)
+		}
+		fmt.Printf("Block %d is included in the ledger of %d blocks\n",
+			p.Proof.Height, p.Proof.TreeSize)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ledgerCmd)
+	ledgerCmd.AddCommand(ledgerProofCmd, ledgerVerifyCmd)
+
+	ledgerProofCmd.Flags().String("ledger-dir", "",
+		"directory with the persisted ledger (default replica.ledgerDir)")
+	must(viper.BindPFlag("ledger.dir",
+		ledgerProofCmd.Flags().Lookup("ledger-dir")))
+
+	ledgerProofCmd.Flags().Uint64("tree-size", 0,
+		"number of blocks in the ledger to prove inclusion in (0 means all)")
+	must(viper.BindPFlag("ledger.treeSize",
+		ledgerProofCmd.Flags().Lookup("tree-size")))
+}
+
+func ledgerDir() string {
+	if dir := viper.GetString("ledger.dir"); dir != "" {
+		return dir
+	}
+	return viper.GetString("replica.ledgerDir")
+}
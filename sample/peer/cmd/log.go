@@ -0,0 +1,110 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/messages"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+// logCmd represents the log command
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Inspect message logs recorded by replicas",
+}
+
+var logDumpCmd = &cobra.Command{
+	Use:   "dump message-log",
+	Short: "Dump a message log in human-readable form",
+	Long: `
+Dump a message log recorded by a replica started with "peer run
+--message-log". Messages are output either in JSON, one per line, or
+as a text table. The JSON output includes embedded messages, decoded
+UIs, and signatures in hex. The message log is read from standard
+input if the file name is "-".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		var write func(msg messages.Message) error
+		var flush func() error
+		switch format := viper.GetString("log.format"); format {
+		case "json":
+			write = func(msg messages.Message) error {
+				data, err := messages.EncodeJSON(msg)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Println(string(data))
+				return err
+			}
+			flush = func() error { return nil }
+		case "text":
+			tw := messages.NewTableWriter(os.Stdout)
+			write, flush = tw.Write, tw.Flush
+		default:
+			return fmt.Errorf("Unknown output format: %s", format)
+		}
+
+		in := os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to open message log: %s", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		impl := protobufMessages.NewImpl()
+		r := bufio.NewReader(in)
+		for {
+			msg, err := messages.ReadMessage(r, impl)
+			if err == io.EOF {
+				break
+			} else if err == io.ErrUnexpectedEOF {
+				// The replica may have stopped while recording
+				fmt.Fprintln(os.Stderr, "Incomplete message at the end ignored")
+				break
+			} else if err != nil {
+				flush() //nolint:errcheck
+				return fmt.Errorf("Failed to read message log: %s", err)
+			}
+
+			if err := write(msg); err != nil {
+				return fmt.Errorf("Failed to output message: %s", err)
+			}
+		}
+
+		return flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	logCmd.AddCommand(logDumpCmd)
+
+	logDumpCmd.Flags().String("format", "json", "output format (json or text)")
+	must(viper.BindPFlag("log.format", logDumpCmd.Flags().Lookup("format")))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+)
+
+// queryMembership returns the current membership as reported by the
+// replicas, querying their status as the client with the specified
+// ID. Replicas from the consensus configuration are queried first,
+// then the replicas joined since, as their addresses are reported. A
+// membership is trusted if more than F of its members report it, so
+// that at least one of them is correct; the trusted membership with
+// the highest epoch is returned.
+func queryMembership(cfg *config.ViperConfiger, clientID uint32, timeout time.Duration) (*api.Membership, error) {
+	addrs := make(map[uint32]string)
+	for _, p := range cfg.Peers() {
+		addrs[uint32(p.ID)] = p.Addr
+	}
+
+	type report struct {
+		membership *api.Membership
+		replicas   []uint32
+	}
+	reports := make(map[string]*report)
+	queried := make(map[uint32]bool)
+
+	var current *api.Membership
+	for {
+		var pending []uint32
+		for id := range addrs {
+			if !queried[id] {
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		sort.Slice(pending, func(i, j int) bool { return pending[i] < pending[j] })
+
+		for _, id := range pending {
+			queried[id] = true
+
+			st, err := queryReplicaStatus(id, addrs[id], clientID, timeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to query status of replica %d: %s\n", id, err)
+				continue
+			} else if st.ReplicaID != id || len(st.Addresses) != len(st.Members) {
+				fmt.Fprintf(os.Stderr, "Invalid status of replica %d\n", id)
+				continue
+			}
+
+			key := fmt.Sprintf("%d/%d/%v/%q", st.Epoch, st.F, st.Members, st.Addresses)
+			r := reports[key]
+			if r == nil {
+				r = &report{membership: statusMembership(st)}
+				reports[key] = r
+			}
+			r.replicas = append(r.replicas, id)
+		}
+
+		for _, r := range reports {
+			m := r.membership
+			if (current == nil || m.Epoch > current.Epoch) && countMembers(m, r.replicas) > int(m.F) {
+				current = m
+			}
+			for _, r := range m.Replicas {
+				if _, known := addrs[r.ID]; !known && r.Address != "" {
+					addrs[r.ID] = r.Address
+				}
+			}
+		}
+	}
+
+	if current == nil {
+		return nil, fmt.Errorf("No membership reported by enough replicas")
+	}
+
+	return current, nil
+}
+
+// queryReplicaStatus queries the status of the replica with the
+// specified ID at the target address as the specified client.
+func queryReplicaStatus(replicaID uint32, target string, clientID uint32, timeout time.Duration) (*api.ReplicaStatus, error) {
+	dialOpt, err := replicaAdminDialOption(replicaID, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return connector.QueryStatus(ctx, target, dialOpt)
+}
+
+// statusMembership returns the membership described in the status.
+func statusMembership(st *api.ReplicaStatus) *api.Membership {
+	m := &api.Membership{Epoch: st.Epoch, F: st.F}
+	for i, id := range st.Members {
+		m.Replicas = append(m.Replicas, api.ReplicaInfo{ID: id, Address: st.Addresses[i]})
+	}
+	return m
+}
+
+// countMembers returns the number of distinct members among the
+// replicas with the specified IDs.
+func countMembers(m *api.Membership, ids []uint32) int {
+	members := make(map[uint32]bool)
+	for _, r := range m.Replicas {
+		members[r.ID] = true
+	}
+
+	count := 0
+	for _, id := range ids {
+		if members[id] {
+			count++
+			delete(members, id)
+		}
+	}
+	return count
+}
+
+// membershipAddresses returns the addresses of the members, taking
+// the addresses of the members of the initial membership from the
+// supplied ones.
+func membershipAddresses(m *api.Membership, initial map[uint32]string) map[uint32]string {
+	addrs := make(map[uint32]string)
+	for _, r := range m.Replicas {
+		if r.Address != "" {
+			addrs[r.ID] = r.Address
+		} else {
+			addrs[r.ID] = initial[r.ID]
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/api"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/config"
+)
+
+// reconfigureCmd represents the reconfigure command
+var reconfigureCmd = &cobra.Command{
+	Use:   "reconfigure",
+	Short: "Change the set of replicas",
+	Long: `
+Submit a reconfiguration request to add or remove replicas. The
+request is signed with the operator key from the keyset file and
+ordered as any other request; the new membership takes effect from
+the next view. Replicas to add are given as ID=ADDRESS and must have
+their keys in the keyset file, e.g. generated with 'keytool
+add-replica'; they should be started with 'peer run --listen'
+beforehand. To replace keys or USIG identity of a replica, remove it
+and add it back under a new ID. Unless specified explicitly, the
+number of faulty replicas to tolerate remains as in the current
+membership.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		keys, err := ioutil.ReadFile(viper.GetString("keys"))
+		if err != nil {
+			return fmt.Errorf("Failed to read keyset file: %s", err)
+		}
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		f := viper.GetInt("reconfigure.f")
+		rc := new(api.Reconfiguration)
+		for _, s := range viper.GetStringSlice("reconfigure.remove") {
+			id, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid replica ID to remove: %s", s)
+			}
+			rc.Remove = append(rc.Remove, uint32(id))
+		}
+		for _, s := range viper.GetStringSlice("reconfigure.add") {
+			parts := strings.SplitN(s, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("Invalid replica to add: %s, expected ID=ADDRESS", s)
+			}
+			id, err := strconv.ParseUint(parts[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("Invalid replica ID to add: %s", parts[0])
+			}
+			identity, err := authen.ReplicaIdentity(bytes.NewReader(keys), uint32(id))
+			if err != nil {
+				return fmt.Errorf("Failed to get identity of replica %d: %s", id, err)
+			}
+			rc.Add = append(rc.Add, api.ReplicaInfo{
+				ID:       uint32(id),
+				Address:  parts[1],
+				Identity: identity,
+			})
+		}
+
+		epoch, err := submitReconfiguration(cfg, keys, func(current *api.Membership) *api.Reconfiguration {
+			rc.Epoch, rc.F = current.Epoch, current.F
+			if f >= 0 {
+				rc.F = uint32(f)
+			}
+			return rc
+		}, uint32(viper.GetInt("reconfigure.operator")),
+			uint32(viper.GetInt("reconfigure.id")),
+			viper.GetDuration("reconfigure.timeout"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Membership epoch %d\n", epoch)
+		return nil
+	},
+}
+
+// submitReconfiguration submits the reconfiguration made of the
+// current membership, as reported by the replicas, as the client with
+// the specified ID on behalf of the operator, signing it with the
+// operator key from the keyset. It waits for the reconfiguration to
+// be executed until the timeout expires, unless it is zero, and
+// returns the membership epoch after the reconfiguration.
+func submitReconfiguration(cfg *config.ViperConfiger, keys []byte, makeReconfiguration func(current *api.Membership) *api.Reconfiguration, operatorID, clientID uint32, timeout time.Duration) (uint64, error) {
+	au, err := authen.New([]api.AuthenticationRole{api.OperatorAuthen}, operatorID, bytes.NewReader(keys))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create operator authenticator: %s", err)
+	}
+
+	current, err := queryMembership(cfg, clientID, defStatusTimeout)
+	if err != nil {
+		return 0, err
+	}
+	rc := makeReconfiguration(current)
+
+	tag, err := au.GenerateMessageAuthenTag(api.OperatorAuthen, minbft.ReconfigurationAuthenBytes(rc))
+	if err != nil {
+		return 0, fmt.Errorf("Failed to sign reconfiguration request: %s", err)
+	}
+
+	client, err := newClient(clientID)
+	if err != nil {
+		return 0, err
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	var res []byte
+	select {
+	case out := <-client.Reconfigure(minbft.MakeReconfigurationOperation(rc, operatorID, tag)):
+		if out.Err != nil {
+			return 0, out.Err
+		}
+		res = out.Result
+	case <-expired:
+		return 0, fmt.Errorf("Reconfiguration not executed within %s", timeout)
+	}
+	result, err := minbft.ParseReconfigurationResult(res)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Epoch, nil
+}
+
+func init() {
+	rootCmd.AddCommand(reconfigureCmd)
+
+	reconfigureCmd.Flags().StringSlice("add", nil, "replicas to add as ID=ADDRESS")
+	must(viper.BindPFlag("reconfigure.add", reconfigureCmd.Flags().Lookup("add")))
+
+	reconfigureCmd.Flags().StringSlice("remove", nil, "IDs of replicas to remove")
+	must(viper.BindPFlag("reconfigure.remove", reconfigureCmd.Flags().Lookup("remove")))
+
+	reconfigureCmd.Flags().Int("f", -1, "number of faulty replicas to tolerate (-1 means unchanged)")
+	must(viper.BindPFlag("reconfigure.f", reconfigureCmd.Flags().Lookup("f")))
+
+	reconfigureCmd.Flags().Int("operator", 0, "ID of the operator key to sign the request with")
+	must(viper.BindPFlag("reconfigure.operator", reconfigureCmd.Flags().Lookup("operator")))
+
+	reconfigureCmd.Flags().Int("id", 0, "ID of the client to submit the request as")
+	must(viper.BindPFlag("reconfigure.id", reconfigureCmd.Flags().Lookup("id")))
+
+	reconfigureCmd.Flags().Duration("timeout", defReconfigurationTimeout, "time to wait for the reconfiguration to be executed (0 means no timeout)")
+	must(viper.BindPFlag("reconfigure.timeout", reconfigureCmd.Flags().Lookup("timeout")))
+}
+
+const defReconfigurationTimeout = 30 * time.Second
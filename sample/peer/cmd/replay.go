@@ -0,0 +1,127 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	logging "github.com/op/go-logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/api"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/trace"
+)
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay id trace",
+	Short: "Replay a trace recorded by a replica",
+	Long: `
+Replay a trace recorded by a replica started with "peer run --trace".
+The recorded incoming messages are fed into a fresh instance of the
+replica with a mocked clock, so that timeouts expire in between the
+same messages as recorded. Messages sent by the fresh instance are
+compared with the recorded ones, apart from signatures and UI
+certificates. The first difference in each message stream is
+reported, and the command fails if there are any.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("Failed to parse replica ID: %s", err)
+		}
+
+		traceFile, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("Failed to open trace file: %s", err)
+		}
+		defer traceFile.Close()
+
+		records, err := trace.Read(traceFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read trace: %s", err)
+		}
+
+		stateMachine := viper.GetString("replay.stateMachine")
+		if stateMachine == "" {
+			stateMachine = viper.GetString("replica.stateMachine")
+		}
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		// Replica logs are mostly noise unless asked for
+		opts := []minbft.Option{minbft.WithLogLevel(logging.WARNING)}
+		logOpts, err := getLoggingOptions()
+		if err != nil {
+			return fmt.Errorf("Failed to create logging options: %s", err)
+		}
+		opts = append(opts, logOpts...)
+
+		start := func(conn api.ReplicaConnector, clock *trace.Clock) (api.ConnectionHandler, error) {
+			auth, err := newReplicaAuthenticator(uint32(id))
+			if err != nil {
+				return nil, err
+			}
+
+			consumer, err := newRequestConsumer(stateMachine, "")
+			if err != nil {
+				return nil, err
+			}
+
+			stack := minbft.NewStack(conn, auth, consumer)
+
+			return minbft.New(uint32(id), cfg, stack,
+				append(opts, minbft.WithTimerProvider(clock))...)
+		}
+
+		divergences, err := trace.Replay(records, start, viper.GetDuration("replay.settle"))
+		if err != nil {
+			return fmt.Errorf("Failed to replay trace: %s", err)
+		}
+
+		for _, d := range divergences {
+			fmt.Println(d)
+		}
+		if len(divergences) != 0 {
+			return fmt.Errorf("Replayed %d records: %d streams diverged", len(records), len(divergences))
+		}
+		fmt.Printf("Replayed %d records: no divergence found\n", len(records))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().String("state-machine", "",
+		"replicated state machine to run (defaults to replica.stateMachine)")
+	must(viper.BindPFlag("replay.stateMachine",
+		replayCmd.Flags().Lookup("state-machine")))
+
+	replayCmd.Flags().Duration("settle", time.Second,
+		"time to wait for the replica to send recorded messages")
+	must(viper.BindPFlag("replay.settle",
+		replayCmd.Flags().Lookup("settle")))
+}
@@ -19,6 +19,7 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -28,10 +29,10 @@ import (
 	authen "github.com/hyperledger-labs/minbft/sample/authentication"
 	"github.com/hyperledger-labs/minbft/sample/config"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
 )
 
 // requestCmd represents the request command
@@ -42,7 +43,8 @@ var requestCmd = &cobra.Command{
 Submit a series of requests to the consensus network, wait for it to be processed
 and output the result. The requests are one or more string arguments.
 If no string argument is given, requests are constructed from standard input, where
-each line is passed to a separate request.`,
+each line is passed to a separate request. With --batch-window, all requests
+are submitted at once and gathered into batches.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		_, err := requests(args)
 		if err != nil {
@@ -55,11 +57,20 @@ each line is passed to a separate request.`,
 func init() {
 	rootCmd.AddCommand(requestCmd)
 
-	requestCmd.Flags().Int("id", 0, "ID of the client")
+	requestCmd.PersistentFlags().Int("id", 0, "ID of the client")
 	must(viper.BindPFlag("client.id",
-		requestCmd.Flags().Lookup("id")))
-	requestCmd.Flags().String("timeout", "0", "Timeout for the request")
-	must(viper.BindPFlag("client.timeout", requestCmd.Flags().Lookup("timeout")))
+		requestCmd.PersistentFlags().Lookup("id")))
+	requestCmd.PersistentFlags().String("timeout", "0", "Timeout for the request")
+	must(viper.BindPFlag("client.timeout", requestCmd.PersistentFlags().Lookup("timeout")))
+	requestCmd.Flags().Bool("certificate", false,
+		"output the reply certificate in JSON instead of the result")
+	must(viper.BindPFlag("client.certificate", requestCmd.Flags().Lookup("certificate")))
+	requestCmd.Flags().Duration("batch-window", 0,
+		"submit requests concurrently, batching those within the window (0 means no batching)")
+	must(viper.BindPFlag("client.batchWindow", requestCmd.Flags().Lookup("batch-window")))
+	requestCmd.Flags().Int("batch-size", 0,
+		"maximal number of requests in a batch (0 means no limit)")
+	must(viper.BindPFlag("client.batchSize", requestCmd.Flags().Lookup("batch-size")))
 }
 
 type clientStack struct {
@@ -68,29 +79,127 @@ type clientStack struct {
 }
 
 func request(client client.Client, arg string) {
-	var timeoutChan <-chan time.Time
-	timeout := viper.GetDuration("client.timeout")
+	if viper.GetBool("client.certificate") {
+		requestCertified(client, arg)
+		return
+	}
+
+	res, err := submit(client, []byte(arg))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Reply:", string(res))
+}
+
+// requestBatched submits all requests at once, so that the client
+// can batch them, and outputs the results in order.
+func requestBatched(c client.Client, args []string) {
+	outChans := make([]<-chan client.Outcome, len(args))
+	for i, arg := range args {
+		outChans[i] = c.Execute([]byte(arg))
+	}
 
-	if timeout > 0 {
-		timeoutChan = time.After(timeout)
+	timeout := requestTimeout()
+	for _, outChan := range outChans {
+		select {
+		case out := <-outChan:
+			if out.Err != nil {
+				fmt.Println(out.Err)
+				os.Exit(1)
+			}
+			fmt.Println("Reply:", string(out.Result))
+		case <-timeout:
+			fmt.Println("Client Request timer expired")
+			os.Exit(1)
+		}
 	}
+}
 
+func requestCertified(c client.Client, arg string) {
+	var cert *client.ReplyCertificate
 	select {
-	case res := <-client.Request([]byte(arg)):
-		fmt.Println("Reply:", string(res))
-	case <-timeoutChan:
-		fmt.Println("Client Request timer expired.")
+	case cert = <-c.RequestCertified([]byte(arg)):
+	case <-requestTimeout():
+		fmt.Println("Client Request timer expired")
+		os.Exit(1)
+	}
+
+	out, err := json.Marshal(cert)
+	if err != nil {
+		fmt.Println("Failed to encode reply certificate:", err)
 		os.Exit(1)
 	}
+	fmt.Println(string(out))
+}
+
+// submit submits a request with the operation and waits for its
+// result, respecting the configured client request timeout.
+func submit(client client.Client, op []byte) ([]byte, error) {
+	return awaitOutcome(client.Execute(op))
+}
+
+// awaitOutcome waits for the outcome of a request to receive from the
+// supplied channel, respecting the configured client request timeout.
+func awaitOutcome(outcomeChan <-chan client.Outcome) ([]byte, error) {
+	select {
+	case out := <-outcomeChan:
+		return out.Result, out.Err
+	case <-requestTimeout():
+		return nil, fmt.Errorf("Client Request timer expired")
+	}
+}
+
+// requestTimeout returns a channel to receive from once the
+// configured client request timeout expires. The returned channel is
+// nil if no timeout is configured.
+func requestTimeout() <-chan time.Time {
+	if timeout := viper.GetDuration("client.timeout"); timeout > 0 {
+		return time.After(timeout)
+	}
+	return nil
 }
 
 func requests(args []string) ([]byte, error) {
-	id := uint32(viper.GetInt("client.id"))
+	client, err := newClient(uint32(viper.GetInt("client.id")))
+	if err != nil {
+		return nil, err
+	}
 
+	if viper.GetDuration("client.batchWindow") > 0 && !viper.GetBool("client.certificate") {
+		if len(args) == 0 {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				args = append(args, scanner.Text())
+			}
+		}
+		requestBatched(client, args)
+	} else if len(args) > 0 {
+		for _, arg := range args {
+			request(client, arg)
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			request(client, scanner.Text())
+		}
+	}
+
+	return nil, nil
+}
+
+// newClient creates a client with the specified ID, starting from
+// the current membership reported by the replicas. The client falls
+// back to the replicas from the consensus configuration if no
+// membership is reported by enough replicas, e.g. while they are
+// starting up.
+func newClient(id uint32) (client.Client, error) {
 	keysFile, err := os.Open(viper.GetString("keys"))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to open keyset file: %s", err)
 	}
+	defer keysFile.Close()
 
 	auth, err := authen.New([]api.AuthenticationRole{api.ClientAuthen}, id, keysFile)
 	if err != nil {
@@ -100,35 +209,37 @@ func requests(args []string) ([]byte, error) {
 	cfg := config.New()
 	cfg.LoadConfig(viper.GetString("consensusConf"))
 
+	var opts []client.Option
+
 	peerAddrs := make(map[uint32]string)
 	for _, p := range cfg.Peers() {
 		peerAddrs[uint32(p.ID)] = p.Addr
 	}
+	if m, err := queryMembership(cfg, id, defStatusTimeout); err != nil {
+		fmt.Fprintf(os.Stderr, "Using replicas from the consensus configuration: %s\n", err)
+	} else {
+		opts = append(opts, client.WithMembership(m))
+		peerAddrs = membershipAddresses(m, peerAddrs)
+	}
 
-	conn := connector.NewClientSide()
-
-	// XXX: The connection destination should be authenticated;
-	// grpc.WithInsecure() option is passed here for simplicity.
-	err = connector.ConnectManyReplicas(conn, peerAddrs, grpc.WithInsecure())
+	creds, err := loadTLSCredentials(mtls.ClientIdentity(id))
 	if err != nil {
+		return nil, err
+	}
+
+	conn := connector.NewClientSide()
+	if err := connectReplicas(conn, peerAddrs, creds); err != nil {
 		return nil, fmt.Errorf("Failed to connect to peers: %s", err)
 	}
 
-	client, err := client.New(id, cfg.N(), cfg.F(), clientStack{auth, conn})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create client instance: %s", err)
+	if window := viper.GetDuration("client.batchWindow"); window > 0 {
+		opts = append(opts, client.WithBatching(window, viper.GetInt("client.batchSize")))
 	}
 
-	if len(args) > 0 {
-		for _, arg := range args {
-			request(client, arg)
-		}
-	} else {
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			request(client, scanner.Text())
-		}
+	client, err := client.New(id, cfg.N(), cfg.F(), clientStack{auth, conn}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create client instance: %s", err)
 	}
 
-	return nil, nil
+	return client, nil
 }
@@ -77,7 +77,7 @@ func initConfig() {
 
 	viper.SetConfigFile(cfgFile)
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
 
@@ -20,26 +20,31 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/a8m/envsubst"
 	logging "github.com/op/go-logging"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/grpc"
 
 	"github.com/hyperledger-labs/minbft/api"
 	minbft "github.com/hyperledger-labs/minbft/core"
 	authen "github.com/hyperledger-labs/minbft/sample/authentication"
 	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/handshake"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
 	"github.com/hyperledger-labs/minbft/sample/conn/grpc/server"
 	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+	"github.com/hyperledger-labs/minbft/sample/trace"
 )
 
 const (
 	defConsensusCfgFile = "consensus.yaml"
 	defKeysFile         = "keys.yaml"
 	defUsigEnclaveFile  = "libusig.signed.so"
+	defMaxClockSkew     = 5 * time.Second
+	defMaxTimestampAge  = 30 * time.Second
 )
 
 // runCmd represents the run command
@@ -73,6 +78,66 @@ func init() {
 	must(viper.BindPFlag("usig.enclaveFile",
 		runCmd.Flags().Lookup("usig-enclave-file")))
 
+	runCmd.Flags().String("state-machine", "ledger",
+		"replicated state machine to run (ledger or kv)")
+	must(viper.BindPFlag("replica.stateMachine",
+		runCmd.Flags().Lookup("state-machine")))
+
+	runCmd.Flags().String("ledger-dir", "",
+		"directory to persist ledger blocks in (in-memory ledger if empty)")
+	must(viper.BindPFlag("replica.ledgerDir",
+		runCmd.Flags().Lookup("ledger-dir")))
+
+	runCmd.Flags().String("message-log", "",
+		"file to append messages generated by the replica to, e.g. for audit")
+	must(viper.BindPFlag("replica.messageLog",
+		runCmd.Flags().Lookup("message-log")))
+
+	runCmd.Flags().String("listen", "",
+		"address to listen at if the replica is not among configured peers, e.g. to join by reconfiguration")
+	must(viper.BindPFlag("replica.listen",
+		runCmd.Flags().Lookup("listen")))
+
+	runCmd.Flags().String("trace", "",
+		"file to record network message exchange to, e.g. for peer replay")
+	must(viper.BindPFlag("replica.trace",
+		runCmd.Flags().Lookup("trace")))
+
+	runCmd.Flags().Float64("client-rate", 0,
+		"requests per second to accept from each client (0 means unlimited)")
+	must(viper.BindPFlag("replica.admission.clientRate",
+		runCmd.Flags().Lookup("client-rate")))
+
+	runCmd.Flags().Int("client-burst", 0,
+		"requests to accept from each client at once in excess of the rate")
+	must(viper.BindPFlag("replica.admission.clientBurst",
+		runCmd.Flags().Lookup("client-burst")))
+
+	runCmd.Flags().Float64("rejection-rate", 0,
+		"rejections per second to issue to each client in excess of the burst (0 means unlimited)")
+	must(viper.BindPFlag("replica.admission.rejectionRate",
+		runCmd.Flags().Lookup("rejection-rate")))
+
+	runCmd.Flags().Int("max-inflight", 0,
+		"requests to accept but not yet executed, all clients together (0 means unlimited)")
+	must(viper.BindPFlag("replica.admission.maxInFlight",
+		runCmd.Flags().Lookup("max-inflight")))
+
+	runCmd.Flags().Int("max-operation-size", 0,
+		"size in bytes of the largest operation to accept (0 means unlimited)")
+	must(viper.BindPFlag("replica.admission.maxOperationSize",
+		runCmd.Flags().Lookup("max-operation-size")))
+
+	runCmd.Flags().Duration("max-clock-skew", defMaxClockSkew,
+		"how far the primary's timestamps may be ahead of the local clock (0 means unlimited)")
+	must(viper.BindPFlag("replica.maxClockSkew",
+		runCmd.Flags().Lookup("max-clock-skew")))
+
+	runCmd.Flags().Duration("max-timestamp-age", defMaxTimestampAge,
+		"how far the primary's timestamps may be behind the local clock to commit (0 means unlimited)")
+	must(viper.BindPFlag("replica.maxTimestampAge",
+		runCmd.Flags().Lookup("max-timestamp-age")))
+
 	rootCmd.PersistentFlags().String("logging-level", "", "logging level")
 	must(viper.BindPFlag("logging.level",
 		rootCmd.PersistentFlags().Lookup("logging-level")))
@@ -82,37 +147,25 @@ func init() {
 		rootCmd.PersistentFlags().Lookup("logging-file")))
 }
 
-type replicaStack struct {
-	api.ReplicaConnector
-	api.Authenticator
-	api.RequestConsumer
-}
-
 func run() error {
 	id := uint32(viper.GetInt("replica.id"))
 
-	usigEnclaveFile, err := envsubst.String(viper.GetString("usig.enclaveFile"))
+	auth, err := newReplicaAuthenticator(id)
 	if err != nil {
-		return fmt.Errorf("Failed to parse USIG enclave filename: %s", err)
-	}
-
-	keysFile, err := os.Open(viper.GetString("keys"))
-	if err != nil {
-		return fmt.Errorf("Failed to open keyset file: %s", err)
-	}
-
-	auth, err := authen.NewWithSGXUSIG([]api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}, id, keysFile, usigEnclaveFile)
-	if err != nil {
-		return fmt.Errorf("Failed to create authenticator: %s", err)
+		return err
 	}
 
 	cfg := config.New()
 	cfg.LoadConfig(viper.GetString("consensusConf"))
 
-	ledger := requestconsumer.NewSimpleLedger()
+	consumer, err := newRequestConsumer(viper.GetString("replica.stateMachine"),
+		viper.GetString("replica.ledgerDir"))
+	if err != nil {
+		return err
+	}
 
 	peerAddrs := make(map[uint32]string)
-	var listenAddr string
+	listenAddr := viper.GetString("replica.listen")
 	for _, p := range cfg.Peers() {
 		// avoid connecting back to this replica
 		if uint32(p.ID) == id {
@@ -122,32 +175,89 @@ func run() error {
 		}
 	}
 
-	loggingOpts, err := getLoggingOptions()
+	opts, err := getLoggingOptions()
 	if err != nil {
 		return fmt.Errorf("Failed to create logging options: %s", err)
 	}
 
-	conn := connector.NewReplicaSide()
+	if path := viper.GetString("replica.messageLog"); path != "" {
+		messageLog, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open message log file: %s", err)
+		}
+		opts = append(opts, minbft.WithMessageLogWriter(messageLog))
+	}
+
+	opts = append(opts, minbft.WithAdmissionPolicy(minbft.AdmissionPolicy{
+		ClientRate:       viper.GetFloat64("replica.admission.clientRate"),
+		ClientBurst:      viper.GetInt("replica.admission.clientBurst"),
+		RejectionRate:    viper.GetFloat64("replica.admission.rejectionRate"),
+		MaxInFlight:      viper.GetInt("replica.admission.maxInFlight"),
+		MaxOperationSize: viper.GetInt("replica.admission.maxOperationSize"),
+	}))
+	opts = append(opts, minbft.WithMaxClockSkew(viper.GetDuration("replica.maxClockSkew")))
+	opts = append(opts, minbft.WithMaxTimestampAge(viper.GetDuration("replica.maxTimestampAge")))
+
+	var rec *trace.Recorder
+	if path := viper.GetString("replica.trace"); path != "" {
+		traceFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open trace file: %s", err)
+		}
+		rec = trace.NewRecorder(traceFile)
+	}
+
+	creds, err := loadTLSCredentials(mtls.ReplicaIdentity(id))
+	if err != nil {
+		return err
+	}
 
-	// XXX: The connection destination should be authenticated;
-	// grpc.WithInsecure() option is passed here for simplicity.
-	if err = connector.ConnectManyReplicas(conn, peerAddrs, grpc.WithInsecure()); err != nil {
+	// Refuse peers with incompatible protocol version or configuration
+	hs := handshake.New(id, cfg.Digest(), auth)
+
+	conn := connector.NewReplicaSide(connector.WithHandshake(hs))
+	if err = connectReplicas(conn, peerAddrs, creds); err != nil {
 		return fmt.Errorf("Failed to connect to peers: %s", err)
 	}
+	if listenAddr == "" {
+		return fmt.Errorf("No address to listen at for replica %d", id)
+	}
+
+	// Authenticate, authorize and connect to replicas joined by
+	// reconfiguration
+	replicaSet := server.NewReplicaSet(cfg.N())
+	opts = append(opts, minbft.WithMembershipObserver(auth))
+	for _, o := range membershipObservers(conn, creds, replicaSet) {
+		opts = append(opts, minbft.WithMembershipObserver(o))
+	}
+
+	var replicaConn api.ReplicaConnector = conn
+	if rec != nil {
+		replicaConn = rec.WrapConnector(conn)
+	}
 
-	replica, err := minbft.New(id, cfg, &replicaStack{conn, auth, ledger}, loggingOpts...)
+	stack := minbft.NewStack(replicaConn, auth, consumer)
+
+	replica, err := minbft.New(id, cfg, stack, opts...)
 	if err != nil {
 		return fmt.Errorf("Failed to create replica instance: %s", err)
 	}
-	replicaServer := server.New(replica)
+	if rec != nil {
+		replica = rec.WrapReplica(replica)
+	}
+
+	serverOpts := []server.Option{server.WithHandshake(hs)}
+	if creds != nil {
+		serverOpts = append(serverOpts, server.WithMutualTLS(creds, replicaSet))
+	}
+	replicaServer := server.New(replica, serverOpts...)
 
 	srvErrChan := make(chan error)
 	go func() {
 		defer replicaServer.Stop()
 
-		// XXX: The replica server should authenticate itself;
-		// appropriate gRPC server options are omitted here
-		// for simplicity.
+		// XXX: The replica server does not authenticate itself
+		// unless TLS is enabled.
 		if err := server.ListenAndServe(replicaServer, listenAddr); err != nil {
 			err = fmt.Errorf("Network server failed: %s", err)
 			fmt.Println(err)
@@ -158,6 +268,44 @@ func run() error {
 	return <-srvErrChan
 }
 
+func newReplicaAuthenticator(id uint32) (*authen.Authenticator, error) {
+	usigEnclaveFile, err := envsubst.String(viper.GetString("usig.enclaveFile"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse USIG enclave filename: %s", err)
+	}
+
+	keysFile, err := os.Open(viper.GetString("keys"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open keyset file: %s", err)
+	}
+	defer keysFile.Close()
+
+	auth, err := authen.NewWithSGXUSIG([]api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}, id, keysFile, usigEnclaveFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create authenticator: %s", err)
+	}
+
+	return auth, nil
+}
+
+func newRequestConsumer(name, ledgerDir string) (api.RequestConsumer, error) {
+	switch name {
+	case "ledger":
+		if ledgerDir == "" {
+			return requestconsumer.NewSimpleLedger(), nil
+		}
+		l, err := requestconsumer.NewPersistentSimpleLedger(ledgerDir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open ledger: %s", err)
+		}
+		return l, nil
+	case "kv":
+		return requestconsumer.NewKVStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown state machine: %s", name)
+	}
+}
+
 func getLoggingOptions() ([]minbft.Option, error) {
 	opts := []minbft.Option{}
 
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the internal state of a replica",
+	Long: `
+Query a running replica for its internal state: the current and
+expected view, the membership, the last executed request, requests pending
+execution, the sequence state of each client, and the last UI
+counter accepted from each peer replica.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		replicaID := uint32(viper.GetInt("status.replica"))
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		target, dialOpt, err := replicaAdminEndpoint(cfg, replicaID, uint32(viper.GetInt("status.id")))
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("status.timeout"))
+		defer cancel()
+		st, err := connector.QueryStatus(ctx, target, dialOpt)
+		if err != nil {
+			return fmt.Errorf("Failed to query replica status: %s", err)
+		}
+
+		if viper.GetBool("status.json") {
+			out, err := json.MarshalIndent(st, "", "  ")
+			if err != nil {
+				return fmt.Errorf("Failed to encode replica status: %s", err)
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		return writeReplicaStatus(st)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().Int("replica", 0, "ID of the replica to query")
+	must(viper.BindPFlag("status.replica", statusCmd.Flags().Lookup("replica")))
+
+	statusCmd.Flags().Int("id", 0, "ID of the client to authenticate with TLS as")
+	must(viper.BindPFlag("status.id", statusCmd.Flags().Lookup("id")))
+
+	statusCmd.Flags().Bool("json", false, "output in JSON")
+	must(viper.BindPFlag("status.json", statusCmd.Flags().Lookup("json")))
+
+	statusCmd.Flags().Duration("timeout", defStatusTimeout, "time to wait for the replica to respond")
+	must(viper.BindPFlag("status.timeout", statusCmd.Flags().Lookup("timeout")))
+}
+
+const defStatusTimeout = 5 * time.Second
+
+func writeReplicaStatus(st *api.ReplicaStatus) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Replica:\t%d\n", st.ReplicaID)
+	fmt.Fprintf(w, "Current view:\t%d (primary replica %d)\n", st.CurrentView, st.Primary)
+	if st.ExpectedView != st.CurrentView {
+		fmt.Fprintf(w, "Expected view:\t%d (view change in progress)\n", st.ExpectedView)
+	} else {
+		fmt.Fprintf(w, "Expected view:\t%d\n", st.ExpectedView)
+	}
+	fmt.Fprintf(w, "Membership:\tepoch %d, replicas %v, f=%d\n", st.Epoch, st.Members, st.F)
+	if r := st.LastExecuted; r != nil {
+		fmt.Fprintf(w, "Last executed:\tclient %d, seq %d\n", r.ClientID, r.Seq)
+	} else {
+		fmt.Fprintf(w, "Last executed:\tnone\n")
+	}
+	fmt.Fprintf(w, "Pending requests:\t%d\n", len(st.Pending))
+	for _, r := range st.Pending {
+		fmt.Fprintf(w, "\tclient %d, seq %d\n", r.ClientID, r.Seq)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CLIENT\tACCEPTED\tPREPARED\tCOMMITTED")
+	for _, c := range st.Clients {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", c.ClientID, c.LastAcceptedSeq, c.LastPreparedSeq, c.LastCommittedSeq)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "PEER\tLAST UI COUNTER")
+	for _, p := range st.Peers {
+		fmt.Fprintf(w, "%d\t%d\n", p.ReplicaID, p.LastUICounter)
+	}
+
+	return w.Flush()
+}
+
+// replicaAdminEndpoint returns the gRPC target address of the replica
+// and the option to dial it with, authenticating with TLS as the
+// specified client if configured. The address of a replica joined by
+// reconfiguration is taken from the current membership reported by
+// the replicas.
+func replicaAdminEndpoint(cfg *config.ViperConfiger, replicaID, clientID uint32) (string, grpc.DialOption, error) {
+	var target string
+	for _, p := range cfg.Peers() {
+		if uint32(p.ID) == replicaID {
+			target = p.Addr
+		}
+	}
+	if target == "" {
+		if m, err := queryMembership(cfg, clientID, defStatusTimeout); err == nil {
+			for _, r := range m.Replicas {
+				if r.ID == replicaID {
+					target = r.Address
+				}
+			}
+		}
+	}
+	if target == "" {
+		return "", nil, fmt.Errorf("Unknown replica %d", replicaID)
+	}
+
+	dialOpt, err := replicaAdminDialOption(replicaID, clientID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return target, dialOpt, nil
+}
+
+// replicaAdminDialOption returns the option to dial the replica with,
+// authenticating with TLS as the specified client if configured.
+func replicaAdminDialOption(replicaID, clientID uint32) (grpc.DialOption, error) {
+	creds, err := loadTLSCredentials(mtls.ClientIdentity(clientID))
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		return grpc.WithInsecure(), nil
+	}
+
+	return creds.DialOption(replicaID), nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-labs/minbft/api"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/connector"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/mtls"
+	"github.com/hyperledger-labs/minbft/sample/conn/grpc/server"
+)
+
+func init() {
+	rootCmd.PersistentFlags().Bool("tls", false,
+		"enable mutual TLS authentication of connections")
+	must(viper.BindPFlag("tls.enabled",
+		rootCmd.PersistentFlags().Lookup("tls")))
+
+	rootCmd.PersistentFlags().String("tls-dir", "",
+		"directory with TLS certificates (derived from keyset file if empty)")
+	must(viper.BindPFlag("tls.dir",
+		rootCmd.PersistentFlags().Lookup("tls-dir")))
+}
+
+// loadTLSCredentials returns credentials for mutual TLS
+// authentication of the node with the specified identity, or nil if
+// TLS is not enabled. Credentials are loaded from the directory as
+// generated by `keytool ca` command, or derived from the keyset file
+// if no directory is specified.
+func loadTLSCredentials(self mtls.Identity) (*mtls.Credentials, error) {
+	if !viper.GetBool("tls.enabled") {
+		return nil, nil
+	}
+
+	if dir := viper.GetString("tls.dir"); dir != "" {
+		creds, err := mtls.LoadDir(dir, self)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load TLS credentials: %s", err)
+		}
+		return creds, nil
+	}
+
+	keysFile, err := os.Open(viper.GetString("keys"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open keyset file: %s", err)
+	}
+	defer keysFile.Close()
+
+	ks, err := authen.LoadSimpleKeyStore(keysFile, []api.AuthenticationRole{self.Role}, self.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load keystore: %s", err)
+	}
+
+	creds, err := mtls.FromKeystore(ks, self)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive TLS credentials: %s", err)
+	}
+
+	return creds, nil
+}
+
+// connectReplicas establishes connections to replicas, with mutual
+// TLS authentication if the credentials are not nil.
+func connectReplicas(conn connector.ReplicaConnector, peerAddrs map[uint32]string, creds *mtls.Credentials) error {
+	if creds != nil {
+		return connector.ConnectManyReplicasTLS(conn, peerAddrs, creds)
+	}
+
+	// XXX: The connection destination is not authenticated
+	// unless TLS is enabled.
+	return connector.ConnectManyReplicas(conn, peerAddrs, grpc.WithInsecure())
+}
+
+// membershipObservers returns the observers to connect to replicas
+// joined by reconfiguration, with mutual TLS authentication if the
+// credentials are not nil. In that case, the credentials and the set
+// of replicas to authorize streams from also follow the membership.
+func membershipObservers(conn connector.ReplicaConnector, creds *mtls.Credentials, replicas *server.ReplicaSet) []api.MembershipObserver {
+	if creds != nil {
+		return []api.MembershipObserver{creds, replicas,
+			connector.MembershipObserverTLS(conn, creds)}
+	}
+
+	// XXX: The connection destination is not authenticated
+	// unless TLS is enabled.
+	return []api.MembershipObserver{
+		connector.MembershipObserver(conn, grpc.WithInsecure())}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/client"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/config"
+)
+
+// verifyReplyCmd represents the verify-reply command
+var verifyReplyCmd = &cobra.Command{
+	Use:   "verify-reply certificate-file",
+	Short: "Verify a reply certificate",
+	Long: `
+Verify a reply certificate output by "peer request --certificate"
+against the keyset file, without connecting to replicas. The
+certificate is read from standard input if the file name is "-".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read reply certificate: %s", err)
+		}
+
+		cert := new(client.ReplyCertificate)
+		if err := json.Unmarshal(data, cert); err != nil {
+			return fmt.Errorf("Failed to decode reply certificate: %s", err)
+		}
+
+		keysFile, err := os.Open(viper.GetString("keys"))
+		if err != nil {
+			return fmt.Errorf("Failed to open keyset file: %s", err)
+		}
+		defer keysFile.Close()
+
+		// Only public keys are needed to verify signatures
+		au, err := authen.New(nil, 0, keysFile)
+		if err != nil {
+			return fmt.Errorf("Failed to create authenticator: %s", err)
+		}
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		if err := client.VerifyReplyCertificate(cert, cfg.F(), au); err != nil {
+			return fmt.Errorf("Reply certificate is invalid: %s", err)
+		}
+		fmt.Printf("Reply certificate is valid; result: %s\n", cert.Result)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyReplyCmd)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/config"
+)
+
+// viewChangeCmd represents the view-change command
+var viewChangeCmd = &cobra.Command{
+	Use:   "view-change",
+	Short: "Hand over the leadership to the next primary by reconfiguration",
+	Long: `
+Make replicas move to the next view without waiting for request
+timeouts, e.g. to hand over the leadership before maintenance of the
+primary replica. This is not a view change of the consensus protocol:
+the command submits a reconfiguration request that keeps the current
+membership unchanged, signed with the operator key from the keyset
+file. The request is ordered as any other request, so it requires the
+current primary to be working; once it is executed, all replicas move
+into the next view together, with the next replica as the primary.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		keys, err := ioutil.ReadFile(viper.GetString("keys"))
+		if err != nil {
+			return fmt.Errorf("Failed to read keyset file: %s", err)
+		}
+
+		cfg := config.New()
+		cfg.LoadConfig(viper.GetString("consensusConf"))
+
+		epoch, err := submitReconfiguration(cfg, keys, func(current *api.Membership) *api.Reconfiguration {
+			return &api.Reconfiguration{Epoch: current.Epoch, F: current.F}
+		},
+			uint32(viper.GetInt("view-change.operator")),
+			uint32(viper.GetInt("view-change.id")),
+			viper.GetDuration("view-change.timeout"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Moved to the next view with membership epoch %d\n", epoch)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(viewChangeCmd)
+
+	viewChangeCmd.Flags().Int("operator", 0, "ID of the operator key to sign the request with")
+	must(viper.BindPFlag("view-change.operator", viewChangeCmd.Flags().Lookup("operator")))
+
+	viewChangeCmd.Flags().Int("id", 0, "ID of the client to submit the request as")
+	must(viper.BindPFlag("view-change.id", viewChangeCmd.Flags().Lookup("id")))
+
+	viewChangeCmd.Flags().Duration("timeout", defReconfigurationTimeout, "time to wait for the replicas to move to the next view (0 means no timeout)")
+	must(viper.BindPFlag("view-change.timeout", viewChangeCmd.Flags().Lookup("timeout")))
+}
@@ -0,0 +1,406 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestconsumer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// KVOpType identifies a type of KVStore operation.
+type KVOpType string
+
+// Types of KVStore operations
+const (
+	// KVGet retrieves the value of the key
+	KVGet KVOpType = "get"
+
+	// KVPut sets the value of the key
+	KVPut KVOpType = "put"
+
+	// KVDelete removes the key
+	KVDelete KVOpType = "delete"
+
+	// KVCompareAndSwap sets the value of the key if the current
+	// value equals the expected one
+	KVCompareAndSwap KVOpType = "cas"
+
+	// KVRange retrieves keys in the range together with their
+	// values in ascending order
+	KVRange KVOpType = "range"
+)
+
+// KVOperation is an operation to execute by KVStore. Operations are
+// encoded in JSON to submit as request operations.
+type KVOperation struct {
+	Op  KVOpType `json:"op"`
+	Key string   `json:"key"`
+
+	// Value to set by put and cas operations
+	Value []byte `json:"value,omitempty"`
+
+	// Expected value for cas operation, unless ExpectAbsent is set
+	Expected []byte `json:"expected"`
+
+	// ExpectAbsent indicates that cas operation expects the key to
+	// be absent rather than to have the Expected value
+	ExpectAbsent bool `json:"expectAbsent,omitempty"`
+
+	// End of the key range (exclusive) for range operation; empty
+	// means no upper bound. Key is the start of the range.
+	End string `json:"end,omitempty"`
+
+	// Maximal number of entries to return by range operation; zero
+	// means no limit
+	Limit int `json:"limit,omitempty"`
+}
+
+// KVEntry is a key-value pair.
+type KVEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// KVResult is a result of KVStore operation execution. Results are
+// encoded in JSON.
+type KVResult struct {
+	// Found indicates if the key existed before execution of get,
+	// delete, or cas operation
+	Found bool `json:"found,omitempty"`
+
+	// Value is the value of the key for get operation, or the
+	// current value of the key if cas operation fails
+	Value []byte `json:"value,omitempty"`
+
+	// Swapped indicates if cas operation has succeeded
+	Swapped bool `json:"swapped,omitempty"`
+
+	// Entries returned by range operation
+	Entries []KVEntry `json:"entries,omitempty"`
+}
+
+// KVStore implements `RequestConsumer` interface. It maintains a
+// simple in-memory key-value store modified by operations encoded as
+// KVOperation in JSON.
+type KVStore struct {
+	sync.RWMutex
+	entries map[string][]byte
+	keys    []string // sorted
+}
+
+var (
+	_ api.Snapshotter        = (*KVStore)(nil)
+	_ api.ConflictKeyer      = (*KVStore)(nil)
+	_ api.OperationValidator = (*KVStore)(nil)
+	_ api.StatusConsumer     = (*KVStore)(nil)
+)
+
+// NewKVStore initializes an object of KVStore
+func NewKVStore() *KVStore {
+	return &KVStore{
+		entries: make(map[string][]byte),
+	}
+}
+
+// Deliver implements the RequestConsumer interface. It executes the
+// operation and returns the result encoded as KVResult in JSON.
+// Operations that cannot be executed produce an empty result.
+func (s *KVStore) Deliver(op []byte) <-chan []byte {
+	resultChan := make(chan []byte, 1)
+	resultChan <- (<-s.DeliverWithStatus(op, api.ExecutionInput{})).Result
+
+	return resultChan
+}
+
+// DeliverWithStatus implements the api.StatusConsumer interface. It
+// is the same as Deliver, except malformed and unknown operations, as
+// well as operations with invalid arguments, are reported as failed.
+func (s *KVStore) DeliverWithStatus(op []byte, input api.ExecutionInput) <-chan api.ExecutionResult {
+	resultChan := make(chan api.ExecutionResult, 1)
+
+	kvOp := new(KVOperation)
+	if err := json.Unmarshal(op, kvOp); err != nil {
+		resultChan <- api.ExecutionResult{Error: fmt.Errorf("malformed operation: %s", err)}
+		return resultChan
+	}
+
+	res, err := s.execute(kvOp)
+	if err != nil {
+		resultChan <- api.ExecutionResult{Error: err}
+		return resultChan
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+	resultChan <- api.ExecutionResult{Result: resJSON}
+
+	return resultChan
+}
+
+// ConflictKeys implements the api.ConflictKeyer interface. Operations
+// on a single key conflict only with operations writing the same
+// key. Range operations and malformed operations conflict with all
+// operations.
+func (s *KVStore) ConflictKeys(op []byte) (reads, writes []string, ok bool) {
+	kvOp := new(KVOperation)
+	if err := json.Unmarshal(op, kvOp); err != nil {
+		return nil, nil, false
+	}
+
+	switch kvOp.Op {
+	case KVGet:
+		return []string{kvOp.Key}, nil, true
+	case KVPut, KVDelete, KVCompareAndSwap:
+		return nil, []string{kvOp.Key}, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// ValidateOperation implements the api.OperationValidator interface.
+// Operations are valid if encoded as KVOperation in JSON with a known
+// operation type and valid arguments, i.e. a non-negative range limit
+// and no expected value for cas operation expecting the key to be
+// absent.
+func (s *KVStore) ValidateOperation(op []byte) error {
+	kvOp := new(KVOperation)
+	if err := json.Unmarshal(op, kvOp); err != nil {
+		return fmt.Errorf("malformed operation: %s", err)
+	}
+
+	switch kvOp.Op {
+	case KVGet, KVPut, KVDelete:
+	case KVCompareAndSwap:
+		if kvOp.ExpectAbsent && len(kvOp.Expected) != 0 {
+			return fmt.Errorf("expected value for absent key")
+		}
+	case KVRange:
+		if kvOp.Limit < 0 {
+			return fmt.Errorf("invalid range limit: %d", kvOp.Limit)
+		}
+	default:
+		return fmt.Errorf("unknown operation: %q", kvOp.Op)
+	}
+
+	return nil
+}
+
+// StateDigest returns the hash of all key-value pairs in the key
+// order as the digest of the system state
+func (s *KVStore) StateDigest() []byte {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.stateDigest()
+}
+
+func (s *KVStore) stateDigest() []byte {
+	h := sha256.New()
+	for _, k := range s.keys {
+		writeLengthPrefixed(h, []byte(k))
+		writeLengthPrefixed(h, s.entries[k])
+	}
+
+	return h.Sum(nil)
+}
+
+// Snapshot implements the api.Snapshotter interface. Each chunk
+// consists of key-value pairs in the key order, both key and value
+// prefixed with 8-byte big-endian length.
+func (s *KVStore) Snapshot() (api.Snapshot, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Values are never modified, only replaced
+	keys := append([]string(nil), s.keys...)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = s.entries[k]
+	}
+
+	next := func() []byte {
+		var buf bytes.Buffer
+		for len(keys) > 0 && buf.Len() < snapshotChunkSize {
+			writeLengthPrefixed(&buf, []byte(keys[0]))
+			writeLengthPrefixed(&buf, values[0])
+			keys, values = keys[1:], values[1:]
+		}
+		if buf.Len() == 0 {
+			return nil
+		}
+		return buf.Bytes()
+	}
+
+	return &snapshot{s.stateDigest(), next}, nil
+}
+
+// Restore implements the api.Snapshotter interface.
+func (s *KVStore) Restore(snap api.Snapshot) error {
+	entries := make(map[string][]byte)
+	var keys []string
+	err := forEachChunk(snap, func(chunk []byte) error {
+		for r := bytes.NewReader(chunk); r.Len() > 0; {
+			k, err := readLengthPrefixed(r)
+			if err != nil {
+				return fmt.Errorf("entry %d: key: %s", len(keys)+1, err)
+			}
+			v, err := readLengthPrefixed(r)
+			if err != nil {
+				return fmt.Errorf("entry %d: value: %s", len(keys)+1, err)
+			}
+
+			key := string(k)
+			if len(keys) > 0 && key <= keys[len(keys)-1] {
+				return fmt.Errorf("entry %d: keys out of order", len(keys)+1)
+			}
+			keys = append(keys, key)
+			entries[key] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %s", err)
+	}
+
+	restored := &KVStore{entries: entries, keys: keys}
+	if !bytes.Equal(restored.stateDigest(), snap.Digest()) {
+		return fmt.Errorf("snapshot digest mismatch")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.entries, s.keys = entries, keys
+
+	return nil
+}
+
+// Get returns the value of the key and whether the key exists.
+func (s *KVStore) Get(key string) ([]byte, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	val, ok := s.entries[key]
+	return val, ok
+}
+
+// Len returns the number of keys in the store.
+func (s *KVStore) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.keys)
+}
+
+func (s *KVStore) execute(op *KVOperation) (*KVResult, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	res := new(KVResult)
+
+	switch op.Op {
+	case KVGet:
+		res.Value, res.Found = s.entries[op.Key]
+	case KVPut:
+		s.put(op.Key, op.Value)
+	case KVDelete:
+		if _, res.Found = s.entries[op.Key]; res.Found {
+			s.delete(op.Key)
+		}
+	case KVCompareAndSwap:
+		if op.ExpectAbsent && len(op.Expected) != 0 {
+			return nil, fmt.Errorf("expected value for absent key")
+		}
+		var cur []byte
+		cur, res.Found = s.entries[op.Key]
+		if (op.ExpectAbsent && !res.Found) ||
+			(!op.ExpectAbsent && res.Found && bytes.Equal(cur, op.Expected)) {
+			s.put(op.Key, op.Value)
+			res.Swapped = true
+		} else {
+			res.Value = cur
+		}
+	case KVRange:
+		if op.Limit < 0 {
+			return nil, fmt.Errorf("invalid range limit: %d", op.Limit)
+		}
+		i := sort.SearchStrings(s.keys, op.Key)
+		for ; i < len(s.keys); i++ {
+			k := s.keys[i]
+			if (op.End != "" && k >= op.End) || (op.Limit != 0 && len(res.Entries) == op.Limit) {
+				break
+			}
+			res.Entries = append(res.Entries, KVEntry{k, s.entries[k]})
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation: %q", op.Op)
+	}
+
+	return res, nil
+}
+
+func (s *KVStore) put(key string, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+
+	if _, ok := s.entries[key]; !ok {
+		i := sort.SearchStrings(s.keys, key)
+		s.keys = append(s.keys, "")
+		copy(s.keys[i+1:], s.keys[i:])
+		s.keys[i] = key
+	}
+	s.entries[key] = value
+}
+
+func (s *KVStore) delete(key string) {
+	delete(s.entries, key)
+
+	i := sort.SearchStrings(s.keys, key)
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+}
+
+func writeLengthPrefixed(w io.Writer, b []byte) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+	_, _ = w.Write(l[:])
+	_, _ = w.Write(b)
+}
+
+func readLengthPrefixed(r *bytes.Reader) ([]byte, error) {
+	var l [8]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, fmt.Errorf("incomplete length")
+	}
+
+	n := binary.BigEndian.Uint64(l[:])
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("incomplete data")
+	}
+	b := make([]byte, n)
+	_, _ = io.ReadFull(r, b)
+
+	return b, nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestconsumer
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The Merkle tree over the blocks of SimpleLedger follows the
+// structure defined in RFC 6962, section 2.1: leaves and internal
+// nodes are hashed with distinct prefixes, and a tree of n leaves
+// is split into a complete left subtree of the largest power of two
+// less than n leaves and the right subtree of the remaining leaves.
+const (
+	leafHashPrefix = 0x00
+	nodeHashPrefix = 0x01
+)
+
+// InclusionProof proves that a block is included in the ledger
+// consisting of TreeSize blocks. Path is the list of sibling hashes
+// from the block's leaf up to the root of the Merkle tree.
+type InclusionProof struct {
+	Height   uint64
+	TreeSize uint64
+	Path     [][]byte
+}
+
+// VerifyInclusionProof checks that the block is included in the
+// ledger with the state digest, as proven by the inclusion proof.
+func VerifyInclusionProof(block *SimpleBlock, proof *InclusionProof, digest []byte) error {
+	if block.Height != proof.Height {
+		return fmt.Errorf("block height %d does not match proof height %d",
+			block.Height, proof.Height)
+	}
+	if proof.Height == 0 || proof.Height > proof.TreeSize {
+		return fmt.Errorf("block height %d out of range for tree size %d",
+			proof.Height, proof.TreeSize)
+	}
+
+	blockBytes, err := block.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %s", err)
+	}
+
+	// Algorithm from RFC 9162, section 2.1.3.2
+	fn, sn := proof.Height-1, proof.TreeSize-1
+	r := merkleLeafHash(blockBytes)
+	for _, p := range proof.Path {
+		if sn == 0 {
+			return fmt.Errorf("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return fmt.Errorf("inclusion proof too short")
+	}
+
+	if !bytes.Equal(r, digest) {
+		return fmt.Errorf("state digest mismatch")
+	}
+
+	return nil
+}
+
+// merkleAccumulator incrementally computes the root of the Merkle
+// tree as leaves are appended. It keeps the roots of the complete
+// subtrees, one for each bit set in the number of leaves, with the
+// largest subtree first.
+type merkleAccumulator struct {
+	size  uint64
+	peaks [][]byte
+}
+
+func (a *merkleAccumulator) append(leaf []byte) {
+	h := leaf
+	for s := a.size; s&1 == 1; s >>= 1 {
+		last := len(a.peaks) - 1
+		h = merkleNodeHash(a.peaks[last], h)
+		a.peaks = a.peaks[:last]
+	}
+	a.peaks = append(a.peaks, h)
+	a.size++
+}
+
+// root returns the root of the Merkle tree, or nil if there are no
+// leaves.
+func (a *merkleAccumulator) root() []byte {
+	if len(a.peaks) == 0 {
+		return nil
+	}
+
+	r := a.peaks[len(a.peaks)-1]
+	for i := len(a.peaks) - 2; i >= 0; i-- {
+		r = merkleNodeHash(a.peaks[i], r)
+	}
+	return r
+}
+
+// merkleRoot computes the root of the Merkle tree over the leaf
+// hashes, or nil if there are no leaves.
+func merkleRoot(leaves [][]byte) []byte {
+	switch n := len(leaves); n {
+	case 0:
+		return nil
+	case 1:
+		return leaves[0]
+	default:
+		k := splitPoint(n)
+		return merkleNodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+	}
+}
+
+// merklePath computes the inclusion proof path for the m-th leaf of
+// the Merkle tree over the leaf hashes.
+func merklePath(m int, leaves [][]byte) [][]byte {
+	n := len(leaves)
+	if n <= 1 {
+		return nil
+	}
+
+	k := splitPoint(n)
+	if m < k {
+		return append(merklePath(m, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merklePath(m-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// splitPoint returns the largest power of two less than n, n > 1.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleLeafHash(data []byte) []byte {
+	h := blockHashAlgo.New()
+	_, _ = h.Write([]byte{leafHashPrefix})
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	h := blockHashAlgo.New()
+	_, _ = h.Write([]byte{nodeHashPrefix})
+	_, _ = h.Write(left)
+	_, _ = h.Write(right)
+	return h.Sum(nil)
+}
@@ -18,10 +18,19 @@
 package requestconsumer
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
 )
 
 var (
@@ -89,7 +98,435 @@ func testSimpleLedger(t *testing.T) {
 	}
 }
 
+func testPersistentSimpleLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Nil(t, l.Block(1))
+
+	n := 3
+	block := mockBlock(nil, testMessage)
+	for i := 0; i < n; i++ {
+		assert.Equal(t, mockResult(block), <-l.Deliver(testMessage))
+		block = mockBlock(block, testMessage)
+	}
+	digest := l.StateDigest()
+	require.NoError(t, l.Close())
+
+	r, err := ReadSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Equal(t, digest, r.StateDigest())
+
+	// Blocks are restored and the chain is continued once the
+	// operations are delivered again
+	l, err = NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(n), l.length)
+	assert.Equal(t, digest, l.StateDigest())
+	assert.Nil(t, l.Block(0))
+	assert.Equal(t, uint64(2), l.Block(2).Height)
+	assert.Nil(t, l.Block(uint64(n+1)))
+	for i := 1; i <= n; i++ {
+		assert.Equal(t, mockResult(l.Block(uint64(i))), <-l.Deliver(testMessage))
+	}
+	assert.Equal(t, uint64(n), l.GetLength())
+	assert.Equal(t, digest, l.StateDigest())
+	assert.Equal(t, mockResult(block), <-l.Deliver(testMessage))
+	require.NoError(t, l.Close())
+
+	// Operations delivered again have to match the blocks
+	l, err = NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Panics(t, func() { l.redeliver([]byte("other")) })
+	require.NoError(t, l.Close())
+
+	// Incomplete record at the end of the file is discarded
+	path := filepath.Join(dir, segmentFileName)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path, data[:len(data)-1], 0644))
+	l, err = NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(n), l.length)
+	for i := 1; i <= n; i++ {
+		<-l.Deliver(testMessage)
+	}
+	block = mockBlock(l.Block(uint64(n)), testMessage)
+	assert.Equal(t, mockResult(block), <-l.Deliver(testMessage))
+	require.NoError(t, l.Close())
+
+	// Broken chain of blocks is detected
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	firstLen := recordHeaderSize + len(mustMarshal(t, l.Block(1)))
+	data[firstLen-1] ^= 0xff // last byte of the first block payload
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+	_, err = NewPersistentSimpleLedger(dir)
+	assert.Error(t, err)
+
+	// Oversized record is refused rather than allocated
+	data[firstLen-1] ^= 0xff
+	binary.BigEndian.PutUint32(data, maxRecordSize+1)
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+	_, err = NewPersistentSimpleLedger(dir)
+	assert.Error(t, err)
+}
+
+func testSimpleLedgerInclusionProof(t *testing.T) {
+	l := NewSimpleLedger()
+
+	n := 17
+	var digests [][]byte
+	for i := 0; i < n; i++ {
+		<-l.Deliver([]byte{byte(i)})
+		digests = append(digests, l.StateDigest())
+	}
+
+	leaf := merkleLeafHash(mustMarshal(t, l.Block(1)))
+	assert.Equal(t, leaf, digests[0])
+
+	for size := 1; size <= n; size++ {
+		digest, err := l.StateDigestAt(uint64(size))
+		require.NoError(t, err)
+		assert.Equal(t, digests[size-1], digest, "tree size %d", size)
+
+		for h := 1; h <= size; h++ {
+			proof, err := l.ProveInclusion(uint64(h), uint64(size))
+			require.NoError(t, err)
+			block := l.Block(uint64(h))
+			assert.NoError(t, VerifyInclusionProof(block, proof, digest),
+				"height %d, tree size %d", h, size)
+
+			if size > 1 {
+				other := l.Block(uint64(h%size + 1))
+				assert.Error(t, VerifyInclusionProof(other, proof, digest))
+			}
+			if size < n {
+				assert.Error(t, VerifyInclusionProof(block, proof, digests[size]))
+			}
+		}
+	}
+
+	proof, err := l.ProveInclusion(5, uint64(n))
+	require.NoError(t, err)
+	block := l.Block(5)
+	tampered := *block
+	tampered.Payload = []byte("tampered")
+	assert.Error(t, VerifyInclusionProof(&tampered, proof, l.StateDigest()))
+
+	short := *proof
+	short.Path = proof.Path[1:]
+	assert.Error(t, VerifyInclusionProof(block, &short, l.StateDigest()))
+	long := *proof
+	long.Path = append(proof.Path, proof.Path[0])
+	assert.Error(t, VerifyInclusionProof(block, &long, l.StateDigest()))
+
+	_, err = l.ProveInclusion(0, uint64(n))
+	assert.Error(t, err)
+	_, err = l.ProveInclusion(5, 4)
+	assert.Error(t, err)
+	_, err = l.ProveInclusion(5, uint64(n+1))
+	assert.Error(t, err)
+}
+
+func testSimpleLedgerSnapshot(t *testing.T) {
+	l := NewSimpleLedger()
+
+	// Snapshot includes delivered messages not yet processed
+	n := 20
+	payload := make([]byte, 10<<10)
+	for i := 0; i < n; i++ {
+		l.Deliver(payload)
+	}
+	snap, err := l.Snapshot()
+	require.NoError(t, err)
+	digest := l.StateDigest()
+	assert.Equal(t, digest, snap.Digest())
+	assert.Equal(t, uint64(n), l.GetLength())
+
+	// Snapshot is not affected by further execution
+	next := <-l.Deliver(testMessage)
+	chunks := readChunks(t, snap)
+	assert.True(t, len(chunks) > 1, "expected several chunks")
+
+	restored := NewSimpleLedger()
+	require.NoError(t, restored.Restore(&testSnapshot{digest, chunks}))
+	assert.Equal(t, digest, restored.StateDigest())
+	assert.Equal(t, l.Block(uint64(n)), restored.Block(uint64(n)))
+	assert.Equal(t, next, <-restored.Deliver(testMessage))
+	assert.Equal(t, l.StateDigest(), restored.StateDigest())
+
+	// Empty ledger
+	empty, err := NewSimpleLedger().Snapshot()
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(empty))
+	assert.Nil(t, restored.StateDigest())
+	assert.Equal(t, uint64(0), restored.GetLength())
+
+	// Malformed snapshots leave the state intact
+	other := NewSimpleLedger()
+	<-other.Deliver(testMessage)
+	otherDigest := other.StateDigest()
+	assert.Error(t, other.Restore(&testSnapshot{otherDigest, chunks}))
+	assert.Error(t, other.Restore(&testSnapshot{digest, chunks[1:]}))
+	truncated := append(chunks[:len(chunks)-1:len(chunks)-1],
+		chunks[len(chunks)-1][:10])
+	assert.Error(t, other.Restore(&testSnapshot{digest, truncated}))
+	assert.Equal(t, otherDigest, other.StateDigest())
+
+	// Restored blocks are persisted
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	p, err := NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	<-p.Deliver([]byte("to be replaced"))
+	require.NoError(t, p.Restore(&testSnapshot{digest, chunks}))
+	assert.Equal(t, next, <-p.Deliver(testMessage))
+	require.NoError(t, p.Close())
+	p, err = NewPersistentSimpleLedger(dir)
+	require.NoError(t, err)
+	assert.Equal(t, l.StateDigest(), p.StateDigest())
+	require.NoError(t, p.Close())
+}
+
+type testSnapshot struct {
+	digest []byte
+	chunks [][]byte
+}
+
+func (s *testSnapshot) Digest() []byte {
+	return s.digest
+}
+
+func (s *testSnapshot) NextChunk() ([]byte, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func readChunks(t *testing.T, snap api.Snapshot) [][]byte {
+	var chunks [][]byte
+	for {
+		chunk, err := snap.NextChunk()
+		if err == io.EOF {
+			return chunks
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, chunk)
+	}
+}
+
+func mustMarshal(t *testing.T, block *SimpleBlock) []byte {
+	data, err := block.MarshalBinary()
+	require.NoError(t, err)
+	return data
+}
+
+func kvExecute(t *testing.T, s *KVStore, op *KVOperation) *KVResult {
+	opJSON, err := json.Marshal(op)
+	require.NoError(t, err)
+
+	res := new(KVResult)
+	require.NoError(t, json.Unmarshal(<-s.Deliver(opJSON), res))
+	return res
+}
+
+func testKVStore(t *testing.T) {
+	s := NewKVStore()
+	emptyDigest := s.StateDigest()
+
+	res := kvExecute(t, s, &KVOperation{Op: KVGet, Key: "a"})
+	assert.Equal(t, &KVResult{}, res)
+
+	for _, k := range []string{"c", "a", "b", "d"} {
+		res = kvExecute(t, s, &KVOperation{Op: KVPut, Key: k, Value: []byte("val-" + k)})
+		assert.Equal(t, &KVResult{}, res)
+	}
+	assert.Equal(t, 4, s.Len())
+
+	res = kvExecute(t, s, &KVOperation{Op: KVGet, Key: "a"})
+	assert.Equal(t, &KVResult{Found: true, Value: []byte("val-a")}, res)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVRange, Key: "b", End: "d"})
+	assert.Equal(t, []KVEntry{{"b", []byte("val-b")}, {"c", []byte("val-c")}}, res.Entries)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVRange, Limit: 3})
+	assert.Equal(t, []KVEntry{{"a", []byte("val-a")}, {"b", []byte("val-b")}, {"c", []byte("val-c")}}, res.Entries)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "a", Expected: []byte("wrong"), Value: []byte("new")})
+	assert.Equal(t, &KVResult{Found: true, Value: []byte("val-a")}, res)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "a", Expected: []byte("val-a"), Value: []byte("new")})
+	assert.Equal(t, &KVResult{Found: true, Swapped: true}, res)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "e", Value: []byte("val-e"), ExpectAbsent: true})
+	assert.Equal(t, &KVResult{Swapped: true}, res)
+
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "e", Value: []byte("other"), ExpectAbsent: true})
+	assert.Equal(t, &KVResult{Found: true, Value: []byte("val-e")}, res)
+
+	// Empty expected value is not the same as absent key
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "f", Expected: []byte{}, Value: []byte("val-f")})
+	assert.Equal(t, &KVResult{}, res)
+	res = kvExecute(t, s, &KVOperation{Op: KVPut, Key: "f", Value: []byte{}})
+	assert.Equal(t, &KVResult{}, res)
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "f", Value: []byte("val-f"), ExpectAbsent: true})
+	assert.Equal(t, &KVResult{Found: true}, res)
+	res = kvExecute(t, s, &KVOperation{Op: KVCompareAndSwap, Key: "f", Expected: []byte{}, Value: []byte("val-f")})
+	assert.Equal(t, &KVResult{Found: true, Swapped: true}, res)
+
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		res = kvExecute(t, s, &KVOperation{Op: KVDelete, Key: k})
+		assert.Equal(t, &KVResult{Found: true}, res)
+	}
+	res = kvExecute(t, s, &KVOperation{Op: KVDelete, Key: "a"})
+	assert.Equal(t, &KVResult{}, res)
+	assert.Equal(t, 0, s.Len())
+	assert.Equal(t, emptyDigest, s.StateDigest())
+
+	for _, op := range []*KVOperation{{Op: "unknown"}, {Op: KVRange, Limit: -1}, {Op: KVCompareAndSwap, Expected: []byte("val"), ExpectAbsent: true}} {
+		opJSON, err := json.Marshal(op)
+		require.NoError(t, err)
+		status := <-s.DeliverWithStatus(opJSON, api.ExecutionInput{})
+		assert.Error(t, status.Error, "operation %q", op.Op)
+		assert.Nil(t, status.Result, "operation %q", op.Op)
+	}
+
+	status := <-s.DeliverWithStatus([]byte("malformed"), api.ExecutionInput{})
+	assert.Error(t, status.Error)
+	assert.Empty(t, <-s.Deliver([]byte("malformed")))
+}
+
+func testKVStoreDigest(t *testing.T) {
+	s1, s2 := NewKVStore(), NewKVStore()
+
+	// Same state reached in different order
+	kvExecute(t, s1, &KVOperation{Op: KVPut, Key: "a", Value: []byte("1")})
+	kvExecute(t, s1, &KVOperation{Op: KVPut, Key: "b", Value: []byte("2")})
+	kvExecute(t, s2, &KVOperation{Op: KVPut, Key: "b", Value: []byte("2")})
+	kvExecute(t, s2, &KVOperation{Op: KVPut, Key: "c", Value: []byte("3")})
+	kvExecute(t, s2, &KVOperation{Op: KVPut, Key: "a", Value: []byte("1")})
+	kvExecute(t, s2, &KVOperation{Op: KVDelete, Key: "c"})
+	assert.Equal(t, s1.StateDigest(), s2.StateDigest())
+
+	// Key and value boundaries are unambiguous
+	s1, s2 = NewKVStore(), NewKVStore()
+	kvExecute(t, s1, &KVOperation{Op: KVPut, Key: "ab", Value: []byte("c")})
+	kvExecute(t, s2, &KVOperation{Op: KVPut, Key: "a", Value: []byte("bc")})
+	assert.NotEqual(t, s1.StateDigest(), s2.StateDigest())
+}
+
+func testKVStoreSnapshot(t *testing.T) {
+	s := NewKVStore()
+
+	n := 1000
+	value := make([]byte, 100)
+	for i := 0; i < n; i++ {
+		kvExecute(t, s, &KVOperation{Op: KVPut, Key: fmt.Sprintf("key%04d", i), Value: value})
+	}
+	kvExecute(t, s, &KVOperation{Op: KVPut, Key: "empty"})
+
+	snap, err := s.Snapshot()
+	require.NoError(t, err)
+	digest := s.StateDigest()
+	assert.Equal(t, digest, snap.Digest())
+
+	// Snapshot is not affected by further execution
+	kvExecute(t, s, &KVOperation{Op: KVDelete, Key: "key0000"})
+	kvExecute(t, s, &KVOperation{Op: KVPut, Key: "key0001", Value: []byte("new")})
+	chunks := readChunks(t, snap)
+	assert.True(t, len(chunks) > 1, "expected several chunks")
+
+	restored := NewKVStore()
+	kvExecute(t, restored, &KVOperation{Op: KVPut, Key: "to be replaced"})
+	require.NoError(t, restored.Restore(&testSnapshot{digest, chunks}))
+	assert.Equal(t, digest, restored.StateDigest())
+	assert.Equal(t, n+1, restored.Len())
+	v, ok := restored.Get("key0001")
+	assert.True(t, ok)
+	assert.Equal(t, value, v)
+	v, ok = restored.Get("empty")
+	assert.True(t, ok)
+	assert.Empty(t, v)
+
+	// Restored store continues execution
+	kvExecute(t, restored, &KVOperation{Op: KVDelete, Key: "key0000"})
+	kvExecute(t, restored, &KVOperation{Op: KVPut, Key: "key0001", Value: []byte("new")})
+	assert.Equal(t, s.StateDigest(), restored.StateDigest())
+
+	// Malformed snapshots leave the state intact
+	other := NewKVStore()
+	otherDigest := other.StateDigest()
+	assert.Error(t, other.Restore(&testSnapshot{otherDigest, chunks}))
+	reordered := [][]byte{chunks[1], chunks[0]}
+	assert.Error(t, other.Restore(&testSnapshot{digest, append(reordered, chunks[2:]...)}))
+	assert.Error(t, other.Restore(&testSnapshot{digest, [][]byte{chunks[0][:20]}}))
+	assert.Equal(t, otherDigest, other.StateDigest())
+	assert.Equal(t, 0, other.Len())
+}
+
+func testKVStoreConflictKeys(t *testing.T) {
+	s := NewKVStore()
+
+	conflictKeys := func(op *KVOperation) (reads, writes []string, ok bool) {
+		opJSON, err := json.Marshal(op)
+		require.NoError(t, err)
+		return s.ConflictKeys(opJSON)
+	}
+
+	reads, writes, ok := conflictKeys(&KVOperation{Op: KVGet, Key: "a"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a"}, reads)
+	assert.Empty(t, writes)
+
+	for _, op := range []KVOpType{KVPut, KVDelete, KVCompareAndSwap} {
+		reads, writes, ok = conflictKeys(&KVOperation{Op: op, Key: "a"})
+		assert.True(t, ok)
+		assert.Empty(t, reads)
+		assert.Equal(t, []string{"a"}, writes)
+	}
+
+	_, _, ok = conflictKeys(&KVOperation{Op: KVRange})
+	assert.False(t, ok)
+	_, _, ok = s.ConflictKeys([]byte("malformed"))
+	assert.False(t, ok)
+}
+
+func testKVStoreValidateOperation(t *testing.T) {
+	s := NewKVStore()
+
+	validate := func(op *KVOperation) error {
+		opJSON, err := json.Marshal(op)
+		require.NoError(t, err)
+		return s.ValidateOperation(opJSON)
+	}
+
+	for _, op := range []KVOpType{KVGet, KVPut, KVDelete, KVCompareAndSwap, KVRange} {
+		assert.NoError(t, validate(&KVOperation{Op: op, Key: "a"}))
+	}
+
+	assert.Error(t, validate(&KVOperation{Op: KVRange, Limit: -1}))
+	assert.Error(t, validate(&KVOperation{Op: KVCompareAndSwap, Key: "a", Expected: []byte("val"), ExpectAbsent: true}))
+	assert.Error(t, validate(&KVOperation{Op: "unknown"}))
+	assert.Error(t, s.ValidateOperation([]byte("malformed")))
+}
+
 func TestRequestConsumer(t *testing.T) {
 	t.Run("SimpleBlockMarshaler", testSimpleBlockMarshaler)
 	t.Run("SimpleLedger", testSimpleLedger)
+	t.Run("PersistentSimpleLedger", testPersistentSimpleLedger)
+	t.Run("SimpleLedgerInclusionProof", testSimpleLedgerInclusionProof)
+	t.Run("SimpleLedgerSnapshot", testSimpleLedgerSnapshot)
+	t.Run("KVStore", testKVStore)
+	t.Run("KVStoreDigest", testKVStoreDigest)
+	t.Run("KVStoreSnapshot", testKVStoreSnapshot)
+	t.Run("KVStoreConflictKeys", testKVStoreConflictKeys)
+	t.Run("KVStoreValidateOperation", testKVStoreValidateOperation)
 }
@@ -0,0 +1,271 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestconsumer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// segmentFileName is the name of the file in the ledger
+	// directory to store blocks in
+	segmentFileName = "blocks.seg"
+
+	recordHeaderSize = 4
+
+	// maxRecordSize limits the size of a single record so that a
+	// corrupted header cannot cause an excessive allocation
+	maxRecordSize = 64 << 20
+)
+
+// segmentFile is an append-only file of blocks. Each block is stored
+// as a record consisting of 4-byte big-endian length followed by the
+// output of SimpleBlock.MarshalBinary.
+type segmentFile struct {
+	path string
+	f    *os.File
+}
+
+// openSegmentFile opens the segment file in the directory, creating
+// the directory and the file if necessary, and loads the stored
+// blocks. The chain of blocks is verified. An incomplete record at
+// the end of the file, e.g. left after a crash, is discarded.
+func openSegmentFile(dir string) (*segmentFile, []*SimpleBlock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create ledger directory: %s", err)
+	}
+
+	path := filepath.Join(dir, segmentFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open segment file: %s", err)
+	}
+
+	blocks, size, err := loadBlocks(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to load blocks from %s: %s", path, err)
+	}
+
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to truncate segment file: %s", err)
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to seek segment file: %s", err)
+	}
+
+	return &segmentFile{path, f}, blocks, nil
+}
+
+// readSegmentFile loads the blocks stored in the segment file in the
+// directory without modifying the file. The chain of blocks is
+// verified; an incomplete record at the end of the file is ignored.
+func readSegmentFile(dir string) ([]*SimpleBlock, error) {
+	path := filepath.Join(dir, segmentFileName)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment file: %s", err)
+	}
+	defer f.Close()
+
+	blocks, _, err := loadBlocks(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocks from %s: %s", path, err)
+	}
+
+	return blocks, nil
+}
+
+// loadBlocks reads and verifies blocks from the segment file. It
+// returns the blocks together with the size of the complete records.
+func loadBlocks(r io.Reader) (blocks []*SimpleBlock, size int64, err error) {
+	rd := bufio.NewReader(r)
+	var prev *SimpleBlock
+
+	for {
+		var hdr [recordHeaderSize]byte
+		if n, err := io.ReadFull(rd, hdr[:]); err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			log.Printf("Discarding incomplete record header of %d bytes", n)
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		recSize := binary.BigEndian.Uint32(hdr[:])
+		if recSize > maxRecordSize {
+			return nil, 0, fmt.Errorf("block %d: record size %d exceeds limit of %d bytes",
+				len(blocks)+1, recSize, maxRecordSize)
+		}
+
+		rec := make([]byte, recSize)
+		if n, err := io.ReadFull(rd, rec); err == io.ErrUnexpectedEOF || err == io.EOF {
+			log.Printf("Discarding incomplete record of %d out of %d bytes", n, len(rec))
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		block := new(SimpleBlock)
+		if err := block.UnmarshalBinary(rec); err != nil {
+			return nil, 0, fmt.Errorf("block %d: %s", len(blocks)+1, err)
+		}
+		if err := verifyBlock(block, prev); err != nil {
+			return nil, 0, err
+		}
+
+		blocks = append(blocks, block)
+		size += int64(recordHeaderSize + len(rec))
+		prev = block
+	}
+
+	return blocks, size, nil
+}
+
+// verifyBlock checks that the block correctly follows the previous
+// block; prev is nil for the first block.
+func verifyBlock(block, prev *SimpleBlock) error {
+	var height uint64 = 1
+	var prevHash []byte
+	if prev != nil {
+		height = prev.Height + 1
+		prevHash = prev.Hash()
+	}
+
+	if block.Height != height {
+		return fmt.Errorf("unexpected block height %d, expected %d", block.Height, height)
+	}
+	if !bytes.Equal(block.PrevBlockHash, prevHash) {
+		return fmt.Errorf("block %d: previous block hash mismatch", block.Height)
+	}
+
+	return nil
+}
+
+// append durably stores the block at the end of the file.
+func (s *segmentFile) append(block *SimpleBlock) error {
+	rec, err := encodeBlockRecord(block)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.f.Write(rec); err != nil {
+		return err
+	}
+
+	return s.f.Sync()
+}
+
+// replace durably replaces the content of the file with the blocks.
+// The new content is written to a temporary file first, which then
+// atomically replaces the segment file.
+func (s *segmentFile) replace(blocks []*SimpleBlock) error {
+	tmpPath := s.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, block := range blocks {
+		rec, err := encodeBlockRecord(block)
+		if err == nil {
+			_, err = w.Write(rec)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.f.Close()
+	s.f = f
+
+	return nil
+}
+
+func (s *segmentFile) close() error {
+	return s.f.Close()
+}
+
+// encodeBlockRecord encodes the block as a record of the file.
+func encodeBlockRecord(block *SimpleBlock) ([]byte, error) {
+	blockBytes, err := block.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(blockBytes) > maxRecordSize {
+		return nil, fmt.Errorf("record size %d exceeds limit of %d bytes", len(blockBytes), maxRecordSize)
+	}
+
+	rec := make([]byte, recordHeaderSize+len(blockBytes))
+	binary.BigEndian.PutUint32(rec, uint32(len(blockBytes)))
+	copy(rec[recordHeaderSize:], blockBytes)
+
+	return rec, nil
+}
+
+// decodeBlockRecord decodes a complete record of the file.
+func decodeBlockRecord(r *bytes.Reader) (*SimpleBlock, error) {
+	var hdr [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("incomplete record header")
+	}
+
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record size %d exceeds limit of %d bytes", size, maxRecordSize)
+	} else if int64(size) > int64(r.Len()) {
+		return nil, fmt.Errorf("incomplete record")
+	}
+	rec := make([]byte, size)
+	if _, err := io.ReadFull(r, rec); err != nil {
+		return nil, err
+	}
+
+	block := new(SimpleBlock)
+	if err := block.UnmarshalBinary(rec); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
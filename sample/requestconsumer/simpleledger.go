@@ -27,6 +27,8 @@ import (
 	"io/ioutil"
 	"log"
 	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
 )
 
 const (
@@ -73,7 +75,11 @@ func (b *SimpleBlock) UnmarshalBinary(marshaled []byte) error {
 	if n, err = r.Read(prevBlockHash[:]); err != nil || n != hashSize {
 		return fmt.Errorf("SimpleBlock binary.Read failed in b.prevBlockHash: %v", err)
 	}
-	copy(b.PrevBlockHash, prevBlockHash[:])
+	if prevBlockHash != [hashSize]byte{} {
+		b.PrevBlockHash = prevBlockHash[:]
+	} else {
+		b.PrevBlockHash = nil // the first block
+	}
 	if b.Payload, err = ioutil.ReadAll(r); err != nil {
 		return fmt.Errorf("SimpleBlock binary.Read failed in b.payload: %v", err)
 	}
@@ -98,29 +104,95 @@ func (b *SimpleBlock) Hash() []byte {
 type acceptedMessage struct {
 	requestPayload []byte
 	resultChan     chan<- []byte
+
+	// closed once all previous messages are processed, if not nil
+	barrier chan<- struct{}
 }
 
 //SimpleLedger implements `RequestConsumer` interface. It defines a queue of delivered
 //messages as the `blockchain` and simply print out the new message.
+//The blocks are kept in memory unless the ledger is file-backed.
 type SimpleLedger struct {
 	sync.RWMutex
 	acceptedMsgQueue chan *acceptedMessage
 	blocks           []*SimpleBlock
 	length           uint64
+
+	// Merkle tree over blocks
+	leaves [][]byte
+	merkle merkleAccumulator
+
+	// stores blocks if file-backed
+	segment *segmentFile
+
+	// blocks loaded on restart that are yet to be delivered again
+	recovered []*SimpleBlock
 }
 
+var _ api.Snapshotter = (*SimpleLedger)(nil)
+
 //NewSimpleLedger initializes an object of SimpleLedger
 func NewSimpleLedger() *SimpleLedger {
+	return newSimpleLedger(nil, nil)
+}
+
+// NewPersistentSimpleLedger initializes an object of SimpleLedger
+// backed by a segment file in the specified directory. Blocks stored
+// in the directory are loaded and verified, so that the chain of
+// blocks is continued after restart. A restarted replica executes all
+// operations again, thus the operations delivered first are matched
+// against the loaded blocks and produce the same results instead of
+// appending new blocks.
+func NewPersistentSimpleLedger(dir string) (*SimpleLedger, error) {
+	segment, blocks, err := openSegmentFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := newSimpleLedger(blocks, segment)
+	l.recovered = blocks
+
+	return l, nil
+}
+
+// ReadSimpleLedger loads and verifies blocks stored in the specified
+// directory by a persistent SimpleLedger without modifying them. It
+// allows inspecting the ledger of a running replica. Blocks appended
+// to the returned ledger are kept in memory only.
+func ReadSimpleLedger(dir string) (*SimpleLedger, error) {
+	blocks, err := readSegmentFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSimpleLedger(blocks, nil), nil
+}
+
+func newSimpleLedger(blocks []*SimpleBlock, segment *segmentFile) *SimpleLedger {
 	l := &SimpleLedger{
 		acceptedMsgQueue: make(chan *acceptedMessage),
+		blocks:           blocks,
+		length:           uint64(len(blocks)),
+		segment:          segment,
+	}
+	for _, b := range blocks {
+		l.addLeaf(b)
 	}
 
 	go func() {
 		for msg := range l.acceptedMsgQueue {
-			// simpleledger: one transaction makes one block
-			block := l.appendBlock(msg.requestPayload)
+			if msg.barrier != nil {
+				close(msg.barrier)
+				continue
+			}
+
+			block := l.redeliver(msg.requestPayload)
+			if block == nil {
+				// simpleledger: one transaction makes one block
+				block = l.appendBlock(msg.requestPayload)
 
-			log.Printf("Received block[%d]: %v", block.Height, string(msg.requestPayload))
+				log.Printf("Received block[%d]: %v", block.Height, string(msg.requestPayload))
+			}
 			// trivial implementation of the transaction execution and return the result
 			blockJSON, err := json.Marshal(block)
 			if err != nil {
@@ -133,6 +205,31 @@ func NewSimpleLedger() *SimpleLedger {
 	return l
 }
 
+// Block returns the block at the specified height, or nil if there
+// is no such block. The first block has height 1.
+func (l *SimpleLedger) Block(height uint64) *SimpleBlock {
+	l.RLock()
+	defer l.RUnlock()
+
+	if height == 0 || height > l.length {
+		return nil
+	}
+	return l.blocks[height-1]
+}
+
+// Close releases the file backing the ledger, if any.
+func (l *SimpleLedger) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.segment == nil {
+		return nil
+	}
+	err := l.segment.close()
+	l.segment = nil
+	return err
+}
+
 // GetLength returns the number of the blocks in the ledger
 func (l *SimpleLedger) GetLength() uint64 {
 	l.RLock()
@@ -144,25 +241,166 @@ func (l *SimpleLedger) GetLength() uint64 {
 // Deliver implements the RequestConsumer interface. It forwards the committed
 // transaction message to the processing queue and returns the result
 func (l *SimpleLedger) Deliver(msg []byte) <-chan []byte {
-	resultChan := make(chan []byte)
+	resultChan := make(chan []byte, 1)
 	l.acceptedMsgQueue <- &acceptedMessage{requestPayload: msg, resultChan: resultChan}
 
 	return resultChan
 }
 
-// StateDigest returns the hash of the latest block as the digest of the system state
+// StateDigest returns the root of the Merkle tree over all blocks as
+// the digest of the system state
 func (l *SimpleLedger) StateDigest() []byte {
 	l.RLock()
 	defer l.RUnlock()
 
-	if l.length == 0 {
-		return nil
+	return l.merkle.root()
+}
+
+// StateDigestAt returns the state digest of the ledger as it was
+// when it consisted of the specified number of blocks.
+func (l *SimpleLedger) StateDigestAt(treeSize uint64) ([]byte, error) {
+	l.RLock()
+	defer l.RUnlock()
+
+	if treeSize > l.length {
+		return nil, fmt.Errorf("tree size %d exceeds ledger length %d", treeSize, l.length)
 	}
-	lastBlockBytes, err := l.blocks[l.length-1].MarshalBinary()
+	return merkleRoot(l.leaves[:treeSize]), nil
+}
+
+// ProveInclusion produces a proof that the block at the specified
+// height is included in the ledger as it was when it consisted of
+// treeSize blocks. The proof can be checked against the state digest
+// of that ledger with VerifyInclusionProof.
+func (l *SimpleLedger) ProveInclusion(height, treeSize uint64) (*InclusionProof, error) {
+	l.RLock()
+	defer l.RUnlock()
+
+	if treeSize > l.length {
+		return nil, fmt.Errorf("tree size %d exceeds ledger length %d", treeSize, l.length)
+	}
+	if height == 0 || height > treeSize {
+		return nil, fmt.Errorf("block height %d out of range for tree size %d", height, treeSize)
+	}
+
+	return &InclusionProof{
+		Height:   height,
+		TreeSize: treeSize,
+		Path:     merklePath(int(height-1), l.leaves[:treeSize]),
+	}, nil
+}
+
+// Snapshot implements the api.Snapshotter interface. Each chunk
+// consists of consecutive blocks encoded as in the segment file.
+func (l *SimpleLedger) Snapshot() (api.Snapshot, error) {
+	l.waitDelivered()
+
+	l.RLock()
+	defer l.RUnlock()
+
+	// Blocks are never modified, only appended
+	blocks := l.blocks[:l.length:l.length]
+	next := func() []byte {
+		var chunk []byte
+		for len(blocks) > 0 && len(chunk) < snapshotChunkSize {
+			rec, err := encodeBlockRecord(blocks[0])
+			if err != nil {
+				panic(fmt.Sprintf("Failed to marshal block: %v", err))
+			}
+			chunk = append(chunk, rec...)
+			blocks = blocks[1:]
+		}
+		return chunk
+	}
+
+	return &snapshot{l.merkle.root(), next}, nil
+}
+
+// Restore implements the api.Snapshotter interface. The chain of
+// restored blocks is verified. If the ledger is file-backed, the
+// segment file is replaced with the restored blocks.
+func (l *SimpleLedger) Restore(s api.Snapshot) error {
+	var blocks []*SimpleBlock
+	var leaves [][]byte
+	var acc merkleAccumulator
+	err := forEachChunk(s, func(chunk []byte) error {
+		for r := bytes.NewReader(chunk); r.Len() > 0; {
+			block, err := decodeBlockRecord(r)
+			if err != nil {
+				return fmt.Errorf("block %d: %s", len(blocks)+1, err)
+			}
+
+			var prev *SimpleBlock
+			if len(blocks) > 0 {
+				prev = blocks[len(blocks)-1]
+			}
+			if err := verifyBlock(block, prev); err != nil {
+				return err
+			}
+
+			blockBytes, err := block.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			leaf := merkleLeafHash(blockBytes)
+			leaves = append(leaves, leaf)
+			acc.append(leaf)
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
 	if err != nil {
-		panic(fmt.Sprintf("Failed to marshal block: %v", err))
+		return fmt.Errorf("failed to read snapshot: %s", err)
+	}
+	if !bytes.Equal(acc.root(), s.Digest()) {
+		return fmt.Errorf("snapshot digest mismatch")
+	}
+
+	l.waitDelivered()
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.segment != nil {
+		if err := l.segment.replace(blocks); err != nil {
+			return fmt.Errorf("failed to store blocks: %s", err)
+		}
 	}
-	return blockHashAlgo.New().Sum(lastBlockBytes)
+
+	l.blocks = blocks
+	l.length = uint64(len(blocks))
+	l.leaves = leaves
+	l.merkle = acc
+	l.recovered = nil
+
+	return nil
+}
+
+// waitDelivered waits for all delivered messages to be processed.
+func (l *SimpleLedger) waitDelivered() {
+	done := make(chan struct{})
+	l.acceptedMsgQueue <- &acceptedMessage{barrier: done}
+	<-done
+}
+
+// redeliver returns the next block loaded on restart, if any. The
+// block has to hold the supplied payload, since the operations are
+// executed in the same order again.
+func (l *SimpleLedger) redeliver(payload []byte) *SimpleBlock {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.recovered) == 0 {
+		return nil
+	}
+
+	block := l.recovered[0]
+	if !bytes.Equal(block.Payload, payload) {
+		panic(fmt.Sprintf("Operation delivered again does not match block %d", block.Height))
+	}
+	l.recovered = l.recovered[1:]
+
+	return block
 }
 
 func (l *SimpleLedger) appendBlock(payload []byte) *SimpleBlock {
@@ -182,6 +420,24 @@ func (l *SimpleLedger) appendBlock(payload []byte) *SimpleBlock {
 		Height:        l.length,
 	}
 	l.blocks = append(l.blocks, block)
+	l.addLeaf(block)
+
+	if l.segment != nil {
+		if err := l.segment.append(block); err != nil {
+			panic(fmt.Sprintf("Failed to store block: %v", err))
+		}
+	}
 
 	return block
 }
+
+func (l *SimpleLedger) addLeaf(block *SimpleBlock) {
+	blockBytes, err := block.MarshalBinary()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to marshal block: %v", err))
+	}
+
+	leaf := merkleLeafHash(blockBytes)
+	l.leaves = append(l.leaves, leaf)
+	l.merkle.append(leaf)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package requestconsumer
+
+import (
+	"io"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// snapshotChunkSize is the size of snapshot chunks to aim at. A chunk
+// may exceed it if a single item does not fit.
+const snapshotChunkSize = 64 << 10
+
+// snapshot implements api.Snapshot. Chunks are produced on demand by
+// the supplied function, which returns nil after the last chunk.
+type snapshot struct {
+	digest []byte
+	next   func() []byte
+}
+
+var _ api.Snapshot = (*snapshot)(nil)
+
+func (s *snapshot) Digest() []byte {
+	return s.digest
+}
+
+func (s *snapshot) NextChunk() ([]byte, error) {
+	if chunk := s.next(); chunk != nil {
+		return chunk, nil
+	}
+	return nil, io.EOF
+}
+
+// forEachChunk invokes the function for each chunk of the snapshot.
+func forEachChunk(s api.Snapshot, f func(chunk []byte) error) error {
+	for {
+		chunk, err := s.NextChunk()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := f(chunk); err != nil {
+			return err
+		}
+	}
+}
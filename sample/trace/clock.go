@@ -0,0 +1,127 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	minbft "github.com/hyperledger-labs/minbft/core"
+)
+
+// Clock is a mocked clock that only advances when told to. It
+// implements minbft.TimerProvider so that replica timeouts expire
+// according to the mocked time.
+type Clock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers map[*clockTimer]struct{}
+}
+
+// NewClock creates a new Clock set to the specified time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, timers: make(map[*clockTimer]struct{})}
+}
+
+// Now returns the current mocked time.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// Advance sets the mocked time to t, firing any timers that expire
+// by then in order of expiration. The clock never goes backwards.
+func (c *Clock) Advance(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !t.After(c.now) {
+		return
+	}
+	c.now = t
+
+	var expired []*clockTimer
+	for timer := range c.timers {
+		if !timer.deadline.After(t) {
+			expired = append(expired, timer)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].deadline.Before(expired[j].deadline)
+	})
+	for _, timer := range expired {
+		delete(c.timers, timer)
+		timer.fire(timer.deadline)
+	}
+}
+
+// NewTimer implements minbft.TimerProvider.
+func (c *Clock) NewTimer(d time.Duration) minbft.Timer {
+	timer := &clockTimer{clock: c, ch: make(chan time.Time, 1)}
+	timer.fire = func(t time.Time) {
+		select {
+		case timer.ch <- t:
+		default:
+		}
+	}
+	timer.Reset(d)
+	return timer
+}
+
+// AfterFunc implements minbft.TimerProvider.
+func (c *Clock) AfterFunc(d time.Duration, f func()) minbft.Timer {
+	timer := &clockTimer{clock: c}
+	timer.fire = func(time.Time) { go f() }
+	timer.Reset(d)
+	return timer
+}
+
+type clockTimer struct {
+	clock    *Clock
+	ch       chan time.Time
+	fire     func(t time.Time)
+	deadline time.Time
+}
+
+func (t *clockTimer) Expired() <-chan time.Time {
+	return t.ch
+}
+
+func (t *clockTimer) Reset(d time.Duration) {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, active := c.timers[t]; active {
+		panic(fmt.Errorf("Resetting active timer"))
+	}
+
+	t.deadline = c.now.Add(d)
+	c.timers[t] = struct{}{}
+}
+
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, active := c.timers[t]
+	delete(c.timers, t)
+	return active
+}
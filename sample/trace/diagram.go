@@ -0,0 +1,292 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+type highlight int
+
+const (
+	plain highlight = iota
+	viewChange
+	dropped
+	invalid
+)
+
+// step is a single element of a sequence diagram: either a message
+// arrow or a note over all participants.
+type step struct {
+	note     bool
+	from, to Participant
+	text     string
+	hl       highlight
+}
+
+// steps lays out the flow as a sequence diagram. Each request is
+// introduced by a note, and so is each new view. Messages are labeled
+// with the time elapsed since the first message of the request, or
+// since the beginning of the flow if not belonging to any request.
+func (f *Flow) steps() []step {
+	var steps []step
+	if len(f.Events) == 0 {
+		return steps
+	}
+
+	start := f.Events[0].Time
+	requestStart := make(map[int]time.Time)
+	var view uint64
+	for _, e := range f.Events {
+		if e.Request != 0 {
+			if _, ok := requestStart[e.Request]; !ok {
+				requestStart[e.Request] = e.Time
+				r := f.Requests[e.Request-1]
+				steps = append(steps, step{note: true,
+					text: fmt.Sprintf("req %d: client %d, seq %d", e.Request, r.ClientID, r.Seq)})
+			}
+		}
+
+		if prep := preparedBy(e.Message); prep != nil && prep.View() > view && e.Err == nil {
+			view = prep.View()
+			steps = append(steps, step{note: true, hl: viewChange,
+				text: fmt.Sprintf("view %d, primary replica %d", view, prep.ReplicaID())})
+		}
+
+		s := step{from: e.From, to: e.To, text: describeEvent(e)}
+		if e.Request != 0 {
+			s.text += fmt.Sprintf(" (+%s)", formatDuration(e.Time.Sub(requestStart[e.Request])))
+		} else {
+			s.text += fmt.Sprintf(" (t+%s)", formatDuration(e.Time.Sub(start)))
+		}
+		if _, ok := e.Message.(messages.ReqViewChange); ok {
+			s.hl = viewChange
+		}
+		if e.Dropped {
+			s.text += " NOT RECEIVED"
+			s.hl = dropped
+		}
+		if e.Err != nil {
+			s.text += " INVALID: " + e.Err.Error()
+			s.hl = invalid
+		}
+		steps = append(steps, s)
+	}
+
+	return steps
+}
+
+func describeEvent(e *Event) string {
+	switch msg := e.Message.(type) {
+	case messages.Request:
+		return fmt.Sprintf("Request req %d", e.Request)
+	case messages.Reply:
+		return fmt.Sprintf("Reply req %d", e.Request)
+	case messages.Prepare:
+		return fmt.Sprintf("Prepare req %d, view %d, cv %s", e.Request, msg.View(), formatUICounter(msg))
+	case messages.Commit:
+		return fmt.Sprintf("Commit req %d, cv %s", e.Request, formatUICounter(msg))
+	case messages.ReqViewChange:
+		return fmt.Sprintf("ReqViewChange to view %d", msg.NewView())
+	default:
+		return "Message"
+	}
+}
+
+// preparedBy returns the Prepare message, if any, that the message
+// is or embeds.
+func preparedBy(msg messages.Message) messages.Prepare {
+	switch msg := msg.(type) {
+	case messages.Prepare:
+		return msg
+	case messages.Commit:
+		return msg.Prepare()
+	default:
+		return nil
+	}
+}
+
+func formatUICounter(msg messages.CertifiedMessage) string {
+	ui := new(usig.UI)
+	if err := ui.UnmarshalBinary(msg.UIBytes()); err != nil {
+		return "?"
+	}
+	return fmt.Sprint(ui.Counter)
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// WriteMermaid writes the flow as a Mermaid sequence diagram. View
+// changes are highlighted in yellow, messages not received in gray,
+// invalid messages in red.
+func (f *Flow) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "sequenceDiagram")
+	for _, p := range f.Participants {
+		fmt.Fprintf(bw, "    participant %s as %s\n", mermaidID(p), p)
+	}
+
+	var first, last string
+	if len(f.Participants) != 0 {
+		first = mermaidID(f.Participants[0])
+		last = mermaidID(f.Participants[len(f.Participants)-1])
+	}
+
+	for _, s := range f.steps() {
+		var line, arrow string
+		switch {
+		case s.note:
+			line = fmt.Sprintf("Note over %s,%s: %s", first, last, mermaidText(s.text))
+		case s.hl == dropped:
+			arrow = "--x"
+		case s.hl == invalid:
+			arrow = "-x"
+		default:
+			arrow = "->>"
+		}
+		if !s.note {
+			line = fmt.Sprintf("%s%s%s: %s", mermaidID(s.from), arrow, mermaidID(s.to), mermaidText(s.text))
+		}
+
+		if color := mermaidColor(s.hl); color != "" {
+			fmt.Fprintf(bw, "    rect %s\n    %s\n    end\n", color, line)
+		} else {
+			fmt.Fprintf(bw, "    %s\n", line)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func mermaidID(p Participant) string {
+	switch p.Kind {
+	case Client:
+		return fmt.Sprintf("C%d", p.ID)
+	case Replica:
+		return fmt.Sprintf("R%d", p.ID)
+	default:
+		return "U"
+	}
+}
+
+func mermaidColor(hl highlight) string {
+	switch hl {
+	case viewChange:
+		return "rgb(255, 240, 180)"
+	case dropped:
+		return "rgb(225, 225, 225)"
+	case invalid:
+		return "rgb(255, 200, 200)"
+	default:
+		return ""
+	}
+}
+
+// mermaidText escapes characters with special meaning in Mermaid
+// message text.
+func mermaidText(s string) string {
+	return strings.NewReplacer("\n", " ", ";", "#59;", "#", "#35;").Replace(s)
+}
+
+// WriteDOT writes the flow as a Graphviz DOT graph laid out as a
+// sequence diagram, with a dashed lifeline for each participant. View
+// changes are highlighted in orange, messages not received in gray,
+// invalid messages in red.
+func (f *Flow) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph flow {")
+	fmt.Fprintln(bw, "    newrank=true;")
+	fmt.Fprintln(bw, "    node [shape=point, width=0.05];")
+	fmt.Fprintln(bw, "    edge [fontsize=10];")
+
+	node := func(p Participant, row int) string {
+		return fmt.Sprintf("%s_%d", mermaidID(p), row)
+	}
+	writeRow := func(row int, attrs func(p Participant) string) {
+		fmt.Fprint(bw, "    { rank=same;")
+		for _, p := range f.Participants {
+			fmt.Fprintf(bw, " %s%s;", node(p, row), attrs(p))
+		}
+		fmt.Fprintln(bw, " }")
+		for i := 1; i < len(f.Participants); i++ {
+			fmt.Fprintf(bw, "    %s -> %s [style=invis];\n",
+				node(f.Participants[i-1], row), node(f.Participants[i], row))
+		}
+	}
+
+	writeRow(0, func(p Participant) string {
+		return fmt.Sprintf(" [shape=box, label=%q]", p.String())
+	})
+
+	steps := f.steps()
+	for i, s := range steps {
+		row := i + 1
+		if s.note {
+			writeRow(row, func(p Participant) string {
+				if p != f.Participants[0] {
+					return ""
+				}
+				return fmt.Sprintf(" [shape=note, fontsize=10, label=%q%s]", s.text, dotColor(s.hl, "style=filled, fillcolor"))
+			})
+			continue
+		}
+
+		writeRow(row, func(Participant) string { return "" })
+		attrs := fmt.Sprintf("label=%q, constraint=false", s.text)
+		switch s.hl {
+		case dropped:
+			attrs += ", style=dashed, arrowhead=tee"
+		case invalid:
+			attrs += ", arrowhead=box"
+		}
+		attrs += dotColor(s.hl, "color")
+		fmt.Fprintf(bw, "    %s -> %s [%s];\n", node(s.from, row), node(s.to, row), attrs)
+	}
+
+	for _, p := range f.Participants {
+		for row := 1; row <= len(steps); row++ {
+			fmt.Fprintf(bw, "    %s -> %s [style=dashed, arrowhead=none, color=gray];\n",
+				node(p, row-1), node(p, row))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+func dotColor(hl highlight, attr string) string {
+	switch hl {
+	case viewChange:
+		return ", " + attr + "=orange"
+	case dropped:
+		return ", " + attr + "=gray"
+	case invalid:
+		return ", " + attr + "=red"
+	default:
+		return ""
+	}
+}
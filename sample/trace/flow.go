@@ -0,0 +1,275 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/messages"
+)
+
+// ParticipantKind distinguishes clients and replicas.
+type ParticipantKind int
+
+const (
+	// Client participant
+	Client ParticipantKind = iota
+	// Replica participant
+	Replica
+	// Unknown participant sent an undecodable message
+	Unknown
+)
+
+// Participant represents a client or a replica exchanging messages.
+type Participant struct {
+	Kind ParticipantKind
+	ID   uint32
+}
+
+func (p Participant) String() string {
+	switch p.Kind {
+	case Client:
+		return fmt.Sprintf("Client %d", p.ID)
+	case Replica:
+		return fmt.Sprintf("Replica %d", p.ID)
+	default:
+		return "Unknown"
+	}
+}
+
+// RequestID identifies a client request.
+type RequestID struct {
+	ClientID uint32
+	Seq      uint64
+}
+
+// Event represents a message passed from one participant to another.
+//
+// Message is nil if the message could not be decoded. Request is the
+// number of the client request the message belongs to, i.e. its index
+// in Flow.Requests plus one, or zero if the message does not belong
+// to any request. Dropped indicates a message sent by a replica but
+// never received by another replica, whose trace is available. Err
+// tells why the message is invalid, if so.
+type Event struct {
+	Time     time.Time
+	From, To Participant
+	Message  messages.Message
+	Request  int
+	Dropped  bool
+	Err      error
+}
+
+// Flow represents the message exchange between clients and replicas
+// reconstructed from traces recorded by the replicas. Participants
+// are ordered with clients first, then replicas. Requests are ordered
+// by their first message, and events by time.
+type Flow struct {
+	Participants []Participant
+	Requests     []RequestID
+	Events       []*Event
+}
+
+// MessageValidator checks whether a message is authentic. It returns
+// nil if the message is valid.
+type MessageValidator func(msg messages.Message) error
+
+// TraceReplicaID determines the ID of the replica that recorded the
+// trace from the messages it sent.
+func TraceReplicaID(records []*Record) (id uint32, ok bool) {
+	for _, rec := range records {
+		if rec.Direction != Outbound {
+			continue
+		}
+		msg, err := messageImpl.NewFromBinary(rec.Message)
+		if err != nil {
+			continue
+		}
+		if m, ok := msg.(messages.ReplicaMessage); ok {
+			return m.ReplicaID(), true
+		}
+	}
+	return 0, false
+}
+
+// NewFlow reconstructs the message exchange from traces recorded by
+// replicas, given the ID of each replica. A message received by a
+// replica is represented at the time of its receipt; a message sent
+// by a replica is represented at the time of sending only if the
+// trace of the receiver is not available or the receiver never
+// received it. Each decoded message is checked with the validator,
+// unless it is nil. Clocks of the replicas are supposed to be
+// synchronized.
+func NewFlow(traces map[uint32][]*Record, validate MessageValidator) *Flow {
+	// Cache of decoded messages and their validity
+	type decoded struct {
+		msg messages.Message
+		err error
+	}
+	cache := make(map[string]*decoded)
+	decode := func(data []byte) *decoded {
+		if d := cache[string(data)]; d != nil {
+			return d
+		}
+		d := new(decoded)
+		d.msg, d.err = messageImpl.NewFromBinary(data)
+		if d.err != nil {
+			d.err = fmt.Errorf("undecodable message: %s", d.err)
+		} else if validate != nil {
+			d.err = validate(d.msg)
+		}
+		cache[string(data)] = d
+		return d
+	}
+
+	type delivery struct {
+		from, to Participant
+		data     string
+	}
+	received := make(map[delivery]int)
+	for id, records := range traces {
+		to := Participant{Replica, id}
+		for _, rec := range records {
+			if rec.Direction == Inbound {
+				from := sender(decode(rec.Message).msg, rec.Peer)
+				received[delivery{from, to, string(rec.Message)}]++
+			}
+		}
+	}
+
+	var events []*Event
+	participants := make(map[Participant]bool)
+	for id, records := range traces {
+		self := Participant{Replica, id}
+		participants[self] = true
+
+		for _, rec := range records {
+			d := decode(rec.Message)
+			e := &Event{Time: rec.Time, Message: d.msg, Err: d.err}
+			if rec.Direction == Inbound {
+				e.From, e.To = sender(d.msg, rec.Peer), self
+			} else {
+				e.From, e.To = self, receiver(d.msg, rec.Peer)
+				if _, traced := traces[e.To.ID]; traced && e.To.Kind == Replica {
+					key := delivery{e.From, e.To, string(rec.Message)}
+					if received[key] > 0 {
+						// Represented by the receiver
+						received[key]--
+						continue
+					}
+					e.Dropped = true
+				}
+			}
+			participants[e.From] = true
+			participants[e.To] = true
+			events = append(events, e)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	f := &Flow{Events: events}
+	requests := make(map[RequestID]int)
+	for _, e := range events {
+		id, ok := requestOf(e.Message)
+		if !ok {
+			continue
+		}
+		if requests[id] == 0 {
+			f.Requests = append(f.Requests, id)
+			requests[id] = len(f.Requests)
+		}
+		e.Request = requests[id]
+	}
+
+	for p := range participants {
+		f.Participants = append(f.Participants, p)
+	}
+	sort.Slice(f.Participants, func(i, j int) bool {
+		p1, p2 := f.Participants[i], f.Participants[j]
+		if p1.Kind != p2.Kind {
+			return p1.Kind < p2.Kind
+		}
+		return p1.ID < p2.ID
+	})
+
+	return f
+}
+
+// Only returns the flow restricted to messages of the specified
+// client request, as well as messages not belonging to any request.
+func (f *Flow) Only(id RequestID) *Flow {
+	only := &Flow{Participants: f.Participants}
+	for i, r := range f.Requests {
+		if r != id {
+			continue
+		}
+		only.Requests = []RequestID{r}
+		for _, e := range f.Events {
+			if e.Request == 0 || e.Request == i+1 {
+				e := *e
+				if e.Request != 0 {
+					e.Request = 1
+				}
+				only.Events = append(only.Events, &e)
+			}
+		}
+	}
+	return only
+}
+
+func sender(msg messages.Message, peer string) Participant {
+	switch msg := msg.(type) {
+	case messages.ReplicaMessage:
+		return Participant{Replica, msg.ReplicaID()}
+	case messages.ClientMessage:
+		return Participant{Client, msg.ClientID()}
+	}
+	var id uint32
+	if parseReplicaLabel(peer, &id) {
+		return Participant{Replica, id}
+	}
+	return Participant{Kind: Unknown}
+}
+
+func receiver(msg messages.Message, peer string) Participant {
+	var id uint32
+	if parseReplicaLabel(peer, &id) {
+		return Participant{Replica, id}
+	}
+	if reply, ok := msg.(messages.Reply); ok {
+		return Participant{Client, reply.ClientID()}
+	}
+	return Participant{Kind: Unknown}
+}
+
+func requestOf(msg messages.Message) (RequestID, bool) {
+	switch msg := msg.(type) {
+	case messages.Request:
+		return RequestID{msg.ClientID(), msg.Sequence()}, true
+	case messages.Reply:
+		return RequestID{msg.ClientID(), msg.Sequence()}, true
+	case messages.Prepare:
+		return requestOf(msg.Request())
+	case messages.Commit:
+		return requestOf(msg.Prepare())
+	default:
+		return RequestID{}, false
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+func TestFlow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	req := messageImpl.NewRequest(0, 7, []byte("op"))
+	prep := messageImpl.NewPrepare(0, 0, req)
+	prep.SetUIBytes(makeUI(t, 1))
+	comm := messageImpl.NewCommit(1, prep)
+	comm.SetUIBytes(makeUI(t, 1))
+	reply0 := messageImpl.NewReply(0, 0, 7, []byte("ok"))
+	reply1 := messageImpl.NewReply(1, 0, 7, []byte("ok"))
+	rvc := messageImpl.NewReqViewChange(1, 1)
+
+	traces := map[uint32][]*Record{
+		0: {
+			makeRecord(t, at(0), Inbound, 1, "client", req),
+			makeRecord(t, at(1), Outbound, 2, "replica 1", prep),
+			makeRecord(t, at(4), Inbound, 3, "peer", comm),
+			makeRecord(t, at(5), Outbound, 1, "client", reply0),
+		},
+		1: {
+			makeRecord(t, at(2), Inbound, 1, "peer", prep),
+			makeRecord(t, at(3), Outbound, 2, "replica 0", comm),
+			makeRecord(t, at(6), Outbound, 3, "client", reply1),
+			makeRecord(t, at(9), Outbound, 2, "replica 0", rvc),
+		},
+	}
+
+	id, ok := TraceReplicaID(traces[1])
+	require.True(t, ok)
+	assert.Equal(t, uint32(1), id)
+
+	validate := func(msg messages.Message) error {
+		if _, ok := msg.(messages.Commit); ok {
+			return fmt.Errorf("bad UI")
+		}
+		return nil
+	}
+	f := NewFlow(traces, validate)
+
+	c0, r0, r1 := Participant{Client, 0}, Participant{Replica, 0}, Participant{Replica, 1}
+	assert.Equal(t, []Participant{c0, r0, r1}, f.Participants)
+	assert.Equal(t, []RequestID{{0, 7}}, f.Requests)
+
+	type event struct {
+		time     time.Time
+		from, to Participant
+		request  int
+		dropped  bool
+		invalid  bool
+	}
+	var events []event
+	for _, e := range f.Events {
+		events = append(events, event{e.Time, e.From, e.To, e.Request, e.Dropped, e.Err != nil})
+	}
+	assert.Equal(t, []event{
+		{at(0), c0, r0, 1, false, false},
+		{at(2), r0, r1, 1, false, false},
+		{at(4), r1, r0, 1, false, true},
+		{at(5), r0, c0, 1, false, false},
+		{at(6), r1, c0, 1, false, false},
+		{at(9), r1, r0, 0, true, false},
+	}, events)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, f.WriteMermaid(buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	assert.Equal(t, []string{
+		"sequenceDiagram",
+		"participant C0 as Client 0",
+		"participant R0 as Replica 0",
+		"participant R1 as Replica 1",
+		"Note over C0,R1: req 1: client 0, seq 7",
+		"C0->>R0: Request req 1 (+0.0ms)",
+		"R0->>R1: Prepare req 1, view 0, cv 1 (+2.0ms)",
+		"rect rgb(255, 200, 200)",
+		"R1-xR0: Commit req 1, cv 1 (+4.0ms) INVALID: bad UI",
+		"end",
+		"R0->>C0: Reply req 1 (+5.0ms)",
+		"R1->>C0: Reply req 1 (+6.0ms)",
+		"rect rgb(225, 225, 225)",
+		"R1--xR0: ReqViewChange to view 1 (t+9.0ms) NOT RECEIVED",
+		"end",
+	}, lines)
+
+	buf.Reset()
+	require.NoError(t, f.WriteDOT(buf))
+	dot := buf.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph flow {"))
+	assert.Contains(t, dot, `C0_0 [shape=box, label="Client 0"];`)
+	assert.Contains(t, dot, `C0_2 -> R0_2 [label="Request req 1 (+0.0ms)", constraint=false];`)
+	assert.Contains(t, dot, `R1_7 -> R0_7 [label="ReqViewChange to view 1 (t+9.0ms) NOT RECEIVED", constraint=false, style=dashed, arrowhead=tee, color=gray];`)
+
+	only := f.Only(RequestID{0, 7})
+	assert.Len(t, only.Events, len(f.Events))
+	only = f.Only(RequestID{0, 8})
+	assert.Empty(t, only.Events)
+}
+
+func makeRecord(t *testing.T, time time.Time, dir Direction, stream uint64, peer string, msg messages.Message) *Record {
+	data, err := msg.MarshalBinary()
+	require.NoError(t, err)
+	return &Record{time, dir, stream, peer, data}
+}
+
+func makeUI(t *testing.T, cv uint64) []byte {
+	uiBytes, err := (&usig.UI{Counter: cv}).MarshalBinary()
+	require.NoError(t, err)
+	return uiBytes
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/messages"
+	"github.com/hyperledger-labs/minbft/usig"
+
+	protobufMessages "github.com/hyperledger-labs/minbft/messages/protobuf"
+)
+
+// pollInterval is how often replay checks for messages sent by the
+// replica while waiting for them.
+const pollInterval = 5 * time.Millisecond
+
+var messageImpl = protobufMessages.NewImpl()
+
+// ReplicaStarter creates a fresh replica instance to replay a trace
+// into. The replica has to connect to peer replicas through the
+// supplied connector and use the supplied clock to trigger timeouts,
+// see minbft.WithTimerProvider.
+type ReplicaStarter func(conn api.ReplicaConnector, clock *Clock) (api.ConnectionHandler, error)
+
+// Divergence describes the first outbound message of a stream that
+// differs between a trace and its replay. Index is the position of
+// the message among outbound messages of the stream, starting from
+// zero. Expected is nil if the replica sent an extra message in
+// replay; Actual is nil if the replica did not send the recorded
+// message.
+type Divergence struct {
+	Stream   uint64
+	Peer     string
+	Index    int
+	Expected []byte
+	Actual   []byte
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("stream %d (%s), outbound message %d: expected %s, got %s",
+		d.Stream, d.Peer, d.Index, describeMessage(d.Expected), describeMessage(d.Actual))
+}
+
+// Replay feeds the inbound messages of a trace into a fresh replica
+// and reports where the messages sent by the replica differ from the
+// recorded ones.
+//
+// The inbound messages are delivered in the recorded order, each to
+// the stream it was recorded in. The mocked clock of the replica
+// starts at the time of the first record. Replay proceeds record by
+// record: it waits for the replica to send as many messages as
+// recorded before the record, but at most for the settle duration,
+// then advances the clock to the time of the record and delivers the
+// message if it is inbound. Thus timeouts expire in between the same
+// messages as recorded. Once all messages are delivered, replay waits
+// for the settle duration before comparing the messages.
+//
+// Signatures and UI certificates are not compared since they are not
+// reproducible; other message content is. The trace is supposed to
+// be recorded from the start of the replica.
+func Replay(records []*Record, start ReplicaStarter, settle time.Duration) ([]*Divergence, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	r, err := newReplayer(records)
+	if err != nil {
+		return nil, err
+	}
+
+	clock := NewClock(records[0].Time)
+	replica, err := start(r, clock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start replica: %s", err)
+	}
+	r.startServerStreams(replica)
+	defer r.close()
+
+	// Stream ID -> number of outbound messages recorded so far
+	expected := make(map[uint64]int)
+	for _, rec := range records {
+		r.await(expected, settle)
+		clock.Advance(rec.Time)
+
+		if rec.Direction == Outbound {
+			expected[rec.Stream]++
+		} else {
+			r.streams[rec.Stream].in <- rec.Message
+		}
+	}
+	r.await(expected, settle)
+	time.Sleep(settle)
+
+	return r.compare(records), nil
+}
+
+type replayStream struct {
+	id   uint64
+	peer string
+	in   chan []byte
+
+	// protected by replayer's lock
+	out [][]byte
+}
+
+// replayer implements api.ReplicaConnector for the replica in
+// replay and collects messages it sends.
+type replayer struct {
+	lock    sync.Mutex
+	streams map[uint64]*replayStream
+
+	// replica ID -> stream the replica initiated to it
+	replicaStreams map[uint32]*replayStream
+	nextStream     uint64
+}
+
+func newReplayer(records []*Record) (*replayer, error) {
+	r := &replayer{
+		streams:        make(map[uint64]*replayStream),
+		replicaStreams: make(map[uint32]*replayStream),
+	}
+
+	inbound := make(map[uint64]int)
+	for _, rec := range records {
+		if rec.Direction != Inbound && rec.Direction != Outbound {
+			return nil, fmt.Errorf("unknown direction %q", rec.Direction)
+		}
+		if rec.Direction == Inbound {
+			inbound[rec.Stream]++
+		}
+		if rec.Stream >= r.nextStream {
+			r.nextStream = rec.Stream + 1
+		}
+	}
+
+	for _, rec := range records {
+		if _, ok := r.streams[rec.Stream]; ok {
+			continue
+		}
+
+		s := &replayStream{
+			id:   rec.Stream,
+			peer: rec.Peer,
+			// Buffer all inbound messages so that
+			// delivery never blocks
+			in: make(chan []byte, inbound[rec.Stream]),
+		}
+		r.streams[s.id] = s
+
+		var replicaID uint32
+		switch {
+		case rec.Peer == peerStreamLabel || rec.Peer == clientStreamLabel:
+		case parseReplicaLabel(rec.Peer, &replicaID):
+			// Only the first connection to each replica
+			// will be established in replay
+			if r.replicaStreams[replicaID] == nil {
+				r.replicaStreams[replicaID] = s
+			}
+		default:
+			return nil, fmt.Errorf("unknown peer %q of stream %d", rec.Peer, rec.Stream)
+		}
+	}
+
+	return r, nil
+}
+
+func parseReplicaLabel(label string, replicaID *uint32) bool {
+	var id uint32
+	if _, err := fmt.Sscanf(label, replicaStreamLabel, &id); err != nil {
+		return false
+	}
+	if label != fmt.Sprintf(replicaStreamLabel, id) {
+		return false
+	}
+	*replicaID = id
+	return true
+}
+
+func (r *replayer) ReplicaMessageStreamHandler(replicaID uint32) api.MessageStreamHandler {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s := r.replicaStreams[replicaID]
+	if s == nil {
+		// Not recorded; collect messages anyway
+		s = &replayStream{
+			id:   r.nextStream,
+			peer: fmt.Sprintf(replicaStreamLabel, replicaID),
+			in:   make(chan []byte),
+		}
+		r.nextStream++
+		r.streams[s.id] = s
+		r.replicaStreams[replicaID] = s
+	}
+
+	return &replayConnection{r, s}
+}
+
+type replayConnection struct {
+	r *replayer
+	s *replayStream
+}
+
+func (c *replayConnection) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	go c.r.collect(c.s, in)
+	return c.s.in
+}
+
+func (r *replayer) startServerStreams(replica api.ConnectionHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, s := range r.streams {
+		var h api.MessageStreamHandler
+		switch s.peer {
+		case peerStreamLabel:
+			h = replica.PeerMessageStreamHandler()
+		case clientStreamLabel:
+			h = replica.ClientMessageStreamHandler()
+		default:
+			continue
+		}
+		go r.collect(s, h.HandleMessageStream(s.in))
+	}
+}
+
+func (r *replayer) collect(s *replayStream, out <-chan []byte) {
+	for msg := range out {
+		r.lock.Lock()
+		s.out = append(s.out, msg)
+		r.lock.Unlock()
+	}
+}
+
+// await waits until the number of messages sent through each stream
+// reaches the expected number or the timeout expires.
+func (r *replayer) await(expected map[uint64]int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && !r.reached(expected) {
+		time.Sleep(pollInterval)
+	}
+}
+
+func (r *replayer) reached(expected map[uint64]int) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for id, n := range expected {
+		if len(r.streams[id].out) < n {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *replayer) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, s := range r.streams {
+		close(s.in)
+	}
+}
+
+func (r *replayer) compare(records []*Record) []*Divergence {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	recorded := make(map[uint64][][]byte)
+	for _, rec := range records {
+		if rec.Direction == Outbound {
+			recorded[rec.Stream] = append(recorded[rec.Stream], rec.Message)
+		}
+	}
+
+	var ids []uint64
+	for id := range r.streams {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var divergences []*Divergence
+	for _, id := range ids {
+		s := r.streams[id]
+		expected, actual := recorded[id], s.out
+		for i := 0; i < len(expected) || i < len(actual); i++ {
+			d := &Divergence{Stream: id, Peer: s.peer, Index: i}
+			if i < len(expected) {
+				d.Expected = expected[i]
+			}
+			if i < len(actual) {
+				d.Actual = actual[i]
+			}
+			if d.Expected == nil || d.Actual == nil || !sameMessage(d.Expected, d.Actual) {
+				divergences = append(divergences, d)
+				break
+			}
+		}
+	}
+
+	return divergences
+}
+
+// sameMessage checks if two serialized messages have the same
+// content, apart from signatures, UI certificates, and input chosen
+// by the primary for execution, i.e. timestamp and random seed.
+func sameMessage(data1, data2 []byte) bool {
+	msg1, err1 := messageImpl.NewFromBinary(data1)
+	msg2, err2 := messageImpl.NewFromBinary(data2)
+	if err1 != nil || err2 != nil {
+		return bytes.Equal(data1, data2)
+	}
+
+	if !bytes.Equal(messages.AuthenBytes(withoutInput(msg1)), messages.AuthenBytes(withoutInput(msg2))) {
+		return false
+	}
+
+	if m1, ok := msg1.(messages.ReplicaMessage); ok {
+		if m1.ReplicaID() != msg2.(messages.ReplicaMessage).ReplicaID() {
+			return false
+		}
+	}
+
+	if m1, ok := msg1.(messages.CertifiedMessage); ok {
+		cv1, ok1 := uiCounter(m1)
+		cv2, ok2 := uiCounter(msg2.(messages.CertifiedMessage))
+		if ok1 != ok2 || cv1 != cv2 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withoutInput returns a copy of Prepare message without input
+// chosen by the primary for execution. Any other message is returned
+// as is.
+func withoutInput(msg messages.Message) messages.Message {
+	if prep, ok := msg.(messages.Prepare); ok {
+		return messageImpl.NewPrepare(prep.ReplicaID(), prep.View(), prep.Request())
+	}
+	return msg
+}
+
+func uiCounter(msg messages.CertifiedMessage) (uint64, bool) {
+	ui := new(usig.UI)
+	if err := ui.UnmarshalBinary(msg.UIBytes()); err != nil {
+		return 0, false
+	}
+	return ui.Counter, true
+}
+
+func describeMessage(data []byte) string {
+	if data == nil {
+		return "none"
+	}
+	msg, err := messageImpl.NewFromBinary(data)
+	if err != nil {
+		return fmt.Sprintf("undecodable message (%s)", err)
+	}
+	return messages.Stringify(msg)
+}
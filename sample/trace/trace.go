@@ -0,0 +1,196 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records the network message exchange of a replica
+// and replays the recorded incoming messages into a fresh replica to
+// reproduce its behavior.
+//
+// A trace is a sequence of records, one per serialized message sent
+// or received through a message stream, in the order observed by the
+// replica. Records are stored as JSON objects, one per line.
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/minbft/api"
+)
+
+// Direction indicates whether a message was received or sent by the
+// replica.
+type Direction string
+
+const (
+	// Inbound messages are received by the replica
+	Inbound Direction = "in"
+	// Outbound messages are sent by the replica
+	Outbound Direction = "out"
+)
+
+// Peer labels of message streams, see Record.
+const (
+	peerStreamLabel    = "peer"
+	clientStreamLabel  = "client"
+	replicaStreamLabel = "replica %d"
+)
+
+// Record represents a single message in a trace.
+//
+// Stream identifies the message stream within the trace. Peer
+// describes the other end of the stream: "peer" or "client" for
+// streams handled by the replica as a server, and "replica N" for
+// streams the replica initiated to replica N.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Stream    uint64
+	Peer      string
+	Message   []byte
+}
+
+// Recorder writes records of messages passed through the message
+// stream handlers it wraps. It is safe to use concurrently.
+type Recorder struct {
+	lock       sync.Mutex
+	enc        *json.Encoder
+	err        error
+	nextStream uint64
+}
+
+// NewRecorder creates a new Recorder to write the trace to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error occurred writing the trace, if any.
+// Recording stops after the first error.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+// WrapReplica returns the replica with its message streams recorded.
+func (r *Recorder) WrapReplica(replica api.Replica) api.Replica {
+	return &recordedReplica{replica, r}
+}
+
+// WrapConnector returns the connector with message streams to peer
+// replicas recorded.
+func (r *Recorder) WrapConnector(conn api.ReplicaConnector) api.ReplicaConnector {
+	return &recordedConnector{conn, r}
+}
+
+func (r *Recorder) newStream() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nextStream++
+	return r.nextStream
+}
+
+func (r *Recorder) record(dir Direction, stream uint64, peer string, msg []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.err = r.enc.Encode(&Record{time.Now(), dir, stream, peer, msg})
+}
+
+// recordStream passes messages from in to the returned channel,
+// recording each message before passing it on.
+func (r *Recorder) recordStream(in <-chan []byte, dir Direction, stream uint64, peer string) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for msg := range in {
+			r.record(dir, stream, peer, msg)
+			out <- msg
+		}
+	}()
+	return out
+}
+
+type recordedReplica struct {
+	api.Replica
+	rec *Recorder
+}
+
+func (r *recordedReplica) PeerMessageStreamHandler() api.MessageStreamHandler {
+	return &recordedHandler{r.Replica.PeerMessageStreamHandler(), r.rec, peerStreamLabel, false}
+}
+
+func (r *recordedReplica) ClientMessageStreamHandler() api.MessageStreamHandler {
+	return &recordedHandler{r.Replica.ClientMessageStreamHandler(), r.rec, clientStreamLabel, false}
+}
+
+type recordedConnector struct {
+	api.ReplicaConnector
+	rec *Recorder
+}
+
+func (c *recordedConnector) ReplicaMessageStreamHandler(replicaID uint32) api.MessageStreamHandler {
+	h := c.ReplicaConnector.ReplicaMessageStreamHandler(replicaID)
+	if h == nil {
+		return nil
+	}
+	return &recordedHandler{h, c.rec, fmt.Sprintf(replicaStreamLabel, replicaID), true}
+}
+
+// recordedHandler records messages of each stream handled by the
+// wrapped handler. If initiated is true then the replica initiated
+// the stream, i.e. the input stream carries outbound messages.
+type recordedHandler struct {
+	api.MessageStreamHandler
+	rec       *Recorder
+	peer      string
+	initiated bool
+}
+
+func (h *recordedHandler) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	inDir, outDir := Inbound, Outbound
+	if h.initiated {
+		inDir, outDir = Outbound, Inbound
+	}
+
+	stream := h.rec.newStream()
+	in = h.rec.recordStream(in, inDir, stream, h.peer)
+	out := h.MessageStreamHandler.HandleMessageStream(in)
+	return h.rec.recordStream(out, outDir, stream, h.peer)
+}
+
+// Read reads all records of a trace. A record incompletely written
+// at the end of the trace is ignored.
+func Read(r io.Reader) ([]*Record, error) {
+	var records []*Record
+
+	dec := json.NewDecoder(r)
+	for {
+		rec := new(Record)
+		if err := dec.Decode(rec); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %s", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+}
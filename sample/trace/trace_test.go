@@ -0,0 +1,188 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	minbft "github.com/hyperledger-labs/minbft/core"
+)
+
+const fakeTimeout = 50 * time.Millisecond
+
+func TestClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewClock(start)
+
+	fired := make(chan int, 3)
+	clock.AfterFunc(2*time.Second, func() { fired <- 2 })
+	clock.AfterFunc(time.Second, func() { fired <- 1 })
+	stopped := clock.AfterFunc(time.Second, func() { fired <- 0 })
+	timer := clock.NewTimer(3 * time.Second)
+
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(start.Add(500 * time.Millisecond))
+	assert.Len(t, fired, 0)
+
+	clock.Advance(start.Add(2 * time.Second))
+	assert.ElementsMatch(t, []int{1, 2}, []int{<-fired, <-fired})
+	assert.Len(t, timer.Expired(), 0)
+
+	clock.Advance(start)
+	assert.Equal(t, start.Add(2*time.Second), clock.Now())
+
+	clock.Advance(start.Add(time.Hour))
+	assert.Equal(t, start.Add(3*time.Second), <-timer.Expired())
+	assert.False(t, timer.Stop())
+	assert.Len(t, fired, 0)
+}
+
+func TestRecordReplay(t *testing.T) {
+	buf := new(bytes.Buffer)
+	rec := NewRecorder(buf)
+
+	conn := rec.WrapConnector(&fakeConnector{make(chan []byte)})
+	replica := rec.WrapReplica(newFakeReplica(conn, stdTimers{}, "ack"))
+
+	in := make(chan []byte)
+	out := replica.ClientMessageStreamHandler().HandleMessageStream(in)
+	in <- []byte("a")
+	assert.Equal(t, "ack:a", string(<-out))
+	time.Sleep(2 * fakeTimeout)
+	in <- []byte("b")
+	assert.Equal(t, "ack:b", string(<-out))
+	close(in)
+	_, more := <-out
+	require.False(t, more)
+	time.Sleep(2 * fakeTimeout)
+	require.NoError(t, rec.Err()) // synchronizes with recording
+
+	records, err := Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Equal(t, Inbound, records[0].Direction)
+	assert.Equal(t, clientStreamLabel, records[0].Peer)
+	assert.Equal(t, "a", string(records[0].Message))
+	assert.Equal(t, Outbound, records[2].Direction)
+	assert.Equal(t, "replica 1", records[2].Peer)
+	assert.Equal(t, "timeout:a", string(records[2].Message))
+
+	// Truncated trace
+	partial, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	require.NoError(t, err)
+	assert.Len(t, partial, 5)
+
+	replay := func(prefix string) []*Divergence {
+		d, err := Replay(records, func(conn api.ReplicaConnector, clock *Clock) (api.ConnectionHandler, error) {
+			return newFakeReplica(conn, clock, prefix), nil
+		}, fakeTimeout)
+		require.NoError(t, err)
+		return d
+	}
+
+	assert.Empty(t, replay("ack"))
+
+	divergences := replay("nak")
+	require.Len(t, divergences, 1)
+	assert.Equal(t, clientStreamLabel, divergences[0].Peer)
+	assert.Equal(t, 0, divergences[0].Index)
+	assert.Equal(t, "ack:a", string(divergences[0].Expected))
+	assert.Equal(t, "nak:a", string(divergences[0].Actual))
+}
+
+// fakeReplica replies to each client message with the message
+// prefixed. Once the fake timeout expires after receiving a client
+// message, the message is sent to replica 1.
+type fakeReplica struct {
+	timers  minbft.TimerProvider
+	prefix  string
+	peerOut chan<- []byte
+}
+
+func newFakeReplica(conn api.ReplicaConnector, timers minbft.TimerProvider, prefix string) *fakeReplica {
+	peerOut := make(chan []byte, 10)
+	conn.ReplicaMessageStreamHandler(1).HandleMessageStream(peerOut)
+	return &fakeReplica{timers, prefix, peerOut}
+}
+
+func (r *fakeReplica) PeerMessageStreamHandler() api.MessageStreamHandler {
+	return r
+}
+
+func (r *fakeReplica) ClientMessageStreamHandler() api.MessageStreamHandler {
+	return r
+}
+
+func (r *fakeReplica) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for msg := range in {
+			msg := msg
+			r.timers.AfterFunc(fakeTimeout, func() {
+				r.peerOut <- append([]byte("timeout:"), msg...)
+			})
+			out <- append([]byte(r.prefix+":"), msg...)
+		}
+	}()
+	return out
+}
+
+func (r *fakeReplica) SubscribeCommitted(uint64, <-chan struct{}) (<-chan *api.CommittedOperation, error) {
+	return nil, nil
+}
+
+func (r *fakeReplica) Status() *api.ReplicaStatus {
+	return nil
+}
+
+type fakeConnector struct {
+	out chan []byte
+}
+
+func (c *fakeConnector) ReplicaMessageStreamHandler(uint32) api.MessageStreamHandler {
+	return c
+}
+
+func (c *fakeConnector) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	go func() {
+		for range in {
+		}
+	}()
+	return c.out
+}
+
+type stdTimers struct{}
+
+func (stdTimers) NewTimer(d time.Duration) minbft.Timer {
+	panic("not implemented")
+}
+
+func (stdTimers) AfterFunc(d time.Duration, f func()) minbft.Timer {
+	return stdTimer{time.AfterFunc(d, f)}
+}
+
+type stdTimer struct{ *time.Timer }
+
+func (t stdTimer) Expired() <-chan time.Time { return t.C }
+func (t stdTimer) Reset(d time.Duration)     { t.Timer.Reset(d) }
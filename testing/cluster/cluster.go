@@ -0,0 +1,504 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster provides means to run a complete MinBFT cluster of
+// replicas and clients within a single process. It is intended for
+// integration tests, benchmarks and experiments.
+//
+// Replicas and clients communicate through an in-process network
+// which allows to inject faults by filtering messages, as well as to
+// disconnect and reconnect individual replicas. Replicas can also be
+// stopped and restarted with fresh state. Clients follow the
+// membership changed by reconfiguration as soon as the first replica
+// switches to it.
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"text/template"
+
+	"github.com/hyperledger-labs/minbft/api"
+	cl "github.com/hyperledger-labs/minbft/client"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	authen "github.com/hyperledger-labs/minbft/sample/authentication"
+	"github.com/hyperledger-labs/minbft/sample/config"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/replicastub"
+	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+)
+
+// ConsumerFactory creates a request consumer for the specified
+// replica.
+type ConsumerFactory func(replicaID uint32) api.RequestConsumer
+
+// Cluster represents a running set of replicas and clients.
+type Cluster struct {
+	cfg      *config.ViperConfiger
+	keys     []byte
+	network  *network
+	replicas []*Replica
+	clients  []cl.Client
+
+	newConsumer ConsumerFactory
+	opt         options
+
+	membership clientMembership
+}
+
+// clientMembership makes the clients of the cluster follow the
+// membership. It implements api.MembershipObserver to be notified by
+// the replicas.
+type clientMembership struct {
+	lock    sync.Mutex
+	current *api.Membership
+	clients []cl.Client
+}
+
+// Replica represents a replica running in the cluster.
+type Replica struct {
+	id      uint32
+	cluster *Cluster
+	authen  *authen.Authenticator
+	node    *node
+
+	lock     sync.Mutex
+	instance api.Replica
+	consumer api.RequestConsumer
+	stopped  bool
+}
+
+type clientStack struct {
+	api.ReplicaConnector
+	api.Authenticator
+}
+
+const cfgTemplate = `
+protocol:
+  "n": {{.N}}
+  f: {{.F}}
+  checkpointPeriod: 10
+  logsize: 20
+  timeout:
+    request: {{.TimeoutRequest}}
+    prepare: {{.TimeoutPrepare}}
+    viewchange: {{.TimeoutViewChange}}
+`
+
+// New creates and starts a cluster of n replicas and m clients.
+// Replicas and clients are assigned IDs from 0 to n-1 and m-1,
+// respectively. Request consumers of replicas are created with the
+// supplied factory; if it is nil then each replica gets a new
+// instance of the sample SimpleLedger.
+func New(n, m int, newConsumer ConsumerFactory, opts ...Option) (*Cluster, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of replicas: %d", n)
+	}
+	if newConsumer == nil {
+		newConsumer = func(uint32) api.RequestConsumer {
+			return requestconsumer.NewSimpleLedger()
+		}
+	}
+
+	opt := newOptions(opts...)
+
+	cfg, err := makeConfig(n, &opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configuration: %s", err)
+	}
+
+	keys, err := makeKeys(n+opt.spareReplicas, m, &opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate keys: %s", err)
+	}
+
+	c := &Cluster{
+		cfg:         cfg,
+		keys:        keys,
+		network:     newNetwork(n+opt.spareReplicas, opt.filter),
+		newConsumer: newConsumer,
+		opt:         opt,
+	}
+
+	for i := 0; i < n; i++ {
+		if _, err := c.StartReplica(uint32(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < m; i++ {
+		client, err := c.startClient(uint32(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to start client %d: %s", i, err)
+		}
+		c.clients = append(c.clients, client)
+	}
+
+	return c, nil
+}
+
+// Config returns the configuration shared by all nodes.
+func (c *Cluster) Config() api.Configer {
+	return c.cfg
+}
+
+// Keystore returns the serialized keystore of the cluster in the
+// format used by the sample authentication package. It includes the
+// keys of operator 0 to authenticate administrative requests.
+func (c *Cluster) Keystore() []byte {
+	return c.keys
+}
+
+// Replicas returns all replicas started, in the order of their IDs.
+func (c *Cluster) Replicas() []*Replica {
+	return c.replicas
+}
+
+// Replica returns the replica with the specified ID, or nil if the
+// replica has not been started.
+func (c *Cluster) Replica(id uint32) *Replica {
+	for _, r := range c.replicas {
+		if r.id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// StartReplica starts a spare replica with the specified ID, see
+// WithSpareReplicas. The replica starts with the initial membership
+// and catches up with the others by processing the messages they
+// generated so far. It becomes a member once added by a
+// reconfiguration.
+func (c *Cluster) StartReplica(id uint32) (*Replica, error) {
+	if int(id) >= len(c.network.nodes) {
+		return nil, fmt.Errorf("no keys for replica %d", id)
+	} else if c.Replica(id) != nil {
+		return nil, fmt.Errorf("replica %d already started", id)
+	}
+
+	r, err := c.newReplica(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start replica %d: %s", id, err)
+	}
+
+	i := len(c.replicas)
+	for i > 0 && c.replicas[i-1].id > id {
+		i--
+	}
+	c.replicas = append(c.replicas, nil)
+	copy(c.replicas[i+1:], c.replicas[i:])
+	c.replicas[i] = r
+
+	return r, nil
+}
+
+// Clients returns all clients in the order of their IDs.
+func (c *Cluster) Clients() []cl.Client {
+	return c.clients
+}
+
+// Client returns the client with the specified ID.
+func (c *Cluster) Client(id uint32) cl.Client {
+	return c.clients[id]
+}
+
+// SetMessageFilter replaces the message filter of the in-process
+// network. Passing nil removes the filter so that all messages are
+// delivered intact.
+func (c *Cluster) SetMessageFilter(filter MessageFilter) {
+	c.network.setFilter(filter)
+}
+
+// Close tears the cluster down. It shuts down the in-process network,
+// so that replicas and clients can no longer communicate and their
+// message streams are closed, and closes request consumers that
+// implement io.Closer. The cluster cannot be used afterwards.
+func (c *Cluster) Close() error {
+	c.network.close()
+
+	var err error
+	for _, r := range c.replicas {
+		r.lock.Lock()
+		if !r.stopped {
+			if e := closeConsumer(r.consumer); e != nil && err == nil {
+				err = fmt.Errorf("failed to close consumer of replica %d: %s", r.id, e)
+			}
+		}
+		r.lock.Unlock()
+	}
+
+	return err
+}
+
+// ID returns the replica ID.
+func (r *Replica) ID() uint32 {
+	return r.id
+}
+
+// Instance returns the current replica instance.
+func (r *Replica) Instance() api.Replica {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.instance
+}
+
+// Consumer returns the request consumer of the current replica
+// instance.
+func (r *Replica) Consumer() api.RequestConsumer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.consumer
+}
+
+// Authenticator returns the authenticator of the replica.
+func (r *Replica) Authenticator() api.Authenticator {
+	return r.authen
+}
+
+// Disconnect partitions the replica from the rest of the cluster.
+// The replica keeps its state; messages to and from the replica are
+// held back until the replica is reconnected.
+func (r *Replica) Disconnect() {
+	r.node.gate.close()
+}
+
+// Reconnect reconnects the disconnected replica to the network. The
+// held messages are delivered in their original order, as permitted
+// by the eventual delivery guarantee of replica connections.
+func (r *Replica) Reconnect() {
+	r.node.gate.open()
+}
+
+// Connected returns true unless the replica is disconnected.
+func (r *Replica) Connected() bool {
+	return r.node.gate.isOpen()
+}
+
+// Stop stops the replica as if it crashed. The replica instance
+// receives no more messages, its replies to clients are discarded,
+// and its request consumer is closed if it implements io.Closer.
+// Messages the replica generated for other replicas before it was
+// stopped are still delivered.
+func (r *Replica) Stop() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.stopped {
+		return fmt.Errorf("replica %d already stopped", r.id)
+	}
+	r.stopped = true
+	r.node.stop()
+
+	if err := closeConsumer(r.consumer); err != nil {
+		return fmt.Errorf("failed to close consumer of replica %d: %s", r.id, err)
+	}
+
+	return nil
+}
+
+// Restart starts the stopped replica again with fresh state and a
+// new request consumer created by the factory of the cluster. The
+// replica keeps its USIG instance, so that it continues to certify
+// messages under the same USIG identity, and catches up with the
+// others by processing the messages they generated so far.
+func (r *Replica) Restart() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.stopped {
+		return fmt.Errorf("replica %d not stopped", r.id)
+	}
+	if err := r.start(); err != nil {
+		return fmt.Errorf("failed to restart replica %d: %s", r.id, err)
+	}
+	r.stopped = false
+
+	return nil
+}
+
+// Stopped returns true if the replica is stopped.
+func (r *Replica) Stopped() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.stopped
+}
+
+func (c *Cluster) newReplica(id uint32) (*Replica, error) {
+	roles := []api.AuthenticationRole{api.ReplicaAuthen, api.USIGAuthen}
+
+	var au *authen.Authenticator
+	var err error
+	if c.opt.usigEnclaveFile != "" {
+		au, err = authen.NewWithSGXUSIG(roles, id, bytes.NewBuffer(c.keys), c.opt.usigEnclaveFile)
+	} else {
+		au, err = authen.NewWithSoftUSIG(roles, id, bytes.NewBuffer(c.keys))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %s", err)
+	}
+
+	r := &Replica{
+		id:      id,
+		cluster: c,
+		authen:  au,
+		node:    c.network.nodes[id],
+	}
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// start creates a new replica instance with a new request consumer
+// and makes it the new incarnation of the replica in the network.
+func (r *Replica) start() error {
+	c := r.cluster
+
+	consumer := c.newConsumer(r.id)
+	stack := minbft.NewStack(c.network.connector(ReplicaEndpoint(r.id)), r.authen, consumer)
+
+	stub := replicastub.New()
+	r.node.start(stub)
+
+	replicaOpts := append(c.opt.replicaOpts[:len(c.opt.replicaOpts):len(c.opt.replicaOpts)], c.opt.replicaOptsOf[r.id]...)
+	replicaOpts = append(replicaOpts, minbft.WithMembershipObserver(&c.membership))
+	instance, err := minbft.New(r.id, c.cfg, stack, replicaOpts...)
+	if err != nil {
+		r.node.stop()
+		closeConsumer(consumer) //nolint:errcheck
+		return err
+	}
+	stub.AssignReplica(instance)
+
+	r.instance = instance
+	r.consumer = consumer
+
+	return nil
+}
+
+func closeConsumer(consumer api.RequestConsumer) error {
+	if closer, ok := consumer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *Cluster) startClient(id uint32) (cl.Client, error) {
+	au, err := authen.New([]api.AuthenticationRole{api.ClientAuthen}, id, bytes.NewBuffer(c.keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticator: %s", err)
+	}
+
+	stack := &clientStack{c.network.connector(ClientEndpoint(id)), au}
+
+	return c.membership.startClient(func(current *api.Membership) (cl.Client, error) {
+		opts := c.opt.clientOpts
+		if current != nil {
+			opts = append(opts[:len(opts):len(opts)], cl.WithMembership(current))
+		}
+		return cl.New(id, c.cfg.N(), c.cfg.F(), stack, opts...)
+	})
+}
+
+// startClient starts a client with the supplied function given the
+// current membership, if changed, and makes it follow the membership.
+func (cm *clientMembership) startClient(start func(current *api.Membership) (cl.Client, error)) (cl.Client, error) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	client, err := start(cm.current)
+	if err != nil {
+		return nil, err
+	}
+	cm.clients = append(cm.clients, client)
+
+	return client, nil
+}
+
+// MembershipChanged notifies the clients of a membership newer than
+// the current one.
+func (cm *clientMembership) MembershipChanged(m *api.Membership) error {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	if cm.current != nil && m.Epoch <= cm.current.Epoch {
+		return nil
+	}
+	cm.current = m
+
+	for _, client := range cm.clients {
+		if err := client.MembershipChanged(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func makeConfig(n int, opt *options) (*config.ViperConfiger, error) {
+	var buf bytes.Buffer
+
+	t := template.Must(template.New("cfgTemplate").Parse(cfgTemplate))
+	if err := t.Execute(&buf, map[string]interface{}{
+		"N":                 n,
+		"F":                 (n - 1) / 2,
+		"TimeoutRequest":    opt.timeoutRequest,
+		"TimeoutPrepare":    opt.timeoutPrepare,
+		"TimeoutViewChange": opt.timeoutViewChange,
+	}); err != nil {
+		return nil, err
+	}
+
+	cfg := config.New()
+	if err := cfg.ReadConfig(&buf, "yaml"); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func makeKeys(n, m int, opt *options) ([]byte, error) {
+	const keySpec = "ECDSA"
+
+	usigKeySpec := "SOFT_ECDSA"
+	if opt.usigEnclaveFile != "" {
+		usigKeySpec = "SGX_ECDSA"
+	}
+
+	var buf bytes.Buffer
+	if err := authen.GenerateTestnetKeys(&buf, &authen.TestnetKeyOpts{
+		NumberReplicas:  n,
+		ReplicaKeySpec:  keySpec,
+		ReplicaSecParam: 256,
+		NumberClients:   m,
+		ClientKeySpec:   keySpec,
+		ClientSecParam:  256,
+		UsigEnclaveFile: opt.usigEnclaveFile,
+		UsigKeySpec:     usigKeySpec,
+
+		NumberOperators:  1,
+		OperatorKeySpec:  keySpec,
+		OperatorSecParam: 256,
+	}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logging "github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger-labs/minbft/api"
+	cl "github.com/hyperledger-labs/minbft/client"
+	minbft "github.com/hyperledger-labs/minbft/core"
+	"github.com/hyperledger-labs/minbft/sample/requestconsumer"
+)
+
+const waitDuration = 200 * time.Millisecond
+
+func newTestCluster(t *testing.T, n, m int, opts ...Option) *Cluster {
+	opts = append(opts, WithReplicaOptions(minbft.WithLogLevel(logging.WARNING)))
+	c, err := New(n, m, nil, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, c.Close()) })
+	return c
+}
+
+// execute requests execution of the operation and requires it to be
+// executed successfully.
+func execute(t *testing.T, client cl.Client, operation string) {
+	out := <-client.Execute([]byte(operation))
+	require.NoError(t, out.Err)
+}
+
+func ledgerLength(r *Replica) uint64 {
+	return r.Consumer().(*requestconsumer.SimpleLedger).GetLength()
+}
+
+func TestClusterRequests(t *testing.T) {
+	c := newTestCluster(t, 3, 2)
+
+	require.Len(t, c.Replicas(), 3)
+	require.Len(t, c.Clients(), 2)
+
+	execute(t, c.Client(0), "request 1")
+	execute(t, c.Client(1), "request 2")
+
+	time.Sleep(waitDuration)
+
+	for _, r := range c.Replicas() {
+		assert.True(t, r.Connected())
+		assert.Equal(t, uint64(2), ledgerLength(r))
+	}
+}
+
+func TestClusterDisconnectReconnect(t *testing.T) {
+	c := newTestCluster(t, 3, 1)
+	disconnected := c.Replica(2)
+
+	disconnected.Disconnect()
+	assert.False(t, disconnected.Connected())
+
+	execute(t, c.Client(0), "request")
+
+	time.Sleep(waitDuration)
+	assert.Equal(t, uint64(1), ledgerLength(c.Replica(0)))
+	assert.Equal(t, uint64(1), ledgerLength(c.Replica(1)))
+	assert.Equal(t, uint64(0), ledgerLength(disconnected))
+
+	disconnected.Reconnect()
+	assert.True(t, disconnected.Connected())
+
+	time.Sleep(waitDuration)
+	assert.Equal(t, uint64(1), ledgerLength(disconnected))
+}
+
+func TestClusterStopRestart(t *testing.T) {
+	c := newTestCluster(t, 3, 1)
+	restarted := c.Replica(2)
+
+	execute(t, c.Client(0), "request 1")
+
+	require.NoError(t, restarted.Stop())
+	assert.True(t, restarted.Stopped())
+	assert.Error(t, restarted.Stop())
+
+	execute(t, c.Client(0), "request 2")
+
+	require.NoError(t, restarted.Restart())
+	assert.False(t, restarted.Stopped())
+	assert.Error(t, restarted.Restart())
+
+	execute(t, c.Client(0), "request 3")
+
+	time.Sleep(waitDuration)
+	digest := c.Replica(0).Consumer().StateDigest()
+	for _, r := range c.Replicas() {
+		assert.Equal(t, uint64(3), ledgerLength(r), "replica %d", r.ID())
+		assert.Equal(t, digest, r.Consumer().StateDigest(), "replica %d", r.ID())
+	}
+}
+
+func TestClusterRestartPersistentLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cluster")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ledgerDir := func(id uint32) string {
+		return filepath.Join(dir, fmt.Sprint(id))
+	}
+	newLedger := func(id uint32) api.RequestConsumer {
+		l, err := requestconsumer.NewPersistentSimpleLedger(ledgerDir(id))
+		if err != nil {
+			panic(err)
+		}
+		return l
+	}
+
+	c, err := New(3, 1, newLedger, WithReplicaOptions(minbft.WithLogLevel(logging.WARNING)))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, c.Close()) }()
+	restarted := c.Replica(2)
+
+	execute(t, c.Client(0), "request 1")
+	execute(t, c.Client(0), "request 2")
+
+	time.Sleep(waitDuration)
+	require.NoError(t, restarted.Stop())
+
+	execute(t, c.Client(0), "request 3")
+
+	require.NoError(t, restarted.Restart())
+	assert.Equal(t, uint64(2), ledgerLength(restarted))
+
+	execute(t, c.Client(0), "request 4")
+
+	time.Sleep(waitDuration)
+	digest := c.Replica(0).Consumer().StateDigest()
+	for _, r := range c.Replicas() {
+		assert.Equal(t, uint64(4), ledgerLength(r), "replica %d", r.ID())
+		assert.Equal(t, digest, r.Consumer().StateDigest(), "replica %d", r.ID())
+	}
+
+	stored, err := requestconsumer.ReadSimpleLedger(ledgerDir(restarted.ID()))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), stored.GetLength())
+	assert.Equal(t, digest, stored.StateDigest())
+}
+
+func TestClusterClose(t *testing.T) {
+	c, err := New(3, 1, nil, WithReplicaOptions(minbft.WithLogLevel(logging.WARNING)))
+	require.NoError(t, err)
+
+	execute(t, c.Client(0), "request")
+	require.NoError(t, c.Close())
+
+	select {
+	case <-c.Client(0).Execute([]byte("request after close")):
+		t.Error("Request executed after close")
+	case <-time.After(waitDuration):
+	}
+	for _, r := range c.Replicas() {
+		assert.False(t, r.Connected())
+		assert.Equal(t, uint64(1), ledgerLength(r))
+	}
+	assert.NoError(t, c.Close())
+}
+
+func TestClusterMessageFilter(t *testing.T) {
+	var dropped int32
+	c := newTestCluster(t, 3, 1, WithMessageFilter(func(src, dst Endpoint, msg []byte) []byte {
+		if dst == ReplicaEndpoint(2) {
+			atomic.AddInt32(&dropped, 1)
+			return nil
+		}
+		return msg
+	}))
+
+	execute(t, c.Client(0), "request 1")
+
+	time.Sleep(waitDuration)
+	assert.NotZero(t, atomic.LoadInt32(&dropped))
+	assert.Equal(t, uint64(0), ledgerLength(c.Replica(2)))
+
+	c.SetMessageFilter(nil)
+
+	execute(t, c.Client(0), "request 2")
+
+	time.Sleep(waitDuration)
+	assert.Equal(t, uint64(2), ledgerLength(c.Replica(0)))
+	assert.Equal(t, uint64(2), ledgerLength(c.Replica(1)))
+}
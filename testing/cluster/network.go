@@ -0,0 +1,500 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/api"
+	"github.com/hyperledger-labs/minbft/sample/conn/common/replicastub"
+)
+
+// Endpoint identifies a node in the cluster.
+type Endpoint struct {
+	// Client indicates if the node is a client, not a replica
+	Client bool
+
+	// ID of the replica or client
+	ID uint32
+}
+
+// ReplicaEndpoint returns an endpoint of the specified replica.
+func ReplicaEndpoint(id uint32) Endpoint {
+	return Endpoint{ID: id}
+}
+
+// ClientEndpoint returns an endpoint of the specified client.
+func ClientEndpoint(id uint32) Endpoint {
+	return Endpoint{Client: true, ID: id}
+}
+
+func (e Endpoint) String() string {
+	if e.Client {
+		return fmt.Sprintf("client %d", e.ID)
+	}
+	return fmt.Sprintf("replica %d", e.ID)
+}
+
+// MessageFilter injects faults into the in-process network.
+//
+// It is invoked for each serialized message passed from src to dst
+// endpoint. It returns the message to deliver, which can be either
+// the supplied message or some modified message, or nil to drop the
+// message. The filter may block to delay the message delivery. It
+// may be invoked concurrently.
+type MessageFilter func(src, dst Endpoint, msg []byte) []byte
+
+// gate blocks the message flow to/from a replica while it is
+// disconnected.
+type gate struct {
+	sync.Mutex
+	disconnected bool
+	shutdown     bool
+	changed      *sync.Cond
+}
+
+func newGate() *gate {
+	g := &gate{}
+	g.changed = sync.NewCond(g)
+	return g
+}
+
+func (g *gate) close() {
+	g.Lock()
+	defer g.Unlock()
+
+	g.disconnected = true
+}
+
+func (g *gate) open() {
+	g.Lock()
+	defer g.Unlock()
+
+	g.disconnected = false
+	g.changed.Broadcast()
+}
+
+func (g *gate) isOpen() bool {
+	g.Lock()
+	defer g.Unlock()
+
+	return !g.disconnected && !g.shutdown
+}
+
+// shut closes the gate permanently.
+func (g *gate) shut() {
+	g.Lock()
+	defer g.Unlock()
+
+	g.shutdown = true
+	g.changed.Broadcast()
+}
+
+// wait blocks while the gate is closed. It returns false if the gate
+// is closed permanently.
+func (g *gate) wait() bool {
+	g.Lock()
+	defer g.Unlock()
+
+	for g.disconnected && !g.shutdown {
+		g.changed.Wait()
+	}
+
+	return !g.shutdown
+}
+
+// node represents a replica in the in-process network. The replica
+// can be stopped and started again; each start creates a new
+// incarnation of the node.
+type node struct {
+	gate *gate
+
+	lock    sync.Mutex
+	current *incarnation
+
+	// closed and replaced once a new incarnation starts
+	started chan struct{}
+}
+
+// incarnation represents a replica instance running at a node.
+type incarnation struct {
+	stub replicastub.ReplicaStub
+
+	// closed once the instance is stopped
+	stopped chan struct{}
+}
+
+func newNode() *node {
+	return &node{
+		gate:    newGate(),
+		started: make(chan struct{}),
+	}
+}
+
+// start makes the supplied replica stub the new incarnation of the
+// node.
+func (n *node) start(stub replicastub.ReplicaStub) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.current = &incarnation{stub: stub, stopped: make(chan struct{})}
+	close(n.started)
+	n.started = make(chan struct{})
+}
+
+// stop stops the current incarnation of the node.
+func (n *node) stop() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	close(n.current.stopped)
+}
+
+// await blocks until an incarnation following the supplied one is
+// running and returns it, or returns nil once the done channel is
+// closed.
+func (n *node) await(prev *incarnation, done <-chan struct{}) *incarnation {
+	for {
+		n.lock.Lock()
+		inc, started := n.current, n.started
+		n.lock.Unlock()
+
+		if inc != nil && inc != prev && !inc.isStopped() {
+			return inc
+		}
+
+		select {
+		case <-started:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (inc *incarnation) isStopped() bool {
+	select {
+	case <-inc.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// messageQueue holds messages passed through a link. If the history
+// is kept, all messages are held; otherwise, messages are discarded
+// once delivered.
+type messageQueue struct {
+	sync.Mutex
+	msgs        [][]byte
+	base        int // index of msgs[0]
+	keepHistory bool
+	closed      bool
+
+	// closed and replaced once a message is added
+	added chan struct{}
+}
+
+func newMessageQueue(keepHistory bool) *messageQueue {
+	return &messageQueue{
+		keepHistory: keepHistory,
+		added:       make(chan struct{}),
+	}
+}
+
+// fill adds messages from the supplied channel until it is closed.
+func (q *messageQueue) fill(in <-chan []byte) {
+	for msg := range in {
+		q.Lock()
+		q.msgs = append(q.msgs, msg)
+		close(q.added)
+		q.added = make(chan struct{})
+		q.Unlock()
+	}
+
+	q.Lock()
+	q.closed = true
+	close(q.added)
+	q.Unlock()
+}
+
+// get returns the message with the specified index. If the message
+// is not yet added, it returns a channel closed once another message
+// is added. It returns false if the message has been discarded or no
+// more messages can be added.
+func (q *messageQueue) get(i int) (msg []byte, added <-chan struct{}, ok bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if i < q.base {
+		return nil, nil, false // discarded after delivery
+	}
+	if !q.keepHistory && i > q.base {
+		q.msgs = q.msgs[i-q.base:]
+		q.base = i
+	}
+
+	if i-q.base < len(q.msgs) {
+		return q.msgs[i-q.base], nil, true
+	} else if q.closed {
+		return nil, nil, false
+	}
+	return nil, q.added, true
+}
+
+// len returns the number of messages added so far.
+func (q *messageQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.base + len(q.msgs)
+}
+
+// connector implements api.ReplicaConnector for an endpoint in the
+// in-process network.
+type connector struct {
+	network *network
+	src     Endpoint
+}
+
+func (c *connector) ReplicaMessageStreamHandler(id uint32) api.MessageStreamHandler {
+	if int(id) >= len(c.network.nodes) || c.network.isClosed() {
+		return nil
+	}
+	if !c.src.Client && c.src.ID == id {
+		return nil
+	}
+
+	return &link{c.network, c.src, ReplicaEndpoint(id)}
+}
+
+// link connects an endpoint with a replica through the in-process
+// network.
+type link struct {
+	network  *network
+	src, dst Endpoint
+}
+
+// HandleMessageStream passes the messages to each incarnation of the
+// destination replica in turn. A replica started again receives all
+// messages from other replicas from the beginning, as if the peer
+// replicas re-established the connection; messages from clients sent
+// meanwhile are lost.
+func (l *link) HandleMessageStream(in <-chan []byte) <-chan []byte {
+	q := newMessageQueue(!l.src.Client)
+	go q.fill(in)
+
+	replies := make(chan []byte)
+	go func() {
+		var inc *incarnation
+		pos := 0
+		for {
+			if inc = l.network.nodes[l.dst.ID].await(inc, l.network.done); inc == nil {
+				return
+			}
+			var sh api.MessageStreamHandler
+			if l.src.Client {
+				sh = inc.stub.ClientMessageStreamHandler()
+			} else {
+				sh = inc.stub.PeerMessageStreamHandler()
+			}
+
+			fwd := make(chan []byte)
+			go l.network.feed(l.src, l.dst, q, pos, inc, fwd)
+			go l.network.collect(sh.HandleMessageStream(fwd), inc, replies)
+
+			select {
+			case <-inc.stopped:
+			case <-l.network.done:
+				return
+			}
+			if l.src.Client {
+				pos = q.len()
+			}
+		}
+	}()
+
+	out := make(chan []byte)
+	go l.network.pump(l.dst, l.src, replies, out)
+
+	return out
+}
+
+// network represents the in-process network connecting replicas and
+// clients.
+type network struct {
+	nodes []*node
+
+	// closed when the network is shut down
+	done chan struct{}
+
+	filterLock sync.RWMutex
+	filter     MessageFilter
+}
+
+func newNetwork(n int, filter MessageFilter) *network {
+	nw := &network{
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+
+	for i := 0; i < n; i++ {
+		nw.nodes = append(nw.nodes, newNode())
+	}
+
+	return nw
+}
+
+func (nw *network) connector(src Endpoint) api.ReplicaConnector {
+	return &connector{nw, src}
+}
+
+func (nw *network) setFilter(filter MessageFilter) {
+	nw.filterLock.Lock()
+	defer nw.filterLock.Unlock()
+
+	nw.filter = filter
+}
+
+func (nw *network) applyFilter(src, dst Endpoint, msg []byte) []byte {
+	nw.filterLock.RLock()
+	filter := nw.filter
+	nw.filterLock.RUnlock()
+
+	if filter == nil {
+		return msg
+	}
+
+	return filter(src, dst, msg)
+}
+
+// close shuts the network down. Messages are no longer delivered and
+// message streams are closed.
+func (nw *network) close() {
+	select {
+	case <-nw.done:
+		return
+	default:
+	}
+
+	close(nw.done)
+	for _, n := range nw.nodes {
+		n.gate.shut()
+	}
+}
+
+func (nw *network) isClosed() bool {
+	select {
+	case <-nw.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitConnected blocks while the endpoint is disconnected. It returns
+// false once the network is shut down.
+func (nw *network) waitConnected(e Endpoint) bool {
+	if e.Client {
+		return !nw.isClosed()
+	}
+	return nw.nodes[e.ID].gate.wait()
+}
+
+// deliver passes the message from src to dst endpoint through the
+// out channel. The message is held while any of the endpoints is
+// disconnected. It returns false if the message cannot be delivered
+// anymore, i.e. the network is shut down or the stop channel is
+// closed.
+func (nw *network) deliver(src, dst Endpoint, msg []byte, out chan<- []byte, stop <-chan struct{}) bool {
+	if !nw.waitConnected(src) || !nw.waitConnected(dst) {
+		return false
+	}
+
+	if msg = nw.applyFilter(src, dst, msg); msg == nil {
+		return true
+	}
+
+	select {
+	case out <- msg:
+		return true
+	case <-stop:
+	case <-nw.done:
+	}
+	return false
+}
+
+// feed passes messages from the queue, starting with the specified
+// index, to the incarnation of dst replica until it is stopped.
+func (nw *network) feed(src, dst Endpoint, q *messageQueue, pos int, inc *incarnation, fwd chan<- []byte) {
+	defer close(fwd)
+
+	for i := pos; ; {
+		msg, added, ok := q.get(i)
+		if !ok {
+			return
+		} else if added != nil {
+			select {
+			case <-added:
+				continue
+			case <-inc.stopped:
+			case <-nw.done:
+			}
+			return
+		}
+
+		if inc.isStopped() || !nw.deliver(src, dst, msg, fwd, inc.stopped) {
+			return
+		}
+		i++
+	}
+}
+
+// collect passes messages produced by the incarnation to the
+// supplied channel until the incarnation is stopped. Messages
+// produced afterwards are discarded.
+func (nw *network) collect(in <-chan []byte, inc *incarnation, out chan<- []byte) {
+	for msg := range in {
+		if inc.isStopped() {
+			continue
+		}
+		select {
+		case out <- msg:
+		case <-inc.stopped:
+		case <-nw.done:
+			return
+		}
+	}
+}
+
+// pump passes messages from in to out channel on their way from src
+// to dst endpoint. Messages are held while any of the endpoints is
+// disconnected and delivered in original order once both are
+// connected. Once the network is shut down, the out channel is closed
+// and any further messages are discarded.
+func (nw *network) pump(src, dst Endpoint, in <-chan []byte, out chan<- []byte) {
+	defer close(out)
+
+	for {
+		select {
+		case msg := <-in:
+			if !nw.deliver(src, dst, msg, out, nil) {
+				return
+			}
+		case <-nw.done:
+			return
+		}
+	}
+}
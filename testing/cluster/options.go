@@ -0,0 +1,118 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"time"
+
+	cl "github.com/hyperledger-labs/minbft/client"
+	minbft "github.com/hyperledger-labs/minbft/core"
+)
+
+type options struct {
+	usigEnclaveFile string
+
+	timeoutRequest    time.Duration
+	timeoutPrepare    time.Duration
+	timeoutViewChange time.Duration
+
+	filter MessageFilter
+
+	spareReplicas int
+
+	replicaOpts   []minbft.Option
+	replicaOptsOf map[uint32][]minbft.Option
+	clientOpts    []cl.Option
+}
+
+// Option represents a parameter to create a cluster with.
+type Option func(*options)
+
+func newOptions(opts ...Option) options {
+	opt := options{
+		timeoutRequest:    2 * time.Second,
+		timeoutPrepare:    1 * time.Second,
+		timeoutViewChange: 3 * time.Second,
+	}
+
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	return opt
+}
+
+// WithSGXUSIG specifies to use SGX USIG loaded from the supplied
+// enclave file. Software USIG is used by default.
+func WithSGXUSIG(enclaveFile string) Option {
+	return func(opts *options) {
+		opts.usigEnclaveFile = enclaveFile
+	}
+}
+
+// WithTimeouts specifies request, prepare and view change timeouts
+// of the consensus protocol.
+func WithTimeouts(request, prepare, viewChange time.Duration) Option {
+	return func(opts *options) {
+		opts.timeoutRequest = request
+		opts.timeoutPrepare = prepare
+		opts.timeoutViewChange = viewChange
+	}
+}
+
+// WithMessageFilter specifies the initial message filter to inject
+// faults into the network. See Cluster.SetMessageFilter.
+func WithMessageFilter(filter MessageFilter) Option {
+	return func(opts *options) {
+		opts.filter = filter
+	}
+}
+
+// WithSpareReplicas specifies to generate keys for k more replicas
+// with IDs following those of the initial replicas. Spare replicas
+// can join the cluster by reconfiguration, see Cluster.StartReplica.
+func WithSpareReplicas(k int) Option {
+	return func(opts *options) {
+		opts.spareReplicas = k
+	}
+}
+
+// WithReplicaOptions specifies options to create each replica
+// instance with, e.g. logging options.
+func WithReplicaOptions(replicaOpts ...minbft.Option) Option {
+	return func(opts *options) {
+		opts.replicaOpts = append(opts.replicaOpts, replicaOpts...)
+	}
+}
+
+// WithReplicaOptionsOf specifies options to create the replica
+// instance with the supplied ID with, in addition to those specified
+// for each replica, e.g. to configure replicas differently.
+func WithReplicaOptionsOf(id uint32, replicaOpts ...minbft.Option) Option {
+	return func(opts *options) {
+		if opts.replicaOptsOf == nil {
+			opts.replicaOptsOf = make(map[uint32][]minbft.Option)
+		}
+		opts.replicaOptsOf[id] = append(opts.replicaOptsOf[id], replicaOpts...)
+	}
+}
+
+// WithClientOptions specifies options to create each client instance
+// with, e.g. to batch operations.
+func WithClientOptions(clientOpts ...cl.Option) Option {
+	return func(opts *options) {
+		opts.clientOpts = append(opts.clientOpts, clientOpts...)
+	}
+}
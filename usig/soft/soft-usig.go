@@ -0,0 +1,246 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package soft provides a software implementation of USIG.
+//
+// The implementation keeps its key pair and counter in the ordinary
+// process memory, thus it provides no protection against a faulty
+// replica. It is intended for testing and development environments
+// where a trusted execution environment is not available. Unique
+// identifiers, certificates and identities produced by this
+// implementation follow the same format as the SGX USIG.
+package soft
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/hyperledger-labs/minbft/usig"
+)
+
+// USIG implements USIG interface in software.
+type USIG struct {
+	lock    sync.Mutex
+	key     *ecdsa.PrivateKey
+	epoch   uint64
+	counter uint64
+}
+
+var _ usig.USIG = new(USIG)
+
+// New creates a new instance of software USIG. The supplied ECDSA
+// private key is used to sign the produced unique identifiers. If
+// nil is passed instead then a new key pair is generated. Each
+// instance initializes its epoch value randomly.
+func New(key *ecdsa.PrivateKey) (*USIG, error) {
+	if key == nil {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key pair: %v", err)
+		}
+	}
+
+	var epoch uint64
+	if err := binary.Read(rand.Reader, binary.BigEndian, &epoch); err != nil {
+		return nil, fmt.Errorf("failed to generate epoch value: %v", err)
+	}
+
+	return &USIG{key: key, epoch: epoch}, nil
+}
+
+// CreateUI creates a unique identifier assigned to the message.
+func (u *USIG) CreateUI(message []byte) (*usig.UI, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	counter := u.counter + 1
+	hash := signedHash(messageDigest(message), u.epoch, counter)
+
+	r, s, err := ecdsa.Sign(rand.Reader, u.key, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign UI: %v", err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		panic(err)
+	}
+
+	u.counter = counter
+
+	return &usig.UI{
+		Counter: counter,
+		Cert:    MakeCert(u.epoch, signature),
+	}, nil
+}
+
+// VerifyUI is just a wrapper around the VerifyUI function at the
+// package-level.
+func (u *USIG) VerifyUI(message []byte, ui *usig.UI, usigID []byte) error {
+	return VerifyUI(message, ui, usigID)
+}
+
+// ID returns the USIG instance identity.
+func (u *USIG) ID() []byte {
+	id, err := MakeID(u.epoch, u.PublicKey())
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// Epoch returns the unique epoch value of this USIG instance.
+func (u *USIG) Epoch() uint64 {
+	return u.epoch
+}
+
+// PublicKey returns the public part of the key used by this USIG
+// instance to sign unique identifiers it produces.
+func (u *USIG) PublicKey() crypto.PublicKey {
+	return &u.key.PublicKey
+}
+
+// VerifyUI verifies unique identifier generated for the message by
+// USIG with the specified identity.
+func VerifyUI(message []byte, ui *usig.UI, usigID []byte) error {
+	epoch, pubKey, err := ParseID(usigID)
+	if err != nil {
+		return fmt.Errorf("failed to parse USIG ID: %s", err)
+	}
+
+	uiEpoch, signature, err := ParseCert(ui.Cert)
+	if err != nil {
+		return fmt.Errorf("failed to parse UI cert: %s", err)
+	}
+
+	if uiEpoch != epoch {
+		return fmt.Errorf("epoch value mismatch")
+	}
+
+	ecdsaPubKey, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("invalid USIG ID format: expected ECDSA public key")
+	}
+
+	ecdsaSignature := new(struct{ R, S *big.Int })
+	rest, err := asn1.Unmarshal(signature, ecdsaSignature)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal USIG signature: %v", err)
+	} else if len(rest) != 0 {
+		return fmt.Errorf("extra bytes in USIG signature")
+	}
+
+	hash := signedHash(messageDigest(message), epoch, ui.Counter)
+	if !ecdsa.Verify(ecdsaPubKey, hash[:], ecdsaSignature.R, ecdsaSignature.S) {
+		return fmt.Errorf("signature not valid")
+	}
+
+	return nil
+}
+
+// MakeID composes a USIG identity which is 64-bit big-endian encoded
+// epoch value followed by public key serialized in PKIX format.
+func MakeID(epoch uint64, publicKey interface{}) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize public key: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := binary.Write(buf, binary.BigEndian, epoch); err != nil {
+		panic(err)
+	}
+
+	if err := binary.Write(buf, binary.BigEndian, publicKeyBytes); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ParseID breaks a USIG identity down to epoch value and public key.
+func ParseID(usigID []byte) (epoch uint64, pubKey crypto.PublicKey, err error) {
+	buf := bytes.NewBuffer(usigID)
+
+	err = binary.Read(buf, binary.BigEndian, &epoch)
+	if err != nil {
+		return uint64(0), nil, fmt.Errorf("failed to extract epoch from USIG ID: %s", err)
+	}
+
+	pubKey, err = x509.ParsePKIXPublicKey(buf.Bytes())
+	if err != nil {
+		return uint64(0), nil, fmt.Errorf("failed to parse public key: %s", err)
+	}
+
+	return epoch, pubKey, err
+}
+
+// MakeCert composes a USIG certificate which is 64-bit big-endian
+// encoded epoch value followed by serialized USIG signature.
+func MakeCert(epoch uint64, signature []byte) []byte {
+	buf := new(bytes.Buffer)
+
+	if err := binary.Write(buf, binary.BigEndian, epoch); err != nil {
+		panic(err)
+	}
+
+	if err := binary.Write(buf, binary.BigEndian, signature); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// ParseCert breaks a USIG certificate down to epoch value and
+// serialized USIG signature.
+func ParseCert(cert []byte) (epoch uint64, signature []byte, err error) {
+	buf := bytes.NewBuffer(cert)
+
+	err = binary.Read(buf, binary.BigEndian, &epoch)
+	if err != nil {
+		return uint64(0), nil, fmt.Errorf("failed to extract epoch from USIG cert: %s", err)
+	}
+
+	return epoch, buf.Bytes(), nil
+}
+
+func messageDigest(message []byte) [sha256.Size]byte {
+	return sha256.Sum256(message)
+}
+
+// signedHash computes the hash signed by USIG. The signature covers
+// the message digest followed by the epoch and counter values in
+// little-endian byte order, same as in SGX USIG enclave.
+func signedHash(digest [sha256.Size]byte, epoch, counter uint64) [sha256.Size]byte {
+	buf := bytes.NewBuffer(digest[:])
+	if err := binary.Write(buf, binary.LittleEndian, epoch); err != nil {
+		panic(err)
+	}
+	if err := binary.Write(buf, binary.LittleEndian, counter); err != nil {
+		panic(err)
+	}
+
+	return sha256.Sum256(buf.Bytes())
+}
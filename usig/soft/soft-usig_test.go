@@ -0,0 +1,59 @@
+// Copyright (c) 2020 NEC Laboratories Europe GmbH.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package soft
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftUSIG(t *testing.T) {
+	msg := []byte("Test message")
+	wrongMsg := []byte("Another message")
+
+	usig, err := New(nil)
+	require.NoError(t, err)
+
+	// Recreate USIG with the same key pair
+	usig, err = New(usig.key)
+	require.NoError(t, err)
+
+	usigID := usig.ID()
+	parsedEpoch, parsedPubKey, err := ParseID(usigID)
+	assert.NoError(t, err)
+	assert.Equal(t, usig.Epoch(), parsedEpoch)
+	assert.Equal(t, usig.PublicKey(), parsedPubKey)
+
+	ui, err := usig.CreateUI(msg)
+	assert.NoError(t, err, "Error creating UI")
+	assert.Equal(t, uint64(1), ui.Counter, "Got wrong UI counter value")
+
+	ui, err = usig.CreateUI(msg)
+	assert.NoError(t, err, "Error creating UI")
+	assert.Equal(t, uint64(2), ui.Counter, "Got wrong UI counter value")
+
+	err = usig.VerifyUI(msg, ui, usigID)
+	assert.NoError(t, err, "Error verifying UI")
+
+	err = VerifyUI(wrongMsg, ui, usigID)
+	assert.Error(t, err, "No error verifying UI with forged message")
+
+	other, err := New(usig.key)
+	require.NoError(t, err)
+	err = VerifyUI(msg, ui, other.ID())
+	assert.Error(t, err, "No error verifying UI with another epoch")
+}